@@ -40,14 +40,17 @@ type aggregatorBehavior struct {
 	cell      cells.Cell
 	aggregate Aggregator
 	value     interface{}
+	options   *options
 }
 
 // NewAggregatorBehavior creates a behavior aggregating the received events
 // and emits events with the new aggregate. A "reset!" topic resets the
-// aggregate to nil again.
-func NewAggregatorBehavior(aggregator Aggregator) cells.Behavior {
+// aggregate to nil again. The emitted topic and the payload key can be
+// changed by options.
+func NewAggregatorBehavior(aggregator Aggregator, opts ...Option) cells.Behavior {
 	return &aggregatorBehavior{
 		aggregate: aggregator,
+		options:   newOptions(opts...),
 	}
 }
 
@@ -73,9 +76,9 @@ func (b *aggregatorBehavior) ProcessEvent(event cells.Event) error {
 			return err
 		}
 		b.value = value
-		b.cell.EmitNew(event.Context(), TopicAggregator, cells.PayloadValues{
+		b.cell.EmitNew(event.Context(), b.options.topic(TopicAggregator), b.options.payload(cells.PayloadValues{
 			PayloadAggregatorValue: b.value,
-		})
+		}))
 	}
 	return nil
 }
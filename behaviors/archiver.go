@@ -0,0 +1,289 @@
+// Tideland Go Cells - Behaviors - Archiver
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicArchived signals that a batch of events has been
+	// written as object.
+	TopicArchived = "archived"
+
+	// PayloadArchivedKey contains the key of the written object.
+	PayloadArchivedKey = "archived:key"
+
+	// PayloadArchivedEvents contains the number of archived events.
+	PayloadArchivedEvents = "archived:events"
+
+	// topicArchiverRotate is emitted by the behavior to itself
+	// when the maximum age of a batch is reached.
+	topicArchiverRotate = "archiver:rotate!"
+
+	// payloadArchiverBatch identifies the batch to rotate.
+	payloadArchiverBatch = "archiver:batch"
+)
+
+//--------------------
+// OBJECT STORE
+//--------------------
+
+// ObjectStore is the small interface to an object storage like
+// S3, GCS, or minio needed by the archiver behavior.
+type ObjectStore interface {
+	// PutObject writes the content with the given key.
+	PutObject(ctx context.Context, key string, content []byte) error
+}
+
+// directoryObjectStore implements the ObjectStore interface
+// using a local directory.
+type directoryObjectStore struct {
+	dir string
+}
+
+// NewDirectoryObjectStore creates an object store writing the
+// objects as files into the passed directory. Slashes in the
+// keys create sub-directories.
+func NewDirectoryObjectStore(dir string) ObjectStore {
+	return &directoryObjectStore{
+		dir: dir,
+	}
+}
+
+// PutObject implements the ObjectStore interface.
+func (s *directoryObjectStore) PutObject(ctx context.Context, key string, content []byte) error {
+	filename := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0644)
+}
+
+//--------------------
+// CODEC
+//--------------------
+
+// Codec encodes the events of the archiver behavior.
+type Codec interface {
+	// Encode returns the encoded event as one record.
+	Encode(event cells.Event) ([]byte, error)
+
+	// Extension returns the file extension of the encoded
+	// records without the compression.
+	Extension() string
+}
+
+// jsonLinesCodec implements the Codec interface.
+type jsonLinesCodec struct{}
+
+// NewJSONLinesCodec creates a codec encoding each event as one
+// line of JSON containing the timestamp, the topic, and the payload.
+func NewJSONLinesCodec() Codec {
+	return jsonLinesCodec{}
+}
+
+// Encode implements the Codec interface.
+func (c jsonLinesCodec) Encode(event cells.Event) ([]byte, error) {
+	pvs := map[string]interface{}{}
+	event.Payload().Do(func(key string, value interface{}) error {
+		pvs[key] = value
+		return nil
+	})
+	record, err := json.Marshal(struct {
+		Timestamp time.Time              `json:"timestamp"`
+		Topic     string                 `json:"topic"`
+		Payload   map[string]interface{} `json:"payload"`
+	}{event.Timestamp(), event.Topic(), pvs})
+	if err != nil {
+		return nil, err
+	}
+	return append(record, '\n'), nil
+}
+
+// Extension implements the Codec interface.
+func (c jsonLinesCodec) Extension() string {
+	return "jsonl"
+}
+
+//--------------------
+// ARCHIVER BEHAVIOR
+//--------------------
+
+// RotationPolicy defines when a batch of events is written as
+// object. The first reached limit rotates the batch, zero values
+// are ignored.
+type RotationPolicy struct {
+	MaxEvents int
+	MaxBytes  int
+	MaxAge    time.Duration
+}
+
+// archiverBehavior implements the archiver behavior.
+type archiverBehavior struct {
+	cell    cells.Cell
+	bucket  ObjectStore
+	rotate  RotationPolicy
+	codec   Codec
+	batch   int
+	count   int
+	records bytes.Buffer
+	timer   *time.Timer
+}
+
+// NewArchiverBehavior creates a behavior collecting the received
+// events encoded by the codec in batches. Based on the rotation policy
+// those batches are compressed with gzip and written to the object
+// store. After each write an event with the topic "archived" and
+// the object key is emitted. A "flush!" or the flush command writes
+// the current batch immediately.
+func NewArchiverBehavior(bucket ObjectStore, rotate RotationPolicy, codec Codec) cells.Behavior {
+	if codec == nil {
+		codec = NewJSONLinesCodec()
+	}
+	return &archiverBehavior{
+		bucket: bucket,
+		rotate: rotate,
+		codec:  codec,
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *archiverBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *archiverBehavior) Terminate() error {
+	return b.write(context.Background())
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *archiverBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case topicArchiverRotate:
+		if event.Payload().GetInt(payloadArchiverBatch, 0) == b.batch {
+			return b.write(event.Context())
+		}
+	case cells.TopicFlush:
+		return b.Flush(event.Context())
+	default:
+		record, err := b.codec.Encode(event)
+		if err != nil {
+			return err
+		}
+		if b.count == 0 {
+			b.arm()
+		}
+		b.records.Write(record)
+		b.count++
+		if (b.rotate.MaxEvents > 0 && b.count >= b.rotate.MaxEvents) ||
+			(b.rotate.MaxBytes > 0 && b.records.Len() >= b.rotate.MaxBytes) {
+			return b.write(event.Context())
+		}
+	}
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *archiverBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// Flush implements the cells.BehaviorFlusher interface.
+func (b *archiverBehavior) Flush(ctx context.Context) error {
+	return b.write(ctx)
+}
+
+// arm starts the timer rotating the current batch by age.
+func (b *archiverBehavior) arm() {
+	if b.rotate.MaxAge <= 0 {
+		return
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	batch := b.batch
+	b.timer = time.AfterFunc(b.rotate.MaxAge, func() {
+		b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicArchiverRotate, cells.PayloadValues{
+			payloadArchiverBatch: batch,
+		})
+	})
+}
+
+// write compresses the current batch and puts it into the
+// object store. If it fails the batch is kept and rotated
+// by age again.
+func (b *archiverBehavior) write(ctx context.Context) error {
+	if b.count == 0 {
+		return nil
+	}
+	key, err := b.put(ctx)
+	if err != nil {
+		b.arm()
+		return err
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	count := b.count
+	b.batch++
+	b.count = 0
+	b.records.Reset()
+	b.cell.EmitNew(ctx, TopicArchived, cells.PayloadValues{
+		PayloadArchivedKey:    key,
+		PayloadArchivedEvents: count,
+	})
+	return nil
+}
+
+// put compresses the current batch and puts it into the object
+// store with a new key.
+func (b *archiverBehavior) put(ctx context.Context) (string, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(b.records.Bytes()); err != nil {
+		return "", errors.Annotate(err, ErrCannotArchive, errorMessages, b.cell.ID())
+	}
+	if err := zw.Close(); err != nil {
+		return "", errors.Annotate(err, ErrCannotArchive, errorMessages, b.cell.ID())
+	}
+	key := fmt.Sprintf("%s/%s-%06d.%s.gz",
+		b.cell.ID(),
+		time.Now().UTC().Format("20060102T150405.000000000"),
+		b.batch,
+		b.codec.Extension())
+	if err := b.bucket.PutObject(ctx, key, compressed.Bytes()); err != nil {
+		return "", errors.Annotate(err, ErrCannotArchive, errorMessages, b.cell.ID())
+	}
+	return key, nil
+}
+
+// EOF
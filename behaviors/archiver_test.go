@@ -0,0 +1,187 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Archiver
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestArchiverBehavior tests the rotation by size and by age.
+func TestArchiverBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("archiver-behavior")
+	defer env.Stop()
+
+	store := newMemoryObjectStore()
+	rotate := behaviors.RotationPolicy{
+		MaxEvents: 3,
+		MaxAge:    100 * time.Millisecond,
+	}
+
+	env.StartCell("archiver", behaviors.NewArchiverBehavior(store, rotate, behaviors.NewJSONLinesCodec()))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("archiver", "collector")
+
+	for i := 0; i < 7; i++ {
+		env.EmitNew(ctx, "archiver", "archive", i)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 3)
+	counts := []int{}
+	accessor.Do(func(index int, event cells.Event) error {
+		key := event.Payload().GetString(behaviors.PayloadArchivedKey, "")
+		count := event.Payload().GetInt(behaviors.PayloadArchivedEvents, 0)
+		assert.True(strings.HasPrefix(key, "archiver/"))
+		assert.True(strings.HasSuffix(key, ".jsonl.gz"))
+		assert.Equal(store.lines(assert, key), count)
+		counts = append(counts, count)
+		return nil
+	})
+	assert.Equal(counts, []int{3, 3, 1})
+}
+
+// TestArchiverBehaviorFlush tests writing a batch by command.
+func TestArchiverBehaviorFlush(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("archiver-behavior-flush")
+	defer env.Stop()
+
+	store := newMemoryObjectStore()
+	rotate := behaviors.RotationPolicy{
+		MaxEvents: 100,
+	}
+
+	env.StartCell("archiver", behaviors.NewArchiverBehavior(store, rotate, nil))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("archiver", "collector")
+
+	for i := 0; i < 2; i++ {
+		env.EmitNew(ctx, "archiver", "archive", i)
+	}
+	reply, err := cells.SendCommand(ctx, env, "archiver", cells.CommandFlush, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(reply.GetString(cells.PayloadCommand, ""), cells.CommandFlush)
+	err = env.Barrier(ctx, "archiver", "collector")
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 1)
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	assert.Equal(last.Payload().GetInt(behaviors.PayloadArchivedEvents, 0), 2)
+}
+
+// TestArchiverBehaviorPutError tests the rotation by age after
+// a failing write.
+func TestArchiverBehaviorPutError(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("archiver-behavior-put-error")
+	defer env.Stop()
+
+	store := newMemoryObjectStore()
+	store.failures = 1
+	rotate := behaviors.RotationPolicy{
+		MaxAge: 50 * time.Millisecond,
+	}
+
+	env.StartCell("archiver", behaviors.NewArchiverBehavior(store, rotate, nil), cells.OnError(cells.ContinueAndCount))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("archiver", "collector")
+
+	for i := 0; i < 2; i++ {
+		env.EmitNew(ctx, "archiver", "archive", i)
+	}
+
+	var accessor cells.EventSinkAccessor
+	for i := 0; i < 100; i++ {
+		var err error
+		accessor, err = behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		if accessor.Len() > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Length(accessor, 1)
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	assert.Equal(last.Payload().GetInt(behaviors.PayloadArchivedEvents, 0), 2)
+	store.mutex.Lock()
+	assert.Equal(store.failures, 0)
+	store.mutex.Unlock()
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// memoryObjectStore keeps the objects in memory. The
+// first puts fail as often as set in failures.
+type memoryObjectStore struct {
+	mutex    sync.Mutex
+	objects  map[string][]byte
+	failures int
+}
+
+func newMemoryObjectStore() *memoryObjectStore {
+	return &memoryObjectStore{
+		objects: make(map[string][]byte),
+	}
+}
+
+func (s *memoryObjectStore) PutObject(ctx context.Context, key string, content []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("put failed")
+	}
+	s.objects[key] = content
+	return nil
+}
+
+func (s *memoryObjectStore) lines(assert audit.Assertion, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	zr, err := gzip.NewReader(bytes.NewReader(s.objects[key]))
+	assert.Nil(err)
+	content, err := ioutil.ReadAll(zr)
+	assert.Nil(err)
+	return strings.Count(string(content), "\n")
+}
+
+// EOF
@@ -0,0 +1,253 @@
+// Tideland Go Cells - Behaviors - Autoscaler
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// topicAutoscalerCheck lets the autoscaler check its pool.
+	topicAutoscalerCheck = "autoscaler:check!"
+
+	// defaultCooldown is the default minimum duration between
+	// two adjustments of a pool.
+	defaultCooldown = 5 * time.Second
+)
+
+//--------------------
+// AUTOSCALER BEHAVIOR
+//--------------------
+
+// WorkerFactory creates the behavior of a new worker cell.
+type WorkerFactory func() (cells.Behavior, error)
+
+// QueueDepth is the number of queued events per worker cell.
+type QueueDepth int
+
+// autoscalerBehavior distributes events over a dynamic pool
+// of worker cells.
+type autoscalerBehavior struct {
+	cell     cells.Cell
+	template WorkerFactory
+	min      int
+	max      int
+	target   QueueDepth
+	workers  []string
+	draining []string
+	strategy Strategy
+	next     int
+	adjusted time.Time
+	stopc    chan struct{}
+	options  *options
+}
+
+// NewAutoscalerBehavior creates a behavior distributing the received
+// events over a pool of worker cells created by the template. The pool
+// starts with min workers. If the average queue depth of the workers
+// exceeds the target a new one is started, up to max workers. If the
+// workers are idle the pool shrinks down to min workers again. Workers
+// to stop don't receive new events and are stopped once their queues
+// are empty. Workers are subscribed to the subscribers of the autoscaler
+// at their start, so the pool acts like one cell. The status command
+// returns the IDs of the running workers, see also
+// RequestAutoscalerWorkers(). The minimum duration between
+// two adjustments can be set with WithCooldown(), default are 5 seconds.
+// Workers are not stopped together with the autoscaler.
+func NewAutoscalerBehavior(template WorkerFactory, min, max int, target QueueDepth, opts ...Option) cells.Behavior {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if target < 1 {
+		target = 1
+	}
+	o := newOptions(opts...)
+	if o.cooldown == 0 {
+		o.cooldown = defaultCooldown
+	}
+	return &autoscalerBehavior{
+		template: template,
+		min:      min,
+		max:      max,
+		target:   target,
+		strategy: LeastQueueStrategy(),
+		stopc:    make(chan struct{}),
+		options:  o,
+	}
+}
+
+// Init the behavior.
+func (b *autoscalerBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	go b.checkLoop()
+	return nil
+}
+
+// Terminate the behavior.
+func (b *autoscalerBehavior) Terminate() error {
+	close(b.stopc)
+	return nil
+}
+
+// ProcessEvent distributes the event and adjusts the pool.
+func (b *autoscalerBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case topicAutoscalerCheck:
+		return b.adjust()
+	case cells.TopicStatus:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving status from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		payload.GetWaiter().Set(append([]string{}, b.workers...))
+	default:
+		if err := b.adjust(); err != nil {
+			return err
+		}
+		env := b.cell.Environment()
+		target, err := b.strategy(env, b.workers, event)
+		if err != nil {
+			return err
+		}
+		return env.Emit(target, event)
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *autoscalerBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// adjust starts or stops workers depending on their queue depths
+// and stops drained workers.
+func (b *autoscalerBehavior) adjust() error {
+	env := b.cell.Environment()
+	// Stop drained workers.
+	remaining := b.draining[:0]
+	for _, id := range b.draining {
+		depth, err := env.QueueDepth(id)
+		if err == nil && depth > 0 {
+			remaining = append(remaining, id)
+			continue
+		}
+		if err := env.StopCell(id); err != nil && !cells.IsInvalidIDError(err) {
+			logger.Errorf("autoscaler %q cannot stop worker %q: %v", b.cell.ID(), id, err)
+		}
+	}
+	b.draining = remaining
+	// Ensure the minimum.
+	for len(b.workers) < b.min {
+		if err := b.startWorker(); err != nil {
+			return err
+		}
+	}
+	now := b.options.now()
+	if now.Sub(b.adjusted) < b.options.cooldown {
+		return nil
+	}
+	total := 0
+	for _, id := range b.workers {
+		depth, err := env.QueueDepth(id)
+		if err != nil {
+			return err
+		}
+		total += depth
+	}
+	average := QueueDepth(total / len(b.workers))
+	switch {
+	case average > b.target && len(b.workers) < b.max:
+		b.adjusted = now
+		return b.startWorker()
+	case total == 0 && len(b.workers) > b.min:
+		b.adjusted = now
+		last := len(b.workers) - 1
+		logger.Infof("autoscaler %q drains worker %q", b.cell.ID(), b.workers[last])
+		b.draining = append(b.draining, b.workers[last])
+		b.workers = b.workers[:last]
+	}
+	return nil
+}
+
+// startWorker starts a new worker and subscribes it to the
+// subscribers of the autoscaler.
+func (b *autoscalerBehavior) startWorker() error {
+	env := b.cell.Environment()
+	behavior, err := b.template()
+	if err != nil {
+		return err
+	}
+	b.next++
+	id := fmt.Sprintf("%s:worker-%d", b.cell.ID(), b.next)
+	if err := env.StartCell(id, behavior); err != nil {
+		return err
+	}
+	subscribers, err := env.Subscribers(b.cell.ID())
+	if err != nil {
+		return err
+	}
+	if len(subscribers) > 0 {
+		if err := env.Subscribe(id, subscribers...); err != nil {
+			return err
+		}
+	}
+	logger.Infof("autoscaler %q started worker %q", b.cell.ID(), id)
+	b.workers = append(b.workers, id)
+	return nil
+}
+
+// checkLoop lets the autoscaler check its pool regularly, also
+// when no events are received.
+func (b *autoscalerBehavior) checkLoop() {
+	for {
+		err := b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicAutoscalerCheck, nil)
+		if err != nil {
+			return
+		}
+		select {
+		case <-b.stopc:
+			return
+		case <-time.After(b.options.cooldown):
+		}
+	}
+}
+
+// RequestAutoscalerWorkers retrieves the IDs of the running workers
+// of an autoscaler.
+func RequestAutoscalerWorkers(ctx context.Context, env cells.Environment, id string, timeout time.Duration) ([]string, error) {
+	payload, err := cells.SendCommand(ctx, env, id, cells.CommandStatus, nil, timeout)
+	if err != nil {
+		return nil, err
+	}
+	workers, ok := payload.GetDefault(nil).([]string)
+	if !ok {
+		return nil, errors.New(ErrInvalidPayload, errorMessages, cells.PayloadDefault)
+	}
+	return workers, nil
+}
+
+// EOF
@@ -0,0 +1,70 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Autoscaler
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestAutoscalerBehavior tests the scaling of a worker pool.
+func TestAutoscalerBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("autoscaler-behavior")
+	defer env.Stop()
+
+	template := func() (cells.Behavior, error) {
+		return behaviors.NewSimpleProcessorBehavior(func(c cells.Cell, event cells.Event) error {
+			time.Sleep(5 * time.Millisecond)
+			return c.Emit(event)
+		}), nil
+	}
+	env.StartCell("autoscaler", behaviors.NewAutoscalerBehavior(template, 1, 4, 2, behaviors.WithCooldown(10*time.Millisecond)))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(1000))
+	env.Subscribe("autoscaler", "collector")
+
+	for i := 0; i < 100; i++ {
+		env.EmitNew(context.Background(), "autoscaler", "work", i)
+	}
+	workers, err := behaviors.RequestAutoscalerWorkers(context.Background(), env, "autoscaler", time.Second)
+	assert.Nil(err)
+	assert.True(len(workers) > 1)
+	assert.True(len(workers) <= 4)
+
+	// All events are processed and the pool shrinks again.
+	collected := 0
+	for i := 0; i < 500 && collected < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		collected = accessor.Len()
+	}
+	assert.Equal(collected, 100)
+	for i := 0; i < 500 && len(workers) > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+		workers, err = behaviors.RequestAutoscalerWorkers(context.Background(), env, "autoscaler", time.Second)
+		assert.Nil(err)
+	}
+	assert.Equal(workers, []string{"autoscaler:worker-1"})
+}
+
+// EOF
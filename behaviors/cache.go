@@ -0,0 +1,270 @@
+// Tideland Go Cells - Behaviors - Cache
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicCacheGet requests the latest cached event of the key
+	// passed with PayloadCacheKey.
+	TopicCacheGet = "cache-get?"
+
+	// TopicCacheKeys requests the sorted keys of all cached events.
+	TopicCacheKeys = "cache-keys?"
+
+	// TopicCacheInvalidate removes the cached event of the key
+	// passed with PayloadCacheKey, or all if no key is passed.
+	TopicCacheInvalidate = "cache-invalidate!"
+
+	// PayloadCacheKey contains the key of a request or invalidation.
+	PayloadCacheKey = "cache:key"
+
+	// PayloadCacheHit signals if the requested key has been found.
+	PayloadCacheHit = "cache:hit"
+
+	// PayloadCacheTopic contains the topic of the cached event.
+	PayloadCacheTopic = "cache:topic"
+
+	// PayloadCachePayload contains the payload of the cached event.
+	PayloadCachePayload = "cache:payload"
+
+	// PayloadCacheStored contains the time the event has been cached.
+	PayloadCacheStored = "cache:stored"
+)
+
+//--------------------
+// CACHE BEHAVIOR
+//--------------------
+
+// CacheKeyFunc returns the key of the entity an event describes.
+// Events with an empty key are not cached.
+type CacheKeyFunc func(event cells.Event) string
+
+// cachedEvent is the latest event of one key.
+type cachedEvent struct {
+	key    string
+	event  cells.Event
+	stored time.Time
+}
+
+// cacheBehavior stores the latest event per key.
+type cacheBehavior struct {
+	cell       cells.Cell
+	key        CacheKeyFunc
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+	options    *options
+}
+
+// NewCacheBehavior creates a behavior storing the latest event per key
+// returned by the key function. So it serves as a materialized view of
+// the most recent state per entity. Entries expire after the ttl, if
+// the number of entries exceeds maxEntries the oldest ones are evicted.
+// A ttl or maxEntries of zero means no limit. Cached events can be
+// requested with "cache-get?" and the key, the keys with "cache-keys?".
+// "cache-invalidate!" removes the entry of a key or all, as does
+// "reset!". The helpers RequestCached() and RequestCacheKeys() do the
+// requests. The clock can be changed by option.
+func NewCacheBehavior(key CacheKeyFunc, ttl time.Duration, maxEntries int, opts ...Option) cells.Behavior {
+	return &cacheBehavior{
+		key:        key,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		options:    newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *cacheBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *cacheBehavior) Terminate() error {
+	b.clear()
+	return nil
+}
+
+// ProcessEvent caches the event or answers the requests.
+func (b *cacheBehavior) ProcessEvent(event cells.Event) error {
+	b.expire()
+	switch event.Topic() {
+	case TopicCacheGet:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving cached event from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		payload.GetWaiter().Set(b.get(payload.GetString(PayloadCacheKey, "")))
+	case TopicCacheKeys:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving cached keys from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		payload.GetWaiter().Set(b.keys())
+	case TopicCacheInvalidate:
+		key := event.Payload().GetString(PayloadCacheKey, "")
+		if key == "" {
+			b.clear()
+			return nil
+		}
+		if element, ok := b.entries[key]; ok {
+			b.remove(element)
+		}
+	case cells.TopicReset:
+		b.clear()
+	default:
+		if key := b.key(event); key != "" {
+			b.store(key, event)
+		}
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *cacheBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// store sets the event as latest one of the key and evicts the
+// oldest entries if needed.
+func (b *cacheBehavior) store(key string, event cells.Event) {
+	now := b.options.now()
+	if element, ok := b.entries[key]; ok {
+		entry := element.Value.(*cachedEvent)
+		entry.event = event
+		entry.stored = now
+		b.order.MoveToBack(element)
+		return
+	}
+	b.entries[key] = b.order.PushBack(&cachedEvent{key, event, now})
+	for b.maxEntries > 0 && b.order.Len() > b.maxEntries {
+		b.remove(b.order.Front())
+	}
+}
+
+// get returns the reply to a request of a key.
+func (b *cacheBehavior) get(key string) cells.PayloadValues {
+	element, ok := b.entries[key]
+	if !ok {
+		return cells.PayloadValues{
+			PayloadCacheKey: key,
+			PayloadCacheHit: false,
+		}
+	}
+	entry := element.Value.(*cachedEvent)
+	return cells.PayloadValues{
+		PayloadCacheKey:     key,
+		PayloadCacheHit:     true,
+		PayloadCacheTopic:   entry.event.Topic(),
+		PayloadCachePayload: entry.event.Payload(),
+		PayloadCacheStored:  entry.stored,
+	}
+}
+
+// keys returns the sorted keys of the cached events.
+func (b *cacheBehavior) keys() []string {
+	keys := make([]string, 0, len(b.entries))
+	for key := range b.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expire removes the entries older than the ttl. The order list
+// is sorted by the storing time, so it stops at the first valid one.
+func (b *cacheBehavior) expire() {
+	if b.ttl <= 0 {
+		return
+	}
+	limit := b.options.now().Add(-b.ttl)
+	for element := b.order.Front(); element != nil; element = b.order.Front() {
+		if element.Value.(*cachedEvent).stored.After(limit) {
+			return
+		}
+		b.remove(element)
+	}
+}
+
+// remove removes one entry.
+func (b *cacheBehavior) remove(element *list.Element) {
+	entry := b.order.Remove(element).(*cachedEvent)
+	delete(b.entries, entry.key)
+}
+
+// clear removes all entries.
+func (b *cacheBehavior) clear() {
+	b.entries = make(map[string]*list.Element)
+	b.order.Init()
+}
+
+// RequestCached retrieves the payload of the latest event cached for
+// the key. If the key is unknown or expired false is returned.
+func RequestCached(ctx context.Context, env cells.Environment, id, key string, timeout time.Duration) (cells.Payload, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payloadIn, waiter := cells.NewWaiterPayload()
+	request := payloadIn.Apply(cells.PayloadValues{
+		PayloadCacheKey: key,
+	})
+	if err := env.EmitNew(ctx, id, TopicCacheGet, request); err != nil {
+		return nil, false, err
+	}
+	reply, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if !reply.GetBool(PayloadCacheHit, false) {
+		return nil, false, nil
+	}
+	payload, ok := reply.Get(PayloadCachePayload, nil).(cells.Payload)
+	if !ok {
+		return nil, false, errors.New(ErrInvalidPayload, errorMessages, PayloadCachePayload)
+	}
+	return payload, true, nil
+}
+
+// RequestCacheKeys retrieves the sorted keys of the cached events.
+func RequestCacheKeys(ctx context.Context, env cells.Environment, id string, timeout time.Duration) ([]string, error) {
+	payload, err := env.Request(ctx, id, TopicCacheKeys, timeout)
+	if err != nil {
+		return nil, err
+	}
+	keys, ok := payload.GetDefault(nil).([]string)
+	if !ok {
+		return nil, errors.New(ErrInvalidPayload, errorMessages, cells.PayloadDefault)
+	}
+	return keys, nil
+}
+
+// EOF
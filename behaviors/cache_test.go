@@ -0,0 +1,107 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Cache
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestCacheBehavior tests the caching of the latest event per key.
+func TestCacheBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("cache-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	key := func(event cells.Event) string {
+		return event.Payload().GetString("id", "")
+	}
+	emit := func(id string, state int) {
+		env.EmitNew(ctx, "cache", "state", cells.PayloadValues{
+			"id":    id,
+			"state": state,
+		})
+	}
+
+	env.StartCell("cache", behaviors.NewCacheBehavior(key, time.Minute, 3, behaviors.WithClock(clock)))
+
+	// Only the latest event per key is cached.
+	emit("a", 1)
+	emit("b", 1)
+	emit("a", 2)
+	env.EmitNew(ctx, "cache", "state", nil)
+	keys, err := behaviors.RequestCacheKeys(ctx, env, "cache", time.Second)
+	assert.Nil(err)
+	assert.Equal(keys, []string{"a", "b"})
+	payload, ok, err := behaviors.RequestCached(ctx, env, "cache", "a", time.Second)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(payload.GetInt("state", 0), 2)
+	_, ok, err = behaviors.RequestCached(ctx, env, "cache", "x", time.Second)
+	assert.Nil(err)
+	assert.False(ok)
+
+	// The oldest entries are evicted.
+	advance(10 * time.Second)
+	emit("c", 1)
+	emit("d", 1)
+	keys, err = behaviors.RequestCacheKeys(ctx, env, "cache", time.Second)
+	assert.Nil(err)
+	assert.Equal(keys, []string{"a", "c", "d"})
+
+	// Entries expire.
+	advance(55 * time.Second)
+	keys, err = behaviors.RequestCacheKeys(ctx, env, "cache", time.Second)
+	assert.Nil(err)
+	assert.Equal(keys, []string{"c", "d"})
+	_, ok, err = behaviors.RequestCached(ctx, env, "cache", "a", time.Second)
+	assert.Nil(err)
+	assert.False(ok)
+
+	// Invalidation of single keys and all.
+	env.EmitNew(ctx, "cache", behaviors.TopicCacheInvalidate, cells.PayloadValues{
+		behaviors.PayloadCacheKey: "c",
+	})
+	keys, err = behaviors.RequestCacheKeys(ctx, env, "cache", time.Second)
+	assert.Nil(err)
+	assert.Equal(keys, []string{"d"})
+	env.EmitNew(ctx, "cache", behaviors.TopicCacheInvalidate, nil)
+	keys, err = behaviors.RequestCacheKeys(ctx, env, "cache", time.Second)
+	assert.Nil(err)
+	assert.Empty(keys)
+}
+
+// EOF
@@ -0,0 +1,188 @@
+// Tideland Go Cells - Behaviors - Cardinality
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"time"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicCardinality labels an event containing the estimated
+	// number of distinct keys of a window.
+	TopicCardinality = "cardinality"
+
+	// PayloadCardinalityEstimate contains the estimated number of
+	// distinct keys.
+	PayloadCardinalityEstimate = "cardinality:estimate"
+
+	// PayloadCardinalityFrom contains the start time of the window.
+	PayloadCardinalityFrom = "cardinality:from"
+
+	// PayloadCardinalityTo contains the end time of the window.
+	PayloadCardinalityTo = "cardinality:to"
+
+	// hllPrecision is the number of hash bits used for the register
+	// index, resulting in 2^14 registers and an error of about 0.8%.
+	hllPrecision = 14
+)
+
+//--------------------
+// HYPERLOGLOG
+//--------------------
+
+// hyperLogLog estimates the number of distinct keys in constant memory.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// newHyperLogLog creates an empty estimator.
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{
+		registers: make([]uint8, 1<<hllPrecision),
+	}
+}
+
+// add adds a key.
+func (h *hyperLogLog) add(key string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	x := mix64(hasher.Sum64())
+	index := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// estimate returns the estimated number of distinct keys.
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(e + 0.5)
+}
+
+// reset clears the estimator.
+func (h *hyperLogLog) reset() {
+	for i := range h.registers {
+		h.registers[i] = 0
+	}
+}
+
+// mix64 spreads the bits of a hash value.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+//--------------------
+// CARDINALITY BEHAVIOR
+//--------------------
+
+// CardinalityKeyFunc returns the key of an event whose distinct
+// values are counted. Events with an empty key are ignored.
+type CardinalityKeyFunc func(event cells.Event) string
+
+// cardinalityBehavior estimates the number of distinct keys.
+type cardinalityBehavior struct {
+	cell    cells.Cell
+	key     CardinalityKeyFunc
+	hll     *hyperLogLog
+	from    time.Time
+	options *options
+}
+
+// NewCardinalityBehavior creates a behavior estimating the number of
+// distinct keys of the received events with HyperLogLog. So it needs
+// about 16 KB memory independent of the number of keys, the estimate
+// has an error of about 0.8%. Each received tick event, e.g. by a
+// subscription to a ticker, ends a window. The estimate of it is emitted
+// and the next window starts. The clock, the emitted topic, and the
+// payload keys can be changed by options.
+func NewCardinalityBehavior(key CardinalityKeyFunc, opts ...Option) cells.Behavior {
+	return &cardinalityBehavior{
+		key:     key,
+		hll:     newHyperLogLog(),
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *cardinalityBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.from = b.options.now()
+	return nil
+}
+
+// Terminate the behavior.
+func (b *cardinalityBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent adds the key of the event or emits the estimate.
+func (b *cardinalityBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case TopicTicker:
+		to := b.options.now()
+		estimate := b.hll.estimate()
+		from := b.from
+		b.hll.reset()
+		b.from = to
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicCardinality), b.options.payload(cells.PayloadValues{
+			PayloadCardinalityEstimate: estimate,
+			PayloadCardinalityFrom:     from,
+			PayloadCardinalityTo:       to,
+		}))
+	case cells.TopicReset:
+		b.hll.reset()
+		b.from = b.options.now()
+	default:
+		if key := b.key(event); key != "" {
+			b.hll.add(key)
+		}
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *cardinalityBehavior) Recover(err interface{}) error {
+	b.hll.reset()
+	b.from = b.options.now()
+	return nil
+}
+
+// EOF
@@ -0,0 +1,73 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Cardinality
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestCardinalityBehavior tests the estimation of distinct keys.
+func TestCardinalityBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("cardinality-behavior")
+	defer env.Stop()
+
+	key := func(event cells.Event) string {
+		return event.Payload().GetString("user", "")
+	}
+	env.StartCell("cardinality", behaviors.NewCardinalityBehavior(key))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("cardinality", "collector")
+
+	for _, n := range []int{10, 10000} {
+		for i := 0; i < 2*n; i++ {
+			env.EmitNew(ctx, "cardinality", "login", cells.PayloadValues{
+				"user": fmt.Sprintf("user-%d", i%n),
+			})
+		}
+		env.EmitNew(ctx, "cardinality", "login", nil)
+		env.EmitNew(ctx, "cardinality", behaviors.TopicTicker, nil)
+	}
+	env.EmitNew(ctx, "cardinality", behaviors.TopicTicker, nil)
+	err := env.Barrier(ctx)
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 3)
+	estimates := []int64{}
+	accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Topic(), behaviors.TopicCardinality)
+		estimate, ok := event.Payload().Get(behaviors.PayloadCardinalityEstimate, nil).(int64)
+		assert.True(ok)
+		estimates = append(estimates, estimate)
+		return nil
+	})
+	assert.Equal(estimates[0], int64(10))
+	assert.Range(estimates[1], int64(9700), int64(10300))
+	assert.Equal(estimates[2], int64(0))
+}
+
+// EOF
@@ -0,0 +1,214 @@
+// Tideland Go Cells - Behaviors - Change Data Capture
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicCDCInsert labels an inserted key.
+	TopicCDCInsert = "cdc-insert"
+
+	// TopicCDCUpdate labels an updated key.
+	TopicCDCUpdate = "cdc-update"
+
+	// TopicCDCDelete labels a deleted key.
+	TopicCDCDelete = "cdc-delete"
+
+	// PayloadCDCKey contains the key of a change.
+	PayloadCDCKey = "cdc:key"
+
+	// PayloadCDCValue contains the new value of an inserted or
+	// updated key, the old one of a deleted key if known.
+	PayloadCDCValue = "cdc:value"
+
+	// PayloadCDCToken contains the resume token of the poll
+	// returning the change.
+	PayloadCDCToken = "cdc:token"
+
+	// topicCDCChanges lets the poll loop pass the polled
+	// changes to the cell.
+	topicCDCChanges = "cdc:changes!"
+
+	// stateCDCToken is the key of the resume token in
+	// the state of the cell.
+	stateCDCToken = "cdc:token"
+)
+
+//--------------------
+// CHANGES
+//--------------------
+
+// ChangeOp describes the kind of a change.
+type ChangeOp int
+
+// Kinds of changes.
+const (
+	ChangeInsert ChangeOp = iota + 1
+	ChangeUpdate
+	ChangeDelete
+)
+
+// Change describes the change of one key in an external system.
+type Change struct {
+	Op    ChangeOp
+	Key   string
+	Value interface{}
+}
+
+// CDCPoller returns the changes since the resume token together with
+// the token to resume from afterwards. The token is empty for the
+// first poll.
+type CDCPoller func(ctx context.Context, since string) ([]Change, string, error)
+
+// cdcBatch contains the changes of one poll.
+type cdcBatch struct {
+	changes []Change
+	token   string
+}
+
+//--------------------
+// CDC BEHAVIOR
+//--------------------
+
+// cdcBehavior converts changes of an external system into events.
+type cdcBehavior struct {
+	cell     cells.Cell
+	poll     CDCPoller
+	interval time.Duration
+	options  *options
+	token    string
+	ctx      context.Context
+	cancel   func()
+}
+
+// NewCDCBehavior creates a change data capture source polling an
+// external system like a database table or an API in the interval.
+// Each returned change is emitted with the topic "cdc-insert",
+// "cdc-update", or "cdc-delete" and the key, the value, and the
+// resume token as payload. After the changes of a poll are emitted the
+// token is stored in the state of the cell, so a restarted cell with
+// the same ID resumes there. Changes may be emitted again after a
+// crash, never lost. Failed polls are logged and retried in the next
+// interval. The emitted topics and payload keys can be changed by
+// options.
+func NewCDCBehavior(poll CDCPoller, interval time.Duration, opts ...Option) cells.Behavior {
+	return &cdcBehavior{
+		poll:     poll,
+		interval: interval,
+		options:  newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *cdcBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	token, _, err := c.State().Get(stateCDCToken)
+	if err != nil {
+		return errors.Annotate(err, ErrKVStore, errorMessages, c.ID())
+	}
+	b.token = string(token)
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.pollLoop(b.token)
+	return nil
+}
+
+// Terminate the behavior. A running poll is canceled.
+func (b *cdcBehavior) Terminate() error {
+	b.cancel()
+	return nil
+}
+
+// ProcessEvent emits the polled changes and stores the token.
+func (b *cdcBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicCDCChanges {
+		return nil
+	}
+	batch, ok := event.Payload().GetDefault(nil).(*cdcBatch)
+	if !ok {
+		return nil
+	}
+	for _, change := range batch.changes {
+		var topic string
+		switch change.Op {
+		case ChangeInsert:
+			topic = TopicCDCInsert
+		case ChangeUpdate:
+			topic = TopicCDCUpdate
+		case ChangeDelete:
+			topic = TopicCDCDelete
+		default:
+			logger.Warningf("cdc source %q skips change of %q with invalid operation %d", b.cell.ID(), change.Key, change.Op)
+			continue
+		}
+		err := b.cell.EmitNew(event.Context(), b.options.topic(topic), b.options.payload(cells.PayloadValues{
+			PayloadCDCKey:   change.Key,
+			PayloadCDCValue: change.Value,
+			PayloadCDCToken: batch.token,
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	if batch.token == b.token {
+		return nil
+	}
+	if err := b.cell.State().Put(stateCDCToken, []byte(batch.token)); err != nil {
+		return errors.Annotate(err, ErrKVStore, errorMessages, b.cell.ID())
+	}
+	b.token = batch.token
+	return nil
+}
+
+// Recover from an error.
+func (b *cdcBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// pollLoop polls the changes until the behavior terminates. It
+// continues with the returned tokens while the cell stores them
+// after emitting the changes.
+func (b *cdcBehavior) pollLoop(token string) {
+	for {
+		changes, next, err := b.poll(b.ctx, token)
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warningf("cdc source %q cannot poll changes since %q: %v", b.cell.ID(), token, err)
+		} else if len(changes) > 0 || next != token {
+			err = b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicCDCChanges, &cdcBatch{changes, next})
+			if err != nil {
+				return
+			}
+			token = next
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(b.interval):
+		}
+	}
+}
+
+// EOF
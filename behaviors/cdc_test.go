@@ -0,0 +1,116 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Change Data Capture
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestCDCBehavior tests emitting changes and resuming after a restart.
+func TestCDCBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("cdc-behavior")
+	defer env.Stop()
+
+	source := &changeSource{
+		changes: []behaviors.Change{
+			{Op: behaviors.ChangeInsert, Key: "a", Value: 1},
+			{Op: behaviors.ChangeInsert, Key: "b", Value: 2},
+			{Op: behaviors.ChangeUpdate, Key: "a", Value: 3},
+			{Op: behaviors.ChangeDelete, Key: "b", Value: nil},
+		},
+	}
+	collect := func(n int) []string {
+		var changes []string
+		for i := 0; i < 100 && len(changes) < n; i++ {
+			time.Sleep(10 * time.Millisecond)
+			accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+			assert.Nil(err)
+			changes = nil
+			accessor.Do(func(index int, event cells.Event) error {
+				changes = append(changes, event.Topic()+":"+event.Payload().GetString(behaviors.PayloadCDCKey, ""))
+				return nil
+			})
+		}
+		return changes
+	}
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.StartCell("cdc", behaviors.NewCDCBehavior(source.poll, 10*time.Millisecond))
+	env.Subscribe("cdc", "collector")
+
+	assert.Equal(collect(4), []string{"cdc-insert:a", "cdc-insert:b", "cdc-update:a", "cdc-delete:b"})
+	assert.Nil(env.Barrier(context.Background(), "cdc", "collector"))
+	assert.Nil(env.StopCell("cdc"))
+
+	// Restart resumes with the stored token.
+	restarted := len(source.sinces())
+	source.add(behaviors.Change{Op: behaviors.ChangeInsert, Key: "c", Value: 4})
+	env.StartCell("cdc", behaviors.NewCDCBehavior(source.poll, 10*time.Millisecond))
+	env.Subscribe("cdc", "collector")
+
+	assert.Equal(collect(5), []string{"cdc-insert:a", "cdc-insert:b", "cdc-update:a", "cdc-delete:b", "cdc-insert:c"})
+	sinces := source.sinces()
+	assert.Equal(sinces[0], "")
+	assert.Equal(sinces[restarted], "4")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// changeSource returns up to two changes per poll, the
+// token is the index of the next change.
+type changeSource struct {
+	mutex   sync.Mutex
+	changes []behaviors.Change
+	since   []string
+}
+
+func (s *changeSource) add(change behaviors.Change) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.changes = append(s.changes, change)
+}
+
+func (s *changeSource) poll(ctx context.Context, since string) ([]behaviors.Change, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.since = append(s.since, since)
+	from, _ := strconv.Atoi(since)
+	to := from + 2
+	if to > len(s.changes) {
+		to = len(s.changes)
+	}
+	return s.changes[from:to], strconv.Itoa(to), nil
+}
+
+func (s *changeSource) sinces() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.since...)
+}
+
+// EOF
@@ -0,0 +1,191 @@
+// Tideland Go Cells - Behaviors - Channel
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicChannelClosed signals that the channel of a
+	// source has been closed.
+	TopicChannelClosed = "channel-closed"
+
+	// topicChannelValue lets the source loop pass a
+	// received value to the cell.
+	topicChannelValue = "channel:value!"
+
+	// topicChannelClosed lets the source loop signal the
+	// closing of the channel to the cell.
+	topicChannelClosed = "channel:closed!"
+)
+
+//--------------------
+// CHANNEL SOURCE BEHAVIOR
+//--------------------
+
+// channelValue wraps a received value, so it is not mixed
+// with payload values.
+type channelValue[T any] struct {
+	value T
+}
+
+// channelSourceBehavior emits the values received from a channel.
+type channelSourceBehavior[T any] struct {
+	cell    cells.Cell
+	ch      <-chan T
+	convert func(value T) (string, interface{})
+	options *options
+	ctx     context.Context
+	cancel  func()
+}
+
+// NewChannelSourceBehavior creates a behavior receiving the values of
+// the channel and emitting them as events. The topic and the payload
+// are returned by the convert function, an empty topic skips the
+// value. Values are received only as fast as the cell processes them,
+// so slow subscribers slow down the sending goroutines. When the
+// channel is closed an event with the topic "channel-closed" is
+// emitted. Its topic can be changed by options.
+func NewChannelSourceBehavior[T any](ch <-chan T, convert func(value T) (topic string, payload interface{}), opts ...Option) cells.Behavior {
+	return &channelSourceBehavior[T]{
+		ch:      ch,
+		convert: convert,
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *channelSourceBehavior[T]) Init(c cells.Cell) error {
+	b.cell = c
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.receiveLoop()
+	return nil
+}
+
+// Terminate the behavior.
+func (b *channelSourceBehavior[T]) Terminate() error {
+	b.cancel()
+	return nil
+}
+
+// ProcessEvent converts and emits the received values.
+func (b *channelSourceBehavior[T]) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case topicChannelValue:
+		cv, ok := event.Payload().GetDefault(nil).(*channelValue[T])
+		if !ok {
+			return nil
+		}
+		topic, payload := b.convert(cv.value)
+		if topic == "" {
+			return nil
+		}
+		return b.cell.EmitNew(event.Context(), topic, payload)
+	case topicChannelClosed:
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicChannelClosed), nil)
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *channelSourceBehavior[T]) Recover(err interface{}) error {
+	return nil
+}
+
+// receiveLoop passes the values of the channel to the cell
+// until the channel is closed or the behavior terminates.
+func (b *channelSourceBehavior[T]) receiveLoop() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case value, ok := <-b.ch:
+			topic := topicChannelValue
+			var payload interface{} = &channelValue[T]{value}
+			if !ok {
+				topic = topicChannelClosed
+				payload = nil
+			}
+			err := b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topic, payload)
+			if err != nil || !ok {
+				return
+			}
+		}
+	}
+}
+
+//--------------------
+// CHANNEL SINK BEHAVIOR
+//--------------------
+
+// channelSinkBehavior sends the received events to a channel.
+type channelSinkBehavior[T any] struct {
+	cell    cells.Cell
+	ch      chan<- T
+	convert func(event cells.Event) (T, bool)
+}
+
+// NewChannelSinkBehavior creates a behavior converting the received
+// events with the passed function and sending the values to the
+// channel. Events the function does not accept are skipped. Sending
+// waits until the value is received or the context of the event is
+// done, e.g. when the environment stops. So slow receivers slow down
+// the cell. The channel is not closed when the cell terminates, as
+// it is owned by the caller.
+func NewChannelSinkBehavior[T any](ch chan<- T, convert func(event cells.Event) (T, bool)) cells.Behavior {
+	return &channelSinkBehavior[T]{
+		ch:      ch,
+		convert: convert,
+	}
+}
+
+// Init the behavior.
+func (b *channelSinkBehavior[T]) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *channelSinkBehavior[T]) Terminate() error {
+	return nil
+}
+
+// ProcessEvent converts the event and sends the value.
+func (b *channelSinkBehavior[T]) ProcessEvent(event cells.Event) error {
+	value, ok := b.convert(event)
+	if !ok {
+		return nil
+	}
+	ctx := event.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case b.ch <- value:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *channelSinkBehavior[T]) Recover(err interface{}) error {
+	return nil
+}
+
+// EOF
@@ -0,0 +1,73 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Channel
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestChannelBehaviors tests gluing channels into a topology.
+func TestChannelBehaviors(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("channel-behaviors")
+	defer env.Stop()
+
+	in := make(chan int)
+	out := make(chan string)
+	convertIn := func(value int) (string, interface{}) {
+		if value%2 != 0 {
+			return "", nil
+		}
+		return "even", value
+	}
+	convertOut := func(event cells.Event) (string, bool) {
+		if event.Topic() == behaviors.TopicChannelClosed {
+			return "closed", true
+		}
+		return fmt.Sprintf("%s:%d", event.Topic(), event.Payload().GetInt(cells.PayloadDefault, -1)), true
+	}
+
+	env.StartCell("source", behaviors.NewChannelSourceBehavior(in, convertIn))
+	env.StartCell("sink", behaviors.NewChannelSinkBehavior(out, convertOut))
+	env.Subscribe("source", "sink")
+
+	go func() {
+		for i := 0; i < 6; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	var received []string
+	for len(received) < 4 {
+		select {
+		case value := <-out:
+			received = append(received, value)
+		case <-time.After(time.Second):
+			t.Fatalf("received only %v", received)
+		}
+	}
+	assert.Equal(received, []string{"even:0", "even:2", "even:4", "closed"})
+}
+
+// EOF
@@ -21,24 +21,50 @@ import (
 	"github.com/tideland/gocells/cells"
 )
 
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicCollectorOverflow signals the first eviction of collected
+	// events since the start or the last reset.
+	TopicCollectorOverflow = "collector-overflow"
+
+	// PayloadCollectorEvicted contains the number of evicted events.
+	PayloadCollectorEvicted = "collector:evicted"
+)
+
 //--------------------
 // COLLECTOR BEHAVIOR
 //--------------------
 
 // collectorBehavior collects events for debugging.
 type collectorBehavior struct {
-	cell cells.Cell
-	sink cells.EventSink
+	cell     cells.Cell
+	sink     cells.EventSink
+	arrivals []time.Time
+	evicted  int64
+	options  *options
 }
 
 // NewCollectorBehavior creates a collector behavior. It collects
 // a maximum number of events, each event is passed through. If the
 // maximum number is 0 it collects until the topic "reset!". An
 // access to the collected events can be retrieved with the topic
-// "collected?" and a payload waiter as default payload.
-func NewCollectorBehavior(max int) cells.Behavior {
+// "collected?" and a payload waiter as default payload. The maximum
+// can also be set with WithMaxEvents(), WithMaxAge() additionally
+// evicts events collected longer ago. The first eviction after the
+// start or a reset is emitted with the topic "collector-overflow",
+// so slow consumers can be detected. The number of evicted events
+// is answered to "status?".
+func NewCollectorBehavior(max int, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	if o.maxEvents == 0 {
+		o.maxEvents = max
+	}
 	return &collectorBehavior{
-		sink: cells.NewEventSink(max),
+		sink:    cells.NewEventSink(0),
+		options: o,
 	}
 }
 
@@ -50,7 +76,7 @@ func (b *collectorBehavior) Init(c cells.Cell) error {
 
 // Terminate the behavior.
 func (b *collectorBehavior) Terminate() error {
-	b.sink.Clear()
+	b.clear()
 	return nil
 }
 
@@ -62,12 +88,25 @@ func (b *collectorBehavior) ProcessEvent(event cells.Event) error {
 		if !ok {
 			logger.Warningf("retrieving collected events from '%s' not possible without payload waiter", b.cell.ID())
 		}
+		b.evict(event.Context())
 		accessor := cells.EventSinkAccessor(b.sink)
 		payload.GetWaiter().Set(accessor)
+	case cells.TopicStatus:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving status from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		b.evict(event.Context())
+		payload.GetWaiter().Set(cells.PayloadValues{
+			PayloadCollectorEvicted: b.evicted,
+		})
 	case cells.TopicReset:
-		b.sink.Clear()
+		b.clear()
 	default:
 		b.sink.Push(event)
+		b.arrivals = append(b.arrivals, b.options.now())
+		b.evict(event.Context())
 		b.cell.Emit(event)
 	}
 	return nil
@@ -75,10 +114,51 @@ func (b *collectorBehavior) ProcessEvent(event cells.Event) error {
 
 // Recover from an error.
 func (b *collectorBehavior) Recover(err interface{}) error {
-	b.sink.Clear()
+	b.clear()
 	return nil
 }
 
+// evict drops the oldest events exceeding the maximum number
+// or age and emits the first eviction.
+func (b *collectorBehavior) evict(ctx context.Context) {
+	n := 0
+	if b.options.maxEvents > 0 && len(b.arrivals) > b.options.maxEvents {
+		n = len(b.arrivals) - b.options.maxEvents
+	}
+	if b.options.maxAge > 0 {
+		oldest := b.options.now().Add(-b.options.maxAge)
+		for n < len(b.arrivals) && b.arrivals[n].Before(oldest) {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		b.sink.PullFirst()
+	}
+	b.arrivals = b.arrivals[n:]
+	first := b.evicted == 0
+	b.evicted += int64(n)
+	if !first {
+		return
+	}
+	logger.Warningf("collector '%s' evicts events, consumer may be too slow", b.cell.ID())
+	err := b.cell.EmitNew(ctx, b.options.topic(TopicCollectorOverflow), b.options.payload(cells.PayloadValues{
+		PayloadCollectorEvicted: b.evicted,
+	}))
+	if err != nil {
+		logger.Errorf("collector '%s' cannot emit overflow: %v", b.cell.ID(), err)
+	}
+}
+
+// clear drops the collected events and the eviction counter.
+func (b *collectorBehavior) clear() {
+	b.sink.Clear()
+	b.arrivals = nil
+	b.evicted = 0
+}
+
 //--------------------
 // CONVENIENCE
 //--------------------
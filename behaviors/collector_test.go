@@ -13,6 +13,7 @@ package behaviors_test
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -50,4 +51,89 @@ func TestCollectorBehavior(t *testing.T) {
 	assert.Empty(accessor)
 }
 
+// TestCollectorBehaviorEviction tests the eviction of collected events.
+func TestCollectorBehaviorEviction(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("collector-behavior-eviction")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	evicted := func() interface{} {
+		payload, err := env.Request(ctx, "collector", cells.TopicStatus, time.Second)
+		assert.Nil(err)
+		return payload.Get(behaviors.PayloadCollectorEvicted, nil)
+	}
+	overflows := func() int {
+		accessor, err := behaviors.RequestCollectedAccessor(env, "overflows", time.Second)
+		assert.Nil(err)
+		n := 0
+		accessor.Do(func(index int, event cells.Event) error {
+			if event.Topic() == behaviors.TopicCollectorOverflow {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(0,
+		behaviors.WithMaxEvents(5),
+		behaviors.WithMaxAge(time.Minute),
+		behaviors.WithClock(clock),
+	))
+	env.StartCell("overflows", behaviors.NewCollectorBehavior(0))
+	env.Subscribe("collector", "overflows")
+
+	// Nothing evicted below the limits.
+	for i := 0; i < 5; i++ {
+		env.EmitNew(ctx, "collector", "collect", i)
+	}
+	assert.Equal(evicted(), int64(0))
+	assert.Equal(overflows(), 0)
+
+	// Exceeding the maximum number evicts the oldest events.
+	for i := 5; i < 8; i++ {
+		env.EmitNew(ctx, "collector", "collect", i)
+	}
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 5)
+	first, ok := accessor.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Payload().GetInt(cells.PayloadDefault, -1), 3)
+	assert.Equal(evicted(), int64(3))
+	assert.Equal(overflows(), 1)
+
+	// Aged events are evicted, the overflow is emitted only once.
+	advance(30 * time.Second)
+	env.EmitNew(ctx, "collector", "collect", 8)
+	advance(31 * time.Second)
+	accessor, err = behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 1)
+	assert.Equal(evicted(), int64(8))
+	assert.Equal(overflows(), 1)
+
+	// Reset arms the overflow again.
+	env.EmitNew(ctx, "collector", cells.TopicReset, nil)
+	assert.Equal(evicted(), int64(0))
+	for i := 0; i < 6; i++ {
+		env.EmitNew(ctx, "collector", "collect", i)
+	}
+	assert.Equal(evicted(), int64(1))
+	assert.Equal(overflows(), 2)
+}
+
 // EOF
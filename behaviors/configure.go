@@ -0,0 +1,96 @@
+// Tideland Go Cells - Behaviors - Configuration
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// PayloadConfigCount contains a new count, e.g. of the
+	// rate window behavior.
+	PayloadConfigCount = "config:count"
+
+	// PayloadConfigDuration contains a new duration, e.g. of
+	// the ticker behavior.
+	PayloadConfigDuration = "config:duration"
+
+	// PayloadConfigSize contains a new window size, e.g. of the
+	// moving statistics behavior.
+	PayloadConfigSize = "config:size"
+
+	// PayloadConfigRules contains new rules of the threshold
+	// behavior.
+	PayloadConfigRules = "config:rules"
+
+	// PayloadConfigFilter contains a new filter function of the
+	// filter behavior.
+	PayloadConfigFilter = "config:filter"
+)
+
+//--------------------
+// CONFIGURATION HELPERS
+//--------------------
+
+// configInt returns the positive integer of the key in the config
+// or the current value if it is not set.
+func configInt(c cells.Cell, config cells.Payload, key string, current int) (int, error) {
+	if config.Get(key, nil) == nil {
+		return current, nil
+	}
+	value := config.GetInt(key, 0)
+	if value < 1 {
+		return 0, invalidConfig(c, "%q has to be a positive integer", key)
+	}
+	return value, nil
+}
+
+// configDuration returns the positive duration of the key in the
+// config or the current value if it is not set.
+func configDuration(c cells.Cell, config cells.Payload, key string, current time.Duration) (time.Duration, error) {
+	if config.Get(key, nil) == nil {
+		return current, nil
+	}
+	value := config.GetDuration(key, 0)
+	if value <= 0 {
+		return 0, invalidConfig(c, "%q has to be a positive duration", key)
+	}
+	return value, nil
+}
+
+// invalidConfig returns the error for an invalid configuration
+// of the behavior running in the cell.
+func invalidConfig(c cells.Cell, format string, args ...interface{}) error {
+	return errors.New(ErrInvalidConfiguration, errorMessages, c.ID(), fmt.Sprintf(format, args...))
+}
+
+// resizeWindow returns a window with the new span and maximum
+// length containing the newest samples of the passed one.
+func resizeWindow(w *window.Window, span time.Duration, maxLen int) *window.Window {
+	resized := window.New(span, maxLen)
+	w.Do(func(s window.Sample) {
+		resized.Push(s.Time, s.Value)
+	})
+	return resized
+}
+
+// EOF
@@ -0,0 +1,94 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Configuration
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestConfigureBehaviors tests reconfiguring running behaviors.
+func TestConfigureBehaviors(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("configure-behaviors")
+	defer env.Stop()
+
+	extract := func(event cells.Event) (float64, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0), nil
+	}
+	small := func(event cells.Event) (bool, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0) < 10, nil
+	}
+
+	env.StartCell("filter", behaviors.NewFilterBehavior(small))
+	env.StartCell("stats", behaviors.NewMovingStatsBehavior(extract, 2))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(0))
+	env.Subscribe("filter", "stats")
+	env.Subscribe("stats", "collector")
+
+	lastCount := func() int {
+		err := env.Barrier(ctx, "filter", "stats", "collector")
+		assert.Nil(err)
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		last, ok := accessor.PeekLast()
+		assert.True(ok)
+		return last.Payload().GetInt(behaviors.PayloadMovingStatsCount, 0)
+	}
+
+	for _, value := range []float64{1, 2, 3, 50} {
+		env.EmitNew(ctx, "filter", "value", value)
+	}
+	assert.Equal(lastCount(), 2)
+
+	// Invalid configurations are replied and keep the cell running.
+	_, err := cells.SendCommand(ctx, env, "stats", cells.CommandConfigure, cells.PayloadValues{
+		behaviors.PayloadConfigSize: 0,
+	}, time.Second)
+	assert.ErrorMatch(err, ".*invalid configuration.*")
+
+	// Configure as command and as event.
+	reply, err := cells.SendCommand(ctx, env, "stats", cells.CommandConfigure, cells.PayloadValues{
+		behaviors.PayloadConfigSize: 4,
+	}, time.Second)
+	assert.Nil(err)
+	assert.Equal(reply.GetString(cells.PayloadCommand, ""), cells.CommandConfigure)
+	large := func(event cells.Event) (bool, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0) >= 10, nil
+	}
+	env.EmitNew(ctx, "filter", cells.TopicConfigure, cells.PayloadValues{
+		behaviors.PayloadConfigFilter: behaviors.Filter(large),
+	})
+
+	for _, value := range []float64{4, 20, 30, 40, 60} {
+		env.EmitNew(ctx, "filter", "value", value)
+	}
+	assert.Equal(lastCount(), 4)
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	assert.Equal(last.Payload().GetFloat64(behaviors.PayloadMovingStatsAverage, 0), 37.5)
+}
+
+// EOF
@@ -28,6 +28,10 @@ import (
 // Counters is a set of named counters and their values.
 type Counters map[string]int64
 
+// TopicCounter is the prefix of the topics of emitted counters. It is
+// followed by a colon and the ID of the counter.
+const TopicCounter = "counter"
+
 // CounterFunc is the signature of a function which analyzis
 // an event and returns, which counters shall be incremented.
 type CounterFunc func(id string, event cells.Event) []string
@@ -37,15 +41,17 @@ type counterBehavior struct {
 	cell        cells.Cell
 	counterFunc CounterFunc
 	counters    Counters
+	options     *options
 }
 
 // NewCounterBehavior creates a counter behavior based on the passed
 // function. It increments and emits those counters named by the result
 // of the counter function. The counters can be retrieved with the
 // event "counters?" and a payload waiter as payload. It can be reset
-// with "reset!".
-func NewCounterBehavior(cf CounterFunc) cells.Behavior {
-	return &counterBehavior{nil, cf, make(Counters)}
+// with "reset!". The prefix of the emitted topics can be changed by
+// the option WithEmitTopic(TopicCounter, "my-prefix").
+func NewCounterBehavior(cf CounterFunc, opts ...Option) cells.Behavior {
+	return &counterBehavior{nil, cf, make(Counters), newOptions(opts...)}
 }
 
 // Init the behavior.
@@ -82,7 +88,7 @@ func (b *counterBehavior) ProcessEvent(event cells.Event) error {
 				} else {
 					b.counters[cid] = 1
 				}
-				topic := "counter:" + cid
+				topic := b.options.topic(TopicCounter) + ":" + cid
 				b.cell.EmitNew(event.Context(), topic, b.counters[cid])
 			}
 		}
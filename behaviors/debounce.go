@@ -0,0 +1,186 @@
+// Tideland Go Cells - Behaviors - Debounce
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// topicDebounceQuiet is emitted by the behavior to itself
+	// when the quiet period of a key may be over.
+	topicDebounceQuiet = "debounce:quiet!"
+
+	// payloadDebounceKey contains the key of the quiet period.
+	payloadDebounceKey = "debounce:key"
+
+	// payloadDebounceGeneration identifies the latest event
+	// of the key when the quiet period started.
+	payloadDebounceGeneration = "debounce:generation"
+)
+
+//--------------------
+// DEBOUNCE BEHAVIOR
+//--------------------
+
+// DebounceKeyFunc returns the key used to group events for the
+// debouncing.
+type DebounceKeyFunc func(event cells.Event) string
+
+// debounceBurst contains the state of a burst of events
+// for one key.
+type debounceBurst struct {
+	event      cells.Event
+	generation int
+	timer      *time.Timer
+}
+
+// debounceBehavior implements the debounce behavior.
+type debounceBehavior struct {
+	cell    cells.Cell
+	quiet   time.Duration
+	keyFunc DebounceKeyFunc
+	leading bool
+	bursts  map[string]*debounceBurst
+}
+
+// NewDebounceBehavior creates a behavior holding bursts of events
+// with the same key returned by the key function. Only the last
+// event of a burst is emitted after no event with the same key
+// has been received for the quiet duration. Flushing emits the
+// last events of all bursts at once.
+func NewDebounceBehavior(quiet time.Duration, keyFunc DebounceKeyFunc) cells.Behavior {
+	return &debounceBehavior{
+		quiet:   quiet,
+		keyFunc: keyFunc,
+		bursts:  make(map[string]*debounceBurst),
+	}
+}
+
+// NewLeadingDebounceBehavior creates a behavior like the debounce
+// behavior, but it emits the first event of a burst immediately and
+// drops all following ones until the quiet duration is over.
+func NewLeadingDebounceBehavior(quiet time.Duration, keyFunc DebounceKeyFunc) cells.Behavior {
+	return &debounceBehavior{
+		quiet:   quiet,
+		keyFunc: keyFunc,
+		leading: true,
+		bursts:  make(map[string]*debounceBurst),
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *debounceBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *debounceBehavior) Terminate() error {
+	b.reset()
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *debounceBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case topicDebounceQuiet:
+		key := event.Payload().GetString(payloadDebounceKey, "")
+		generation := event.Payload().GetInt(payloadDebounceGeneration, 0)
+		burst, ok := b.bursts[key]
+		if !ok || burst.generation != generation {
+			// Outdated quiet event.
+			return nil
+		}
+		delete(b.bursts, key)
+		if !b.leading {
+			return b.cell.Emit(burst.event)
+		}
+	case cells.TopicReset:
+		b.reset()
+	default:
+		key := b.keyFunc(event)
+		burst, ok := b.bursts[key]
+		if !ok {
+			// Store the burst only after a successful leading
+			// emit, so each stored burst has a timer.
+			if b.leading {
+				if err := b.cell.Emit(event); err != nil {
+					return err
+				}
+			}
+			burst = &debounceBurst{}
+			b.bursts[key] = burst
+		} else {
+			burst.timer.Stop()
+		}
+		burst.event = event
+		burst.generation++
+		burst.timer = b.remind(key, burst.generation)
+	}
+	return nil
+}
+
+// Flush implements the cells.BehaviorFlusher interface. The
+// held events are emitted sorted by their keys.
+func (b *debounceBehavior) Flush(ctx context.Context) error {
+	bursts := b.bursts
+	b.reset()
+	if b.leading {
+		return nil
+	}
+	keys := make([]string, 0, len(bursts))
+	for key := range bursts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := b.cell.Emit(bursts[key].event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *debounceBehavior) Recover(err interface{}) error {
+	b.reset()
+	return nil
+}
+
+// remind starts the timer for the end of the quiet period.
+func (b *debounceBehavior) remind(key string, generation int) *time.Timer {
+	return time.AfterFunc(b.quiet, func() {
+		b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicDebounceQuiet, cells.PayloadValues{
+			payloadDebounceKey:        key,
+			payloadDebounceGeneration: generation,
+		})
+	})
+}
+
+// reset drops all held bursts.
+func (b *debounceBehavior) reset() {
+	for _, burst := range b.bursts {
+		burst.timer.Stop()
+	}
+	b.bursts = make(map[string]*debounceBurst)
+}
+
+// EOF
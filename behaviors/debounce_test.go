@@ -0,0 +1,149 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Debounce
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestDebounceBehavior tests the emitting of the last event of bursts.
+func TestDebounceBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("debounce-behavior")
+	defer env.Stop()
+
+	env.StartCell("debouncer", behaviors.NewDebounceBehavior(50*time.Millisecond, topicKey))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("debouncer", "collector")
+
+	emitBursts(env, "debouncer")
+	time.Sleep(200 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 2)
+	accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Payload().GetDefault(0), 4)
+		return nil
+	})
+}
+
+// TestDebounceBehaviorFlush tests emitting the held events when flushing.
+func TestDebounceBehaviorFlush(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("debounce-behavior-flush")
+	defer env.Stop()
+
+	env.StartCell("debouncer", behaviors.NewDebounceBehavior(time.Minute, topicKey))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("debouncer", "collector")
+
+	emitBursts(env, "debouncer")
+	_, err := env.Request(context.Background(), "debouncer", cells.TopicFlush, time.Second)
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	topics := []string{}
+	accessor.Do(func(index int, event cells.Event) error {
+		topics = append(topics, event.Topic())
+		assert.Equal(event.Payload().GetDefault(0), 4)
+		return nil
+	})
+	assert.Equal(topics, []string{"a", "b"})
+}
+
+// TestLeadingDebounceBehavior tests the emitting of the first event of bursts.
+func TestLeadingDebounceBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("leading-debounce-behavior")
+	defer env.Stop()
+
+	env.StartCell("debouncer", behaviors.NewLeadingDebounceBehavior(50*time.Millisecond, topicKey))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("debouncer", "collector")
+
+	emitBursts(env, "debouncer")
+	time.Sleep(200 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 2)
+	accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Payload().GetDefault(-1), 0)
+		return nil
+	})
+}
+
+// TestLeadingDebounceBehaviorEmitError tests a failing emit of
+// the first event of a burst.
+func TestLeadingDebounceBehaviorEmitError(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("leading-debounce-behavior-emit-error")
+	defer env.Stop()
+
+	failer := func(c cells.Cell, event cells.Event) error {
+		return errors.New("failed")
+	}
+	env.StartCell("debouncer", behaviors.NewLeadingDebounceBehavior(time.Minute, topicKey), cells.OnError(cells.ContinueAndCount))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.StartCell("failer", behaviors.NewSimpleProcessorBehavior(failer), cells.Inline())
+	env.Subscribe("debouncer", "collector", "failer")
+
+	// Failed emits start no burst, so each event is emitted again.
+	for i := 0; i < 3; i++ {
+		env.EmitNew(ctx, "debouncer", "a", i)
+	}
+	_, err := env.Request(ctx, "debouncer", cells.TopicFlush, time.Second)
+	assert.Nil(err)
+	env.EmitNew(ctx, "debouncer", cells.TopicReset, nil)
+	assert.Nil(env.Barrier(ctx, "debouncer", "collector"))
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 3)
+	assert.Nil(env.StopCell("debouncer"))
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// topicKey uses the topic as debounce key.
+func topicKey(event cells.Event) string {
+	return event.Topic()
+}
+
+// emitBursts emits two interleaved bursts of events.
+func emitBursts(env cells.Environment, id string) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		env.EmitNew(ctx, id, "a", i)
+		env.EmitNew(ctx, id, "b", i)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// EOF
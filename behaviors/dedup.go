@@ -0,0 +1,328 @@
+// Tideland Go Cells - Behaviors - Deduplication
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// dedupCompactionMinimum is the number of obsolete lines
+	// in the file of a dedup store before it is compacted.
+	dedupCompactionMinimum = 1024
+)
+
+//--------------------
+// DEDUP STORE
+//--------------------
+
+// DedupStore has to be implemented by the storage of the keys already
+// seen by deduplicating behaviors or idempotent sinks. Keys expire
+// after their TTL. Durable implementations keep them across restarts,
+// so at-least-once inputs like message brokers can be de-duplicated
+// reliably. Implementations have to be safe for concurrent use.
+type DedupStore interface {
+	// Seen checks if the key has been marked and is not yet expired
+	// at the passed time. Otherwise it is marked until now plus the
+	// TTL. Checking and marking is atomic.
+	Seen(key string, now time.Time, ttl time.Duration) (bool, error)
+
+	// Forget removes the mark of a key, e.g. if processing the
+	// event failed and a redelivery shall pass.
+	Forget(key string) error
+
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// memoryDedupStore implements the DedupStore interface in memory.
+type memoryDedupStore struct {
+	mutex   sync.Mutex
+	expires map[string]time.Time
+	checks  int
+}
+
+// NewMemoryDedupStore creates a dedup store only keeping the keys
+// in memory. It is not durable, so duplicates after a restart
+// are not detected.
+func NewMemoryDedupStore() DedupStore {
+	return &memoryDedupStore{
+		expires: make(map[string]time.Time),
+	}
+}
+
+// Seen implements the DedupStore interface.
+func (s *memoryDedupStore) Seen(key string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.checks++
+	if s.checks%dedupCompactionMinimum == 0 {
+		for k, expires := range s.expires {
+			if !now.Before(expires) {
+				delete(s.expires, k)
+			}
+		}
+	}
+	if expires, ok := s.expires[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+	s.expires[key] = now.Add(ttl)
+	return false, nil
+}
+
+// Forget implements the DedupStore interface.
+func (s *memoryDedupStore) Forget(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.expires, key)
+	return nil
+}
+
+// Close implements the DedupStore interface.
+func (s *memoryDedupStore) Close() error {
+	return nil
+}
+
+// fileDedupStore implements the DedupStore interface with an
+// append-only file.
+type fileDedupStore struct {
+	memoryDedupStore
+	filename string
+	file     *os.File
+	lines    int
+}
+
+// NewFileDedupStore creates a durable dedup store. The keys are kept
+// in memory and each change is appended to the passed file, which is
+// read again when the store is created after a restart. The file is
+// compacted when it contains more expired than valid keys.
+func NewFileDedupStore(filename string) (DedupStore, error) {
+	s := &fileDedupStore{
+		memoryDedupStore: memoryDedupStore{
+			expires: make(map[string]time.Time),
+		},
+		filename: filename,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Seen implements the DedupStore interface.
+func (s *fileDedupStore) Seen(key string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if expires, ok := s.expires[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+	expires := now.Add(ttl)
+	if err := s.append(key, expires); err != nil {
+		return false, err
+	}
+	s.expires[key] = expires
+	if s.lines > 2*len(s.expires)+dedupCompactionMinimum {
+		if err := s.compact(now); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Forget implements the DedupStore interface.
+func (s *fileDedupStore) Forget(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.expires[key]; !ok {
+		return nil
+	}
+	if err := s.append(key, time.Time{}); err != nil {
+		return err
+	}
+	delete(s.expires, key)
+	return nil
+}
+
+// Close implements the DedupStore interface.
+func (s *fileDedupStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// load reads the keys of the file. The last line of a key wins,
+// a zero expiration removes it.
+func (s *fileDedupStore) load() error {
+	f, err := os.Open(s.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		key, err := strconv.Unquote(parts[1])
+		if err != nil {
+			continue
+		}
+		if nanos == 0 {
+			delete(s.expires, key)
+			continue
+		}
+		s.expires[key] = time.Unix(0, nanos)
+	}
+	return scanner.Err()
+}
+
+// append writes the expiration of a key to the file.
+func (s *fileDedupStore) append(key string, expires time.Time) error {
+	var nanos int64
+	if !expires.IsZero() {
+		nanos = expires.UnixNano()
+	}
+	if _, err := fmt.Fprintf(s.file, "%d\t%s\n", nanos, strconv.Quote(key)); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// compact removes the expired keys and rewrites the file
+// with the valid ones.
+func (s *fileDedupStore) compact(now time.Time) error {
+	for key, expires := range s.expires {
+		if !now.Before(expires) {
+			delete(s.expires, key)
+		}
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	tmpname := s.filename + ".tmp"
+	tmp, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	s.file = tmp
+	s.lines = 0
+	for key, expires := range s.expires {
+		if err := s.append(key, expires); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpname, s.filename); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.filename, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+//--------------------
+// DEDUP BEHAVIOR
+//--------------------
+
+// DedupKeyFunc returns the key identifying duplicate events,
+// e.g. a message ID of a broker.
+type DedupKeyFunc func(event cells.Event) string
+
+// dedupBehavior emits only the first event per key.
+type dedupBehavior struct {
+	cell    cells.Cell
+	store   DedupStore
+	key     DedupKeyFunc
+	ttl     time.Duration
+	options *options
+}
+
+// NewDedupBehavior creates a behavior emitting only the first of the
+// received events with the same key during the TTL. The keys are kept
+// in the passed store, a durable one detects duplicates after restarts
+// too. Events with an empty key are always emitted. The clock can be
+// changed with WithClock().
+func NewDedupBehavior(store DedupStore, key DedupKeyFunc, ttl time.Duration, opts ...Option) cells.Behavior {
+	return &dedupBehavior{
+		store:   store,
+		key:     key,
+		ttl:     ttl,
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *dedupBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *dedupBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent emits the event if its key is not yet seen.
+func (b *dedupBehavior) ProcessEvent(event cells.Event) error {
+	key := b.key(event)
+	if key == "" {
+		return b.cell.Emit(event)
+	}
+	seen, err := b.store.Seen(key, b.options.now(), b.ttl)
+	if err != nil {
+		return errors.Annotate(err, ErrDedupStore, errorMessages, b.cell.ID())
+	}
+	if seen {
+		return nil
+	}
+	if err := b.cell.Emit(event); err != nil {
+		// Let a redelivery pass.
+		b.store.Forget(key)
+		return err
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *dedupBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// EOF
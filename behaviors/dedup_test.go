@@ -0,0 +1,114 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Deduplication
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestDedupStores tests the memory and the file dedup store.
+func TestDedupStores(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	dir, err := ioutil.TempDir("", "dedup")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "keys")
+	now := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	fileStore, err := behaviors.NewFileDedupStore(filename)
+	assert.Nil(err)
+	for _, store := range []behaviors.DedupStore{behaviors.NewMemoryDedupStore(), fileStore} {
+		seen, err := store.Seen("a", now, time.Minute)
+		assert.Nil(err)
+		assert.False(seen)
+		seen, err = store.Seen("a", now.Add(30*time.Second), time.Minute)
+		assert.Nil(err)
+		assert.True(seen)
+		seen, err = store.Seen("a", now.Add(time.Minute), time.Minute)
+		assert.Nil(err)
+		assert.False(seen)
+		seen, err = store.Seen("b\tc", now, time.Hour)
+		assert.Nil(err)
+		assert.False(seen)
+		assert.Nil(store.Forget("a"))
+		seen, err = store.Seen("a", now.Add(time.Minute), time.Minute)
+		assert.Nil(err)
+		assert.False(seen)
+	}
+	assert.Nil(fileStore.Forget("a"))
+	assert.Nil(fileStore.Close())
+
+	// Keys survive a restart. The file store is created with
+	// the real time, so only keys expiring later are kept.
+	now = time.Now()
+	fileStore, err = behaviors.NewFileDedupStore(filename)
+	assert.Nil(err)
+	seen, err := fileStore.Seen("x", now, time.Hour)
+	assert.Nil(err)
+	assert.False(seen)
+	assert.Nil(fileStore.Close())
+	fileStore, err = behaviors.NewFileDedupStore(filename)
+	assert.Nil(err)
+	defer fileStore.Close()
+	seen, err = fileStore.Seen("x", now.Add(time.Minute), time.Hour)
+	assert.Nil(err)
+	assert.True(seen)
+	seen, err = fileStore.Seen("a", now, time.Hour)
+	assert.Nil(err)
+	assert.False(seen)
+}
+
+// TestDedupBehavior tests the emitting of only the first
+// events per key.
+func TestDedupBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("dedup-behavior")
+	defer env.Stop()
+
+	byID := func(event cells.Event) string {
+		return event.Payload().GetString("id", "")
+	}
+	env.StartCell("dedup", behaviors.NewDedupBehavior(behaviors.NewMemoryDedupStore(), byID, time.Minute))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("dedup", "collector")
+
+	for _, id := range []string{"1", "2", "1", "", "3", "2", ""} {
+		env.EmitNew(ctx, "dedup", "message", cells.PayloadValues{"id": id})
+	}
+	assert.Nil(env.Barrier(ctx, "dedup", "collector"))
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	var ids []string
+	accessor.Do(func(index int, event cells.Event) error {
+		ids = append(ids, byID(event))
+		return nil
+	})
+	assert.Equal(ids, []string{"1", "2", "", "3", ""})
+}
+
+// EOF
@@ -0,0 +1,259 @@
+// Tideland Go Cells - Behaviors - Dimensional Counter
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicDimensionalCount labels an event containing the updated
+	// count of a label set.
+	TopicDimensionalCount = "dimensional-count"
+
+	// TopicDimensionalCounts requests the counts of a dimensional
+	// counter, optionally filtered and grouped.
+	TopicDimensionalCounts = "dimensional-counts?"
+
+	// PayloadDimensionLabels contains the label set of a count.
+	PayloadDimensionLabels = "dimension:labels"
+
+	// PayloadDimensionCount contains the count of a label set.
+	PayloadDimensionCount = "dimension:count"
+
+	// PayloadDimensionFilter contains the labels the requested
+	// counts have to match.
+	PayloadDimensionFilter = "dimension:filter"
+
+	// PayloadDimensionGroupBy contains the dimensions the requested
+	// counts are grouped by.
+	PayloadDimensionGroupBy = "dimension:group-by"
+
+	// OverflowDimension is the only label of the label set counting
+	// all events exceeding the maximum cardinality.
+	OverflowDimension = "overflow"
+
+	// defaultMaxCardinality is the default maximum number of label
+	// sets of a dimensional counter.
+	defaultMaxCardinality = 10000
+)
+
+//--------------------
+// DIMENSIONAL COUNTER BEHAVIOR
+//--------------------
+
+// DimensionFunc returns the label set of an event, a nil set
+// signals that the event shall not be counted.
+type DimensionFunc func(event cells.Event) map[string]string
+
+// DimensionalCount is the count of one label set.
+type DimensionalCount struct {
+	Labels map[string]string
+	Count  int64
+}
+
+// dimensionalCounterBehavior counts events by label sets.
+type dimensionalCounterBehavior struct {
+	cell       cells.Cell
+	dimensions DimensionFunc
+	counts     map[string]*DimensionalCount
+	overflowed bool
+	options    *options
+}
+
+// NewDimensionalCounterBehavior creates a counter behavior counting events
+// by the label sets returned by the dimensions function. Each update is
+// emitted with the label set and the new count. The counts can be retrieved
+// with RequestDimensionalCounts(), filtered by labels and grouped by
+// dimensions. To protect against too many label sets, e.g. by labels
+// containing IDs, the number of them is limited to 10,000 or the value
+// set with WithMaxCardinality(). Further label sets are counted in the
+// overflow label set. The counts can be reset with "reset!".
+func NewDimensionalCounterBehavior(dims DimensionFunc, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	if o.maxKeys == 0 {
+		o.maxKeys = defaultMaxCardinality
+	}
+	return &dimensionalCounterBehavior{
+		dimensions: dims,
+		counts:     make(map[string]*DimensionalCount),
+		options:    o,
+	}
+}
+
+// Init the behavior.
+func (b *dimensionalCounterBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *dimensionalCounterBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent counts the event for its label set.
+func (b *dimensionalCounterBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case TopicDimensionalCounts:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving counts from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		filter, _ := payload.Get(PayloadDimensionFilter, nil).(map[string]string)
+		groupBy, _ := payload.Get(PayloadDimensionGroupBy, nil).([]string)
+		payload.GetWaiter().Set(b.query(filter, groupBy))
+	case cells.TopicReset:
+		b.counts = make(map[string]*DimensionalCount)
+		b.overflowed = false
+	default:
+		labels := b.dimensions(event)
+		if labels == nil {
+			return nil
+		}
+		key := labelKey(labels)
+		count, ok := b.counts[key]
+		if !ok {
+			if len(b.counts) >= b.options.maxKeys {
+				if !b.overflowed {
+					logger.Warningf("dimensional counter '%s' exceeds %d label sets", b.cell.ID(), b.options.maxKeys)
+					b.overflowed = true
+				}
+				labels = map[string]string{OverflowDimension: "true"}
+				key = labelKey(labels)
+				count, ok = b.counts[key]
+			}
+			if !ok {
+				count = &DimensionalCount{Labels: copyLabels(labels)}
+				b.counts[key] = count
+			}
+		}
+		count.Count++
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicDimensionalCount), b.options.payload(cells.PayloadValues{
+			PayloadDimensionLabels: copyLabels(count.Labels),
+			PayloadDimensionCount:  count.Count,
+		}))
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *dimensionalCounterBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// query returns the counts matching the filter, grouped by the
+// passed dimensions and sorted by their labels.
+func (b *dimensionalCounterBehavior) query(filter map[string]string, groupBy []string) []DimensionalCount {
+	grouped := make(map[string]*DimensionalCount)
+	for _, count := range b.counts {
+		if !matchLabels(count.Labels, filter) {
+			continue
+		}
+		labels := count.Labels
+		if len(groupBy) > 0 {
+			labels = make(map[string]string)
+			for _, dim := range groupBy {
+				labels[dim] = count.Labels[dim]
+			}
+		}
+		key := labelKey(labels)
+		if gc, ok := grouped[key]; ok {
+			gc.Count += count.Count
+		} else {
+			grouped[key] = &DimensionalCount{Labels: copyLabels(labels), Count: count.Count}
+		}
+	}
+	keys := make([]string, 0, len(grouped))
+	for key := range grouped {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	counts := make([]DimensionalCount, len(keys))
+	for i, key := range keys {
+		counts[i] = *grouped[key]
+	}
+	return counts
+}
+
+// labelKey returns a canonical key for a label set.
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + labels[name]
+	}
+	return strings.Join(parts, ",")
+}
+
+// matchLabels checks if the labels contain all of the filter.
+func matchLabels(labels, filter map[string]string) bool {
+	for name, value := range filter {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// copyLabels returns a copy of a label set.
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return copied
+}
+
+// RequestDimensionalCounts retrieves the counts of a dimensional counter
+// matching all labels of the filter and grouped by the passed dimensions.
+// A nil filter and no grouping return the counts of all label sets.
+func RequestDimensionalCounts(ctx context.Context, env cells.Environment, id string, filter map[string]string, groupBy []string, timeout time.Duration) ([]DimensionalCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payloadIn, waiter := cells.NewWaiterPayload()
+	request := payloadIn.Apply(cells.PayloadValues{
+		PayloadDimensionFilter:  filter,
+		PayloadDimensionGroupBy: groupBy,
+	})
+	if err := env.EmitNew(ctx, id, TopicDimensionalCounts, request); err != nil {
+		return nil, err
+	}
+	payload, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, ok := payload.GetDefault(nil).([]DimensionalCount)
+	if !ok {
+		return nil, errors.New(ErrInvalidPayload, errorMessages, cells.PayloadDefault)
+	}
+	return counts, nil
+}
+
+// EOF
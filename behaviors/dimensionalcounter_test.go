@@ -0,0 +1,104 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Dimensional Counter
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestDimensionalCounterBehavior tests counting by label sets.
+func TestDimensionalCounterBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("dimensional-counter-behavior")
+	defer env.Stop()
+
+	dims := func(event cells.Event) map[string]string {
+		if event.Topic() == "ignore" {
+			return nil
+		}
+		return map[string]string{
+			"method": event.Topic(),
+			"status": event.Payload().GetString(cells.PayloadDefault, ""),
+		}
+	}
+	env.StartCell("counter", behaviors.NewDimensionalCounterBehavior(dims))
+
+	env.EmitNew(ctx, "counter", "GET", "200")
+	env.EmitNew(ctx, "counter", "GET", "200")
+	env.EmitNew(ctx, "counter", "GET", "404")
+	env.EmitNew(ctx, "counter", "POST", "200")
+	env.EmitNew(ctx, "counter", "ignore", "200")
+
+	counts, err := behaviors.RequestDimensionalCounts(ctx, env, "counter", nil, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(counts, []behaviors.DimensionalCount{
+		{Labels: map[string]string{"method": "GET", "status": "200"}, Count: 2},
+		{Labels: map[string]string{"method": "GET", "status": "404"}, Count: 1},
+		{Labels: map[string]string{"method": "POST", "status": "200"}, Count: 1},
+	})
+
+	counts, err = behaviors.RequestDimensionalCounts(ctx, env, "counter", map[string]string{"method": "GET"}, nil, time.Second)
+	assert.Nil(err)
+	assert.Length(counts, 2)
+
+	counts, err = behaviors.RequestDimensionalCounts(ctx, env, "counter", nil, []string{"status"}, time.Second)
+	assert.Nil(err)
+	assert.Equal(counts, []behaviors.DimensionalCount{
+		{Labels: map[string]string{"status": "200"}, Count: 3},
+		{Labels: map[string]string{"status": "404"}, Count: 1},
+	})
+
+	env.EmitNew(ctx, "counter", cells.TopicReset, nil)
+	counts, err = behaviors.RequestDimensionalCounts(ctx, env, "counter", nil, nil, time.Second)
+	assert.Nil(err)
+	assert.Length(counts, 0)
+}
+
+// TestDimensionalCounterBehaviorCardinality tests the protection
+// against too many label sets.
+func TestDimensionalCounterBehaviorCardinality(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("dimensional-counter-behavior-cardinality")
+	defer env.Stop()
+
+	dims := func(event cells.Event) map[string]string {
+		return map[string]string{"id": event.Topic()}
+	}
+	env.StartCell("counter", behaviors.NewDimensionalCounterBehavior(dims, behaviors.WithMaxCardinality(2)))
+
+	for _, topic := range []string{"a", "b", "c", "d", "a"} {
+		env.EmitNew(ctx, "counter", topic, nil)
+	}
+
+	counts, err := behaviors.RequestDimensionalCounts(ctx, env, "counter", nil, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(counts, []behaviors.DimensionalCount{
+		{Labels: map[string]string{"id": "a"}, Count: 2},
+		{Labels: map[string]string{"id": "b"}, Count: 1},
+		{Labels: map[string]string{behaviors.OverflowDimension: "true"}, Count: 2},
+	})
+}
+
+// EOF
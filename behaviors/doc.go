@@ -10,7 +10,25 @@
 // created by calling NewXyzBehavior(). Their configuration
 // is done by constructor arguments. Additionally some of them take
 // functions or implementations of interfaces to control their
-// processing. These behaviors are:
+// processing. Several behaviors also accept options like WithClock(),
+// WithEmitTopic(), and WithPayloadKeys() to intercept the time or to
+// customize the topics and payload keys of their emitted events. Filter,
+// moving statistics, rate, rate window, threshold, and ticker can be
+// reconfigured at runtime with the configure command or topic and the
+// payload keys PayloadConfigXyz. These behaviors are:
+//
+// Archiver
+//
+// The archiver behavior encodes received events in batches. Based on
+// a rotation policy those are compressed and written into an object
+// store like S3, GCS, or minio.
+//
+// Autoscaler
+//
+// The autoscaler behavior distributes received events over a pool of
+// worker cells created by a template. Depending on the queue depths
+// of the workers it starts new ones or stops idle ones within the
+// given minimum and maximum.
 //
 // Broadcaster
 //
@@ -19,17 +37,46 @@
 // to directly rigger multiple handlers instead of emitting an event
 // manually to those handlers.
 //
+// Cache
+//
+// The cache behavior stores the latest event per key returned by a key
+// function. So it is a materialized view of the most recent state per
+// entity. Entries expire after a ttl and the oldest are evicted if a
+// maximum number is reached. Cached events and the keys can be requested,
+// single or all entries can be invalidated.
+//
 // Callback
 //
 // The callback behavior allows you to provide a number of functions
 // which will be called when an event is received. Those functions
 // have the topic and the payload of the event as argument.
 //
+// Cardinality
+//
+// The cardinality behavior estimates the number of distinct keys of the
+// received events with HyperLogLog in constant memory. Each tick event
+// ends a window and lets the behavior emit the estimate.
+//
+// CDC
+//
+// The change data capture behavior polls an external system in an
+// interval and emits its changes as insert, update, and delete events.
+// The resume token of the last poll is stored in the state of the cell,
+// so a restart continues with the next changes.
+//
+// Channel Source and Sink
+//
+// The channel source behavior emits the values received from a Go
+// channel converted into topics and payloads, the channel sink sends
+// the received events converted into values to a channel. So existing
+// goroutine pipelines can be connected with cells.
+//
 // Collector
 //
 // The collector behavior collects all received events. They can be
 // retrieved and resetted. It also emits all received events to its
-// subscribers.
+// subscribers. The number and the age of the collected events can be
+// limited, the first eviction is emitted to detect slow consumers.
 //
 // Configurator
 //
@@ -45,6 +92,44 @@
 // which are incremented then. The counters are emitted each time and
 // also can be resetted.
 //
+// Debounce
+//
+// The debounce behavior holds bursts of events with the same key
+// and emits only the last one after a quiet period. In leading mode
+// the first event of a burst is emitted and the following dropped.
+//
+// Deduplication
+//
+// The dedup behavior emits only the first of the events with the same
+// key during a TTL. The keys are kept in a DedupStore, the file store
+// keeps them across restarts, so at-least-once inputs of brokers can
+// be de-duplicated durably.
+//
+// Dimensional Counter
+//
+// The dimensional counter behavior counts events by the label sets
+// returned by a dimensions function. The counts can be requested
+// filtered by labels and grouped by dimensions. The number of label
+// sets is limited, further ones are counted as overflow.
+//
+// Enricher
+//
+// The enricher behavior augments events with values retrieved by
+// an external lookup. Results are cached with TTLs and a LRU limit,
+// not found ones are cached too.
+//
+// Extractor
+//
+// The extractor behavior applies regular expressions or JSONPaths
+// to payload fields and emits the events with the extracted values
+// flattened into new payload keys.
+//
+// File Watcher Source
+//
+// The file watcher source behavior scans files and directories in an
+// interval and emits created, written, removed, and renamed files. Bursts
+// of writes are emitted once the file is stable, e.g. for ingest folders.
+//
 // Filter
 //
 // The filter behavior is created with a filtering function which is
@@ -56,6 +141,38 @@
 // The FSM behavior implements a finite state machine. State functions
 // process the events and return the following state function.
 //
+// Heartbeat
+//
+// The heartbeat behavior emits heartbeats in an interval and monitors
+// the heartbeats of other cells it receives. If a source misses too many
+// of them a silence-detected event with its last-seen time is emitted.
+//
+// Histogram Evaluator
+//
+// The histogram evaluator behavior keeps the ratings of a rolling period
+// in a high dynamic range histogram. Requests answer with minimum, maximum,
+// mean, arbitrary quantiles, and buckets of the whole or a shorter period.
+//
+// HTTP Poll Source
+//
+// The HTTP poll source behavior requests an URL in an interval and
+// emits an event each time the response changed, parsed by an optional
+// function. With ETag support unchanged responses are detected by the
+// server via If-None-Match and If-Modified-Since.
+//
+// Load Balancer
+//
+// The load balancer behavior emits each event to one cell out of a pool
+// of targets. The strategy selects the target round robin, weighted, by
+// the least queue depth, or sticky by a key of the event.
+//
+// Log Parser
+//
+// The log parser behavior parses received log lines in JSON, logfmt, or
+// the Common and Combined Log Format of web servers. They are emitted
+// normalized with level, message, timestamp, and further fields. Together
+// with a reader source it builds log pipelines.
+//
 // Logger
 //
 // The logger behavior logs every event. The used level is INFO.
@@ -65,6 +182,53 @@
 // The mapper behavior is created with a mapping. It is called with each
 // received event and returns a new mapped one.
 //
+// Moving Statistics
+//
+// The moving statistics behavior maintains average, variance, minimum,
+// maximum, and rate of change over a window of the last extracted
+// values. They are emitted with each event or on changes beyond a delta.
+// Like the rate window it handles late events by the policy set with
+// WithLatePolicy(): dropping them, emitting them separately, or
+// inserting them and computing the window again.
+//
+// Notifier
+//
+// The notifier behavior renders subject and message templates with the
+// topic and the payload of received events and passes them to a notify
+// function. Identical messages are deduplicated and the number of
+// notifications is rate limited. Sinks for Slack webhooks, SMTP, and
+// PagerDuty are provided.
+//
+// Outbox
+//
+// The outbox behavior implements the transactional outbox pattern.
+// Received events are appended to a store and published in the
+// background with at-least-once semantics.
+//
+// Pair
+//
+// The pair behavior checks if two events matching a criterion occur
+// within a given duration. The keyed pair behavior does the same for
+// many concurrent open pairs, e.g. one per transaction ID.
+//
+// Persistent Counter
+//
+// The persistent counter behavior works like the counter behavior but
+// periodically stores its counters in a key-value store and restores
+// them when it is started again, e.g. for daily totals.
+//
+// Poll
+//
+// The poll behavior periodically sends a request to a set of cells,
+// gathers their answers until a timeout, and emits them as one report.
+// So periodic status or capacity reports can be built.
+//
+// Probe
+//
+// The probe behavior sends a probe along a path of cells in an interval
+// as synthetic monitoring. It passes their queues without being processed
+// by the behaviors, the latencies per hop and the total one are emitted.
+//
 // Round Robin
 //
 // The round robin behavior distributes each received event round robin
@@ -81,11 +245,48 @@
 // The simple behavior is created with a simple event processing function.
 // Useful if no state and no complex recovery is needed.
 //
+// Standard I/O
+//
+// The stdin source behavior reads lines, parses them, and emits the
+// results as events. The stdout sink behavior writes received events
+// as lines, by default as JSON. So pipelines can be part of Unix pipes.
+//
+// Tap
+//
+// The tap behavior writes each received event to a writer, as JSON or
+// logfmt and with configurable redaction of payload keys, and emits it
+// unchanged. So it can be placed anywhere in a topology for debugging.
+//
+// Threshold
+//
+// The threshold behavior checks values extracted out of the events
+// against upper or lower limits. Alerts are raised when a limit is
+// crossed for a sustained duration and cleared with a hysteresis.
+//
 // Ticker
 //
 // The ticker behavior emits a tick event in a defined interval to its
 // subscribers. So they can process chronological tasks beside other
 // events.
+//
+// Typed
+//
+// The typed behavior lets new behaviors be written against domain types
+// instead of payloads. A decoder like DecodeDefault converts each event,
+// events failing to decode are emitted with the topic "dead-letter".
+//
+// Unbatcher
+//
+// The unbatcher behavior splits batch events into single ones. They
+// are emitted in order with the index, the size, and the ID of the
+// batch and with the context of the batch event, so correlation
+// values are kept.
+//
+// Behaviors can also be created by name with New() and a configuration
+// map, e.g. for topologies loaded from configuration files. Factories
+// for own behaviors are added with Register(), the built-in ones not
+// needing functions as arguments are registered already. As New()
+// matches cells.BehaviorFactory it can be used to restore topologies.
 package behaviors
 
 //--------------------
@@ -0,0 +1,239 @@
+// Tideland Go Cells - Behaviors - Enricher
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CACHE POLICY
+//--------------------
+
+// LookupFunc retrieves additional values for an event from an
+// external source like a database or a HTTP service. Returning
+// nil values and no error signals that nothing has been found.
+type LookupFunc func(ctx context.Context, event cells.Event) (cells.PayloadValues, error)
+
+// CachePolicy controls the caching of lookups. Key returns the
+// cache key of an event, by default its topic. Found values are
+// cached for TTL, not found ones for NegativeTTL, zero durations
+// disable the caching. MaxEntries limits the cache size by removing
+// the least recently used entries. Concurrency limits the number
+// of parallel lookups, by default one.
+type CachePolicy struct {
+	Key         func(event cells.Event) string
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+	Concurrency int
+}
+
+// cacheEntry contains the cached result of one lookup.
+type cacheEntry struct {
+	key     string
+	values  cells.PayloadValues
+	expires time.Time
+}
+
+// lookupCache is a LRU cache with expiring entries.
+type lookupCache struct {
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+// newLookupCache creates a new cache.
+func newLookupCache(maxEntries int) *lookupCache {
+	return &lookupCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the cached values of a key if they are not expired.
+func (c *lookupCache) get(key string, now time.Time) (cells.PayloadValues, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if now.After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.values, true
+}
+
+// put adds the values of a key to the cache.
+func (c *lookupCache) put(key string, values cells.PayloadValues, expires time.Time) {
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.values = values
+		entry.expires = expires
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, values, expires})
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+//--------------------
+// ENRICHER BEHAVIOR
+//--------------------
+
+// enricherBehavior implements the enricher behavior.
+type enricherBehavior struct {
+	cell     cells.Cell
+	lookup   LookupFunc
+	policy   CachePolicy
+	options  *options
+	mutex    sync.Mutex
+	cache    *lookupCache
+	inflight map[string][]cells.Event
+	slots    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewEnricherBehavior creates a behavior augmenting received events
+// with the values returned by the lookup function. The events are
+// emitted with the same topic and their payload extended by those
+// values. Results are cached according to the policy, concurrent
+// lookups for the same key are done only once. If nothing is found
+// or the lookup fails the events are emitted unchanged. Due to the
+// parallel lookups the order of the events may change. Lookups are
+// done with Cell.InFlight(), so starting the cell with the option
+// cells.MaxInFlight() additionally limits them.
+func NewEnricherBehavior(lookup LookupFunc, cache CachePolicy, opts ...Option) cells.Behavior {
+	if cache.Key == nil {
+		cache.Key = func(event cells.Event) string {
+			return event.Topic()
+		}
+	}
+	if cache.Concurrency < 1 {
+		cache.Concurrency = 1
+	}
+	return &enricherBehavior{
+		lookup:   lookup,
+		policy:   cache,
+		options:  newOptions(opts...),
+		cache:    newLookupCache(cache.MaxEntries),
+		inflight: make(map[string][]cells.Event),
+		slots:    make(chan struct{}, cache.Concurrency),
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *enricherBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *enricherBehavior) Terminate() error {
+	b.wg.Wait()
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *enricherBehavior) ProcessEvent(event cells.Event) error {
+	key := b.policy.Key(event)
+	b.mutex.Lock()
+	if values, ok := b.cache.get(key, b.options.now()); ok {
+		b.mutex.Unlock()
+		return b.emit(event, values)
+	}
+	if waiting, ok := b.inflight[key]; ok {
+		b.inflight[key] = append(waiting, event)
+		b.mutex.Unlock()
+		return nil
+	}
+	b.inflight[key] = []cells.Event{event}
+	b.mutex.Unlock()
+	// Wait for a free lookup slot.
+	select {
+	case b.slots <- struct{}{}:
+	case <-event.Context().Done():
+		return b.finish(key, nil)
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() { <-b.slots }()
+		var values cells.PayloadValues
+		err := b.cell.InFlight(event.Context(), func() error {
+			var err error
+			values, err = b.lookup(event.Context(), event)
+			return err
+		})
+		if err != nil {
+			logger.Errorf("enricher %q cannot lookup %q: %v", b.cell.ID(), key, err)
+			b.finish(key, nil)
+			return
+		}
+		ttl := b.policy.TTL
+		if values == nil {
+			ttl = b.policy.NegativeTTL
+		}
+		b.mutex.Lock()
+		if ttl > 0 {
+			b.cache.put(key, values, b.options.now().Add(ttl))
+		}
+		b.mutex.Unlock()
+		b.finish(key, values)
+	}()
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *enricherBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// finish emits all events waiting for the lookup of the key.
+func (b *enricherBehavior) finish(key string, values cells.PayloadValues) error {
+	b.mutex.Lock()
+	waiting := b.inflight[key]
+	delete(b.inflight, key)
+	b.mutex.Unlock()
+	for _, event := range waiting {
+		if err := b.emit(event, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit emits the event with the enriched payload.
+func (b *enricherBehavior) emit(event cells.Event, values cells.PayloadValues) error {
+	payload := event.Payload()
+	if len(values) > 0 {
+		payload = payload.Apply(values)
+	}
+	return b.cell.EmitNew(event.Context(), event.Topic(), payload)
+}
+
+// EOF
@@ -0,0 +1,79 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Enricher
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestEnricherBehavior tests the enrichment of events with cached lookups.
+func TestEnricherBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("enricher-behavior")
+	defer env.Stop()
+
+	var lookups int32
+	lookup := func(ctx context.Context, event cells.Event) (cells.PayloadValues, error) {
+		atomic.AddInt32(&lookups, 1)
+		time.Sleep(20 * time.Millisecond)
+		if event.Topic() == "unknown" {
+			return nil, nil
+		}
+		return cells.PayloadValues{"name": "customer-" + event.Topic()}, nil
+	}
+	policy := behaviors.CachePolicy{
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		MaxEntries:  10,
+		Concurrency: 2,
+	}
+
+	env.StartCell("enricher", behaviors.NewEnricherBehavior(lookup, policy))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("enricher", "collector")
+
+	for _, topic := range []string{"42", "unknown", "42", "unknown", "42"} {
+		env.EmitNew(context.Background(), "enricher", topic, cells.PayloadValues{"id": topic})
+	}
+	time.Sleep(100 * time.Millisecond)
+	env.EmitNew(context.Background(), "enricher", "42", cells.PayloadValues{"id": "42"})
+	time.Sleep(50 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 6)
+	assert.Equal(atomic.LoadInt32(&lookups), int32(2))
+	accessor.Do(func(index int, event cells.Event) error {
+		name := event.Payload().GetString("name", "")
+		if event.Topic() == "unknown" {
+			assert.Equal(name, "")
+		} else {
+			assert.Equal(name, "customer-42")
+		}
+		assert.Equal(event.Payload().GetString("id", ""), event.Topic())
+		return nil
+	})
+}
+
+// EOF
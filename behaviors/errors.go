@@ -25,6 +25,17 @@ const (
 	ErrCannotValidateConfiguration
 	ErrInvalidPayload
 	ErrMissingPayloadWaiter
+	ErrOutboxStore
+	ErrCannotArchive
+	ErrInvalidJSONPath
+	ErrNoTargets
+	ErrHTTPStatus
+	ErrUnknownBehavior
+	ErrDuplicateBehavior
+	ErrInvalidConfiguration
+	ErrDedupStore
+	ErrKVStore
+	ErrNotify
 )
 
 var errorMessages = errors.Messages{
@@ -32,6 +43,17 @@ var errorMessages = errors.Messages{
 	ErrCannotValidateConfiguration: "configuration validation failed",
 	ErrInvalidPayload:              "payload '%v' does not exist or has wrong type",
 	ErrMissingPayloadWaiter:        "cell '%s' has no configured waiter",
+	ErrOutboxStore:                 "outbox '%s' cannot append event to store",
+	ErrCannotArchive:               "archiver '%s' cannot write batch",
+	ErrInvalidJSONPath:             "invalid or unsupported JSONPath '%s'",
+	ErrNoTargets:                   "load balancer '%s' has no targets",
+	ErrHTTPStatus:                  "unexpected HTTP status '%s'",
+	ErrUnknownBehavior:             "behavior '%s' is not registered",
+	ErrDuplicateBehavior:           "behavior '%s' is already registered",
+	ErrInvalidConfiguration:        "invalid configuration of behavior '%s': %s",
+	ErrDedupStore:                  "dedup '%s' cannot access store",
+	ErrKVStore:                     "cell '%s' cannot access key-value store",
+	ErrNotify:                      "notifier '%s' cannot send notification",
 }
 
 // EOF
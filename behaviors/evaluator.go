@@ -51,19 +51,22 @@ type evaluatorBehavior struct {
 	minRating float64
 	maxRating float64
 	avgRating float64
+	options   *options
 }
 
 // NewEvaluatorBehavior creates a behavior evaluating received events based
 // on the passed function. This function returns a rating. Their minimum,
 // maximum, average, and number of events are emitted. A "reset!" topic
-// sets all values to zero again.
-func NewEvaluatorBehavior(evaluator Evaluator) cells.Behavior {
+// sets all values to zero again. The emitted topic and the payload keys
+// can be changed by options.
+func NewEvaluatorBehavior(evaluator Evaluator, opts ...Option) cells.Behavior {
 	return &evaluatorBehavior{
 		evaluate:  evaluator,
 		count:     0,
 		minRating: 0.0,
 		maxRating: 0.0,
 		avgRating: 0.0,
+		options:   newOptions(opts...),
 	}
 }
 
@@ -108,12 +111,12 @@ func (b *evaluatorBehavior) ProcessEvent(event cells.Event) error {
 			}
 		}
 		// Emit value.
-		b.cell.EmitNew(event.Context(), TopicEvaluation, cells.PayloadValues{
+		b.cell.EmitNew(event.Context(), b.options.topic(TopicEvaluation), b.options.payload(cells.PayloadValues{
 			PayloadEvaluationCount:   b.count,
 			PayloadEvaluationAverage: b.avgRating,
 			PayloadEvaluationMax:     b.maxRating,
 			PayloadEvaluationMin:     b.minRating,
-		})
+		}))
 	}
 	return nil
 }
@@ -0,0 +1,30 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Export
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	TopicHeartbeatBeat = topicHeartbeatBeat
+)
+
+//--------------------
+// REGISTRY
+//--------------------
+
+// Unregister removes the factory registered by a test, so
+// the tests can run multiple times.
+func Unregister(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.factories, name)
+}
+
+// EOF
@@ -0,0 +1,259 @@
+// Tideland Go Cells - Behaviors - Extractor
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// EXTRACT RULE
+//--------------------
+
+// ExtractRule defines how to extract values out of one payload
+// field. If Regexp is set it is applied to the string value of the
+// field. Named groups are stored with their names, unnamed ones with
+// their index, each prefixed by Target and a dot if Target is set.
+// Otherwise JSONPath is applied to the field containing JSON as string,
+// as []byte, or already decoded. The supported JSONPath subset contains
+// the root "$", child names like ".name" or "['name']", and array
+// indexes like "[0]". The result is stored with the key Target, nested
+// objects and arrays are flattened into keys separated by dots.
+type ExtractRule struct {
+	Field    string
+	Regexp   *regexp.Regexp
+	JSONPath string
+	Target   string
+}
+
+// jsonPathStep is one step of a parsed JSONPath, either
+// a child name or an array index.
+type jsonPathStep struct {
+	name  string
+	index int
+}
+
+// parseJSONPath parses the supported JSONPath subset.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New(ErrInvalidJSONPath, errorMessages, path)
+	}
+	steps := []jsonPathStep{}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, errors.New(ErrInvalidJSONPath, errorMessages, path)
+			}
+			steps = append(steps, jsonPathStep{name: name, index: -1})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, errors.New(ErrInvalidJSONPath, errorMessages, path)
+			}
+			selector := rest[1:end]
+			if len(selector) > 1 && selector[0] == '\'' && selector[len(selector)-1] == '\'' {
+				steps = append(steps, jsonPathStep{name: selector[1 : len(selector)-1], index: -1})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, errors.New(ErrInvalidJSONPath, errorMessages, path)
+				}
+				steps = append(steps, jsonPathStep{index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, errors.New(ErrInvalidJSONPath, errorMessages, path)
+		}
+	}
+	return steps, nil
+}
+
+// walkJSONPath returns the value of decoded JSON at the path.
+func walkJSONPath(value interface{}, steps []jsonPathStep) (interface{}, bool) {
+	for _, step := range steps {
+		if step.index < 0 {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			value, ok = object[step.name]
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok || step.index >= len(array) {
+			return nil, false
+		}
+		value = array[step.index]
+	}
+	return value, true
+}
+
+// flatten stores the value with the key in the payload values,
+// nested objects and arrays are stored with dotted keys.
+func flatten(pvs cells.PayloadValues, key string, value interface{}) {
+	join := func(sub string) string {
+		if key == "" {
+			return sub
+		}
+		return key + "." + sub
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for sub, subValue := range v {
+			flatten(pvs, join(sub), subValue)
+		}
+	case []interface{}:
+		for i, subValue := range v {
+			flatten(pvs, join(strconv.Itoa(i)), subValue)
+		}
+	default:
+		pvs[key] = value
+	}
+}
+
+//--------------------
+// EXTRACTOR BEHAVIOR
+//--------------------
+
+// extractorBehavior implements the extractor behavior.
+type extractorBehavior struct {
+	cell      cells.Cell
+	rules     []ExtractRule
+	jsonPaths [][]jsonPathStep
+}
+
+// NewExtractorBehavior creates a behavior applying the passed
+// rules to the payloads of the received events. Each event is
+// emitted with the same topic and its payload extended by the
+// extracted values. So it can be used as the first stage before
+// routing the events. Invalid JSONPaths let the start of the
+// cell fail.
+func NewExtractorBehavior(rules []ExtractRule) cells.Behavior {
+	return &extractorBehavior{
+		rules: rules,
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *extractorBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.jsonPaths = make([][]jsonPathStep, len(b.rules))
+	for i, rule := range b.rules {
+		if rule.Regexp != nil {
+			continue
+		}
+		steps, err := parseJSONPath(rule.JSONPath)
+		if err != nil {
+			return err
+		}
+		b.jsonPaths[i] = steps
+	}
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *extractorBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *extractorBehavior) ProcessEvent(event cells.Event) error {
+	extracted := cells.PayloadValues{}
+	for i, rule := range b.rules {
+		value := event.Payload().Get(rule.Field, nil)
+		if value == nil {
+			continue
+		}
+		if rule.Regexp != nil {
+			b.extractRegexp(extracted, rule, value)
+			continue
+		}
+		b.extractJSONPath(extracted, rule, b.jsonPaths[i], value)
+	}
+	return b.cell.EmitNew(event.Context(), event.Topic(), event.Payload().Apply(extracted))
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *extractorBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// extractRegexp applies the regular expression of the rule.
+func (b *extractorBehavior) extractRegexp(extracted cells.PayloadValues, rule ExtractRule, value interface{}) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return
+	}
+	matches := rule.Regexp.FindStringSubmatch(text)
+	if matches == nil {
+		return
+	}
+	for i, name := range rule.Regexp.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if rule.Target != "" {
+			name = rule.Target + "." + name
+		}
+		extracted[name] = matches[i]
+	}
+}
+
+// extractJSONPath applies the JSONPath of the rule.
+func (b *extractorBehavior) extractJSONPath(extracted cells.PayloadValues, rule ExtractRule, steps []jsonPathStep, value interface{}) {
+	var document interface{}
+	switch v := value.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(v), &document); err != nil {
+			return
+		}
+	case []byte:
+		if err := json.Unmarshal(v, &document); err != nil {
+			return
+		}
+	default:
+		document = v
+	}
+	result, ok := walkJSONPath(document, steps)
+	if !ok {
+		return
+	}
+	flatten(extracted, rule.Target, result)
+}
+
+// EOF
@@ -0,0 +1,88 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Extractor
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestExtractorBehavior tests the extraction of payload values.
+func TestExtractorBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("extractor-behavior")
+	defer env.Stop()
+
+	rules := []behaviors.ExtractRule{
+		{
+			Field:  "line",
+			Regexp: regexp.MustCompile(`^(?P<level>[A-Z]+) (?P<message>.*)$`),
+			Target: "log",
+		}, {
+			Field:    "body",
+			JSONPath: "$.order.items[1]",
+			Target:   "item",
+		}, {
+			Field:    "body",
+			JSONPath: "$['order'].id",
+			Target:   "order",
+		},
+	}
+
+	env.StartCell("extractor", behaviors.NewExtractorBehavior(rules))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("extractor", "collector")
+
+	env.EmitNew(context.Background(), "extractor", "input", cells.PayloadValues{
+		"line": "WARN disk almost full",
+		"body": `{"order": {"id": "o-42", "items": [{"sku": "a"}, {"sku": "b", "qty": 2}]}}`,
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 1)
+	event, ok := accessor.PeekFirst()
+	assert.True(ok)
+	assert.Equal(event.Topic(), "input")
+	pl := event.Payload()
+	assert.Equal(pl.GetString("log.level", ""), "WARN")
+	assert.Equal(pl.GetString("log.message", ""), "disk almost full")
+	assert.Equal(pl.GetString("item.sku", ""), "b")
+	assert.Equal(pl.GetFloat64("item.qty", 0), 2.0)
+	assert.Equal(pl.GetString("order", ""), "o-42")
+	assert.Equal(pl.GetString("line", ""), "WARN disk almost full")
+}
+
+// TestExtractorBehaviorInvalidPath tests the start with an invalid JSONPath.
+func TestExtractorBehaviorInvalidPath(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("extractor-behavior-invalid-path")
+	defer env.Stop()
+
+	rules := []behaviors.ExtractRule{{Field: "body", JSONPath: "order[x]"}}
+	err := env.StartCell("extractor", behaviors.NewExtractorBehavior(rules))
+	assert.ErrorMatch(err, ".*invalid or unsupported JSONPath.*")
+}
+
+// EOF
@@ -58,6 +58,24 @@ func (b *filterBehavior) ProcessEvent(event cells.Event) error {
 	return nil
 }
 
+// Configure replaces the filter function with the one contained
+// in the payload key "config:filter".
+func (b *filterBehavior) Configure(config cells.Payload) error {
+	if config.Get(PayloadConfigFilter, nil) == nil {
+		return nil
+	}
+	matches, ok := config.Get(PayloadConfigFilter, nil).(Filter)
+	if !ok {
+		fn, fok := config.Get(PayloadConfigFilter, nil).(func(cells.Event) (bool, error))
+		if !fok {
+			return invalidConfig(b.cell, "%q has to be a filter", PayloadConfigFilter)
+		}
+		matches = fn
+	}
+	b.matches = matches
+	return nil
+}
+
 // Recover from an error.
 func (b *filterBehavior) Recover(err interface{}) error {
 	return nil
@@ -102,7 +102,7 @@ func (b *fsmBehavior) Recover(err interface{}) error {
 
 // RequestFSMStatus retrieves the status of a FSM cell.
 func RequestFSMStatus(ctx context.Context, env cells.Environment, id string, timeout time.Duration) (bool, error) {
-	payload, err := env.Request(ctx, id, cells.TopicStatus, timeout)
+	payload, err := cells.SendCommand(ctx, env, id, cells.CommandStatus, nil, timeout)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,275 @@
+// Tideland Go Cells - Behaviors - File Watcher Source
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicFSCreate labels an event for a created file.
+	TopicFSCreate = "fs-create"
+
+	// TopicFSWrite labels an event for a written file.
+	TopicFSWrite = "fs-write"
+
+	// TopicFSRemove labels an event for a removed file.
+	TopicFSRemove = "fs-remove"
+
+	// TopicFSRename labels an event for a renamed file.
+	TopicFSRename = "fs-rename"
+
+	// PayloadFSPath contains the path of the file.
+	PayloadFSPath = "fs:path"
+
+	// PayloadFSOldPath contains the former path of a renamed file.
+	PayloadFSOldPath = "fs:old-path"
+
+	// PayloadFSSize contains the size of the file.
+	PayloadFSSize = "fs:size"
+
+	// PayloadFSModTime contains the modification time of the file.
+	PayloadFSModTime = "fs:mod-time"
+
+	// defaultFSWatcherInterval is the default interval the watched
+	// paths are scanned in.
+	defaultFSWatcherInterval = time.Second
+
+	// topicFSChanges lets the watcher emit the found changes.
+	topicFSChanges = "fs-changes!"
+)
+
+//--------------------
+// FILE WATCHER SOURCE BEHAVIOR
+//--------------------
+
+// fsChange is one change found by a scan.
+type fsChange struct {
+	topic   string
+	path    string
+	oldPath string
+	info    os.FileInfo
+}
+
+// fsFile is the state of a watched file.
+type fsFile struct {
+	info    os.FileInfo
+	written bool
+}
+
+// fsWatcherBehavior scans paths and emits file changes.
+type fsWatcherBehavior struct {
+	cell      cells.Cell
+	paths     []string
+	recursive bool
+	files     map[string]*fsFile
+	options   *options
+	ctx       context.Context
+	cancel    func()
+}
+
+// NewFSWatcherBehavior creates a behavior watching the files in the
+// passed paths, which can be files or directories. With recursive
+// the subdirectories are watched too. Created, written, removed, and
+// renamed files are emitted with the topics "fs-create", "fs-write",
+// "fs-remove", and "fs-rename" and their path, size, and modification
+// time. Renames are found by the identity of the files. The paths are
+// scanned every second or in the interval set by WithInterval(). Writes
+// are debounced, so a burst of them is emitted once when the file did
+// not change for one interval, e.g. when a dropped file is complete.
+// The emitted topics and the payload keys can be changed by options.
+func NewFSWatcherBehavior(paths []string, recursive bool, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	if o.interval == 0 {
+		o.interval = defaultFSWatcherInterval
+	}
+	return &fsWatcherBehavior{
+		paths:     paths,
+		recursive: recursive,
+		options:   o,
+	}
+}
+
+// Init the behavior.
+func (b *fsWatcherBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.files = make(map[string]*fsFile)
+	for path, info := range b.scan() {
+		b.files[path] = &fsFile{info: info}
+	}
+	go b.watchLoop()
+	return nil
+}
+
+// Terminate the behavior.
+func (b *fsWatcherBehavior) Terminate() error {
+	b.cancel()
+	return nil
+}
+
+// ProcessEvent emits the changes found by the scans.
+func (b *fsWatcherBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicFSChanges {
+		return nil
+	}
+	changes, ok := event.Payload().GetDefault(nil).([]fsChange)
+	if !ok {
+		return nil
+	}
+	for _, change := range changes {
+		values := cells.PayloadValues{
+			PayloadFSPath: change.path,
+		}
+		if change.oldPath != "" {
+			values[PayloadFSOldPath] = change.oldPath
+		}
+		if change.info != nil {
+			values[PayloadFSSize] = change.info.Size()
+			values[PayloadFSModTime] = change.info.ModTime()
+		}
+		err := b.cell.EmitNew(event.Context(), b.options.topic(change.topic), b.options.payload(values))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *fsWatcherBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// watchLoop scans the paths until the behavior terminates.
+func (b *fsWatcherBehavior) watchLoop() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(b.options.interval):
+		}
+		changes := b.compare(b.scan())
+		if len(changes) == 0 {
+			continue
+		}
+		// Let the cell emit the changes to avoid races
+		// when subscribers are updated.
+		err := b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicFSChanges, changes)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// scan returns the current files of the watched paths.
+func (b *fsWatcherBehavior) scan() map[string]os.FileInfo {
+	infos := make(map[string]os.FileInfo)
+	for _, path := range b.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warningf("file watcher %q cannot access %q: %v", b.cell.ID(), path, err)
+			}
+			continue
+		}
+		if !info.IsDir() {
+			infos[path] = info
+			continue
+		}
+		if b.recursive {
+			filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					infos[p] = info
+				}
+				return nil
+			})
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			logger.Warningf("file watcher %q cannot read %q: %v", b.cell.ID(), path, err)
+			continue
+		}
+		for _, info := range entries {
+			if info.Mode().IsRegular() {
+				infos[filepath.Join(path, info.Name())] = info
+			}
+		}
+	}
+	return infos
+}
+
+// compare updates the watched files with the scanned ones and
+// returns the changes.
+func (b *fsWatcherBehavior) compare(infos map[string]os.FileInfo) []fsChange {
+	var changes []fsChange
+	var created, removed []string
+	for path, info := range infos {
+		file, ok := b.files[path]
+		if !ok {
+			created = append(created, path)
+			continue
+		}
+		switch {
+		case info.Size() != file.info.Size() || !info.ModTime().Equal(file.info.ModTime()):
+			// Still writing, wait until the file is stable.
+			file.written = true
+		case file.written:
+			file.written = false
+			changes = append(changes, fsChange{topic: TopicFSWrite, path: path, info: info})
+		}
+		file.info = info
+	}
+	for path := range b.files {
+		if _, ok := infos[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(removed)
+	for _, path := range created {
+		info := infos[path]
+		change := fsChange{topic: TopicFSCreate, path: path, info: info}
+		for i, oldPath := range removed {
+			if os.SameFile(b.files[oldPath].info, info) {
+				change.topic = TopicFSRename
+				change.oldPath = oldPath
+				delete(b.files, oldPath)
+				removed = append(removed[:i], removed[i+1:]...)
+				break
+			}
+		}
+		b.files[path] = &fsFile{info: info}
+		changes = append(changes, change)
+	}
+	for _, path := range removed {
+		delete(b.files, path)
+		changes = append(changes, fsChange{topic: TopicFSRemove, path: path})
+	}
+	return changes
+}
+
+// EOF
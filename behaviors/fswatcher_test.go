@@ -0,0 +1,92 @@
+// Tideland Go Cells - Behaviors - Unit Tests - File Watcher Source
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestFSWatcherBehavior tests watching a directory for changed files.
+func TestFSWatcherBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("fs-watcher-behavior")
+	defer env.Stop()
+
+	dir, err := ioutil.TempDir("", "fs-watcher")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	assert.Nil(os.Mkdir(sub, 0755))
+	ioutil.WriteFile(filepath.Join(dir, "existing"), []byte("x"), 0644)
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(0))
+	env.StartCell("watcher", behaviors.NewFSWatcherBehavior([]string{dir}, true, behaviors.WithInterval(10*time.Millisecond)))
+	env.Subscribe("watcher", "collector")
+
+	waitFor := func(topic string) cells.Event {
+		for i := 0; i < 200; i++ {
+			err := env.Barrier(context.Background(), "watcher", "collector")
+			assert.Nil(err)
+			accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+			assert.Nil(err)
+			if last, ok := accessor.PeekLast(); ok && last.Topic() == topic {
+				env.EmitNew(context.Background(), "collector", cells.TopicReset, nil)
+				return last
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Fail("missing event " + topic)
+		return nil
+	}
+
+	path := filepath.Join(sub, "data.csv")
+	file, err := os.Create(path)
+	assert.Nil(err)
+	event := waitFor(behaviors.TopicFSCreate)
+	assert.Equal(event.Payload().GetString(behaviors.PayloadFSPath, ""), path)
+
+	// A burst of writes is emitted once.
+	for i := 0; i < 5; i++ {
+		file.WriteString("a,b,c\n")
+		time.Sleep(2 * time.Millisecond)
+	}
+	file.Close()
+	event = waitFor(behaviors.TopicFSWrite)
+	assert.Equal(event.Payload().GetString(behaviors.PayloadFSPath, ""), path)
+	assert.Equal(event.Payload().Get(behaviors.PayloadFSSize, nil), int64(30))
+
+	renamed := filepath.Join(dir, "data.done")
+	assert.Nil(os.Rename(path, renamed))
+	event = waitFor(behaviors.TopicFSRename)
+	assert.Equal(event.Payload().GetString(behaviors.PayloadFSOldPath, ""), path)
+	assert.Equal(event.Payload().GetString(behaviors.PayloadFSPath, ""), renamed)
+
+	assert.Nil(os.Remove(renamed))
+	event = waitFor(behaviors.TopicFSRemove)
+	assert.Equal(event.Payload().GetString(behaviors.PayloadFSPath, ""), renamed)
+}
+
+// EOF
@@ -0,0 +1,176 @@
+// Tideland Go Cells - Behaviors - Heartbeat
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/loop"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicHeartbeat signals a heartbeat.
+	TopicHeartbeat = "heartbeat"
+
+	// TopicSilenceDetected signals that the heartbeats of a
+	// monitored source are missing.
+	TopicSilenceDetected = "silence-detected"
+
+	// TopicHeartbeatRecovered signals that a silent source
+	// sends heartbeats again.
+	TopicHeartbeatRecovered = "heartbeat-recovered"
+
+	// PayloadHeartbeatID contains the ID of the heartbeat source.
+	PayloadHeartbeatID = "heartbeat:id"
+
+	// PayloadHeartbeatTime contains the time of the heartbeat.
+	PayloadHeartbeatTime = "heartbeat:time"
+
+	// PayloadHeartbeatLastSeen contains the time of the last
+	// heartbeat received from a silent source.
+	PayloadHeartbeatLastSeen = "heartbeat:last-seen"
+
+	// defaultHeartbeatInterval is used for intervals
+	// not greater than zero.
+	defaultHeartbeatInterval = time.Second
+
+	// topicHeartbeatBeat is emitted by the behavior to itself
+	// in the heartbeat interval.
+	topicHeartbeatBeat = "heartbeat:beat!"
+)
+
+//--------------------
+// HEARTBEAT BEHAVIOR
+//--------------------
+
+// heartbeatSource contains the state of a monitored source.
+type heartbeatSource struct {
+	lastSeen time.Time
+	silent   bool
+}
+
+// heartbeatBehavior implements the heartbeat behavior.
+type heartbeatBehavior struct {
+	cell            cells.Cell
+	interval        time.Duration
+	missedThreshold int
+	sources         map[string]*heartbeatSource
+	loop            loop.Loop
+	options         *options
+}
+
+// NewHeartbeatBehavior creates a behavior emitting heartbeat events
+// with its ID and the current time in the passed interval. Received
+// heartbeats of other cells are monitored. If a source missed more
+// than missedThreshold intervals an event with the topic
+// "silence-detected", the ID of the source, and the time it has been
+// last seen is emitted. When it sends heartbeats again the topic
+// "heartbeat-recovered" is emitted. An interval not greater than
+// zero is set to one second. The clock can be changed by the option
+// WithClock().
+func NewHeartbeatBehavior(interval time.Duration, missedThreshold int, opts ...Option) cells.Behavior {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if missedThreshold < 1 {
+		missedThreshold = 1
+	}
+	return &heartbeatBehavior{
+		interval:        interval,
+		missedThreshold: missedThreshold,
+		sources:         make(map[string]*heartbeatSource),
+		options:         newOptions(opts...),
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *heartbeatBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.loop = loop.Go(b.beatLoop)
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *heartbeatBehavior) Terminate() error {
+	return b.loop.Stop()
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *heartbeatBehavior) ProcessEvent(event cells.Event) error {
+	now := b.options.now()
+	switch event.Topic() {
+	case topicHeartbeatBeat:
+		b.cell.EmitNew(event.Context(), TopicHeartbeat, cells.PayloadValues{
+			PayloadHeartbeatID:   b.cell.ID(),
+			PayloadHeartbeatTime: now,
+		})
+		silence := b.interval * time.Duration(b.missedThreshold)
+		for id, source := range b.sources {
+			if !source.silent && now.Sub(source.lastSeen) > silence {
+				source.silent = true
+				b.cell.EmitNew(event.Context(), TopicSilenceDetected, cells.PayloadValues{
+					PayloadHeartbeatID:       id,
+					PayloadHeartbeatLastSeen: source.lastSeen,
+				})
+			}
+		}
+	case TopicHeartbeat:
+		id := event.Payload().GetString(PayloadHeartbeatID, "")
+		if id == "" {
+			return nil
+		}
+		source, ok := b.sources[id]
+		if !ok {
+			source = &heartbeatSource{}
+			b.sources[id] = source
+		}
+		source.lastSeen = now
+		if source.silent {
+			source.silent = false
+			b.cell.EmitNew(event.Context(), TopicHeartbeatRecovered, cells.PayloadValues{
+				PayloadHeartbeatID:   id,
+				PayloadHeartbeatTime: now,
+			})
+		}
+	case cells.TopicReset:
+		b.sources = make(map[string]*heartbeatSource)
+	}
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *heartbeatBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// beatLoop lets the behavior beat in the interval.
+func (b *heartbeatBehavior) beatLoop(l loop.Loop) error {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case <-ticker.C:
+			b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicHeartbeatBeat, nil)
+		}
+	}
+}
+
+// EOF
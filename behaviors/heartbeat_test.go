@@ -0,0 +1,112 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Heartbeat
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestHeartbeatBehavior tests the detection of missing heartbeats.
+// The beats are emitted by the test with a controlled clock.
+func TestHeartbeatBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("heartbeat-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	beat := func(ids ...string) {
+		for _, id := range ids {
+			assert.Nil(env.EmitNew(ctx, id, behaviors.TopicHeartbeatBeat, nil))
+		}
+		assert.Nil(env.Barrier(ctx))
+	}
+	collected := func() []string {
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		var topics []string
+		accessor.Do(func(index int, event cells.Event) error {
+			assert.Equal(event.Payload().GetString(behaviors.PayloadHeartbeatID, ""), "source")
+			topics = append(topics, event.Topic())
+			return nil
+		})
+		return topics
+	}
+	filter := func(event cells.Event) (bool, error) {
+		switch event.Topic() {
+		case behaviors.TopicSilenceDetected, behaviors.TopicHeartbeatRecovered:
+			return true, nil
+		}
+		return false, nil
+	}
+
+	// The interval is long, so only the test beats.
+	env.StartCell("source", behaviors.NewHeartbeatBehavior(time.Hour, 3, behaviors.WithClock(clock)))
+	env.StartCell("monitor", behaviors.NewHeartbeatBehavior(time.Hour, 3, behaviors.WithClock(clock)))
+	env.StartCell("filter", behaviors.NewFilterBehavior(filter))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("source", "monitor")
+	env.Subscribe("monitor", "filter")
+	env.Subscribe("filter", "collector")
+
+	// Regular beats.
+	for i := 0; i < 5; i++ {
+		beat("source", "monitor")
+		advance(time.Hour)
+	}
+	assert.Length(collected(), 0)
+
+	// Missing beats of the source.
+	lastSeen := clock().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		beat("monitor")
+		advance(time.Hour)
+	}
+	assert.Length(collected(), 0)
+	beat("monitor")
+	assert.Equal(collected(), []string{behaviors.TopicSilenceDetected})
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Payload().GetTime(behaviors.PayloadHeartbeatLastSeen, time.Time{}), lastSeen)
+		return nil
+	})
+
+	// Source beats again.
+	beat("source")
+	assert.Equal(collected(), []string{behaviors.TopicSilenceDetected, behaviors.TopicHeartbeatRecovered})
+}
+
+// EOF
@@ -0,0 +1,401 @@
+// Tideland Go Cells - Behaviors - Histogram Evaluator
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicHistogram requests a summary of a histogram evaluator.
+	TopicHistogram = "histogram?"
+
+	// PayloadHistogramPeriod contains the rolling period a summary
+	// is requested for.
+	PayloadHistogramPeriod = "histogram:period"
+
+	// PayloadHistogramQuantiles contains the requested quantiles.
+	PayloadHistogramQuantiles = "histogram:quantiles"
+
+	// PayloadHistogramBounds contains the upper bounds of the
+	// requested buckets.
+	PayloadHistogramBounds = "histogram:bounds"
+
+	// histogramSubBuckets is the number of buckets per power of two,
+	// it leads to a relative error of less than one percent.
+	histogramSubBuckets = 128
+
+	// histogramExpOffset keeps the bucket numbers of all exponents
+	// of float64 values positive.
+	histogramExpOffset = 1100
+
+	// histogramSlots is the number of slots the period of a
+	// histogram evaluator is divided into.
+	histogramSlots = 10
+)
+
+//--------------------
+// HISTOGRAM
+//--------------------
+
+// HistogramBucket contains the number of values in a range.
+type HistogramBucket struct {
+	Lower float64
+	Upper float64
+	Count int
+}
+
+// HistogramSummary describes the evaluated values of a period.
+type HistogramSummary struct {
+	From      time.Time
+	To        time.Time
+	Count     int
+	Min       float64
+	Max       float64
+	Mean      float64
+	Quantiles map[float64]float64
+	Buckets   []HistogramBucket
+}
+
+// histogram is a high dynamic range histogram with logarithmic
+// buckets. Their keys are ordered like the values, negative keys
+// contain negative values and key 0 contains zeros.
+type histogram struct {
+	counts map[int]int
+	count  int
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// newHistogram creates an empty histogram.
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make(map[int]int),
+	}
+}
+
+// record adds a value.
+func (h *histogram) record(value float64) {
+	h.counts[histogramKey(value)]++
+	if h.count == 0 || value < h.min {
+		h.min = value
+	}
+	if h.count == 0 || value > h.max {
+		h.max = value
+	}
+	h.count++
+	h.sum += value
+}
+
+// merge adds the values of another histogram.
+func (h *histogram) merge(o *histogram) {
+	if o.count == 0 {
+		return
+	}
+	for key, count := range o.counts {
+		h.counts[key] += count
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if h.count == 0 || o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+}
+
+// keys returns the ordered keys of the filled buckets.
+func (h *histogram) keys() []int {
+	keys := make([]int, 0, len(h.counts))
+	for key := range h.counts {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// quantile returns the value at the quantile q between 0 and 1.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for _, key := range h.keys() {
+		seen += h.counts[key]
+		if seen >= rank {
+			lower, upper := histogramBounds(key)
+			value := (lower + upper) / 2
+			return math.Min(math.Max(value, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// buckets returns the counts of the ranges ending with the passed
+// upper bounds plus one for the values above. Without bounds the
+// filled buckets of the histogram are returned.
+func (h *histogram) buckets(bounds []float64) []HistogramBucket {
+	if len(bounds) == 0 {
+		var buckets []HistogramBucket
+		for _, key := range h.keys() {
+			lower, upper := histogramBounds(key)
+			buckets = append(buckets, HistogramBucket{lower, upper, h.counts[key]})
+		}
+		return buckets
+	}
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	buckets := make([]HistogramBucket, len(sorted)+1)
+	lower := math.Inf(-1)
+	for i, upper := range sorted {
+		buckets[i] = HistogramBucket{Lower: lower, Upper: upper}
+		lower = upper
+	}
+	buckets[len(sorted)] = HistogramBucket{Lower: lower, Upper: math.Inf(1)}
+	for key, count := range h.counts {
+		// Buckets start at the bound nearer to zero, it is
+		// the exact value of the recorded ones.
+		start, end := histogramBounds(key)
+		if key < 0 {
+			start = end
+		}
+		i := sort.SearchFloat64s(sorted, start)
+		buckets[i].Count += count
+	}
+	return buckets
+}
+
+// histogramKey returns the bucket key of a value.
+func histogramKey(value float64) int {
+	switch {
+	case value > 0:
+		return histogramBucket(value)
+	case value < 0:
+		return -histogramBucket(-value)
+	}
+	return 0
+}
+
+// histogramBucket returns the bucket number of a positive value.
+func histogramBucket(value float64) int {
+	frac, exp := math.Frexp(value)
+	sub := int((frac - 0.5) * 2 * histogramSubBuckets)
+	if sub >= histogramSubBuckets {
+		sub = histogramSubBuckets - 1
+	}
+	return (exp+histogramExpOffset)*histogramSubBuckets + sub
+}
+
+// histogramBounds returns the lower and upper bound of a bucket key.
+func histogramBounds(key int) (float64, float64) {
+	bucket := key
+	if key < 0 {
+		bucket = -key
+	}
+	if key == 0 {
+		return 0, 0
+	}
+	exp := bucket/histogramSubBuckets - histogramExpOffset
+	sub := float64(bucket % histogramSubBuckets)
+	lower := math.Ldexp(0.5+sub/(2*histogramSubBuckets), exp)
+	upper := math.Ldexp(0.5+(sub+1)/(2*histogramSubBuckets), exp)
+	if key < 0 {
+		return -upper, -lower
+	}
+	return lower, upper
+}
+
+//--------------------
+// HISTOGRAM EVALUATOR BEHAVIOR
+//--------------------
+
+// histogramEvaluatorBehavior keeps histograms of evaluated values.
+type histogramEvaluatorBehavior struct {
+	cell       cells.Cell
+	evaluate   Evaluator
+	period     time.Duration
+	resolution time.Duration
+	slots      map[int64]*histogram
+	options    *options
+}
+
+// NewHistogramEvaluatorBehavior creates a behavior evaluating received
+// events like the evaluator behavior, but keeping the ratings of the
+// passed rolling period in a high dynamic range histogram. The request
+// topic "histogram?", e.g. sent with RequestHistogram(), answers with a
+// summary of the whole or a shorter period containing minimum, maximum,
+// mean, arbitrary quantiles, and buckets. The period is divided into ten
+// slots, so older ratings leave the histogram slot by slot. Backfilled
+// events are sorted in by their event time, the clock can be changed
+// with WithClock(). A "reset!" clears the histogram.
+func NewHistogramEvaluatorBehavior(evaluator Evaluator, period time.Duration, opts ...Option) cells.Behavior {
+	resolution := period / histogramSlots
+	if resolution < time.Millisecond {
+		resolution = time.Millisecond
+	}
+	return &histogramEvaluatorBehavior{
+		evaluate:   evaluator,
+		period:     period,
+		resolution: resolution,
+		slots:      make(map[int64]*histogram),
+		options:    newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *histogramEvaluatorBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *histogramEvaluatorBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent evaluates the event or answers requests.
+func (b *histogramEvaluatorBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case TopicHistogram:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving histogram from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		period := payload.GetDuration(PayloadHistogramPeriod, b.period)
+		quantiles, _ := payload.Get(PayloadHistogramQuantiles, nil).([]float64)
+		bounds, _ := payload.Get(PayloadHistogramBounds, nil).([]float64)
+		payload.GetWaiter().Set(b.summary(period, quantiles, bounds))
+	case cells.TopicReset:
+		b.slots = make(map[int64]*histogram)
+	default:
+		rating, err := b.evaluate(event)
+		if err != nil {
+			return err
+		}
+		slot := b.slot(b.options.eventTime(event))
+		if slot <= b.slot(b.options.now())-histogramSlots {
+			// Too old for the period.
+			return nil
+		}
+		h, ok := b.slots[slot]
+		if !ok {
+			h = newHistogram()
+			b.slots[slot] = h
+			b.prune()
+		}
+		h.record(rating)
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *histogramEvaluatorBehavior) Recover(err interface{}) error {
+	b.slots = make(map[int64]*histogram)
+	return nil
+}
+
+// slot returns the number of the slot containing the time.
+func (b *histogramEvaluatorBehavior) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(b.resolution)
+}
+
+// prune removes the slots outside of the period.
+func (b *histogramEvaluatorBehavior) prune() {
+	oldest := b.slot(b.options.now()) - histogramSlots
+	for slot := range b.slots {
+		if slot <= oldest {
+			delete(b.slots, slot)
+		}
+	}
+}
+
+// summary merges the slots of the period and describes them.
+func (b *histogramEvaluatorBehavior) summary(period time.Duration, quantiles, bounds []float64) *HistogramSummary {
+	if period <= 0 || period > b.period {
+		period = b.period
+	}
+	b.prune()
+	now := b.options.now()
+	current := b.slot(now)
+	slots := int64((period + b.resolution - 1) / b.resolution)
+	merged := newHistogram()
+	for slot, h := range b.slots {
+		if slot > current-slots {
+			merged.merge(h)
+		}
+	}
+	summary := &HistogramSummary{
+		From:      time.Unix(0, (current-slots+1)*int64(b.resolution)),
+		To:        now,
+		Count:     merged.count,
+		Min:       merged.min,
+		Max:       merged.max,
+		Quantiles: make(map[float64]float64, len(quantiles)),
+		Buckets:   merged.buckets(bounds),
+	}
+	if merged.count > 0 {
+		summary.Mean = merged.sum / float64(merged.count)
+	}
+	for _, q := range quantiles {
+		summary.Quantiles[q] = merged.quantile(q)
+	}
+	return summary
+}
+
+// RequestHistogram retrieves the summary of a histogram evaluator for
+// the passed period with the values at the quantiles, e.g. 0.5 and 0.99,
+// and the buckets ending with the passed upper bounds. A zero period
+// returns the summary of the whole period of the evaluator, no bounds
+// return the internal buckets.
+func RequestHistogram(ctx context.Context, env cells.Environment, id string, period time.Duration, quantiles, bounds []float64, timeout time.Duration) (*HistogramSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payloadIn, waiter := cells.NewWaiterPayload()
+	request := payloadIn.Apply(cells.PayloadValues{
+		PayloadHistogramPeriod:    period,
+		PayloadHistogramQuantiles: quantiles,
+		PayloadHistogramBounds:    bounds,
+	})
+	if err := env.EmitNew(ctx, id, TopicHistogram, request); err != nil {
+		return nil, err
+	}
+	payload, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary, ok := payload.GetDefault(nil).(*HistogramSummary)
+	if !ok {
+		return nil, errors.New(ErrInvalidPayload, errorMessages, cells.PayloadDefault)
+	}
+	return summary, nil
+}
+
+// EOF
@@ -0,0 +1,100 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Histogram Evaluator
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestHistogramEvaluatorBehavior tests the histogram evaluator behavior.
+func TestHistogramEvaluatorBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("histogram-evaluator-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	evaluate := func(event cells.Event) (float64, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0), nil
+	}
+
+	env.StartCell("histogram", behaviors.NewHistogramEvaluatorBehavior(evaluate, time.Minute, behaviors.WithClock(clock)))
+
+	for i := 1; i <= 100; i++ {
+		env.EmitNew(ctx, "histogram", "value", float64(i))
+	}
+	summary, err := behaviors.RequestHistogram(ctx, env, "histogram", 0, []float64{0.5, 0.99}, []float64{10, 50}, time.Second)
+	assert.Nil(err)
+	assert.Equal(summary.Count, 100)
+	assert.Equal(summary.Min, 1.0)
+	assert.Equal(summary.Max, 100.0)
+	assert.Equal(summary.Mean, 50.5)
+	assert.About(summary.Quantiles[0.5], 50.0, 0.5)
+	assert.About(summary.Quantiles[0.99], 99.0, 1.0)
+	assert.Length(summary.Buckets, 3)
+	assert.Equal(summary.Buckets[0].Count, 10)
+	assert.Equal(summary.Buckets[1].Count, 40)
+	assert.Equal(summary.Buckets[2].Count, 50)
+	assert.True(math.IsInf(summary.Buckets[2].Upper, 1))
+
+	// Shorter periods only contain the newer values.
+	advance(30 * time.Second)
+	env.EmitNew(ctx, "histogram", "value", -5.0)
+	summary, err = behaviors.RequestHistogram(ctx, env, "histogram", 10*time.Second, []float64{0.5}, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(summary.Count, 1)
+	assert.Equal(summary.Quantiles[0.5], -5.0)
+	assert.Length(summary.Buckets, 1)
+	assert.True(summary.Buckets[0].Lower <= -5.0 && summary.Buckets[0].Upper >= -5.0)
+	summary, err = behaviors.RequestHistogram(ctx, env, "histogram", 0, nil, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(summary.Count, 101)
+	assert.Equal(summary.Min, -5.0)
+
+	// Values leave the period.
+	advance(35 * time.Second)
+	summary, err = behaviors.RequestHistogram(ctx, env, "histogram", 0, nil, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(summary.Count, 1)
+
+	env.EmitNew(ctx, "histogram", cells.TopicReset, nil)
+	summary, err = behaviors.RequestHistogram(ctx, env, "histogram", 0, []float64{0.5}, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(summary.Count, 0)
+	assert.Equal(summary.Quantiles[0.5], 0.0)
+}
+
+// EOF
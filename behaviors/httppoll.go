@@ -0,0 +1,197 @@
+// Tideland Go Cells - Behaviors - HTTP Poll Source
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicHTTPPollChange labels an event containing a changed
+	// response when no parser is used.
+	TopicHTTPPollChange = "http-poll-change"
+
+	// PayloadHTTPPollURL contains the polled URL.
+	PayloadHTTPPollURL = "http-poll:url"
+
+	// PayloadHTTPPollBody contains the changed response body.
+	PayloadHTTPPollBody = "http-poll:body"
+
+	// topicHTTPPollBody lets the source process a changed body.
+	topicHTTPPollBody = "http-poll-body!"
+)
+
+//--------------------
+// HTTP POLL SOURCE BEHAVIOR
+//--------------------
+
+// BodyParser parses a changed response body into the topic and
+// the payload of the event to emit.
+type BodyParser func(body []byte) (string, interface{}, error)
+
+// httpPollSourceBehavior polls an URL and emits changes.
+type httpPollSourceBehavior struct {
+	cell         cells.Cell
+	url          string
+	interval     time.Duration
+	parser       BodyParser
+	etagSupport  bool
+	client       *http.Client
+	etag         string
+	lastModified string
+	last         []byte
+	ctx          context.Context
+	cancel       func()
+}
+
+// NewHTTPPollSourceBehavior creates a behavior polling the URL in the
+// given interval and emitting an event each time the response body
+// changed. With ETag support the requests contain the headers
+// If-None-Match and If-Modified-Since, so servers can answer with
+// 304 Not Modified. Without a parser the changes are emitted with the
+// topic "http-poll-change" and the URL and the body as payload. Failed
+// requests and bodies which cannot be parsed are logged and skipped.
+func NewHTTPPollSourceBehavior(url string, interval time.Duration, parser BodyParser, etagSupport bool) cells.Behavior {
+	b := &httpPollSourceBehavior{
+		url:         url,
+		interval:    interval,
+		parser:      parser,
+		etagSupport: etagSupport,
+		client:      &http.Client{Timeout: interval},
+	}
+	if b.parser == nil {
+		b.parser = func(body []byte) (string, interface{}, error) {
+			return TopicHTTPPollChange, cells.PayloadValues{
+				PayloadHTTPPollURL:  url,
+				PayloadHTTPPollBody: string(body),
+			}, nil
+		}
+	}
+	return b
+}
+
+// Init the behavior.
+func (b *httpPollSourceBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.pollLoop()
+	return nil
+}
+
+// Terminate the behavior. A running request is canceled.
+func (b *httpPollSourceBehavior) Terminate() error {
+	b.cancel()
+	return nil
+}
+
+// ProcessEvent parses changed bodies and emits the results.
+func (b *httpPollSourceBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicHTTPPollBody {
+		return nil
+	}
+	body, ok := event.Payload().Get(cells.PayloadDefault, nil).([]byte)
+	if !ok {
+		return nil
+	}
+	topic, payload, err := b.parser(body)
+	if err != nil {
+		logger.Warningf("http poll source %q cannot parse response of %q: %v", b.cell.ID(), b.url, err)
+		return nil
+	}
+	return b.cell.EmitNew(event.Context(), topic, payload)
+}
+
+// Recover from an error.
+func (b *httpPollSourceBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// pollLoop polls the URL until the behavior terminates.
+func (b *httpPollSourceBehavior) pollLoop() {
+	for {
+		body, changed, err := b.poll()
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warningf("http poll source %q cannot poll %q: %v", b.cell.ID(), b.url, err)
+		} else if changed {
+			// Let the cell process the body to avoid races
+			// when subscribers are updated.
+			err = b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicHTTPPollBody, body)
+			if err != nil {
+				return
+			}
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(b.interval):
+		}
+	}
+}
+
+// poll requests the URL once and checks if the body changed.
+func (b *httpPollSourceBehavior) poll() ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, b.url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req = req.WithContext(b.ctx)
+	if b.etagSupport {
+		if b.etag != "" {
+			req.Header.Set("If-None-Match", b.etag)
+		}
+		if b.lastModified != "" {
+			req.Header.Set("If-Modified-Since", b.lastModified)
+		}
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, false, errors.New(ErrHTTPStatus, errorMessages, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	if b.etagSupport {
+		b.etag = resp.Header.Get("ETag")
+		b.lastModified = resp.Header.Get("Last-Modified")
+	}
+	if b.last != nil && bytes.Equal(body, b.last) {
+		return nil, false, nil
+	}
+	b.last = body
+	return body, true, nil
+}
+
+// EOF
@@ -0,0 +1,88 @@
+// Tideland Go Cells - Behaviors - Unit Tests - HTTP Poll Source
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestHTTPPollSourceBehavior tests polling an URL and emitting changes.
+func TestHTTPPollSourceBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("http-poll-source-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	requests := 0
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		etag := `"v1"`
+		body := "first"
+		if requests > 3 {
+			etag = `"v2"`
+			body = "second"
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.StartCell("poll", behaviors.NewHTTPPollSourceBehavior(server.URL, 10*time.Millisecond, nil, true))
+	env.Subscribe("poll", "collector")
+
+	var bodies []string
+	for i := 0; i < 100 && len(bodies) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		err := env.Barrier(context.Background(), "poll", "collector")
+		assert.Nil(err)
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		bodies = nil
+		accessor.Do(func(index int, event cells.Event) error {
+			assert.Equal(event.Topic(), behaviors.TopicHTTPPollChange)
+			assert.Equal(event.Payload().GetString(behaviors.PayloadHTTPPollURL, ""), server.URL)
+			bodies = append(bodies, event.Payload().GetString(behaviors.PayloadHTTPPollBody, ""))
+			return nil
+		})
+	}
+	assert.Equal(bodies, []string{"first", "second"})
+	env.StopCell("poll")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.True(notModified >= 2)
+}
+
+// EOF
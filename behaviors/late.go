@@ -0,0 +1,112 @@
+// Tideland Go Cells - Behaviors - Late Events
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicLateEvent labels an event emitted for a late event
+	// with the policy LateEmitSeparately.
+	TopicLateEvent = "late-event"
+
+	// PayloadLateTopic contains the topic of the late event.
+	PayloadLateTopic = "late:topic"
+
+	// PayloadLateTime contains the event time of the late event.
+	PayloadLateTime = "late:time"
+
+	// PayloadLatePayload contains the payload of the late event.
+	PayloadLatePayload = "late:payload"
+
+	// PayloadLateCount contains the number of late events in the
+	// status of windowed behaviors.
+	PayloadLateCount = "late:count"
+)
+
+//--------------------
+// LATE POLICY
+//--------------------
+
+// LatePolicy decides what windowed behaviors do with events arriving
+// after their window moved on, e.g. when backfilled out of order.
+type LatePolicy int
+
+const (
+	// LateRecomputeWindow inserts late events in the order of their
+	// event time and computes the window again. It is the default.
+	LateRecomputeWindow LatePolicy = iota
+
+	// LateDrop ignores late events.
+	LateDrop
+
+	// LateEmitSeparately doesn't add late events to the window but
+	// emits them with the topic "late-event" to the subscribers.
+	LateEmitSeparately
+)
+
+// WithLatePolicy sets the policy for late events of windowed behaviors.
+func WithLatePolicy(policy LatePolicy) Option {
+	return func(o *options) {
+		o.latePolicy = policy
+	}
+}
+
+// lateEvents applies the late policy and counts the late events.
+type lateEvents struct {
+	count int
+}
+
+// handle checks if an event with the event time is late compared to
+// the newest one of the window. It returns true if the event has to
+// be inserted into the window and processed.
+func (l *lateEvents) handle(c cells.Cell, o *options, event cells.Event, t, newest time.Time) (bool, error) {
+	if !t.Before(newest) {
+		return true, nil
+	}
+	l.count++
+	switch o.latePolicy {
+	case LateDrop:
+		logger.Debugf("cell '%s' drops late event '%s'", c.ID(), event.Topic())
+		return false, nil
+	case LateEmitSeparately:
+		return false, c.EmitNew(event.Context(), o.topic(TopicLateEvent), o.payload(cells.PayloadValues{
+			PayloadLateTopic:   event.Topic(),
+			PayloadLateTime:    t,
+			PayloadLatePayload: event.Payload(),
+		}))
+	}
+	return true, nil
+}
+
+// status answers a status request with the number of late events.
+func (l *lateEvents) status(c cells.Cell, event cells.Event) {
+	payload, ok := cells.HasWaiterPayload(event)
+	if !ok {
+		logger.Warningf("retrieving status from '%s' not possible without payload waiter", c.ID())
+		return
+	}
+	payload.GetWaiter().Set(cells.PayloadValues{
+		PayloadLateCount: l.count,
+	})
+}
+
+// EOF
@@ -0,0 +1,178 @@
+// Tideland Go Cells - Behaviors - Load Balancer
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// STRATEGIES
+//--------------------
+
+// Strategy selects the target cell out of the passed ones for an
+// event. The environment can be queried for details about the
+// targets. Strategies may keep a state, so each load balancer
+// needs its own one.
+type Strategy func(env cells.Environment, targets []string, event cells.Event) (string, error)
+
+// RoundRobinStrategy selects the targets one after another.
+func RoundRobinStrategy() Strategy {
+	var mutex sync.Mutex
+	next := 0
+	return func(env cells.Environment, targets []string, event cells.Event) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		target := targets[next%len(targets)]
+		next = (next + 1) % len(targets)
+		return target, nil
+	}
+}
+
+// WeightedStrategy selects the targets round robin according to
+// their weights. A target with weight 3 receives three times more
+// events than one with weight 1. Targets without a weight have the
+// weight 1. The selection is smoothed, so heavy targets don't get
+// bursts of events.
+func WeightedStrategy(weights map[string]int) Strategy {
+	var mutex sync.Mutex
+	current := make(map[string]int)
+	return func(env cells.Environment, targets []string, event cells.Event) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		total := 0
+		selected := ""
+		for _, target := range targets {
+			weight, ok := weights[target]
+			if !ok || weight < 1 {
+				weight = 1
+			}
+			total += weight
+			current[target] += weight
+			if selected == "" || current[target] > current[selected] {
+				selected = target
+			}
+		}
+		current[selected] -= total
+		return selected, nil
+	}
+}
+
+// LeastQueueStrategy selects the target with the smallest number
+// of queued events. Targets with equal queue depths are selected
+// in turns.
+func LeastQueueStrategy() Strategy {
+	var mutex sync.Mutex
+	start := 0
+	return func(env cells.Environment, targets []string, event cells.Event) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		selected := ""
+		least := 0
+		for i := range targets {
+			target := targets[(start+i)%len(targets)]
+			depth, err := env.QueueDepth(target)
+			if err != nil {
+				return "", err
+			}
+			if selected == "" || depth < least {
+				selected = target
+				least = depth
+			}
+		}
+		start = (start + 1) % len(targets)
+		return selected, nil
+	}
+}
+
+// StickyStrategy selects the target by the key of the event, so
+// all events with the same key are processed by the same target.
+// Changing the targets only moves the keys of the changed ones.
+func StickyStrategy(key func(event cells.Event) string) Strategy {
+	return func(env cells.Environment, targets []string, event cells.Event) (string, error) {
+		k := key(event)
+		selected := ""
+		var highest uint64
+		for _, target := range targets {
+			h := fnv.New64a()
+			h.Write([]byte(target))
+			h.Write([]byte{0})
+			h.Write([]byte(k))
+			if score := h.Sum64(); selected == "" || score > highest {
+				selected = target
+				highest = score
+			}
+		}
+		return selected, nil
+	}
+}
+
+//--------------------
+// LOAD BALANCER BEHAVIOR
+//--------------------
+
+// loadBalancerBehavior distributes events over a pool of cells.
+type loadBalancerBehavior struct {
+	cell     cells.Cell
+	targets  []string
+	strategy Strategy
+}
+
+// NewLoadBalancerBehavior creates a behavior emitting each received
+// event to one of the target cells, selected by the strategy. So work
+// can be spread over a pool of identical worker cells. If no strategy
+// is passed round robin is used.
+func NewLoadBalancerBehavior(targets []string, strategy Strategy) cells.Behavior {
+	if strategy == nil {
+		strategy = RoundRobinStrategy()
+	}
+	return &loadBalancerBehavior{
+		targets:  append([]string{}, targets...),
+		strategy: strategy,
+	}
+}
+
+// Init the behavior.
+func (b *loadBalancerBehavior) Init(c cells.Cell) error {
+	if len(b.targets) == 0 {
+		return errors.New(ErrNoTargets, errorMessages, c.ID())
+	}
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *loadBalancerBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent emits the event to the selected target.
+func (b *loadBalancerBehavior) ProcessEvent(event cells.Event) error {
+	env := b.cell.Environment()
+	target, err := b.strategy(env, b.targets, event)
+	if err != nil {
+		return err
+	}
+	return env.Emit(target, event)
+}
+
+// Recover from an error.
+func (b *loadBalancerBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// EOF
@@ -0,0 +1,94 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Load Balancer
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestLoadBalancerBehavior tests the load balancer behavior
+// with the different strategies.
+func TestLoadBalancerBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	workers := []string{"w1", "w2", "w3"}
+	key := func(event cells.Event) string {
+		return event.Payload().GetString("key", "")
+	}
+	tests := []struct {
+		name     string
+		strategy behaviors.Strategy
+		expected []int
+	}{
+		{"round-robin", behaviors.RoundRobinStrategy(), []int{4, 4, 4}},
+		{"weighted", behaviors.WeightedStrategy(map[string]int{"w1": 4, "w3": 1}), []int{8, 2, 2}},
+		{"least-queue", behaviors.LeastQueueStrategy(), nil},
+		{"sticky", behaviors.StickyStrategy(key), nil},
+	}
+	for _, test := range tests {
+		assert.Logf("strategy %s", test.name)
+		env := cells.NewEnvironment("load-balancer-behavior", test.name)
+		for _, worker := range workers {
+			env.StartCell(worker, behaviors.NewCollectorBehavior(100))
+		}
+		env.StartCell("balancer", behaviors.NewLoadBalancerBehavior(workers, test.strategy))
+
+		for i := 0; i < 12; i++ {
+			env.EmitNew(context.Background(), "balancer", "work", cells.PayloadValues{
+				"key": fmt.Sprintf("key-%d", i%4),
+			})
+		}
+		err := env.Barrier(context.Background())
+		assert.Nil(err)
+
+		total := 0
+		keys := map[string]string{}
+		for i, worker := range workers {
+			accessor, err := behaviors.RequestCollectedAccessor(env, worker, time.Second)
+			assert.Nil(err)
+			total += accessor.Len()
+			if test.expected != nil {
+				assert.Length(accessor, test.expected[i])
+			}
+			accessor.Do(func(index int, event cells.Event) error {
+				k := event.Payload().GetString("key", "")
+				if test.name == "sticky" {
+					if previous, ok := keys[k]; ok {
+						assert.Equal(previous, worker)
+					}
+				}
+				keys[k] = worker
+				return nil
+			})
+		}
+		assert.Equal(total, 12)
+		env.Stop()
+	}
+
+	env := cells.NewEnvironment("load-balancer-behavior", "no-targets")
+	defer env.Stop()
+	err := env.StartCell("balancer", behaviors.NewLoadBalancerBehavior(nil, nil))
+	assert.NotNil(err)
+}
+
+// EOF
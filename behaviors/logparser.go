@@ -0,0 +1,359 @@
+// Tideland Go Cells - Behaviors - Log Parser
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// LogFormat defines the format of the parsed log lines.
+type LogFormat int
+
+const (
+	// LogFormatJSON parses lines containing one JSON object.
+	LogFormatJSON LogFormat = iota
+
+	// LogFormatLogfmt parses lines of key=value pairs.
+	LogFormatLogfmt
+
+	// LogFormatCommon parses lines of the Common Log Format
+	// of web servers.
+	LogFormatCommon
+
+	// LogFormatCombined parses lines of the Combined Log Format,
+	// the Common Log Format with referer and user agent.
+	LogFormatCombined
+)
+
+const (
+	// TopicLogEntry labels a parsed log line.
+	TopicLogEntry = "log-entry"
+
+	// PayloadLogLevel contains the lowercase level of the entry.
+	PayloadLogLevel = "log:level"
+
+	// PayloadLogMessage contains the message of the entry.
+	PayloadLogMessage = "log:message"
+
+	// PayloadLogTimestamp contains the time of the entry.
+	PayloadLogTimestamp = "log:timestamp"
+
+	// PayloadLogFields contains all further values of the entry
+	// as map[string]interface{}.
+	PayloadLogFields = "log:fields"
+
+	// defaultLogLevel is the level of entries without one.
+	defaultLogLevel = "info"
+
+	// accessLogTimeLayout is the time layout of access logs.
+	accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+var (
+	// logLevelKeys, logMessageKeys, and logTimeKeys are the
+	// keys looked for in JSON and logfmt lines.
+	logLevelKeys   = []string{"level", "lvl", "severity"}
+	logMessageKeys = []string{"msg", "message"}
+	logTimeKeys    = []string{"time", "ts", "timestamp", "@timestamp"}
+
+	// commonLogRegexp and combinedLogRegexp match lines of
+	// the Common and the Combined Log Format.
+	commonLogRegexp   = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\S+)`)
+	combinedLogRegexp = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\S+) "([^"]*)" "([^"]*)"`)
+)
+
+//--------------------
+// LOG PARSER BEHAVIOR
+//--------------------
+
+// logEntry is a normalized log line.
+type logEntry struct {
+	level     string
+	message   string
+	timestamp time.Time
+	fields    map[string]interface{}
+}
+
+// logParserBehavior parses log lines into events.
+type logParserBehavior struct {
+	cell    cells.Cell
+	format  LogFormat
+	options *options
+}
+
+// NewLogParserBehavior creates a behavior parsing the log lines
+// contained as string in the default payload of received events, e.g.
+// emitted by a reader source. Each line is emitted normalized with the
+// topic "log-entry" and its level, message, timestamp, and further
+// fields. JSON and logfmt lines use the usual keys like "level" or
+// "lvl", "msg" or "message", and "time" or "ts". Access logs get the
+// request as message and a level by their status. Lines without a
+// timestamp get the time of the event. Lines which cannot be parsed
+// are logged and skipped. The emitted topic and the payload keys can
+// be changed by options.
+func NewLogParserBehavior(format LogFormat, opts ...Option) cells.Behavior {
+	return &logParserBehavior{
+		format:  format,
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *logParserBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *logParserBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent parses the line and emits the entry.
+func (b *logParserBehavior) ProcessEvent(event cells.Event) error {
+	line, ok := event.Payload().GetDefault(nil).(string)
+	if !ok {
+		return nil
+	}
+	var entry *logEntry
+	var err error
+	switch b.format {
+	case LogFormatJSON:
+		entry, err = parseJSONLogLine(line)
+	case LogFormatLogfmt:
+		entry, err = parseLogfmtLine(line)
+	default:
+		entry, err = parseAccessLogLine(line, b.format == LogFormatCombined)
+	}
+	if err != nil {
+		logger.Warningf("log parser %q cannot parse line %q: %v", b.cell.ID(), line, err)
+		return nil
+	}
+	if entry.timestamp.IsZero() {
+		entry.timestamp = b.options.eventTime(event)
+	}
+	return b.cell.EmitNew(event.Context(), b.options.topic(TopicLogEntry), b.options.payload(cells.PayloadValues{
+		PayloadLogLevel:     entry.level,
+		PayloadLogMessage:   entry.message,
+		PayloadLogTimestamp: entry.timestamp,
+		PayloadLogFields:    entry.fields,
+	}))
+}
+
+// Recover from an error.
+func (b *logParserBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+//--------------------
+// PARSERS
+//--------------------
+
+// parseJSONLogLine parses a line containing a JSON object.
+func parseJSONLogLine(line string) (*logEntry, error) {
+	fields := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				fields[key] = i
+			} else {
+				fields[key], _ = n.Float64()
+			}
+		}
+	}
+	return normalizeLogFields(fields), nil
+}
+
+// parseLogfmtLine parses a line of key=value pairs. Values
+// can be quoted, keys without values are true.
+func parseLogfmtLine(line string) (*logEntry, error) {
+	fields := make(map[string]interface{})
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		end := strings.IndexAny(rest, "= ")
+		if end < 0 {
+			fields[rest] = true
+			break
+		}
+		key := rest[:end]
+		if key == "" {
+			return nil, fmt.Errorf("missing key at %q", rest)
+		}
+		if rest[end] == ' ' {
+			fields[key] = true
+			rest = strings.TrimLeft(rest[end:], " ")
+			continue
+		}
+		rest = rest[end+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] == '\\' {
+					i++
+					continue
+				}
+				if rest[i] == '"' {
+					break
+				}
+			}
+			if i >= len(rest) {
+				return nil, fmt.Errorf("unterminated value of %q", key)
+			}
+			unquoted, err := strconv.Unquote(rest[:i+1])
+			if err != nil {
+				return nil, err
+			}
+			value = unquoted
+			rest = rest[i+1:]
+		} else {
+			end = strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+		fields[key] = value
+		rest = strings.TrimLeft(rest, " ")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty line")
+	}
+	return normalizeLogFields(fields), nil
+}
+
+// parseAccessLogLine parses a line of the Common or the
+// Combined Log Format.
+func parseAccessLogLine(line string, combined bool) (*logEntry, error) {
+	re := commonLogRegexp
+	if combined {
+		re = combinedLogRegexp
+	}
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("no access log line")
+	}
+	timestamp, err := time.Parse(accessLogTimeLayout, match[4])
+	if err != nil {
+		return nil, err
+	}
+	status, _ := strconv.Atoi(match[6])
+	fields := map[string]interface{}{
+		"remote_host": match[1],
+		"ident":       match[2],
+		"user":        match[3],
+		"status":      status,
+	}
+	if size, err := strconv.Atoi(match[7]); err == nil {
+		fields["size"] = size
+	}
+	if request := strings.Fields(match[5]); len(request) == 3 {
+		fields["method"] = request[0]
+		fields["path"] = request[1]
+		fields["protocol"] = request[2]
+	}
+	if combined {
+		fields["referer"] = match[8]
+		fields["user_agent"] = match[9]
+	}
+	level := defaultLogLevel
+	switch {
+	case status >= 500:
+		level = "error"
+	case status >= 400:
+		level = "warning"
+	}
+	return &logEntry{
+		level:     level,
+		message:   match[5],
+		timestamp: timestamp,
+		fields:    fields,
+	}, nil
+}
+
+// normalizeLogFields moves level, message, and timestamp out
+// of the fields.
+func normalizeLogFields(fields map[string]interface{}) *logEntry {
+	entry := &logEntry{
+		level:  defaultLogLevel,
+		fields: fields,
+	}
+	if key, ok := firstLogKey(fields, logLevelKeys); ok {
+		entry.level = strings.ToLower(fmt.Sprintf("%v", fields[key]))
+		delete(fields, key)
+	}
+	if key, ok := firstLogKey(fields, logMessageKeys); ok {
+		entry.message = fmt.Sprintf("%v", fields[key])
+		delete(fields, key)
+	}
+	if key, ok := firstLogKey(fields, logTimeKeys); ok {
+		if timestamp, ok := parseLogTime(fields[key]); ok {
+			entry.timestamp = timestamp
+			delete(fields, key)
+		}
+	}
+	return entry
+}
+
+// firstLogKey returns the first of the keys contained in the fields.
+func firstLogKey(fields map[string]interface{}, keys []string) (string, bool) {
+	for _, key := range keys {
+		if _, ok := fields[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// parseLogTime parses RFC 3339 strings and Unix seconds.
+func parseLogTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixLogTime(f), true
+		}
+	case int64:
+		return time.Unix(v, 0).UTC(), true
+	case float64:
+		return unixLogTime(v), true
+	}
+	return time.Time{}, false
+}
+
+// unixLogTime converts Unix seconds with fraction into a time.
+func unixLogTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+}
+
+// EOF
@@ -0,0 +1,112 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Log Parser
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestLogParserBehavior tests parsing log lines of the
+// different formats.
+func TestLogParserBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("log-parser-behavior")
+	defer env.Stop()
+
+	parse := func(format behaviors.LogFormat, lines ...string) []cells.Payload {
+		env.StartCell("parser", behaviors.NewLogParserBehavior(format))
+		env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+		env.Subscribe("parser", "collector")
+		defer env.StopCell("parser")
+		defer env.StopCell("collector")
+		for _, line := range lines {
+			env.EmitNew(ctx, "parser", behaviors.TopicLine, line)
+		}
+		assert.Nil(env.Barrier(ctx, "parser", "collector"))
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		var payloads []cells.Payload
+		accessor.Do(func(index int, event cells.Event) error {
+			assert.Equal(event.Topic(), behaviors.TopicLogEntry)
+			payloads = append(payloads, event.Payload())
+			return nil
+		})
+		return payloads
+	}
+	fields := func(payload cells.Payload) map[string]interface{} {
+		fs, ok := payload.Get(behaviors.PayloadLogFields, nil).(map[string]interface{})
+		assert.True(ok)
+		return fs
+	}
+
+	// JSON lines.
+	payloads := parse(behaviors.LogFormatJSON,
+		`{"level":"WARN","msg":"disk almost full","time":"2017-10-01T12:00:00Z","disk":"/dev/sda","used":97}`,
+		`no json`,
+		`{"message":"started","ts":1506859200.5}`,
+	)
+	assert.Length(payloads, 2)
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogLevel, ""), "warn")
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogMessage, ""), "disk almost full")
+	assert.Equal(payloads[0].GetTime(behaviors.PayloadLogTimestamp, time.Time{}), time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(fields(payloads[0]), map[string]interface{}{"disk": "/dev/sda", "used": int64(97)})
+	assert.Equal(payloads[1].GetString(behaviors.PayloadLogLevel, ""), "info")
+	assert.Equal(payloads[1].GetTime(behaviors.PayloadLogTimestamp, time.Time{}), time.Date(2017, time.October, 1, 12, 0, 0, 500000000, time.UTC))
+
+	// Logfmt lines.
+	payloads = parse(behaviors.LogFormatLogfmt,
+		`level=error msg="cannot connect \"db\"" host=db1 retry`,
+		`msg="unterminated`,
+	)
+	assert.Length(payloads, 1)
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogLevel, ""), "error")
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogMessage, ""), `cannot connect "db"`)
+	assert.False(payloads[0].GetTime(behaviors.PayloadLogTimestamp, time.Time{}).IsZero())
+	assert.Equal(fields(payloads[0]), map[string]interface{}{"host": "db1", "retry": true})
+
+	// Access log lines.
+	common := `127.0.0.1 - frank [10/Oct/2017:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326`
+	combined := `10.0.0.1 - - [10/Oct/2017:13:55:36 -0700] "POST /api HTTP/1.1" 503 - "" "curl/7.55"`
+	payloads = parse(behaviors.LogFormatCommon, common, "garbage")
+	assert.Length(payloads, 1)
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogLevel, ""), "info")
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogMessage, ""), "GET /index.html HTTP/1.0")
+	assert.Equal(payloads[0].GetTime(behaviors.PayloadLogTimestamp, time.Time{}).UTC(), time.Date(2017, time.October, 10, 20, 55, 36, 0, time.UTC))
+	fs := fields(payloads[0])
+	assert.Equal(fs["user"], "frank")
+	assert.Equal(fs["path"], "/index.html")
+	assert.Equal(fs["status"], 200)
+	assert.Equal(fs["size"], 2326)
+
+	payloads = parse(behaviors.LogFormatCombined, combined, common)
+	assert.Length(payloads, 1)
+	assert.Equal(payloads[0].GetString(behaviors.PayloadLogLevel, ""), "error")
+	fs = fields(payloads[0])
+	assert.Equal(fs["method"], "POST")
+	assert.Equal(fs["referer"], "")
+	assert.Equal(fs["user_agent"], "curl/7.55")
+	assert.Nil(fs["size"])
+}
+
+// EOF
@@ -0,0 +1,169 @@
+// Tideland Go Cells - Behaviors - Moving Statistics
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicMovingStats labels an event as emitted moving statistics.
+	TopicMovingStats = "moving-stats"
+
+	// PayloadMovingStatsCount contains the number of values in the window.
+	PayloadMovingStatsCount = "moving-stats:count"
+
+	// PayloadMovingStatsAverage contains the average of the values.
+	PayloadMovingStatsAverage = "moving-stats:average"
+
+	// PayloadMovingStatsVariance contains the variance of the values.
+	PayloadMovingStatsVariance = "moving-stats:variance"
+
+	// PayloadMovingStatsMin contains the minimum of the values.
+	PayloadMovingStatsMin = "moving-stats:min"
+
+	// PayloadMovingStatsMax contains the maximum of the values.
+	PayloadMovingStatsMax = "moving-stats:max"
+
+	// PayloadMovingStatsRate contains the change between the oldest and
+	// the newest value per second.
+	PayloadMovingStatsRate = "moving-stats:rate"
+)
+
+//--------------------
+// MOVING STATS BEHAVIOR
+//--------------------
+
+// movingStatsBehavior implements the moving stats behavior.
+type movingStatsBehavior struct {
+	cell       cells.Cell
+	extract    Evaluator
+	size       int
+	values     *window.Window
+	emitted    bool
+	emittedAvg float64
+	late       lateEvents
+	options    *options
+}
+
+// NewMovingStatsBehavior creates a behavior maintaining the average,
+// variance, minimum, maximum, and rate of change of the last size
+// values extracted out of the received events. The statistics are
+// emitted with each event. With the option WithMinChange() they are
+// only emitted if the average changed more than the delta. A "reset!"
+// topic clears the window. Backfilled events are measured by their
+// event time, events older than the newest value are handled by the
+// late policy set with WithLatePolicy(). Their number is part of the
+// status. The emitted topic and the payload keys can be changed by
+// options.
+func NewMovingStatsBehavior(extract Evaluator, size int, opts ...Option) cells.Behavior {
+	if size < 1 {
+		size = 1
+	}
+	return &movingStatsBehavior{
+		extract: extract,
+		size:    size,
+		values:  window.New(0, size),
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *movingStatsBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *movingStatsBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent adds the value of the event to the window.
+func (b *movingStatsBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case cells.TopicReset:
+		b.reset()
+	case cells.TopicStatus:
+		b.late.status(b.cell, event)
+	default:
+		value, err := b.extract(event)
+		if err != nil {
+			return err
+		}
+		current := b.options.eventTime(event)
+		if newest, ok := b.values.Last(); ok {
+			insert, err := b.late.handle(b.cell, b.options, event, current, newest.Time)
+			if !insert {
+				return err
+			}
+		}
+		b.values.Insert(current, value)
+		// Calculate and emit the statistics.
+		stats := b.values.Stats()
+		oldest, _ := b.values.First()
+		newest, _ := b.values.Last()
+		rate := 0.0
+		if elapsed := newest.Time.Sub(oldest.Time).Seconds(); elapsed > 0 {
+			rate = (newest.Value - oldest.Value) / elapsed
+		}
+		if b.options.minChange > 0 && b.emitted && math.Abs(stats.Average-b.emittedAvg) <= b.options.minChange {
+			return nil
+		}
+		b.emitted = true
+		b.emittedAvg = stats.Average
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicMovingStats), b.options.payload(cells.PayloadValues{
+			PayloadMovingStatsCount:    stats.Count,
+			PayloadMovingStatsAverage:  stats.Average,
+			PayloadMovingStatsVariance: stats.Variance,
+			PayloadMovingStatsMin:      stats.Min,
+			PayloadMovingStatsMax:      stats.Max,
+			PayloadMovingStatsRate:     rate,
+		}))
+	}
+	return nil
+}
+
+// Configure changes the number of values the statistics are
+// calculated of with "config:size".
+func (b *movingStatsBehavior) Configure(config cells.Payload) error {
+	size, err := configInt(b.cell, config, PayloadConfigSize, b.size)
+	if err != nil {
+		return err
+	}
+	if size != b.size {
+		b.size = size
+		b.values = resizeWindow(b.values, 0, size)
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *movingStatsBehavior) Recover(err interface{}) error {
+	b.reset()
+	return nil
+}
+
+// reset clears the window.
+func (b *movingStatsBehavior) reset() {
+	b.values.Reset()
+	b.emitted = false
+}
+
+// EOF
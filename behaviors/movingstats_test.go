@@ -0,0 +1,103 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Moving Statistics
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestMovingStatsBehavior tests the moving statistics behavior.
+func TestMovingStatsBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("moving-stats-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+	extract := func(event cells.Event) (float64, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0), nil
+	}
+
+	env.StartCell("stats", behaviors.NewMovingStatsBehavior(extract, 3, behaviors.WithClock(clock)))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("stats", "collector")
+
+	for _, value := range []float64{2, 4, 6, 8} {
+		env.EmitNew(context.Background(), "stats", "value", value)
+	}
+	err := env.Barrier(context.Background(), "stats", "collector")
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 4)
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	pl := last.Payload()
+	assert.Equal(pl.GetInt(behaviors.PayloadMovingStatsCount, 0), 3)
+	assert.Equal(pl.GetFloat64(behaviors.PayloadMovingStatsAverage, 0), 6.0)
+	assert.About(pl.GetFloat64(behaviors.PayloadMovingStatsVariance, 0), 8.0/3.0, 0.0001)
+	assert.Equal(pl.GetFloat64(behaviors.PayloadMovingStatsMin, 0), 4.0)
+	assert.Equal(pl.GetFloat64(behaviors.PayloadMovingStatsMax, 0), 8.0)
+	assert.Equal(pl.GetFloat64(behaviors.PayloadMovingStatsRate, 0), 2.0)
+}
+
+// TestMovingStatsBehaviorMinChange tests emitting only on changes
+// beyond a delta.
+func TestMovingStatsBehaviorMinChange(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("moving-stats-behavior-min-change")
+	defer env.Stop()
+
+	extract := func(event cells.Event) (float64, error) {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0), nil
+	}
+
+	env.StartCell("stats", behaviors.NewMovingStatsBehavior(extract, 2, behaviors.WithMinChange(1.0)))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("stats", "collector")
+
+	for _, value := range []float64{10, 10.5, 11, 14, 14} {
+		env.EmitNew(context.Background(), "stats", "value", value)
+	}
+	err := env.Barrier(context.Background(), "stats", "collector")
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	averages := []float64{}
+	accessor.Do(func(index int, event cells.Event) error {
+		averages = append(averages, event.Payload().GetFloat64(behaviors.PayloadMovingStatsAverage, 0))
+		return nil
+	})
+	assert.Equal(averages, []float64{10, 12.5, 14})
+}
+
+// EOF
@@ -0,0 +1,307 @@
+// Tideland Go Cells - Behaviors - Notifier
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// PagerDutyEventsURL is the standard endpoint of the
+	// PagerDuty Events API v2.
+	PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	// defaultNotifierRateLimit and defaultNotifierRatePeriod limit
+	// the number of notifications if not configured otherwise.
+	defaultNotifierRateLimit  = 10
+	defaultNotifierRatePeriod = time.Minute
+
+	// defaultNotifierDedupWindow is the duration identical messages
+	// are suppressed if not configured otherwise.
+	defaultNotifierDedupWindow = 5 * time.Minute
+
+	// notifierTimeout is the timeout of the external calls.
+	notifierTimeout = 10 * time.Second
+)
+
+//--------------------
+// NOTIFIER BEHAVIOR
+//--------------------
+
+// Notification is passed to the templates of the notifiers.
+type Notification struct {
+	Topic   string
+	Time    time.Time
+	Emitter string
+	Payload cells.PayloadValues
+}
+
+// Message is a rendered notification.
+type Message struct {
+	// Source is the ID of the notifier cell.
+	Source string
+
+	// Key identifies identical messages.
+	Key string
+
+	Subject string
+	Text    string
+}
+
+// NotifyFunc sends a rendered notification.
+type NotifyFunc func(ctx context.Context, msg Message) error
+
+// notifierBehavior renders notifications for the received events
+// and sends them rate limited and deduplicated.
+type notifierBehavior struct {
+	cell       cells.Cell
+	notify     NotifyFunc
+	subject    *template.Template
+	message    *template.Template
+	err        error
+	sent       []time.Time
+	seen       map[string]time.Time
+	suppressed int
+	options    *options
+}
+
+// NewNotifierBehavior creates a behavior rendering the subject and
+// the message templates with a Notification for each received event
+// and passing them to the notify function. Identical messages are
+// sent only once per dedup window, by default 5 minutes, and at most
+// 10 notifications per minute. Both can be changed with the options
+// WithDedupWindow() and WithRateLimit(), the clock with WithClock().
+// Invalid templates let the start of the cell fail, errors of the
+// notify function are returned.
+func NewNotifierBehavior(notify NotifyFunc, subject, message string, opts ...Option) cells.Behavior {
+	b := &notifierBehavior{
+		notify:  notify,
+		seen:    make(map[string]time.Time),
+		options: newOptions(opts...),
+	}
+	if b.options.rateLimit == 0 {
+		b.options.rateLimit = defaultNotifierRateLimit
+		b.options.ratePeriod = defaultNotifierRatePeriod
+	}
+	if b.options.dedupWindow == 0 {
+		b.options.dedupWindow = defaultNotifierDedupWindow
+	}
+	b.subject, b.err = template.New("subject").Parse(subject)
+	if b.err == nil {
+		b.message, b.err = template.New("message").Parse(message)
+	}
+	return b
+}
+
+// Init the behavior.
+func (b *notifierBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	if b.err != nil {
+		return errors.Annotate(b.err, ErrInvalidConfiguration, errorMessages, c.ID(), "invalid template")
+	}
+	return nil
+}
+
+// Terminate the behavior.
+func (b *notifierBehavior) Terminate() error {
+	if b.suppressed > 0 {
+		logger.Infof("notifier '%s' suppressed %d notifications", b.cell.ID(), b.suppressed)
+	}
+	return nil
+}
+
+// ProcessEvent renders and sends the notification of the event.
+func (b *notifierBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() == cells.TopicReset {
+		b.sent = nil
+		b.seen = make(map[string]time.Time)
+		return nil
+	}
+	notification := Notification{
+		Topic:   event.Topic(),
+		Time:    event.Timestamp(),
+		Emitter: event.Emitter(),
+		Payload: cells.PayloadValues{},
+	}
+	event.Payload().Do(func(key string, value interface{}) error {
+		notification.Payload[key] = value
+		return nil
+	})
+	var subject, message bytes.Buffer
+	if err := b.subject.Execute(&subject, notification); err != nil {
+		return errors.Annotate(err, ErrNotify, errorMessages, b.cell.ID())
+	}
+	if err := b.message.Execute(&message, notification); err != nil {
+		return errors.Annotate(err, ErrNotify, errorMessages, b.cell.ID())
+	}
+	hash := sha1.Sum([]byte(subject.String() + "\n" + message.String()))
+	key := hex.EncodeToString(hash[:])
+	if !b.admit(key) {
+		b.suppressed++
+		return nil
+	}
+	err := b.cell.InFlight(event.Context(), func() error {
+		ctx, cancel := context.WithTimeout(event.Context(), notifierTimeout)
+		defer cancel()
+		return b.notify(ctx, Message{
+			Source:  b.cell.ID(),
+			Key:     key,
+			Subject: subject.String(),
+			Text:    message.String(),
+		})
+	})
+	if err != nil {
+		return errors.Annotate(err, ErrNotify, errorMessages, b.cell.ID())
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *notifierBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// admit checks if a message with the key may be sent now
+// and records it.
+func (b *notifierBehavior) admit(key string) bool {
+	now := b.options.now()
+	for k, t := range b.seen {
+		if now.Sub(t) >= b.options.dedupWindow {
+			delete(b.seen, k)
+		}
+	}
+	if _, ok := b.seen[key]; ok {
+		return false
+	}
+	i := 0
+	for i < len(b.sent) && now.Sub(b.sent[i]) >= b.options.ratePeriod {
+		i++
+	}
+	b.sent = b.sent[i:]
+	if len(b.sent) >= b.options.rateLimit {
+		return false
+	}
+	b.sent = append(b.sent, now)
+	b.seen[key] = now
+	return true
+}
+
+//--------------------
+// SINKS
+//--------------------
+
+// NewSlackSinkBehavior creates a notifier posting the message rendered
+// with the template to the Slack incoming webhook.
+func NewSlackSinkBehavior(webhook, message string, opts ...Option) cells.Behavior {
+	client := &http.Client{}
+	notify := func(ctx context.Context, msg Message) error {
+		return postJSON(ctx, client, webhook, map[string]string{
+			"text": msg.Text,
+		})
+	}
+	return NewNotifierBehavior(notify, "", message, opts...)
+}
+
+// SMTPServer describes the mail server used by the SMTP sink.
+type SMTPServer struct {
+	Addr string
+	Auth smtp.Auth
+}
+
+// headerReplacer removes line breaks from rendered mail headers.
+var headerReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// NewSMTPSinkBehavior creates a notifier sending mails with the
+// subject and the message rendered with the templates to the
+// recipients.
+func NewSMTPSinkBehavior(server SMTPServer, from string, to []string, subject, message string, opts ...Option) cells.Behavior {
+	notify := func(ctx context.Context, msg Message) error {
+		var mail bytes.Buffer
+		fmt.Fprintf(&mail, "From: %s\r\n", from)
+		fmt.Fprintf(&mail, "To: %s\r\n", strings.Join(to, ", "))
+		fmt.Fprintf(&mail, "Subject: %s\r\n", headerReplacer.Replace(msg.Subject))
+		fmt.Fprintf(&mail, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		mail.WriteString(msg.Text)
+		return smtp.SendMail(server.Addr, server.Auth, from, to, mail.Bytes())
+	}
+	return NewNotifierBehavior(notify, subject, message, opts...)
+}
+
+// NewPagerDutySinkBehavior creates a notifier triggering PagerDuty
+// incidents with the message rendered with the template as summary.
+// The severity is one of "critical", "error", "warning", or "info".
+// Identical messages share the dedup key, so PagerDuty groups them
+// too. The endpoint can be changed with WithEndpoint().
+func NewPagerDutySinkBehavior(routingKey, severity, message string, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	endpoint := PagerDutyEventsURL
+	if o.endpoint != "" {
+		endpoint = o.endpoint
+	}
+	client := &http.Client{}
+	notify := func(ctx context.Context, msg Message) error {
+		return postJSON(ctx, client, endpoint, map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "trigger",
+			"dedup_key":    msg.Key,
+			"payload": map[string]string{
+				"summary":  msg.Text,
+				"source":   msg.Source,
+				"severity": severity,
+			},
+		})
+	}
+	return NewNotifierBehavior(notify, "", message, opts...)
+}
+
+// postJSON posts the value as JSON to the URL.
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(ErrHTTPStatus, errorMessages, resp.Status)
+	}
+	return nil
+}
+
+// EOF
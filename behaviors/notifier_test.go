@@ -0,0 +1,136 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Notifier
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSlackSinkBehavior tests the rendering, deduplication, and
+// rate limiting of notifications.
+func TestSlackSinkBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("slack-sink-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		texts = append(texts, body["text"])
+	}))
+	defer server.Close()
+	received := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, texts...)
+	}
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+
+	env.StartCell("slack", behaviors.NewSlackSinkBehavior(server.URL,
+		"{{.Topic}}: {{.Payload.host}} is down",
+		behaviors.WithClock(clock),
+		behaviors.WithRateLimit(2, time.Minute),
+		behaviors.WithDedupWindow(10*time.Minute),
+	))
+
+	// Identical alerts are sent once.
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "a"})
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "a"})
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(received(), []string{"alert: a is down"})
+
+	// No more than the rate limit.
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "b"})
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "c"})
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(received(), []string{"alert: a is down", "alert: b is down"})
+
+	// Limits end after their periods.
+	advance(time.Minute)
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "a"})
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "c"})
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(received(), []string{"alert: a is down", "alert: b is down", "alert: c is down"})
+	advance(10 * time.Minute)
+	env.EmitNew(ctx, "slack", "alert", cells.PayloadValues{"host": "a"})
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(received(), 4)
+
+	// Invalid templates let the start fail.
+	err := env.StartCell("invalid", behaviors.NewSlackSinkBehavior(server.URL, "{{.Topic"))
+	assert.ErrorMatch(err, ".*invalid template.*")
+}
+
+// TestPagerDutySinkBehavior tests the triggering of incidents.
+func TestPagerDutySinkBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("pager-duty-sink-behavior")
+	defer env.Stop()
+
+	bodyc := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodyc <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	env.StartCell("pager-duty", behaviors.NewPagerDutySinkBehavior("routing", "critical",
+		"disk of {{.Payload.host}} {{.Payload.usage}}% full",
+		behaviors.WithEndpoint(server.URL),
+	))
+	env.EmitNew(ctx, "pager-duty", "disk", cells.PayloadValues{"host": "db", "usage": 97})
+
+	body := <-bodyc
+	assert.Equal(body["routing_key"], "routing")
+	assert.Equal(body["event_action"], "trigger")
+	assert.Length(body["dedup_key"], 40)
+	assert.Equal(body["payload"], map[string]interface{}{
+		"summary":  "disk of db 97% full",
+		"source":   "pager-duty",
+		"severity": "critical",
+	})
+}
+
+// EOF
@@ -0,0 +1,235 @@
+// Tideland Go Cells - Behaviors - Options
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// Clock returns the current time. It is used by behaviors instead
+// of time.Now() so that the time can be intercepted.
+type Clock func() time.Time
+
+// Option configures a behavior. Options are passed as last
+// arguments to the constructors of those behaviors supporting
+// them.
+type Option func(o *options)
+
+// options contains the configuration of a behavior.
+type options struct {
+	clock       Clock
+	topics      map[string]string
+	payloadKeys map[string]string
+	minChange   float64
+	maxKeys     int
+	cooldown    time.Duration
+	latePolicy  LatePolicy
+	interval    time.Duration
+	bucket      time.Duration
+	rateLimit   int
+	ratePeriod  time.Duration
+	dedupWindow time.Duration
+	endpoint    string
+	maxEvents   int
+	maxAge      time.Duration
+}
+
+// newOptions creates the options of a behavior with the
+// system clock and applies the passed options.
+func newOptions(opts ...Option) *options {
+	o := &options{
+		clock:       time.Now,
+		topics:      make(map[string]string),
+		payloadKeys: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithClock sets the clock used by the behavior.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+// WithEmitTopic replaces the standard topic of events emitted
+// by the behavior with a custom one. So multiple instances of
+// a behavior can be distinguished by their subscribers.
+func WithEmitTopic(topic, custom string) Option {
+	return func(o *options) {
+		o.topics[topic] = custom
+	}
+}
+
+// WithPayloadKeys replaces the standard payload keys of events
+// emitted by the behavior with custom ones. The passed map uses
+// the standard keys as keys and the custom ones as values.
+func WithPayloadKeys(keys map[string]string) Option {
+	return func(o *options) {
+		for key, custom := range keys {
+			o.payloadKeys[key] = custom
+		}
+	}
+}
+
+// WithMinChange lets behaviors emitting continuously updated values
+// only emit them if they changed by more than the passed delta since
+// their last emitting.
+func WithMinChange(delta float64) Option {
+	return func(o *options) {
+		if delta > 0 {
+			o.minChange = delta
+		}
+	}
+}
+
+// WithMaxCardinality limits the number of distinct keys like label
+// sets a behavior tracks. This protects against unbounded memory usage
+// by keys containing for example IDs.
+func WithMaxCardinality(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxKeys = n
+		}
+	}
+}
+
+// WithCooldown sets the minimum duration between two adjustments
+// of a behavior, e.g. of the size of a worker pool.
+func WithCooldown(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.cooldown = d
+		}
+	}
+}
+
+// WithInterval sets the interval of behaviors polling their sources,
+// e.g. of the file watcher.
+func WithInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.interval = d
+		}
+	}
+}
+
+// WithBucket sets the granularity of the buckets behaviors
+// aggregate events in, e.g. the rate behavior.
+func WithBucket(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.bucket = d
+		}
+	}
+}
+
+// WithRateLimit limits the number of actions of a behavior, e.g.
+// sent notifications, to n per period.
+func WithRateLimit(n int, period time.Duration) Option {
+	return func(o *options) {
+		if n > 0 && period > 0 {
+			o.rateLimit = n
+			o.ratePeriod = period
+		}
+	}
+}
+
+// WithDedupWindow sets the duration identical actions of a behavior,
+// e.g. sent notifications, are suppressed.
+func WithDedupWindow(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.dedupWindow = d
+		}
+	}
+}
+
+// WithEndpoint replaces the standard endpoint of behaviors calling
+// external services, e.g. for tests or proxies.
+func WithEndpoint(url string) Option {
+	return func(o *options) {
+		if url != "" {
+			o.endpoint = url
+		}
+	}
+}
+
+// WithMaxEvents limits the number of events a behavior keeps,
+// e.g. the collector. Further events evict the oldest ones.
+func WithMaxEvents(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxEvents = n
+		}
+	}
+}
+
+// WithMaxAge limits the duration a behavior keeps events, e.g.
+// the collector. Older events are evicted.
+func WithMaxAge(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.maxAge = d
+		}
+	}
+}
+
+// now returns the current time of the clock.
+func (o *options) now() time.Time {
+	return o.clock()
+}
+
+// eventTime returns the original event time for backfilled events,
+// otherwise the current time of the clock.
+func (o *options) eventTime(event cells.Event) time.Time {
+	if cells.IsBackfill(event) {
+		return cells.EventTime(event)
+	}
+	return o.clock()
+}
+
+// topic returns the custom topic for a standard one.
+func (o *options) topic(topic string) string {
+	if custom, ok := o.topics[topic]; ok {
+		return custom
+	}
+	return topic
+}
+
+// payload returns the passed payload values with custom keys.
+func (o *options) payload(pvs cells.PayloadValues) cells.PayloadValues {
+	if len(o.payloadKeys) == 0 {
+		return pvs
+	}
+	custom := cells.PayloadValues{}
+	for key, value := range pvs {
+		if customKey, ok := o.payloadKeys[key]; ok {
+			key = customKey
+		}
+		custom[key] = value
+	}
+	return custom
+}
+
+// EOF
@@ -0,0 +1,289 @@
+// Tideland Go Cells - Behaviors - Outbox
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+	"github.com/tideland/golib/loop"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicOutboxPublished signals that an entry of the outbox has
+	// been published and acknowledged.
+	TopicOutboxPublished = "outbox:published"
+
+	// PayloadOutboxID contains the ID of the published entry.
+	PayloadOutboxID = "outbox:id"
+
+	// PayloadOutboxTopic contains the topic of the published entry.
+	PayloadOutboxTopic = "outbox:topic"
+
+	// PayloadOutboxAppended contains the number of appended entries.
+	PayloadOutboxAppended = "outbox:appended"
+
+	// PayloadOutboxPublished contains the number of published entries.
+	PayloadOutboxPublished = "outbox:published"
+
+	// PayloadOutboxFailed contains the number of failed publishings.
+	PayloadOutboxFailed = "outbox:failed"
+
+	// outboxRetryInterval is the time after which the publishing
+	// of still pending entries is retried.
+	outboxRetryInterval = time.Second
+)
+
+//--------------------
+// OUTBOX STORE
+//--------------------
+
+// OutboxEntry is one stored event of the outbox.
+type OutboxEntry struct {
+	ID        uint64
+	Timestamp time.Time
+	Topic     string
+	Payload   cells.PayloadValues
+}
+
+// OutboxStore has to be implemented by the durable storage of the
+// outbox. It is used concurrently by the processing of events and
+// by the publishing, so implementations have to be safe for
+// concurrent use.
+type OutboxStore interface {
+	// Append stores a new entry and returns its ID.
+	Append(entry OutboxEntry) (uint64, error)
+
+	// Pending returns the not yet acknowledged entries in the
+	// order of their appending.
+	Pending() ([]OutboxEntry, error)
+
+	// Ack acknowledges the successful publishing of an entry.
+	Ack(id uint64) error
+}
+
+// memoryOutboxStore implements the OutboxStore interface in memory.
+type memoryOutboxStore struct {
+	mutex   sync.Mutex
+	next    uint64
+	entries []OutboxEntry
+}
+
+// NewMemoryOutboxStore creates an outbox store only keeping the
+// entries in memory. It is not durable and so intended for tests
+// and for outboxes where the loss of entries is acceptable.
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{}
+}
+
+// Append implements the OutboxStore interface.
+func (s *memoryOutboxStore) Append(entry OutboxEntry) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.next++
+	entry.ID = s.next
+	s.entries = append(s.entries, entry)
+	return entry.ID, nil
+}
+
+// Pending implements the OutboxStore interface.
+func (s *memoryOutboxStore) Pending() ([]OutboxEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := make([]OutboxEntry, len(s.entries))
+	copy(entries, s.entries)
+	return entries, nil
+}
+
+// Ack implements the OutboxStore interface.
+func (s *memoryOutboxStore) Ack(id uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, entry := range s.entries {
+		if entry.ID == id {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+//--------------------
+// OUTBOX BEHAVIOR
+//--------------------
+
+// PublishFunc publishes one entry of the outbox. Only if it returns
+// no error the entry is acknowledged, otherwise the publishing is
+// retried later.
+type PublishFunc func(ctx context.Context, entry OutboxEntry) error
+
+// outboxBehavior implements the outbox behavior.
+type outboxBehavior struct {
+	mutex     sync.Mutex
+	cell      cells.Cell
+	store     OutboxStore
+	publish   PublishFunc
+	notifyc   chan struct{}
+	loop      loop.Loop
+	appended  int
+	published int
+	failed    int
+}
+
+// NewOutboxBehavior creates a behavior implementing the transactional
+// outbox pattern. Each received event is first appended to the store.
+// A background loop then publishes the pending entries in the order
+// of their appending using the publish function and acknowledges
+// them afterwards. So publishing happens at least once, also after
+// a restart with pending entries in a durable store. Each acknowledged
+// entry is emitted with the topic "outbox:published". The numbers of
+// appended, published, and failed entries can be retrieved with
+// the topic "status?".
+func NewOutboxBehavior(store OutboxStore, publish PublishFunc) cells.Behavior {
+	return &outboxBehavior{
+		store:   store,
+		publish: publish,
+		notifyc: make(chan struct{}, 1),
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *outboxBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.loop = loop.Go(b.publishLoop)
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *outboxBehavior) Terminate() error {
+	return b.loop.Stop()
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *outboxBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case cells.TopicStatus:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving status from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		b.mutex.Lock()
+		status := cells.PayloadValues{
+			PayloadOutboxAppended:  b.appended,
+			PayloadOutboxPublished: b.published,
+			PayloadOutboxFailed:    b.failed,
+		}
+		b.mutex.Unlock()
+		payload.GetWaiter().Set(status)
+	default:
+		pvs := cells.PayloadValues{}
+		event.Payload().Do(func(key string, value interface{}) error {
+			pvs[key] = value
+			return nil
+		})
+		_, err := b.store.Append(OutboxEntry{
+			Timestamp: event.Timestamp(),
+			Topic:     event.Topic(),
+			Payload:   pvs,
+		})
+		if err != nil {
+			return errors.Annotate(err, ErrOutboxStore, errorMessages, b.cell.ID())
+		}
+		b.mutex.Lock()
+		b.appended++
+		b.mutex.Unlock()
+		select {
+		case b.notifyc <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *outboxBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// publishLoop publishes the pending entries when notified about
+// new ones and retries failed ones in an interval. The context of
+// the publishings is canceled when the loop shall stop, so hanging
+// ones don't block the termination.
+func (b *outboxBehavior) publishLoop(l loop.Loop) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.ShallStop():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case <-b.notifyc:
+			b.publishPending(ctx)
+		case <-ticker.C:
+			b.publishPending(ctx)
+		}
+	}
+}
+
+// publishPending publishes and acknowledges the pending entries
+// until the first failing one or the context is done.
+func (b *outboxBehavior) publishPending(ctx context.Context) {
+	entries, err := b.store.Pending()
+	if err != nil {
+		logger.Errorf("outbox '%s' cannot read pending entries: %v", b.cell.ID(), err)
+		return
+	}
+	for _, entry := range entries {
+		if err := b.publish(ctx, entry); err != nil {
+			if ctx.Err() != nil {
+				// Stopping, the entry stays pending.
+				return
+			}
+			logger.Warningf("outbox '%s' cannot publish entry %d: %v", b.cell.ID(), entry.ID, err)
+			b.mutex.Lock()
+			b.failed++
+			b.mutex.Unlock()
+			return
+		}
+		if err := b.store.Ack(entry.ID); err != nil {
+			logger.Errorf("outbox '%s' cannot acknowledge entry %d: %v", b.cell.ID(), entry.ID, err)
+			return
+		}
+		b.mutex.Lock()
+		b.published++
+		b.mutex.Unlock()
+		b.cell.EmitNew(ctx, TopicOutboxPublished, cells.PayloadValues{
+			PayloadOutboxID:    entry.ID,
+			PayloadOutboxTopic: entry.Topic,
+		})
+	}
+}
+
+// EOF
@@ -0,0 +1,121 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Outbox
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestOutboxBehavior tests the publishing of the outbox behavior
+// including the retry of failed publishings.
+func TestOutboxBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("outbox-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	topics := []string{}
+	failures := 2
+	publish := func(ctx context.Context, entry behaviors.OutboxEntry) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if entry.Topic == "b" && failures > 0 {
+			failures--
+			return errors.New("ouch")
+		}
+		topics = append(topics, entry.Topic)
+		return nil
+	}
+	store := behaviors.NewMemoryOutboxStore()
+
+	env.StartCell("outbox", behaviors.NewOutboxBehavior(store, publish))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("outbox", "collector")
+
+	env.EmitNew(ctx, "outbox", "a", 1)
+	env.EmitNew(ctx, "outbox", "b", 2)
+	env.EmitNew(ctx, "outbox", "c", 3)
+
+	time.Sleep(3500 * time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(topics, []string{"a", "b", "c"})
+	mutex.Unlock()
+	pending, err := store.Pending()
+	assert.Nil(err)
+	assert.Empty(pending)
+
+	status, err := env.Request(ctx, "outbox", cells.TopicStatus, time.Second)
+	assert.Nil(err)
+	assert.Equal(status.GetInt(behaviors.PayloadOutboxAppended, 0), 3)
+	assert.Equal(status.GetInt(behaviors.PayloadOutboxPublished, 0), 3)
+	assert.Equal(status.GetInt(behaviors.PayloadOutboxFailed, 0), 2)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 3)
+}
+
+// TestOutboxBehaviorStop tests stopping the outbox behavior
+// while a publishing hangs.
+func TestOutboxBehaviorStop(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("outbox-behavior-stop")
+	defer env.Stop()
+
+	publishingc := make(chan struct{})
+	publish := func(ctx context.Context, entry behaviors.OutboxEntry) error {
+		close(publishingc)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	store := behaviors.NewMemoryOutboxStore()
+
+	env.StartCell("outbox", behaviors.NewOutboxBehavior(store, publish))
+	env.EmitNew(ctx, "outbox", "a", 1)
+	select {
+	case <-publishingc:
+	case <-time.After(time.Second):
+		t.Fatalf("entry not published")
+	}
+
+	stoppedc := make(chan error)
+	go func() {
+		stoppedc <- env.StopCell("outbox")
+	}()
+	select {
+	case err := <-stoppedc:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		t.Fatalf("hanging publishing blocks stopping")
+	}
+	pending, err := store.Pending()
+	assert.Nil(err)
+	assert.Length(pending, 1)
+}
+
+// EOF
@@ -12,9 +12,12 @@ package behaviors
 //--------------------
 
 import (
+	"container/list"
 	"context"
 	"time"
 
+	"github.com/tideland/golib/logger"
+
 	"github.com/tideland/gocells/cells"
 )
 
@@ -45,6 +48,14 @@ const (
 	// PayloadPairTimeout contains the time of the timeout, when the second
 	// event hasn't been received in time.
 	PayloadPairTimeout = "pair:timeout"
+
+	// PayloadPairKey contains the key of a pair tracked by the
+	// keyed pair behavior.
+	PayloadPairKey = "pair:key"
+
+	// defaultMaxOpenPairs is the default maximum number of open
+	// pairs of a keyed pair behavior.
+	defaultMaxOpenPairs = 10000
 )
 
 //--------------------
@@ -66,6 +77,7 @@ type pairBehavior struct {
 	hit      *time.Time
 	hitData  interface{}
 	timeout  *time.Timer
+	options  *options
 }
 
 // NewPairBehavior creates a behavior checking if two events match a criterion
@@ -73,8 +85,9 @@ type pairBehavior struct {
 // longer than the passed duration. In case of a positive pair match an according
 // event containing both timestamps and both returned datas is emitted. In case
 // of a timeout a timeout event is emitted. It's payload is the first timestamp,
-// the first data, and the timestamp of the timeout.
-func NewPairBehavior(matches PairCriterion, duration time.Duration) cells.Behavior {
+// the first data, and the timestamp of the timeout. The clock, the emitted
+// topics, and the payload keys can be changed by options.
+func NewPairBehavior(matches PairCriterion, duration time.Duration, opts ...Option) cells.Behavior {
 	return &pairBehavior{
 		cell:     nil,
 		matches:  matches,
@@ -82,6 +95,7 @@ func NewPairBehavior(matches PairCriterion, duration time.Duration) cells.Behavi
 		hit:      nil,
 		hitData:  nil,
 		timeout:  nil,
+		options:  newOptions(opts...),
 	}
 }
 
@@ -110,7 +124,7 @@ func (b *pairBehavior) ProcessEvent(event cells.Event) error {
 		}
 	default:
 		if hitData, ok := b.matches(event, b.hitData); ok {
-			now := time.Now()
+			now := b.options.now()
 			if b.hit == nil {
 				// First hit, store time and data and start timeout reminder.
 				b.hit = &now
@@ -143,23 +157,186 @@ func (b *pairBehavior) Recover(err interface{}) error {
 
 // emitPair emits the event for a successful pair.
 func (b *pairBehavior) emitPair(ctx context.Context, timestamp time.Time, data interface{}) {
-	b.cell.EmitNew(ctx, TopicPair, cells.PayloadValues{
+	b.cell.EmitNew(ctx, b.options.topic(TopicPair), b.options.payload(cells.PayloadValues{
 		PayloadPairFirstTime:  *b.hit,
 		PayloadPairFirstData:  b.hitData,
 		PayloadPairSecondTime: timestamp,
 		PayloadPairSecondData: data,
-	})
+	}))
 	b.hit = nil
 }
 
 // emitTimeout emits the event for a pairing timeout.
 func (b *pairBehavior) emitTimeout(ctx context.Context) {
-	b.cell.EmitNew(ctx, TopicPairTimeout, cells.PayloadValues{
+	b.cell.EmitNew(ctx, b.options.topic(TopicPairTimeout), b.options.payload(cells.PayloadValues{
 		PayloadPairFirstTime: *b.hit,
 		PayloadPairFirstData: b.hitData,
-		PayloadPairTimeout:   time.Now(),
-	})
+		PayloadPairTimeout:   b.options.now(),
+	}))
 	b.hit = nil
 }
 
+//--------------------
+// KEYED PAIR BEHAVIOR
+//--------------------
+
+// PairKeyFunc returns the key of an event for the keyed pair
+// behavior, e.g. a transaction ID. Events with an empty key
+// are ignored.
+type PairKeyFunc func(event cells.Event) string
+
+// openPair is a first hit waiting for its second one.
+type openPair struct {
+	key     string
+	hit     time.Time
+	hitData interface{}
+	timeout *time.Timer
+}
+
+// keyedPairBehavior checks if events occur in pairs per key.
+type keyedPairBehavior struct {
+	cell     cells.Cell
+	key      PairKeyFunc
+	matches  PairCriterion
+	duration time.Duration
+	pairs    map[string]*list.Element
+	order    *list.List
+	options  *options
+}
+
+// NewKeyedPairBehavior creates a behavior like NewPairBehavior() but tracking
+// many concurrent open pairs, one per key returned by the key function. The
+// emitted events additionally contain the key. The number of open pairs is
+// limited to 10,000 or the value set with WithMaxCardinality(). If it is
+// reached the oldest open pair is evicted with a timeout event, so abandoned
+// keys cannot exhaust the memory.
+func NewKeyedPairBehavior(key PairKeyFunc, matches PairCriterion, duration time.Duration, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	if o.maxKeys == 0 {
+		o.maxKeys = defaultMaxOpenPairs
+	}
+	return &keyedPairBehavior{
+		key:      key,
+		matches:  matches,
+		duration: duration,
+		pairs:    make(map[string]*list.Element),
+		order:    list.New(),
+		options:  o,
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *keyedPairBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *keyedPairBehavior) Terminate() error {
+	for _, elem := range b.pairs {
+		elem.Value.(*openPair).timeout.Stop()
+	}
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *keyedPairBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case TopicPairTimeout:
+		// Received timeout event, check if the expected one.
+		key := event.Payload().GetString(PayloadPairKey, "")
+		elem, ok := b.pairs[key]
+		if !ok {
+			return nil
+		}
+		op := elem.Value.(*openPair)
+		hit := event.Payload().GetTime(PayloadPairFirstTime, time.Time{})
+		if hit.Equal(op.hit) {
+			b.remove(elem)
+			b.emitTimeout(event.Context(), op)
+		}
+	default:
+		key := b.key(event)
+		if key == "" {
+			return nil
+		}
+		elem, open := b.pairs[key]
+		var hitData interface{}
+		if open {
+			hitData = elem.Value.(*openPair).hitData
+		}
+		data, ok := b.matches(event, hitData)
+		if !ok {
+			return nil
+		}
+		now := b.options.now()
+		if !open {
+			// First hit, evict the oldest pair if needed.
+			if len(b.pairs) >= b.options.maxKeys {
+				oldest := b.order.Front()
+				b.remove(oldest)
+				logger.Warningf("keyed pair '%s' evicts open pair '%s'", b.cell.ID(), oldest.Value.(*openPair).key)
+				b.emitTimeout(event.Context(), oldest.Value.(*openPair))
+			}
+			op := &openPair{
+				key:     key,
+				hit:     now,
+				hitData: data,
+			}
+			op.timeout = time.AfterFunc(b.duration, func() {
+				b.cell.Environment().EmitNew(event.Context(), b.cell.ID(), TopicPairTimeout, cells.PayloadValues{
+					PayloadPairKey:       key,
+					PayloadPairFirstTime: now,
+				})
+			})
+			b.pairs[key] = b.order.PushBack(op)
+			return nil
+		}
+		// Second hit earlier than timeout event.
+		// Check if it is in time.
+		op := elem.Value.(*openPair)
+		b.remove(elem)
+		if now.Sub(op.hit) > b.duration {
+			b.emitTimeout(event.Context(), op)
+		} else {
+			b.emitPair(event.Context(), op, now, data)
+		}
+	}
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *keyedPairBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// remove stops the timeout of an open pair and removes it.
+func (b *keyedPairBehavior) remove(elem *list.Element) {
+	op := elem.Value.(*openPair)
+	op.timeout.Stop()
+	b.order.Remove(elem)
+	delete(b.pairs, op.key)
+}
+
+// emitPair emits the event for a successful pair.
+func (b *keyedPairBehavior) emitPair(ctx context.Context, op *openPair, timestamp time.Time, data interface{}) {
+	b.cell.EmitNew(ctx, b.options.topic(TopicPair), b.options.payload(cells.PayloadValues{
+		PayloadPairKey:        op.key,
+		PayloadPairFirstTime:  op.hit,
+		PayloadPairFirstData:  op.hitData,
+		PayloadPairSecondTime: timestamp,
+		PayloadPairSecondData: data,
+	}))
+}
+
+// emitTimeout emits the event for a pairing timeout.
+func (b *keyedPairBehavior) emitTimeout(ctx context.Context, op *openPair) {
+	b.cell.EmitNew(ctx, b.options.topic(TopicPairTimeout), b.options.payload(cells.PayloadValues{
+		PayloadPairKey:       op.key,
+		PayloadPairFirstTime: op.hit,
+		PayloadPairFirstData: op.hitData,
+		PayloadPairTimeout:   b.options.now(),
+	}))
+}
+
 // EOF
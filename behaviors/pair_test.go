@@ -102,4 +102,52 @@ func TestPairBehavior(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestKeyedPairBehavior tests the keyed event pair behavior.
+func TestKeyedPairBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("keyed-pair-behavior")
+	defer env.Stop()
+
+	key := func(event cells.Event) string {
+		return event.Payload().GetString("tx", "")
+	}
+	matches := func(event cells.Event, data interface{}) (interface{}, bool) {
+		if data == nil {
+			return event.Topic(), event.Topic() == "open"
+		}
+		return event.Topic(), event.Topic() == "close"
+	}
+	env.StartCell("pairer", behaviors.NewKeyedPairBehavior(key, matches, 50*time.Millisecond, behaviors.WithMaxCardinality(2)))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(100))
+	env.Subscribe("pairer", "collector")
+
+	for _, tx := range []string{"tx1", "tx2", "tx3"} {
+		env.EmitNew(ctx, "pairer", "open", cells.PayloadValues{"tx": tx})
+	}
+	env.EmitNew(ctx, "pairer", "close", cells.PayloadValues{"tx": "tx2"})
+	env.EmitNew(ctx, "pairer", "close", cells.PayloadValues{"tx": "tx3"})
+	env.EmitNew(ctx, "pairer", "open", cells.PayloadValues{"tx": "tx4"})
+	time.Sleep(200 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 4)
+	expected := []struct {
+		topic string
+		tx    string
+	}{
+		{behaviors.TopicPairTimeout, "tx1"},
+		{behaviors.TopicPair, "tx2"},
+		{behaviors.TopicPair, "tx3"},
+		{behaviors.TopicPairTimeout, "tx4"},
+	}
+	accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Topic(), expected[index].topic)
+		assert.Equal(event.Payload().GetString(behaviors.PayloadPairKey, ""), expected[index].tx)
+		assert.Equal(event.Payload().Get(behaviors.PayloadPairFirstData, nil), "open")
+		return nil
+	})
+}
+
 // EOF
@@ -0,0 +1,227 @@
+// Tideland Go Cells - Behaviors - Persistent Counter
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// topicCounterFlush is emitted by the persistent counter to
+// itself in the flush interval.
+const topicCounterFlush = "counter:flush!"
+
+//--------------------
+// KEY-VALUE STORE
+//--------------------
+
+// KVStore is a simple storage of values by key used by behaviors
+// to persist their state. Implementations have to be safe for
+// concurrent use.
+type KVStore interface {
+	// Get returns the value stored for the key, or nil if
+	// there is none.
+	Get(key string) ([]byte, error)
+
+	// Put stores the value for the key.
+	Put(key string, value []byte) error
+}
+
+// memoryKVStore implements the KVStore interface in memory.
+type memoryKVStore struct {
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryKVStore creates a key-value store only keeping the
+// values in memory. It is intended for tests and for sharing the
+// state between cells of one process.
+func NewMemoryKVStore() KVStore {
+	return &memoryKVStore{
+		values: make(map[string][]byte),
+	}
+}
+
+// Get implements the KVStore interface.
+func (s *memoryKVStore) Get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.values[key], nil
+}
+
+// Put implements the KVStore interface.
+func (s *memoryKVStore) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// directoryKVStore implements the KVStore interface with one
+// file per key in a directory.
+type directoryKVStore struct {
+	mutex sync.Mutex
+	dir   string
+}
+
+// NewDirectoryKVStore creates a key-value store writing each value
+// into a file of the directory. Files are replaced atomically, so
+// a crash never leaves a partly written value.
+func NewDirectoryKVStore(dir string) (KVStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &directoryKVStore{
+		dir: dir,
+	}, nil
+}
+
+// Get implements the KVStore interface.
+func (s *directoryKVStore) Get(key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, err := ioutil.ReadFile(s.filename(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Put implements the KVStore interface.
+func (s *directoryKVStore) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	filename := s.filename(key)
+	tmpname := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpname, value, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpname, filename)
+}
+
+// filename returns the name of the file for the key.
+func (s *directoryKVStore) filename(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".value")
+}
+
+//--------------------
+// PERSISTENT COUNTER BEHAVIOR
+//--------------------
+
+// persistentCounterBehavior extends the counter behavior by
+// persisting its counters.
+type persistentCounterBehavior struct {
+	*counterBehavior
+	store         KVStore
+	flushInterval time.Duration
+	dirty         bool
+	stopc         chan struct{}
+}
+
+// NewPersistentCounterBehavior creates a counter behavior like
+// NewCounterBehavior() which additionally stores its counters with
+// the cell ID as key in the passed store. This happens in the flush
+// interval if the counters changed and when the cell terminates.
+// During initialization the stored counters are restored, so long
+// running counts like daily totals survive restarts.
+func NewPersistentCounterBehavior(cf CounterFunc, store KVStore, flushInterval time.Duration, opts ...Option) cells.Behavior {
+	return &persistentCounterBehavior{
+		counterBehavior: NewCounterBehavior(cf, opts...).(*counterBehavior),
+		store:           store,
+		flushInterval:   flushInterval,
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *persistentCounterBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	value, err := b.store.Get(c.ID())
+	if err != nil {
+		return errors.Annotate(err, ErrKVStore, errorMessages, c.ID())
+	}
+	if value != nil {
+		if err := json.Unmarshal(value, &b.counters); err != nil {
+			return errors.Annotate(err, ErrKVStore, errorMessages, c.ID())
+		}
+	}
+	b.stopc = make(chan struct{})
+	go b.flushLoop()
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *persistentCounterBehavior) Terminate() error {
+	close(b.stopc)
+	return b.flush()
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *persistentCounterBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case topicCounterFlush:
+		if err := b.flush(); err != nil {
+			logger.Errorf("persistent counter '%s' cannot flush: %v", b.cell.ID(), err)
+		}
+		return nil
+	case cells.TopicCounters:
+	default:
+		b.dirty = true
+	}
+	return b.counterBehavior.ProcessEvent(event)
+}
+
+// flush stores the counters if they changed.
+func (b *persistentCounterBehavior) flush() error {
+	if !b.dirty {
+		return nil
+	}
+	value, err := json.Marshal(b.counters)
+	if err != nil {
+		return errors.Annotate(err, ErrKVStore, errorMessages, b.cell.ID())
+	}
+	if err := b.store.Put(b.cell.ID(), value); err != nil {
+		return errors.Annotate(err, ErrKVStore, errorMessages, b.cell.ID())
+	}
+	b.dirty = false
+	return nil
+}
+
+// flushLoop lets the behavior flush in the interval.
+func (b *persistentCounterBehavior) flushLoop() {
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopc:
+			return
+		case <-ticker.C:
+			b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicCounterFlush, nil)
+		}
+	}
+}
+
+// EOF
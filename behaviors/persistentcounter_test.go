@@ -0,0 +1,91 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Persistent Counter
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestPersistentCounterBehavior tests the flushing and restoring
+// of counters.
+func TestPersistentCounterBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("persistent-counter-behavior")
+	defer env.Stop()
+
+	dir, err := ioutil.TempDir("", "persistent-counter")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	store, err := behaviors.NewDirectoryKVStore(dir)
+	assert.Nil(err)
+
+	cf := func(id string, event cells.Event) []string {
+		return event.Payload().GetDefault([]string{}).([]string)
+	}
+	env.StartCell("counter", behaviors.NewPersistentCounterBehavior(cf, store, 20*time.Millisecond))
+	env.EmitNew(ctx, "counter", "count", []string{"a", "b"})
+	env.EmitNew(ctx, "counter", "count", []string{"a"})
+
+	// Flushed in the interval.
+	assert.Wait(waitForValue(store, "counter"), true, time.Second)
+
+	// Flushed when terminating and restored after restart.
+	env.EmitNew(ctx, "counter", "count", []string{"c"})
+	assert.Nil(env.StopCell("counter"))
+	env.StartCell("counter", behaviors.NewPersistentCounterBehavior(cf, store, time.Minute))
+	env.EmitNew(ctx, "counter", "count", []string{"a"})
+
+	counters, err := behaviors.RequestCounterResults(ctx, env, "counter", time.Second)
+	assert.Nil(err)
+	assert.Equal(counters, behaviors.Counters{"a": 3, "b": 1, "c": 1})
+
+	// Failing store prevents the start.
+	value := []byte("garbage")
+	assert.Nil(store.Put("broken", value))
+	err = env.StartCell("broken", behaviors.NewPersistentCounterBehavior(cf, store, time.Minute))
+	assert.ErrorMatch(err, `.*cannot access key-value store.*`)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// waitForValue signals when the store contains a value for the key.
+func waitForValue(store behaviors.KVStore, key string) chan interface{} {
+	waitc := make(chan interface{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			if value, _ := store.Get(key); value != nil {
+				waitc <- true
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	return waitc
+}
+
+// EOF
@@ -0,0 +1,170 @@
+// Tideland Go Cells - Behaviors - Poll
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicPoll is the topic of the requests sent to the polled cells.
+	TopicPoll = "poll?"
+
+	// TopicPollReport labels the consolidated answers of a poll.
+	TopicPollReport = "poll-report"
+
+	// PayloadPollAnswers contains the answers of the polled cells
+	// as map[string]cells.Payload by their IDs.
+	PayloadPollAnswers = "poll:answers"
+
+	// PayloadPollFailed contains the sorted IDs of the cells
+	// which did not answer in time.
+	PayloadPollFailed = "poll:failed"
+
+	// PayloadPollTime contains the time the poll started.
+	PayloadPollTime = "poll:time"
+
+	// topicPollReport lets the poll loop pass a report to
+	// the cell.
+	topicPollReport = "poll:report!"
+)
+
+//--------------------
+// POLL BEHAVIOR
+//--------------------
+
+// pollReport contains the result of one poll.
+type pollReport struct {
+	time    time.Time
+	answers map[string]cells.Payload
+	failed  []string
+}
+
+// pollBehavior periodically requests a set of cells.
+type pollBehavior struct {
+	cell     cells.Cell
+	targets  []string
+	question cells.Payload
+	interval time.Duration
+	timeout  time.Duration
+	options  *options
+	ctx      context.Context
+	cancel   func()
+}
+
+// NewPollBehavior creates a behavior polling the target cells in the
+// passed interval. Each poll sends a request with the topic "poll?"
+// and the question as payload to all targets at once. The answers
+// received until the timeout are emitted as one report with the topic
+// "poll-report", the IDs of the cells not answering are added. So
+// periodic status or capacity reports can be built. The request topic
+// can be changed with WithEmitTopic() like the topic of the report,
+// e.g. to cells.TopicStatus.
+func NewPollBehavior(targets []string, question cells.Payload, interval, timeout time.Duration, opts ...Option) cells.Behavior {
+	return &pollBehavior{
+		targets:  targets,
+		question: question,
+		interval: interval,
+		timeout:  timeout,
+		options:  newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *pollBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.pollLoop()
+	return nil
+}
+
+// Terminate the behavior.
+func (b *pollBehavior) Terminate() error {
+	b.cancel()
+	return nil
+}
+
+// ProcessEvent emits the reports of the poll loop.
+func (b *pollBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicPollReport {
+		return nil
+	}
+	report, ok := event.Payload().GetDefault(nil).(*pollReport)
+	if !ok {
+		return nil
+	}
+	return b.cell.EmitNew(event.Context(), b.options.topic(TopicPollReport), b.options.payload(cells.PayloadValues{
+		PayloadPollTime:    report.time,
+		PayloadPollAnswers: report.answers,
+		PayloadPollFailed:  report.failed,
+	}))
+}
+
+// Recover from an error.
+func (b *pollBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// pollLoop polls the targets until the behavior terminates. It
+// runs outside of the cell, so a poll does not block its processing.
+func (b *pollBehavior) pollLoop() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report := b.poll()
+		if b.ctx.Err() != nil {
+			return
+		}
+		err := b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicPollReport, report)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// poll requests the targets once.
+func (b *pollBehavior) poll() *pollReport {
+	report := &pollReport{
+		time: b.options.now(),
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, b.timeout)
+	defer cancel()
+	answers, err := b.cell.Environment().RequestAll(ctx, b.targets, b.options.topic(TopicPoll), b.question)
+	if err != nil {
+		logger.Warningf("poll %q got no answers of all cells: %v", b.cell.ID(), err)
+	}
+	report.answers = answers
+	for _, id := range b.targets {
+		if _, ok := answers[id]; !ok {
+			report.failed = append(report.failed, id)
+		}
+	}
+	sort.Strings(report.failed)
+	return report
+}
+
+// EOF
@@ -0,0 +1,78 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Poll
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestPollBehavior tests the periodic polling of cells.
+func TestPollBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("poll-behavior")
+	defer env.Stop()
+
+	answer := func(cell cells.Cell, event cells.Event) error {
+		if event.Topic() != "capacity?" {
+			return nil
+		}
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			return nil
+		}
+		unit := payload.GetString("unit", "")
+		payload.GetWaiter().Set(cells.PayloadValues{"capacity": len(cell.ID()), "unit": unit})
+		return nil
+	}
+	question := cells.NewPayload(cells.PayloadValues{"unit": "slots"})
+
+	env.StartCell("a", behaviors.NewSimpleProcessorBehavior(answer))
+	env.StartCell("bb", behaviors.NewSimpleProcessorBehavior(answer))
+	env.StartCell("silent", behaviors.NewBroadcasterBehavior())
+	env.StartCell("poll", behaviors.NewPollBehavior(
+		[]string{"a", "bb", "silent"}, question, 20*time.Millisecond, 10*time.Millisecond,
+		behaviors.WithEmitTopic(behaviors.TopicPoll, "capacity?"),
+	))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("poll", "collector")
+
+	var report cells.Event
+	for i := 0; i < 100 && report == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		report, _ = accessor.PeekFirst()
+	}
+	assert.NotNil(report)
+	assert.Equal(report.Topic(), behaviors.TopicPollReport)
+	answers, ok := report.Payload().Get(behaviors.PayloadPollAnswers, nil).(map[string]cells.Payload)
+	assert.True(ok)
+	assert.Length(answers, 2)
+	assert.Equal(answers["a"].GetInt("capacity", 0), 1)
+	assert.Equal(answers["bb"].GetInt("capacity", 0), 2)
+	assert.Equal(answers["bb"].GetString("unit", ""), "slots")
+	failed, ok := report.Payload().Get(behaviors.PayloadPollFailed, nil).([]string)
+	assert.True(ok)
+	assert.Equal(failed, []string{"silent"})
+}
+
+// EOF
@@ -0,0 +1,170 @@
+// Tideland Go Cells - Behaviors - Probe
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/loop"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicProbe signals the latencies of a probe along the path.
+	TopicProbe = "probe"
+
+	// TopicProbeHop signals the latency of a probe in one cell.
+	TopicProbeHop = "probe-hop"
+
+	// TopicProbeFailed signals a probe not travelling the
+	// whole path within the interval.
+	TopicProbeFailed = "probe-failed"
+
+	// PayloadProbePath contains the IDs of the cells of the path.
+	PayloadProbePath = "probe:path"
+
+	// PayloadProbeLatencies contains the latencies per hop.
+	PayloadProbeLatencies = "probe:latencies"
+
+	// PayloadProbeTotal contains the total latency of a probe.
+	PayloadProbeTotal = "probe:total"
+
+	// PayloadProbeHop contains the ID of the cell of a hop.
+	PayloadProbeHop = "probe:hop"
+
+	// PayloadProbeIndex contains the index of a hop in the path.
+	PayloadProbeIndex = "probe:index"
+
+	// PayloadProbeLatency contains the latency of a hop.
+	PayloadProbeLatency = "probe:latency"
+
+	// PayloadProbeError contains the error of a failed probe.
+	PayloadProbeError = "probe:error"
+
+	// topicProbeDone is emitted by the behavior to itself
+	// after each probe.
+	topicProbeDone = "probe:done!"
+
+	// payloadProbeResult contains the result of a probe.
+	payloadProbeResult = "probe:result"
+)
+
+//--------------------
+// PROBE BEHAVIOR
+//--------------------
+
+// probeBehavior periodically sends probes along a path of cells.
+type probeBehavior struct {
+	cell     cells.Cell
+	path     []string
+	interval time.Duration
+	loop     loop.Loop
+	options  *options
+}
+
+// NewProbeBehavior creates a behavior sending a probe along the path
+// of cells in each interval. The probe passes the queues of the cells
+// without being processed by their behaviors. For each probe one event
+// per hop with the topic "probe-hop" and the latency since the
+// previous hop is emitted, followed by one with the topic "probe"
+// and all latencies together with the total one. Probes not arriving
+// at the end of the path within the interval are emitted with the
+// topic "probe-failed". The emitted topics and payload keys can be
+// changed by options.
+func NewProbeBehavior(path []string, interval time.Duration, opts ...Option) cells.Behavior {
+	return &probeBehavior{
+		path:     path,
+		interval: interval,
+		options:  newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *probeBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	b.loop = loop.Go(b.probeLoop)
+	return nil
+}
+
+// Terminate the behavior.
+func (b *probeBehavior) Terminate() error {
+	return b.loop.Stop()
+}
+
+// ProcessEvent emits the measurements of the done probes.
+func (b *probeBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicProbeDone {
+		return nil
+	}
+	if err := event.Payload().Error(); err != nil {
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicProbeFailed), b.options.payload(cells.PayloadValues{
+			PayloadProbePath:  b.path,
+			PayloadProbeError: err.Error(),
+		}))
+	}
+	result, ok := event.Payload().Get(payloadProbeResult, nil).(*cells.ProbeResult)
+	if !ok {
+		return nil
+	}
+	latencies := make([]time.Duration, len(result.Hops))
+	for i, hop := range result.Hops {
+		latencies[i] = hop.Latency
+		err := b.cell.EmitNew(event.Context(), b.options.topic(TopicProbeHop), b.options.payload(cells.PayloadValues{
+			PayloadProbeHop:     hop.ID,
+			PayloadProbeIndex:   i,
+			PayloadProbeLatency: hop.Latency,
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return b.cell.EmitNew(event.Context(), b.options.topic(TopicProbe), b.options.payload(cells.PayloadValues{
+		PayloadProbePath:      b.path,
+		PayloadProbeLatencies: latencies,
+		PayloadProbeTotal:     result.Total,
+	}))
+}
+
+// Recover from an error.
+func (b *probeBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// probeLoop sends the probes and passes their results
+// to its own process method.
+func (b *probeBehavior) probeLoop(l loop.Loop) error {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), b.interval)
+			result, err := b.cell.Environment().Probe(ctx, b.path...)
+			cancel()
+			var payload interface{} = cells.PayloadValues{payloadProbeResult: result}
+			if err != nil {
+				payload = err
+			}
+			b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicProbeDone, payload)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,96 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Probe
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestProbeBehavior tests the measuring of latencies along a path.
+func TestProbeBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("probe-behavior")
+	defer env.Stop()
+
+	type result struct {
+		topic   string
+		payload cells.Payload
+	}
+	resultc := make(chan result, 100)
+	callback := func(topic string, payload cells.Payload) error {
+		resultc <- result{topic, payload}
+		return nil
+	}
+	var processed int64
+	counter := func(topic string, payload cells.Payload) error {
+		atomic.AddInt64(&processed, 1)
+		return nil
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		env.StartCell(id, behaviors.NewCallbackBehavior(counter))
+	}
+	env.StartCell("probe", behaviors.NewProbeBehavior([]string{"a", "b", "c"}, 20*time.Millisecond))
+	env.StartCell("failing", behaviors.NewProbeBehavior([]string{"a", "missing"}, 20*time.Millisecond))
+	env.StartCell("callback", behaviors.NewCallbackBehavior(callback))
+	env.Subscribe("probe", "callback")
+	env.Subscribe("failing", "callback")
+
+	var hops []string
+	var probed, failed bool
+	for !probed || !failed {
+		select {
+		case r := <-resultc:
+			payload := r.payload
+			switch r.topic {
+			case behaviors.TopicProbeHop:
+				hops = append(hops, payload.GetString(behaviors.PayloadProbeHop, ""))
+			case behaviors.TopicProbe:
+				if probed {
+					continue
+				}
+				probed = true
+				latencies, ok := payload.Get(behaviors.PayloadProbeLatencies, nil).([]time.Duration)
+				assert.True(ok)
+				assert.Length(latencies, 3)
+				var sum time.Duration
+				for _, latency := range latencies {
+					sum += latency
+				}
+				assert.Equal(payload.GetDuration(behaviors.PayloadProbeTotal, 0), sum)
+				assert.Equal(hops[len(hops)-3:], []string{"a", "b", "c"})
+			case behaviors.TopicProbeFailed:
+				failed = true
+				assert.True(payload.GetString(behaviors.PayloadProbeError, "") != "")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no probe results")
+		}
+	}
+
+	// Probes are not processed by the behaviors.
+	assert.Nil(env.Barrier(context.Background(), "a", "b", "c"))
+	assert.Equal(atomic.LoadInt64(&processed), int64(0))
+}
+
+// EOF
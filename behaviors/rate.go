@@ -12,9 +12,13 @@ package behaviors
 //--------------------
 
 import (
+	"math"
 	"time"
 
+	"github.com/tideland/golib/logger"
+
 	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/window"
 )
 
 //--------------------
@@ -25,23 +29,44 @@ const (
 	// TopicRate signals the rate of detected matching events.
 	TopicRate = "rate"
 
-	// PayloadRateAverage contains the average event rate.
+	// PayloadRateAverage contains the exponentially weighted
+	// moving average of the durations between matching events.
 	PayloadRateAverage = "rate:average"
 
 	// PayloadRateDuration contains the duration between the
 	// first and the last event.
 	PayloadRateDuration = "rate:duration"
 
-	// PayloadRateHigh contains the highest measured time
-	// between matching events.
+	// PayloadRateHigh contains the highest of the last
+	// measured times between matching events.
 	PayloadRateHigh = "rate:high"
 
-	// PayloadRateLow contains the highest measured time
-	// between matching events.
+	// PayloadRateLow contains the lowest of the last
+	// measured times between matching events.
 	PayloadRateLow = "rate:low"
 
 	// PayloadRateTime contains the time of the last matching.
 	PayloadRateTime = "rate:time"
+
+	// PayloadRateInstant contains the matching events per second
+	// in the last complete bucket.
+	PayloadRateInstant = "rate:instant"
+
+	// PayloadRate1m contains the one minute average of the
+	// matching events per second.
+	PayloadRate1m = "rate:1m"
+
+	// PayloadRate5m contains the five minutes average of the
+	// matching events per second.
+	PayloadRate5m = "rate:5m"
+
+	// PayloadRate15m contains the fifteen minutes average of the
+	// matching events per second.
+	PayloadRate15m = "rate:15m"
+
+	// defaultRateBucket is the default granularity of the
+	// buckets the matching events are counted in.
+	defaultRateBucket = 5 * time.Second
 )
 
 //--------------------
@@ -54,20 +79,50 @@ type RateCriterion func(event cells.Event) (bool, error)
 
 // rateBehavior calculates the average rate of events matching a criterion.
 type rateBehavior struct {
-	cell      cells.Cell
-	matches   RateCriterion
-	count     int
-	last      time.Time
-	durations []time.Duration
+	cell        cells.Cell
+	matches     RateCriterion
+	count       int
+	alpha       float64
+	last        time.Time
+	measured    bool
+	average     float64
+	durations   *window.Window
+	bucket      time.Duration
+	bucketStart time.Time
+	bucketCount int
+	instant     float64
+	rates       [3]float64
+	decays      [3]float64
+	options     *options
 }
 
 // NewRateBehavior creates an even rate measuiring behavior. Each time the
 // criterion function returns true for a received event the duration between
 // this and the last one is calculated and emitted together with the timestamp.
-// Additionally a moving average, lowest, and highest duration is calculated
-// and emitted too. A "reset!" as topic resets the stored values.
-func NewRateBehavior(matches RateCriterion, count int) cells.Behavior {
-	return &rateBehavior{nil, matches, count, time.Now(), []time.Duration{}}
+// Additionally an exponentially weighted moving average over about count
+// durations, so single outliers only have a small influence, and the lowest
+// and highest of the last count durations are emitted too. The matching events are also counted
+// in buckets with a granularity set by WithBucket(), default are 5 seconds.
+// Like load averages the instantaneous rate and the 1, 5, and 15 minutes
+// averages of the events per second are returned to requests with the topic
+// "status?". A "reset!" as topic resets the stored values. The clock, the
+// emitted topic, and the payload keys can be changed by options.
+func NewRateBehavior(matches RateCriterion, count int, opts ...Option) cells.Behavior {
+	o := newOptions(opts...)
+	if o.bucket == 0 {
+		o.bucket = defaultRateBucket
+	}
+	b := &rateBehavior{
+		matches: matches,
+		bucket:  o.bucket,
+		options: o,
+	}
+	for i, period := range []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute} {
+		b.decays[i] = math.Exp(-b.bucket.Seconds() / period.Seconds())
+	}
+	b.setCount(count)
+	b.reset(o.now())
+	return b
 }
 
 // Init implements the cells.Behavior interface.
@@ -84,52 +139,135 @@ func (b *rateBehavior) Terminate() error {
 // ProcessEvent implements the cells.Behavior interface.
 func (b *rateBehavior) ProcessEvent(event cells.Event) error {
 	switch event.Topic() {
+	case cells.TopicStatus:
+		payload, ok := cells.HasWaiterPayload(event)
+		if !ok {
+			logger.Warningf("retrieving status from '%s' not possible without payload waiter", b.cell.ID())
+			return nil
+		}
+		b.advance(b.options.now())
+		payload.GetWaiter().Set(b.options.payload(cells.PayloadValues{
+			PayloadRateInstant: b.instant,
+			PayloadRate1m:      b.rates[0],
+			PayloadRate5m:      b.rates[1],
+			PayloadRate15m:     b.rates[2],
+			PayloadRateAverage: time.Duration(b.average),
+			PayloadRateHigh:    b.high(),
+			PayloadRateLow:     b.low(),
+		}))
 	case cells.TopicReset:
-		b.last = time.Now()
-		b.durations = []time.Duration{}
+		b.reset(b.options.now())
 	default:
 		ok, err := b.matches(event)
 		if err != nil {
 			return err
 		}
 		if ok {
-			current := time.Now()
+			current := b.options.now()
 			duration := current.Sub(b.last)
 			b.last = current
-			b.durations = append(b.durations, duration)
-			if len(b.durations) > b.count {
-				b.durations = b.durations[1:]
-			}
-			total := 0 * time.Nanosecond
-			low := 0x7FFFFFFFFFFFFFFF * time.Nanosecond
-			high := 0 * time.Nanosecond
-			for _, d := range b.durations {
-				total += d
-				if d < low {
-					low = d
-				}
-				if d > high {
-					high = d
-				}
-			}
-			avg := total / time.Duration(len(b.durations))
-			return b.cell.EmitNew(event.Context(), TopicRate, cells.PayloadValues{
+			b.advance(current)
+			b.bucketCount++
+			b.measure(current, duration)
+			return b.cell.EmitNew(event.Context(), b.options.topic(TopicRate), b.options.payload(cells.PayloadValues{
 				PayloadRateTime:     current,
 				PayloadRateDuration: duration,
-				PayloadRateAverage:  avg,
-				PayloadRateHigh:     high,
-				PayloadRateLow:      low,
-			})
+				PayloadRateAverage:  time.Duration(b.average),
+				PayloadRateHigh:     b.high(),
+				PayloadRateLow:      b.low(),
+			}))
 		}
 	}
 	return nil
 }
 
+// Configure changes the number of durations the moving average
+// is weighted for and the lowest and highest duration are
+// calculated of with "config:count".
+func (b *rateBehavior) Configure(config cells.Payload) error {
+	count, err := configInt(b.cell, config, PayloadConfigCount, b.count)
+	if err != nil {
+		return err
+	}
+	b.setCount(count)
+	return nil
+}
+
 // Recover implements the cells.Behavior interface.
 func (b *rateBehavior) Recover(err interface{}) error {
-	b.last = time.Now()
-	b.durations = []time.Duration{}
+	b.reset(b.options.now())
 	return nil
 }
 
+// setCount sets the number of durations and the according
+// smoothing factor of the moving average and the size of the
+// window of the last durations.
+func (b *rateBehavior) setCount(count int) {
+	if count < 1 {
+		count = 1
+	}
+	b.count = count
+	b.alpha = 2.0 / float64(count+1)
+	if b.durations == nil {
+		b.durations = window.New(0, count)
+	} else {
+		b.durations = resizeWindow(b.durations, 0, count)
+	}
+}
+
+// reset drops all measured values.
+func (b *rateBehavior) reset(now time.Time) {
+	b.last = now
+	b.measured = false
+	b.average = 0
+	b.durations.Reset()
+	b.bucketStart = now
+	b.bucketCount = 0
+	b.instant = 0
+	b.rates = [3]float64{}
+}
+
+// measure adds the duration to the moving average and the
+// window of the last durations.
+func (b *rateBehavior) measure(current time.Time, duration time.Duration) {
+	b.durations.Push(current, float64(duration))
+	if !b.measured {
+		b.measured = true
+		b.average = float64(duration)
+		return
+	}
+	b.average += b.alpha * (float64(duration) - b.average)
+}
+
+// low returns the lowest of the last durations.
+func (b *rateBehavior) low() time.Duration {
+	return time.Duration(b.durations.Stats().Min)
+}
+
+// high returns the highest of the last durations.
+func (b *rateBehavior) high() time.Duration {
+	return time.Duration(b.durations.Stats().Max)
+}
+
+// advance closes the buckets passed until now and updates the
+// rates with their counts. Empty buckets let the rates decay.
+func (b *rateBehavior) advance(now time.Time) {
+	n := int(now.Sub(b.bucketStart) / b.bucket)
+	if n <= 0 {
+		return
+	}
+	b.instant = float64(b.bucketCount) / b.bucket.Seconds()
+	for i := range b.rates {
+		b.rates[i] = b.rates[i]*b.decays[i] + b.instant*(1-b.decays[i])
+		if n > 1 {
+			b.rates[i] *= math.Pow(b.decays[i], float64(n-1))
+		}
+	}
+	if n > 1 {
+		b.instant = 0
+	}
+	b.bucketStart = b.bucketStart.Add(time.Duration(n) * b.bucket)
+	b.bucketCount = 0
+}
+
 // EOF
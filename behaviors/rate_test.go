@@ -13,7 +13,9 @@ package behaviors_test
 
 import (
 	"context"
+	"math"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
@@ -64,4 +66,131 @@ func TestRateBehavior(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestRateBehaviorOptions tests the rate behavior with an
+// intercepted clock, a custom topic, and custom payload keys.
+func TestRateBehaviorOptions(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("rate-behavior-options")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.October, 23, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+	matches := func(event cells.Event) (bool, error) {
+		return true, nil
+	}
+
+	env.StartCell("rater", behaviors.NewRateBehavior(matches, 10,
+		behaviors.WithClock(clock),
+		behaviors.WithEmitTopic(behaviors.TopicRate, "my-rate"),
+		behaviors.WithPayloadKeys(map[string]string{
+			behaviors.PayloadRateAverage: "my-average",
+		}),
+	))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("rater", "collector")
+
+	for i := 0; i < 5; i++ {
+		env.EmitNew(ctx, "rater", "now", nil)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", cells.DefaultTimeout)
+	assert.Nil(err)
+	assert.Length(accessor, 5)
+	err = accessor.Do(func(index int, event cells.Event) error {
+		assert.Equal(event.Topic(), "my-rate")
+		assert.Equal(event.Payload().GetDuration("my-average", -1), time.Second)
+		assert.Equal(event.Payload().GetDuration(behaviors.PayloadRateAverage, -1), time.Duration(-1))
+		assert.Equal(event.Payload().GetDuration(behaviors.PayloadRateDuration, -1), time.Second)
+		return nil
+	})
+	assert.Nil(err)
+}
+
+// TestRateBehaviorStatus tests the moving average and the
+// bucketed rates returned as status.
+func TestRateBehaviorStatus(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("rate-behavior-status")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.October, 23, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	matches := func(event cells.Event) (bool, error) {
+		return true, nil
+	}
+
+	env.StartCell("rater", behaviors.NewRateBehavior(matches, 9,
+		behaviors.WithClock(clock),
+		behaviors.WithBucket(time.Second),
+	))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(100))
+	env.Subscribe("rater", "collector")
+
+	// Ten events in the first bucket, the last one an outlier.
+	for i := 0; i < 10; i++ {
+		if i == 9 {
+			advance(900 * time.Millisecond)
+		} else {
+			advance(10 * time.Millisecond)
+		}
+		env.EmitNew(ctx, "rater", "now", nil)
+		assert.Nil(env.Barrier(ctx, "rater"))
+	}
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	assert.Equal(last.Payload().GetDuration(behaviors.PayloadRateAverage, 0), 188*time.Millisecond)
+	assert.Equal(last.Payload().GetDuration(behaviors.PayloadRateLow, 0), 10*time.Millisecond)
+	assert.Equal(last.Payload().GetDuration(behaviors.PayloadRateHigh, 0), 900*time.Millisecond)
+
+	// Bucket is closed, rates decay after it.
+	advance(100 * time.Millisecond)
+	status, err := env.Request(ctx, "rater", cells.TopicStatus, time.Second)
+	assert.Nil(err)
+	assert.Equal(status.GetFloat64(behaviors.PayloadRateInstant, -1), 10.0)
+	rate1m := status.GetFloat64(behaviors.PayloadRate1m, -1)
+	rate15m := status.GetFloat64(behaviors.PayloadRate15m, -1)
+	assert.About(rate1m, 10*(1-math.Exp(-1.0/60)), 0.0001)
+	assert.True(rate15m < rate1m)
+
+	advance(time.Minute)
+	status, err = env.Request(ctx, "rater", cells.TopicStatus, time.Second)
+	assert.Nil(err)
+	assert.Equal(status.GetFloat64(behaviors.PayloadRateInstant, -1), 0.0)
+	assert.True(status.GetFloat64(behaviors.PayloadRate1m, -1) < rate1m/2)
+	assert.Equal(status.GetDuration(behaviors.PayloadRateHigh, 0), 900*time.Millisecond)
+
+	// Lowest and highest durations only cover the last ones.
+	for i := 0; i < 10; i++ {
+		advance(10 * time.Millisecond)
+		env.EmitNew(ctx, "rater", "now", nil)
+		assert.Nil(env.Barrier(ctx, "rater"))
+	}
+	status, err = env.Request(ctx, "rater", cells.TopicStatus, time.Second)
+	assert.Nil(err)
+	assert.Equal(status.GetDuration(behaviors.PayloadRateLow, 0), 10*time.Millisecond)
+	assert.Equal(status.GetDuration(behaviors.PayloadRateHigh, 0), 10*time.Millisecond)
+}
+
 // EOF
@@ -15,7 +15,7 @@ import (
 	"time"
 
 	"github.com/tideland/gocells/cells"
-	"github.com/tideland/golib/collections"
+	"github.com/tideland/gocells/cells/window"
 )
 
 //--------------------
@@ -52,20 +52,26 @@ type rateWindowBehavior struct {
 	matches    RateWindowCriterion
 	count      int
 	duration   time.Duration
-	timestamps collections.RingBuffer
+	timestamps *window.Window
+	late       lateEvents
+	options    *options
 }
 
 // NewRateWindowBehavior creates an event rate window behavior. It checks
 // if an event matches the passed criterion. If count events match during
 // duration an according event containing the first time, the last time,
 // and the number of matches is emitted. A "reset!" as topic resets the
-// collected matches.
-func NewRateWindowBehavior(matches RateWindowCriterion, count int, duration time.Duration) cells.Behavior {
+// collected matches. Backfilled events are measured by their event time,
+// events older than the newest match are handled by the late policy set
+// with WithLatePolicy(). Their number is part of the status. The clock,
+// the emitted topic, and the payload keys can be changed by options.
+func NewRateWindowBehavior(matches RateWindowCriterion, count int, duration time.Duration, opts ...Option) cells.Behavior {
 	return &rateWindowBehavior{
 		matches:    matches,
 		count:      count,
 		duration:   duration,
-		timestamps: collections.NewRingBuffer(count),
+		timestamps: window.New(duration, count),
+		options:    newOptions(opts...),
 	}
 }
 
@@ -84,37 +90,61 @@ func (b *rateWindowBehavior) Terminate() error {
 func (b *rateWindowBehavior) ProcessEvent(event cells.Event) error {
 	switch event.Topic() {
 	case cells.TopicReset:
-		b.timestamps = collections.NewRingBuffer(b.count)
+		b.timestamps.Reset()
+	case cells.TopicStatus:
+		b.late.status(b.cell, event)
 	default:
 		ok, err := b.matches(event)
 		if err != nil {
 			return err
 		}
 		if ok {
-			current := time.Now()
-			b.timestamps.Push(current)
-			if b.timestamps.Len() == b.timestamps.Cap() {
-				// Collected timestamps are full, check duration.
-				firstRaw, _ := b.timestamps.Peek()
-				first := firstRaw.(time.Time)
-				difference := current.Sub(first)
-				if difference <= b.duration {
-					// We've got a burst!
-					b.cell.EmitNew(event.Context(), TopicRateWindow, cells.PayloadValues{
-						PayloadRateWindowCount:     b.count,
-						PayloadRateWindowFirstTime: first,
-						PayloadRateWindowLastTime:  current,
-					})
+			current := b.options.eventTime(event)
+			if newest, ok := b.timestamps.Last(); ok {
+				insert, err := b.late.handle(b.cell, b.options, event, current, newest.Time)
+				if !insert {
+					return err
 				}
 			}
+			b.timestamps.Insert(current, 0)
+			if b.timestamps.Len() == b.count {
+				// Collected timestamps are full and inside
+				// the duration, we've got a burst!
+				first, _ := b.timestamps.First()
+				last, _ := b.timestamps.Last()
+				b.cell.EmitNew(event.Context(), b.options.topic(TopicRateWindow), b.options.payload(cells.PayloadValues{
+					PayloadRateWindowCount:     b.count,
+					PayloadRateWindowFirstTime: first.Time,
+					PayloadRateWindowLastTime:  last.Time,
+				}))
+			}
 		}
 	}
 	return nil
 }
 
+// Configure changes the number of matches with "config:count" and
+// the timespan with "config:duration".
+func (b *rateWindowBehavior) Configure(config cells.Payload) error {
+	count, err := configInt(b.cell, config, PayloadConfigCount, b.count)
+	if err != nil {
+		return err
+	}
+	duration, err := configDuration(b.cell, config, PayloadConfigDuration, b.duration)
+	if err != nil {
+		return err
+	}
+	if count != b.count || duration != b.duration {
+		b.count = count
+		b.duration = duration
+		b.timestamps = resizeWindow(b.timestamps, duration, count)
+	}
+	return nil
+}
+
 // Recover implements the cells.Behavior interface.
 func (b *rateWindowBehavior) Recover(err interface{}) error {
-	b.timestamps = collections.NewRingBuffer(b.count)
+	b.timestamps.Reset()
 	return nil
 }
 
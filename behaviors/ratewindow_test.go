@@ -76,4 +76,100 @@ func TestRateWindowBehavior(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestRateWindowBehaviorBackfill tests the event rate window behavior
+// with backfilled events measured by their event time.
+func TestRateWindowBehaviorBackfill(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("rate-window-behavior-backfill")
+	defer env.Stop()
+
+	matches := func(event cells.Event) (bool, error) {
+		return true, nil
+	}
+	past := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	events := []cells.HistoricalEvent{}
+	for _, offset := range []int{0, 10, 20, 50, 55, 58} {
+		events = append(events, cells.HistoricalEvent{
+			ID:        "windower",
+			EventTime: past.Add(time.Duration(offset) * time.Second),
+			Topic:     "history",
+		})
+	}
+
+	env.StartCell("windower", behaviors.NewRateWindowBehavior(matches, 3, 10*time.Second))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("windower", "collector")
+
+	err := env.Backfill(context.Background(), cells.NewSliceEventIterator(events...))
+	assert.Nil(err)
+	err = env.Barrier(context.Background(), "windower", "collector")
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 1)
+	first, ok := accessor.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Payload().GetTime(behaviors.PayloadRateWindowFirstTime, time.Time{}), past.Add(50*time.Second))
+	assert.Equal(first.Payload().GetTime(behaviors.PayloadRateWindowLastTime, time.Time{}), past.Add(58*time.Second))
+}
+
+// TestRateWindowBehaviorLateEvents tests the event rate window behavior
+// with the different policies for late events.
+func TestRateWindowBehaviorLateEvents(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("rate-window-behavior-late-events")
+	defer env.Stop()
+
+	matches := func(event cells.Event) (bool, error) {
+		return true, nil
+	}
+	past := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		id     string
+		policy behaviors.LatePolicy
+		topic  string
+	}{
+		{"recompute", behaviors.LateRecomputeWindow, behaviors.TopicRateWindow},
+		{"drop", behaviors.LateDrop, ""},
+		{"separately", behaviors.LateEmitSeparately, behaviors.TopicLateEvent},
+	}
+	for _, test := range tests {
+		assert.Logf("late policy %q", test.id)
+		events := []cells.HistoricalEvent{}
+		for _, offset := range []int{0, 20, 15, 22} {
+			events = append(events, cells.HistoricalEvent{
+				ID:        test.id,
+				EventTime: past.Add(time.Duration(offset) * time.Second),
+				Topic:     "history",
+			})
+		}
+		collector := test.id + "-collector"
+
+		env.StartCell(test.id, behaviors.NewRateWindowBehavior(matches, 3, 10*time.Second, behaviors.WithLatePolicy(test.policy)))
+		env.StartCell(collector, behaviors.NewCollectorBehavior(10))
+		env.Subscribe(test.id, collector)
+
+		err := env.Backfill(context.Background(), cells.NewSliceEventIterator(events...))
+		assert.Nil(err)
+		err = env.Barrier(context.Background(), test.id, collector)
+		assert.Nil(err)
+
+		accessor, err := behaviors.RequestCollectedAccessor(env, collector, time.Second)
+		assert.Nil(err)
+		if test.topic == "" {
+			assert.Length(accessor, 0)
+		} else {
+			assert.Length(accessor, 1)
+			first, ok := accessor.PeekFirst()
+			assert.True(ok)
+			assert.Equal(first.Topic(), test.topic)
+		}
+
+		status, err := cells.SendCommand(context.Background(), env, test.id, cells.CommandStatus, nil, time.Second)
+		assert.Nil(err)
+		assert.Equal(status.GetInt(behaviors.PayloadLateCount, 0), 1)
+	}
+}
+
 // EOF
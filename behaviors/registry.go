@@ -0,0 +1,429 @@
+// Tideland Go Cells - Behaviors - Registry
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONFIG
+//--------------------
+
+// Config gives typed access to the configuration of a behavior
+// created by name. The first invalid value is kept as error, so
+// factories can read all values and check Err() once. Values are
+// accepted in the types a JSON decoder returns too, e.g. integers
+// as float64 and durations as strings like "5s".
+type Config struct {
+	name   string
+	values map[string]interface{}
+	read   map[string]bool
+	err    error
+}
+
+// newConfig creates the configuration for the named behavior.
+func newConfig(name string, values map[string]interface{}) *Config {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return &Config{
+		name:   name,
+		values: values,
+		read:   make(map[string]bool),
+	}
+}
+
+// Require checks if the configuration contains all passed keys.
+func (c *Config) Require(keys ...string) {
+	for _, key := range keys {
+		if _, ok := c.values[key]; !ok {
+			c.fail("missing value %q", key)
+		}
+	}
+}
+
+// Int returns the integer value of the key or the default value.
+func (c *Config) Int(key string, dv int) int {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v)
+		}
+	}
+	c.invalid(key, "integer")
+	return dv
+}
+
+// Float64 returns the float value of the key or the default value.
+func (c *Config) Float64(key string, dv float64) float64 {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	c.invalid(key, "float")
+	return dv
+}
+
+// Bool returns the boolean value of the key or the default value.
+func (c *Config) Bool(key string, dv bool) bool {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case bool:
+		return v
+	}
+	c.invalid(key, "boolean")
+	return dv
+}
+
+// String returns the string value of the key or the default value.
+func (c *Config) String(key, dv string) string {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case string:
+		return v
+	}
+	c.invalid(key, "string")
+	return dv
+}
+
+// Duration returns the duration value of the key or the default
+// value. Numbers are taken as seconds.
+func (c *Config) Duration(key string, dv time.Duration) time.Duration {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case time.Duration:
+		return v
+	case string:
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+	case int:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	c.invalid(key, "duration")
+	return dv
+}
+
+// Strings returns the string list value of the key or the default
+// value.
+func (c *Config) Strings(key string, dv []string) []string {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case []string:
+		return v
+	case []interface{}:
+		ss := make([]string, len(v))
+		for i, iv := range v {
+			s, ok := iv.(string)
+			if !ok {
+				c.invalid(key, "string list")
+				return dv
+			}
+			ss[i] = s
+		}
+		return ss
+	}
+	c.invalid(key, "string list")
+	return dv
+}
+
+// StringMap returns the string map value of the key or the default
+// value.
+func (c *Config) StringMap(key string, dv map[string]string) map[string]string {
+	switch v := c.value(key).(type) {
+	case nil:
+		return dv
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		sm := make(map[string]string, len(v))
+		for k, iv := range v {
+			s, ok := iv.(string)
+			if !ok {
+				c.invalid(key, "string map")
+				return dv
+			}
+			sm[k] = s
+		}
+		return sm
+	}
+	c.invalid(key, "string map")
+	return dv
+}
+
+// Options returns the behavior options configured with the keys
+// "emit-topics" and "payload-keys", both maps of the standard
+// names to the custom ones.
+func (c *Config) Options() []Option {
+	var opts []Option
+	for topic, custom := range c.StringMap("emit-topics", nil) {
+		opts = append(opts, WithEmitTopic(topic, custom))
+	}
+	if keys := c.StringMap("payload-keys", nil); keys != nil {
+		opts = append(opts, WithPayloadKeys(keys))
+	}
+	return opts
+}
+
+// notifierOptions returns the options of notifiers configured with
+// the keys "rate-limit", "rate-period", "dedup-window", and "endpoint".
+func (c *Config) notifierOptions() []Option {
+	return append(c.Options(),
+		WithRateLimit(c.Int("rate-limit", 0), c.Duration("rate-period", time.Minute)),
+		WithDedupWindow(c.Duration("dedup-window", 0)),
+		WithEndpoint(c.String("endpoint", "")),
+	)
+}
+
+// Err returns the first invalid value or, if all have been valid,
+// an error for keys not read by the factory.
+func (c *Config) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	var unknown []string
+	for key := range c.values {
+		if !c.read[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.fail("unknown values %s", strings.Join(unknown, ", "))
+	}
+	return c.err
+}
+
+// value returns the raw value of the key and marks it as read.
+func (c *Config) value(key string) interface{} {
+	c.read[key] = true
+	return c.values[key]
+}
+
+// invalid keeps an error for a value of a wrong type.
+func (c *Config) invalid(key, kind string) {
+	c.fail("value %q is no %s", key, kind)
+}
+
+// fail keeps the first error.
+func (c *Config) fail(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = errors.New(ErrInvalidConfiguration, errorMessages, c.name, fmt.Sprintf(format, args...))
+	}
+}
+
+//--------------------
+// REGISTRY
+//--------------------
+
+// Factory creates a behavior out of its configuration.
+type Factory func(config *Config) (cells.Behavior, error)
+
+// registry contains the factories by name.
+var registry = struct {
+	mutex     sync.RWMutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+// Register adds a factory for behaviors with the given name, so they
+// can be created by New(), e.g. for topologies loaded from configuration
+// files. Names can be registered only once and the factory must not
+// be nil.
+func Register(name string, factory Factory) error {
+	if factory == nil {
+		return errors.New(ErrInvalidConfiguration, errorMessages, name, "no factory")
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.factories[name]; ok {
+		return errors.New(ErrDuplicateBehavior, errorMessages, name)
+	}
+	registry.factories[name] = factory
+	return nil
+}
+
+// New creates a behavior by the name of its registered factory and
+// the configuration. Invalid or unknown configuration values lead to
+// an error. Its signature matches cells.BehaviorFactory, so it can
+// directly be used to restore topologies.
+func New(name string, config map[string]interface{}) (cells.Behavior, error) {
+	registry.mutex.RLock()
+	factory, ok := registry.factories[name]
+	registry.mutex.RUnlock()
+	if !ok {
+		return nil, errors.New(ErrUnknownBehavior, errorMessages, name)
+	}
+	cfg := newConfig(name, config)
+	behavior, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Err(); err != nil {
+		return nil, err
+	}
+	return behavior, nil
+}
+
+// Registered returns the sorted names of all registered factories.
+func Registered() []string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ensure New can be used to restore topologies.
+var _ cells.BehaviorFactory = New
+
+//--------------------
+// BUILT-IN BEHAVIORS
+//--------------------
+
+// init registers the built-in behaviors which can be created
+// without functions as arguments.
+func init() {
+	builtins := map[string]Factory{
+		"broadcaster": func(cfg *Config) (cells.Behavior, error) {
+			return NewBroadcasterBehavior(), nil
+		},
+		"collector": func(cfg *Config) (cells.Behavior, error) {
+			opts := append(cfg.Options(), WithMaxAge(cfg.Duration("max-age", 0)))
+			return NewCollectorBehavior(cfg.Int("max", 0), opts...), nil
+		},
+		"fs-watcher": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("paths")
+			paths := cfg.Strings("paths", nil)
+			recursive := cfg.Bool("recursive", false)
+			opts := append(cfg.Options(), WithInterval(cfg.Duration("interval", 0)))
+			return NewFSWatcherBehavior(paths, recursive, opts...), nil
+		},
+		"heartbeat": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("interval")
+			interval := cfg.Duration("interval", 0)
+			missed := cfg.Int("missed-threshold", 1)
+			return NewHeartbeatBehavior(interval, missed, cfg.Options()...), nil
+		},
+		"http-poll": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("url", "interval")
+			url := cfg.String("url", "")
+			interval := cfg.Duration("interval", 0)
+			etag := cfg.Bool("etag", false)
+			return NewHTTPPollSourceBehavior(url, interval, nil, etag), nil
+		},
+		"load-balancer": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("targets")
+			targets := cfg.Strings("targets", nil)
+			var strategy Strategy
+			switch s := cfg.String("strategy", "round-robin"); s {
+			case "round-robin":
+				strategy = RoundRobinStrategy()
+			case "least-queue":
+				strategy = LeastQueueStrategy()
+			default:
+				cfg.fail("unknown strategy %q", s)
+			}
+			return NewLoadBalancerBehavior(targets, strategy), nil
+		},
+		"log-parser": func(cfg *Config) (cells.Behavior, error) {
+			var format LogFormat
+			switch f := cfg.String("format", "json"); f {
+			case "json":
+				format = LogFormatJSON
+			case "logfmt":
+				format = LogFormatLogfmt
+			case "common":
+				format = LogFormatCommon
+			case "combined":
+				format = LogFormatCombined
+			default:
+				cfg.fail("unknown format %q", f)
+			}
+			return NewLogParserBehavior(format, cfg.Options()...), nil
+		},
+		"logger": func(cfg *Config) (cells.Behavior, error) {
+			return NewLoggerBehavior(), nil
+		},
+		"pager-duty-sink": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("routing-key", "template")
+			routingKey := cfg.String("routing-key", "")
+			severity := cfg.String("severity", "error")
+			template := cfg.String("template", "")
+			return NewPagerDutySinkBehavior(routingKey, severity, template, cfg.notifierOptions()...), nil
+		},
+		"round-robin": func(cfg *Config) (cells.Behavior, error) {
+			return NewRoundRobinBehavior(), nil
+		},
+		"probe": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("path", "interval")
+			path := cfg.Strings("path", nil)
+			interval := cfg.Duration("interval", 0)
+			return NewProbeBehavior(path, interval, cfg.Options()...), nil
+		},
+		"slack-sink": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("webhook", "template")
+			webhook := cfg.String("webhook", "")
+			template := cfg.String("template", "")
+			return NewSlackSinkBehavior(webhook, template, cfg.notifierOptions()...), nil
+		},
+		"stdout-sink": func(cfg *Config) (cells.Behavior, error) {
+			return NewStdoutSinkBehavior(nil), nil
+		},
+		"ticker": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("duration")
+			return NewTickerBehavior(cfg.Duration("duration", 0), cfg.Options()...), nil
+		},
+		"unbatcher": func(cfg *Config) (cells.Behavior, error) {
+			cfg.Require("key")
+			return NewUnbatcherBehavior(UnbatchKey(cfg.String("key", "")), cfg.Options()...), nil
+		},
+	}
+	for name, factory := range builtins {
+		Register(name, factory)
+	}
+}
+
+// EOF
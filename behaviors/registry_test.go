@@ -0,0 +1,86 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Registry
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestRegistry tests creating behaviors by name.
+func TestRegistry(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("registry")
+	defer env.Stop()
+
+	assert.True(len(behaviors.Registered()) > 0)
+
+	// Register a custom factory.
+	defer behaviors.Unregister("test-threshold")
+	err := behaviors.Register("test-nil", nil)
+	assert.ErrorMatch(err, ".*no factory.*")
+	err = behaviors.Register("test-threshold", func(cfg *behaviors.Config) (cells.Behavior, error) {
+		cfg.Require("limit")
+		limit := cfg.Float64("limit", 0)
+		return behaviors.NewFilterBehavior(func(event cells.Event) (bool, error) {
+			return event.Payload().GetFloat64(cells.PayloadDefault, 0) > limit, nil
+		}), cfg.Err()
+	})
+	assert.Nil(err)
+	err = behaviors.Register("test-threshold", func(cfg *behaviors.Config) (cells.Behavior, error) {
+		return behaviors.NewBroadcasterBehavior(), nil
+	})
+	assert.ErrorMatch(err, ".*already registered.*")
+
+	// Create behaviors with valid and invalid configurations.
+	_, err = behaviors.New("unknown", nil)
+	assert.ErrorMatch(err, ".*not registered.*")
+	_, err = behaviors.New("test-threshold", nil)
+	assert.ErrorMatch(err, `.*missing value "limit".*`)
+	_, err = behaviors.New("test-threshold", map[string]interface{}{"limit": "high"})
+	assert.ErrorMatch(err, `.*value "limit" is no float.*`)
+	_, err = behaviors.New("collector", map[string]interface{}{"max": 10.0, "size": 5.0})
+	assert.ErrorMatch(err, `.*unknown values size.*`)
+	_, err = behaviors.New("ticker", map[string]interface{}{"duration": "soon"})
+	assert.ErrorMatch(err, `.*value "duration" is no duration.*`)
+
+	filter, err := behaviors.New("test-threshold", map[string]interface{}{"limit": 5})
+	assert.Nil(err)
+	collector, err := behaviors.New("collector", map[string]interface{}{"max": 10.0})
+	assert.Nil(err)
+
+	env.StartCell("filter", filter)
+	env.StartCell("collector", collector)
+	env.Subscribe("filter", "collector")
+
+	for _, value := range []float64{1, 6, 3, 9} {
+		env.EmitNew(context.Background(), "filter", "value", value)
+	}
+	err = env.Barrier(context.Background(), "filter", "collector")
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 2)
+}
+
+// EOF
@@ -0,0 +1,194 @@
+// Tideland Go Cells - Behaviors - Standard I/O
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/codec"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicLine labels an event containing a read line when
+	// no parser is used.
+	TopicLine = "line"
+
+	// topicSourceLine lets the source process a read line.
+	topicSourceLine = "source-line!"
+
+	// maxLineLength is the maximum length of a read line.
+	maxLineLength = 1024 * 1024
+)
+
+//--------------------
+// SOURCE BEHAVIOR
+//--------------------
+
+// LineParser parses a read line into the topic and the payload
+// of the event to emit.
+type LineParser func(line string) (string, interface{}, error)
+
+// sourceBehavior emits events for the lines of a reader.
+type sourceBehavior struct {
+	cell   cells.Cell
+	reader io.Reader
+	parser LineParser
+	stopc  chan struct{}
+}
+
+// NewStdinSourceBehavior creates a behavior reading lines from stdin,
+// parsing them, and emitting the results as events. So a pipeline
+// can be part of a Unix pipe. Without a parser the lines are emitted
+// with the topic "line" and the line as default payload. Lines which
+// cannot be parsed are logged and skipped.
+func NewStdinSourceBehavior(parser LineParser) cells.Behavior {
+	return NewReaderSourceBehavior(os.Stdin, parser)
+}
+
+// NewReaderSourceBehavior works like NewStdinSourceBehavior() but
+// reads from the passed reader.
+func NewReaderSourceBehavior(r io.Reader, parser LineParser) cells.Behavior {
+	if parser == nil {
+		parser = func(line string) (string, interface{}, error) {
+			return TopicLine, line, nil
+		}
+	}
+	return &sourceBehavior{
+		reader: r,
+		parser: parser,
+		stopc:  make(chan struct{}),
+	}
+}
+
+// Init the behavior.
+func (b *sourceBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	go b.readLines()
+	return nil
+}
+
+// Terminate the behavior. A reader blocked in reading is not
+// interrupted, but its following lines aren't emitted anymore.
+func (b *sourceBehavior) Terminate() error {
+	close(b.stopc)
+	return nil
+}
+
+// ProcessEvent parses read lines and emits the results.
+func (b *sourceBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != topicSourceLine {
+		return nil
+	}
+	line := event.Payload().GetString(cells.PayloadDefault, "")
+	topic, payload, err := b.parser(line)
+	if err != nil {
+		logger.Warningf("source %q cannot parse line %q: %v", b.cell.ID(), line, err)
+		return nil
+	}
+	return b.cell.EmitNew(event.Context(), topic, payload)
+}
+
+// Recover from an error.
+func (b *sourceBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// readLines reads the lines and lets the cell process them.
+func (b *sourceBehavior) readLines() {
+	scanner := bufio.NewScanner(b.reader)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+	for scanner.Scan() {
+		select {
+		case <-b.stopc:
+			return
+		default:
+		}
+		err := b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), topicSourceLine, scanner.Text())
+		if err != nil {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Errorf("source %q cannot read lines: %v", b.cell.ID(), err)
+	}
+}
+
+//--------------------
+// SINK BEHAVIOR
+//--------------------
+
+// EventFormatter formats an event as one line of output.
+type EventFormatter func(event cells.Event) ([]byte, error)
+
+// sinkBehavior writes received events as lines to a writer.
+type sinkBehavior struct {
+	cell      cells.Cell
+	writer    io.Writer
+	formatter EventFormatter
+}
+
+// NewStdoutSinkBehavior creates a behavior writing each received event
+// as one line to stdout. Without a formatter the events are written as
+// JSON, so they can be processed by tools like jq.
+func NewStdoutSinkBehavior(formatter EventFormatter) cells.Behavior {
+	return NewWriterSinkBehavior(os.Stdout, formatter)
+}
+
+// NewWriterSinkBehavior works like NewStdoutSinkBehavior() but writes
+// to the passed writer.
+func NewWriterSinkBehavior(w io.Writer, formatter EventFormatter) cells.Behavior {
+	if formatter == nil {
+		formatter = codec.NewJSONCodec().Encode
+	}
+	return &sinkBehavior{
+		writer:    w,
+		formatter: formatter,
+	}
+}
+
+// Init the behavior.
+func (b *sinkBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *sinkBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent writes the formatted event.
+func (b *sinkBehavior) ProcessEvent(event cells.Event) error {
+	line, err := b.formatter(event)
+	if err != nil {
+		return err
+	}
+	_, err = b.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Recover from an error.
+func (b *sinkBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// EOF
@@ -0,0 +1,79 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Standard I/O
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSourceSinkBehaviors tests reading lines as events
+// and writing events as lines.
+func TestSourceSinkBehaviors(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("source-sink-behaviors")
+	defer env.Stop()
+
+	input := strings.NewReader("error disk full\ninfo started\nbroken\nerror network down\n")
+	parser := func(line string) (string, interface{}, error) {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return "", nil, errors.New("invalid line")
+		}
+		return parts[0], parts[1], nil
+	}
+	filter := func(event cells.Event) (bool, error) {
+		return event.Topic() == "error", nil
+	}
+	var output bytes.Buffer
+
+	env.StartCell("filter", behaviors.NewFilterBehavior(filter))
+	env.StartCell("stdout", behaviors.NewWriterSinkBehavior(&output, nil))
+	env.Subscribe("filter", "stdout")
+	env.StartCell("stdin", behaviors.NewReaderSourceBehavior(input, parser))
+	env.Subscribe("stdin", "filter")
+
+	time.Sleep(50 * time.Millisecond)
+	err := env.Barrier(context.Background())
+	assert.Nil(err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Length(lines, 2)
+	messages := []string{}
+	for _, line := range lines {
+		var decoded struct {
+			Topic   string
+			Payload map[string]interface{}
+		}
+		err := json.Unmarshal([]byte(line), &decoded)
+		assert.Nil(err)
+		assert.Equal(decoded.Topic, "error")
+		messages = append(messages, decoded.Payload[cells.PayloadDefault].(string))
+	}
+	assert.Equal(messages, []string{"disk full", "network down"})
+}
+
+// EOF
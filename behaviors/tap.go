@@ -0,0 +1,172 @@
+// Tideland Go Cells - Behaviors - Tap
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// Redacted replaces the values of redacted payload keys.
+	Redacted = "[REDACTED]"
+)
+
+//--------------------
+// FORMATTER
+//--------------------
+
+// TapRecord contains the data of an event written by the tap behavior.
+type TapRecord struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Cell      string                 `json:"cell"`
+	ID        string                 `json:"id,omitempty"`
+	Emitter   string                 `json:"emitter,omitempty"`
+	Topic     string                 `json:"topic"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+}
+
+// Formatter writes a tap record to a writer.
+type Formatter func(w io.Writer, record *TapRecord) error
+
+// JSONFormatter writes each record as one line of JSON.
+func JSONFormatter() Formatter {
+	return func(w io.Writer, record *TapRecord) error {
+		return json.NewEncoder(w).Encode(record)
+	}
+}
+
+// LogfmtFormatter writes each record as one line of logfmt. The
+// payload values are written with the prefix "payload." and sorted
+// by their keys.
+func LogfmtFormatter() Formatter {
+	return func(w io.Writer, record *TapRecord) error {
+		parts := []string{
+			"timestamp=" + record.Timestamp.Format(time.RFC3339Nano),
+			"cell=" + logfmtValue(record.Cell),
+		}
+		if record.ID != "" {
+			parts = append(parts, "id="+logfmtValue(record.ID))
+		}
+		if record.Emitter != "" {
+			parts = append(parts, "emitter="+logfmtValue(record.Emitter))
+		}
+		parts = append(parts, "topic="+logfmtValue(record.Topic))
+		keys := make([]string, 0, len(record.Payload))
+		for key := range record.Payload {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parts = append(parts, "payload."+key+"="+logfmtValue(fmt.Sprintf("%v", record.Payload[key])))
+		}
+		_, err := io.WriteString(w, strings.Join(parts, " ")+"\n")
+		return err
+	}
+}
+
+// logfmtValue quotes a value if needed.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+//--------------------
+// TAP BEHAVIOR
+//--------------------
+
+// tapBehavior writes all received events and emits them.
+type tapBehavior struct {
+	cell   cells.Cell
+	w      io.Writer
+	format Formatter
+	redact map[string]bool
+}
+
+// NewTapBehavior creates a behavior writing each received event to the
+// writer, e.g. a file or stderr, before it emits the event unchanged. So
+// it can be placed as a debugging tap anywhere in a topology. Without
+// formatter the events are written as JSON. The values of the payload
+// keys to redact are replaced by "[REDACTED]". Failing writes are logged
+// but don't stop the emitting.
+func NewTapBehavior(w io.Writer, format Formatter, redact []string) cells.Behavior {
+	if format == nil {
+		format = JSONFormatter()
+	}
+	b := &tapBehavior{
+		w:      w,
+		format: format,
+		redact: make(map[string]bool, len(redact)),
+	}
+	for _, key := range redact {
+		b.redact[key] = true
+	}
+	return b
+}
+
+// Init the behavior.
+func (b *tapBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *tapBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent writes the event and emits it.
+func (b *tapBehavior) ProcessEvent(event cells.Event) error {
+	record := &TapRecord{
+		Timestamp: event.Timestamp(),
+		Cell:      b.cell.ID(),
+		ID:        event.ID(),
+		Emitter:   event.Emitter(),
+		Topic:     event.Topic(),
+	}
+	if payload := event.Payload(); payload != nil && payload.Len() > 0 {
+		record.Payload = make(map[string]interface{}, payload.Len())
+		payload.Do(func(key string, value interface{}) error {
+			if b.redact[key] {
+				value = Redacted
+			}
+			record.Payload[key] = value
+			return nil
+		})
+	}
+	if err := b.format(b.w, record); err != nil {
+		logger.Warningf("tap '%s' cannot write event '%s': %v", b.cell.ID(), event.Topic(), err)
+	}
+	return b.cell.Emit(event)
+}
+
+// Recover from an error.
+func (b *tapBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// EOF
@@ -0,0 +1,85 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Tap
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTapBehavior tests the writing and emitting of events.
+func TestTapBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	tests := []struct {
+		name   string
+		format behaviors.Formatter
+		check  func(line string)
+	}{
+		{"json", behaviors.JSONFormatter(), func(line string) {
+			var record behaviors.TapRecord
+			err := json.Unmarshal([]byte(line), &record)
+			assert.Nil(err)
+			assert.Equal(record.Cell, "tap")
+			assert.Equal(record.Topic, "login")
+			assert.Equal(record.Payload, map[string]interface{}{
+				"user":     "alice",
+				"password": behaviors.Redacted,
+			})
+		}},
+		{"logfmt", behaviors.LogfmtFormatter(), func(line string) {
+			assert.Contents("cell=tap", line)
+			assert.Contents("topic=login", line)
+			assert.True(strings.HasSuffix(line, `payload.password=[REDACTED] payload.user=alice`))
+		}},
+	}
+	for _, test := range tests {
+		assert.Logf("format %s", test.name)
+		env := cells.NewEnvironment("tap-behavior", test.name)
+		buf := &bytes.Buffer{}
+		env.StartCell("tap", behaviors.NewTapBehavior(buf, test.format, []string{"password"}))
+		env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+		env.Subscribe("tap", "collector")
+
+		env.EmitNew(context.Background(), "tap", "login", cells.PayloadValues{
+			"user":     "alice",
+			"password": "secret",
+		})
+		err := env.Barrier(context.Background())
+		assert.Nil(err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Length(lines, 1)
+		test.check(lines[0])
+
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		assert.Length(accessor, 1)
+		event, _ := accessor.PeekFirst()
+		assert.Equal(event.Payload().GetString("password", ""), "secret")
+		env.Stop()
+	}
+}
+
+// EOF
@@ -0,0 +1,198 @@
+// Tideland Go Cells - Behaviors - Threshold
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicAlertRaised signals that a threshold rule raised an alert.
+	TopicAlertRaised = "alert-raised"
+
+	// TopicAlertCleared signals that a raised alert has been cleared.
+	TopicAlertCleared = "alert-cleared"
+
+	// PayloadAlertRule contains the name of the threshold rule.
+	PayloadAlertRule = "alert:rule"
+
+	// PayloadAlertValue contains the value raising or clearing the alert.
+	PayloadAlertValue = "alert:value"
+
+	// PayloadAlertLimit contains the limit of the threshold rule.
+	PayloadAlertLimit = "alert:limit"
+
+	// PayloadAlertDuration contains how long the limit has been crossed
+	// when raising, and how long the alert has been raised when clearing.
+	PayloadAlertDuration = "alert:duration"
+)
+
+// ThresholdKind defines in which direction a limit is crossed.
+type ThresholdKind int
+
+// Kinds of threshold rules.
+const (
+	// ThresholdAbove raises an alert for values above the limit.
+	ThresholdAbove ThresholdKind = iota
+
+	// ThresholdBelow raises an alert for values below the limit.
+	ThresholdBelow
+)
+
+//--------------------
+// THRESHOLD BEHAVIOR
+//--------------------
+
+// ThresholdRule defines when an alert is raised and cleared. It is
+// raised when the values cross the limit in the direction of the kind
+// for at least the sustain duration. It is cleared when the values
+// are back behind the limit by more than the hysteresis.
+type ThresholdRule struct {
+	Name       string
+	Kind       ThresholdKind
+	Limit      float64
+	Hysteresis float64
+	Sustain    time.Duration
+}
+
+// crossed checks if the value crosses the limit.
+func (r ThresholdRule) crossed(value float64) bool {
+	if r.Kind == ThresholdBelow {
+		return value < r.Limit
+	}
+	return value > r.Limit
+}
+
+// cleared checks if the value is back behind the limit
+// including the hysteresis.
+func (r ThresholdRule) cleared(value float64) bool {
+	if r.Kind == ThresholdBelow {
+		return value > r.Limit+r.Hysteresis
+	}
+	return value < r.Limit-r.Hysteresis
+}
+
+// thresholdState contains the state of one rule.
+type thresholdState struct {
+	crossing bool
+	since    time.Time
+	raised   bool
+	raisedAt time.Time
+}
+
+// thresholdBehavior implements the threshold behavior.
+type thresholdBehavior struct {
+	cell    cells.Cell
+	extract func(cells.Event) float64
+	rules   []ThresholdRule
+	states  []thresholdState
+	options *options
+}
+
+// NewThresholdBehavior creates a behavior extracting a value out of
+// each received event and checking it against the rules. Alerts
+// are raised with the topic "alert-raised" and cleared with the
+// topic "alert-cleared". The sustain durations are checked when
+// events are received.
+func NewThresholdBehavior(extract func(cells.Event) float64, rules []ThresholdRule, opts ...Option) cells.Behavior {
+	return &thresholdBehavior{
+		extract: extract,
+		rules:   rules,
+		states:  make([]thresholdState, len(rules)),
+		options: newOptions(opts...),
+	}
+}
+
+// Init implements the cells.Behavior interface.
+func (b *thresholdBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *thresholdBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *thresholdBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() == cells.TopicReset {
+		b.states = make([]thresholdState, len(b.rules))
+		return nil
+	}
+	now := b.options.now()
+	value := b.extract(event)
+	for i, rule := range b.rules {
+		state := &b.states[i]
+		if state.raised {
+			if rule.cleared(value) {
+				state.raised = false
+				state.crossing = false
+				b.emit(event, TopicAlertCleared, rule, value, now.Sub(state.raisedAt))
+			}
+			continue
+		}
+		if !rule.crossed(value) {
+			state.crossing = false
+			continue
+		}
+		if !state.crossing {
+			state.crossing = true
+			state.since = now
+		}
+		if now.Sub(state.since) >= rule.Sustain {
+			state.raised = true
+			state.raisedAt = now
+			b.emit(event, TopicAlertRaised, rule, value, now.Sub(state.since))
+		}
+	}
+	return nil
+}
+
+// Configure replaces the rules with the ones contained in the
+// payload key "config:rules". The states of the alerts are reset.
+func (b *thresholdBehavior) Configure(config cells.Payload) error {
+	if config.Get(PayloadConfigRules, nil) == nil {
+		return nil
+	}
+	rules, ok := config.Get(PayloadConfigRules, nil).([]ThresholdRule)
+	if !ok {
+		return invalidConfig(b.cell, "%q has to be a list of threshold rules", PayloadConfigRules)
+	}
+	b.rules = rules
+	b.states = make([]thresholdState, len(rules))
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *thresholdBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// emit emits an alert event.
+func (b *thresholdBehavior) emit(event cells.Event, topic string, rule ThresholdRule, value float64, duration time.Duration) {
+	pvs := cells.PayloadValues{
+		PayloadAlertRule:     rule.Name,
+		PayloadAlertValue:    value,
+		PayloadAlertLimit:    rule.Limit,
+		PayloadAlertDuration: duration,
+	}
+	b.cell.EmitNew(event.Context(), b.options.topic(topic), b.options.payload(pvs))
+}
+
+// EOF
@@ -0,0 +1,88 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Threshold
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestThresholdBehavior tests raising and clearing of alerts.
+func TestThresholdBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("threshold-behavior")
+	defer env.Stop()
+
+	var mutex sync.Mutex
+	now := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	extract := func(event cells.Event) float64 {
+		return event.Payload().GetFloat64(cells.PayloadDefault, 0)
+	}
+	rules := []behaviors.ThresholdRule{
+		{Name: "high", Kind: behaviors.ThresholdAbove, Limit: 80, Hysteresis: 10, Sustain: 2 * time.Second},
+		{Name: "low", Kind: behaviors.ThresholdBelow, Limit: 10},
+	}
+
+	env.StartCell("threshold", behaviors.NewThresholdBehavior(extract, rules, behaviors.WithClock(clock)))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("threshold", "collector")
+
+	for _, value := range []float64{50, 85, 90, 95, 75, 65, 5, 20} {
+		env.EmitNew(context.Background(), "threshold", "value", value)
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		now = now.Add(time.Second)
+		mutex.Unlock()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 4)
+	expected := []struct {
+		topic    string
+		rule     string
+		value    float64
+		duration time.Duration
+	}{
+		{behaviors.TopicAlertRaised, "high", 95, 2 * time.Second},
+		{behaviors.TopicAlertCleared, "high", 65, 2 * time.Second},
+		{behaviors.TopicAlertRaised, "low", 5, 0},
+		{behaviors.TopicAlertCleared, "low", 20, time.Second},
+	}
+	accessor.Do(func(index int, event cells.Event) error {
+		pl := event.Payload()
+		assert.Equal(event.Topic(), expected[index].topic)
+		assert.Equal(pl.GetString(behaviors.PayloadAlertRule, ""), expected[index].rule)
+		assert.Equal(pl.GetFloat64(behaviors.PayloadAlertValue, 0), expected[index].value)
+		assert.Equal(pl.GetDuration(behaviors.PayloadAlertDuration, -1), expected[index].duration)
+		return nil
+	})
+}
+
+// EOF
@@ -13,6 +13,7 @@ package behaviors
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/tideland/gocells/cells"
@@ -42,14 +43,17 @@ const (
 // tickerBehavior emits events in chronological order.
 type tickerBehavior struct {
 	cell     cells.Cell
-	duration time.Duration
+	duration int64
 	loop     loop.Loop
+	options  *options
 }
 
-// NewTickerBehavior creates a ticker behavior.
-func NewTickerBehavior(duration time.Duration) cells.Behavior {
+// NewTickerBehavior creates a ticker behavior. The clock, the emitted
+// topic, and the payload keys can be changed by options.
+func NewTickerBehavior(duration time.Duration, opts ...Option) cells.Behavior {
 	return &tickerBehavior{
-		duration: duration,
+		duration: int64(duration),
+		options:  newOptions(opts...),
 	}
 }
 
@@ -71,13 +75,25 @@ func (b *tickerBehavior) ProcessEvent(event cells.Event) error {
 	if event.Topic() == TopicTicker {
 		pvs := cells.PayloadValues{
 			PayloadTickerID:   b.cell.ID(),
-			PayloadTickerTime: time.Now(),
+			PayloadTickerTime: b.options.now(),
 		}
-		b.cell.EmitNew(event.Context(), TopicTicker, pvs)
+		b.cell.EmitNew(event.Context(), b.options.topic(TopicTicker), b.options.payload(pvs))
 	}
 	return nil
 }
 
+// Configure changes the interval of the ticks with "config:duration".
+// It is used after the next tick.
+func (b *tickerBehavior) Configure(config cells.Payload) error {
+	current := time.Duration(atomic.LoadInt64(&b.duration))
+	duration, err := configDuration(b.cell, config, PayloadConfigDuration, current)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&b.duration, int64(duration))
+	return nil
+}
+
 // Recover from an error. Counter will be set back to the initial counter.
 func (b *tickerBehavior) Recover(err interface{}) error {
 	return nil
@@ -89,7 +105,7 @@ func (b *tickerBehavior) tickerLoop(l loop.Loop) error {
 		select {
 		case <-l.ShallStop():
 			return nil
-		case now := <-time.After(b.duration):
+		case now := <-time.After(time.Duration(atomic.LoadInt64(&b.duration))):
 			// Notify myself, action there to avoid
 			// race when subscribers are updated.
 			b.cell.Environment().EmitNew(context.Background(), b.cell.ID(), TopicTicker, now)
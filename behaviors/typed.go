@@ -0,0 +1,122 @@
+// Tideland Go Cells - Behaviors - Typed
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicDeadLetter labels events a typed behavior cannot decode.
+	TopicDeadLetter = "dead-letter"
+
+	// PayloadDeadLetterCell contains the ID of the cell which
+	// could not decode the event.
+	PayloadDeadLetterCell = "dead-letter:cell"
+
+	// PayloadDeadLetterTopic contains the topic of the event.
+	PayloadDeadLetterTopic = "dead-letter:topic"
+
+	// PayloadDeadLetterPayload contains the payload of the event.
+	PayloadDeadLetterPayload = "dead-letter:payload"
+
+	// PayloadDeadLetterError contains the decoding error.
+	PayloadDeadLetterError = "dead-letter:error"
+)
+
+//--------------------
+// TYPED BEHAVIOR
+//--------------------
+
+// Emitter allows typed handlers to emit events to the subscribers
+// of their cell.
+type Emitter interface {
+	// Emit emits an event to all subscribers.
+	Emit(event cells.Event) error
+
+	// EmitNew creates an event and emits it to all subscribers.
+	EmitNew(ctx context.Context, topic string, payload interface{}) error
+}
+
+// typedBehavior decodes events into values of type T.
+type typedBehavior[T any] struct {
+	cell    cells.Cell
+	decode  func(event cells.Event) (T, error)
+	handle  func(ctx context.Context, value T, emitter Emitter) error
+	options *options
+}
+
+// Typed creates a behavior working with values of a domain type
+// instead of payloads. Each received event is decoded into a value
+// passed to the handler together with the context of the event and
+// an emitter. Events which cannot be decoded are emitted with the
+// topic "dead-letter", their topic, their payload, and the error,
+// so they are not lost. The dead-letter topic and its payload keys
+// can be changed by options. Errors of the handler are returned
+// like by any behavior.
+func Typed[T any](decode func(event cells.Event) (T, error), handle func(ctx context.Context, value T, emitter Emitter) error, opts ...Option) cells.Behavior {
+	return &typedBehavior[T]{
+		decode:  decode,
+		handle:  handle,
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *typedBehavior[T]) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *typedBehavior[T]) Terminate() error {
+	return nil
+}
+
+// ProcessEvent decodes the event and lets it handle.
+func (b *typedBehavior[T]) ProcessEvent(event cells.Event) error {
+	value, err := b.decode(event)
+	if err != nil {
+		return b.cell.EmitNew(event.Context(), b.options.topic(TopicDeadLetter), b.options.payload(cells.PayloadValues{
+			PayloadDeadLetterCell:    b.cell.ID(),
+			PayloadDeadLetterTopic:   event.Topic(),
+			PayloadDeadLetterPayload: event.Payload(),
+			PayloadDeadLetterError:   err.Error(),
+		}))
+	}
+	return b.handle(event.Context(), value, b.cell)
+}
+
+// Recover from an error.
+func (b *typedBehavior[T]) Recover(err interface{}) error {
+	return nil
+}
+
+// DecodeDefault decodes the default payload value of an event if
+// it has the type T. It can be passed directly to Typed().
+func DecodeDefault[T any](event cells.Event) (T, error) {
+	value, ok := event.Payload().GetDefault(nil).(T)
+	if !ok {
+		return value, errors.New(ErrInvalidPayload, errorMessages, cells.PayloadDefault)
+	}
+	return value, nil
+}
+
+// EOF
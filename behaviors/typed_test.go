@@ -0,0 +1,67 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Typed
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/celltest"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// order is a domain type for the typed behavior test.
+type order struct {
+	ID     string
+	Amount float64
+}
+
+// TestTypedBehavior tests handling decoded domain values and
+// emitting undecodable events as dead letters.
+func TestTypedBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	handle := func(ctx context.Context, o order, emitter behaviors.Emitter) error {
+		if o.Amount < 100 {
+			return nil
+		}
+		return emitter.EmitNew(ctx, "large-order", o.ID)
+	}
+	tester, err := celltest.NewTester(behaviors.Typed(behaviors.DecodeDefault[order], handle))
+	assert.Nil(err)
+	defer tester.Stop()
+
+	tester.Emit("order", order{"a", 50})
+	tester.Emit("order", order{"b", 150})
+	tester.Emit("order", "garbage")
+
+	celltest.AssertEmitted(t, tester, celltest.MatchPayload("large-order", cells.PayloadValues{
+		cells.PayloadDefault: "b",
+	}))
+	dead := celltest.AssertEmitted(t, tester, celltest.MatchPayload(behaviors.TopicDeadLetter, cells.PayloadValues{
+		behaviors.PayloadDeadLetterCell:  celltest.TestedID,
+		behaviors.PayloadDeadLetterTopic: "order",
+	}))
+	assert.Length(tester.Emitted(), 2)
+	assert.Contents("does not exist or has wrong type", dead.Payload().GetString(behaviors.PayloadDeadLetterError, ""))
+	payload, ok := dead.Payload().Get(behaviors.PayloadDeadLetterPayload, nil).(cells.Payload)
+	assert.True(ok)
+	assert.Equal(payload.GetString(cells.PayloadDefault, ""), "garbage")
+}
+
+// EOF
@@ -0,0 +1,132 @@
+// Tideland Go Cells - Behaviors - Unbatcher
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicUnbatched labels the single events split out of a batch.
+	TopicUnbatched = "unbatched"
+
+	// PayloadUnbatchIndex contains the index of the single event
+	// inside of its batch.
+	PayloadUnbatchIndex = "unbatch:index"
+
+	// PayloadUnbatchSize contains the number of events of the batch.
+	PayloadUnbatchSize = "unbatch:size"
+
+	// PayloadUnbatchBatchID contains the ID of the batch event, if
+	// the environment has an ID generator.
+	PayloadUnbatchBatchID = "unbatch:batch-id"
+)
+
+//--------------------
+// UNBATCHER BEHAVIOR
+//--------------------
+
+// UnbatchFunc extracts the payloads of the single events
+// out of a batch event.
+type UnbatchFunc func(event cells.Event) []cells.Payload
+
+// unbatcherBehavior splits batch events into single ones.
+type unbatcherBehavior struct {
+	cell    cells.Cell
+	extract UnbatchFunc
+	options *options
+}
+
+// NewUnbatcherBehavior creates a behavior splitting received batch
+// events into single ones. Each payload returned by the extract
+// function is emitted in order with the topic "unbatched" and the
+// index, the size, and the ID of the batch added. They are emitted
+// with the context of the batch event, so correlation values and the
+// causation are propagated. The emitted topic and the payload keys
+// can be changed by options.
+func NewUnbatcherBehavior(extract UnbatchFunc, opts ...Option) cells.Behavior {
+	return &unbatcherBehavior{
+		extract: extract,
+		options: newOptions(opts...),
+	}
+}
+
+// Init the behavior.
+func (b *unbatcherBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *unbatcherBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent emits the single events of the batch.
+func (b *unbatcherBehavior) ProcessEvent(event cells.Event) error {
+	payloads := b.extract(event)
+	topic := b.options.topic(TopicUnbatched)
+	for i, payload := range payloads {
+		values := cells.PayloadValues{
+			PayloadUnbatchIndex: i,
+			PayloadUnbatchSize:  len(payloads),
+		}
+		if event.ID() != "" {
+			values[PayloadUnbatchBatchID] = event.ID()
+		}
+		if payload == nil {
+			payload = cells.EmptyPayload()
+		}
+		if err := b.cell.EmitNew(event.Context(), topic, payload.Apply(b.options.payload(values))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *unbatcherBehavior) Recover(err interface{}) error {
+	return nil
+}
+
+// UnbatchKey returns an extract function for batches stored as
+// list with the key in the payload. Elements may be payloads,
+// payload values, or maps like decoded from JSON, other values
+// are stored with the default key.
+func UnbatchKey(key string) UnbatchFunc {
+	return func(event cells.Event) []cells.Payload {
+		var payloads []cells.Payload
+		switch batch := event.Payload().Get(key, nil).(type) {
+		case []cells.Payload:
+			payloads = batch
+		case []cells.PayloadValues:
+			for _, values := range batch {
+				payloads = append(payloads, cells.NewPayload(values))
+			}
+		case []map[string]interface{}:
+			for _, values := range batch {
+				payloads = append(payloads, cells.NewPayload(values))
+			}
+		case []interface{}:
+			for _, value := range batch {
+				payloads = append(payloads, cells.NewPayload(value))
+			}
+		}
+		return payloads
+	}
+}
+
+// EOF
@@ -0,0 +1,93 @@
+// Tideland Go Cells - Behaviors - Unit Tests - Unbatcher
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package behaviors_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestUnbatcherBehavior tests the splitting of batch events.
+func TestUnbatcherBehavior(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	var mutex sync.Mutex
+	var causations []string
+	n := 0
+	env := cells.NewEnvironment("unbatcher-behavior",
+		cells.WithIDGenerator(func() string {
+			mutex.Lock()
+			defer mutex.Unlock()
+			n++
+			return fmt.Sprintf("id-%d", n)
+		}),
+		cells.WithObserver(func(event cells.Event) {
+			if event.Emitter() == "unbatcher" {
+				mutex.Lock()
+				defer mutex.Unlock()
+				causations = append(causations, cells.CausationID(event))
+			}
+		}))
+	defer env.Stop()
+
+	env.StartCell("unbatcher", behaviors.NewUnbatcherBehavior(behaviors.UnbatchKey("records")))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("unbatcher", "collector")
+
+	env.EmitNew(ctx, "unbatcher", "batch", cells.PayloadValues{
+		"records": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+			"c",
+		},
+	})
+	env.EmitNew(ctx, "unbatcher", "batch", nil)
+	assert.Nil(env.Barrier(ctx))
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 3)
+	var batchID string
+	accessor.Do(func(index int, event cells.Event) error {
+		payload := event.Payload()
+		assert.Equal(event.Topic(), behaviors.TopicUnbatched)
+		assert.Equal(payload.GetInt(behaviors.PayloadUnbatchIndex, -1), index)
+		assert.Equal(payload.GetInt(behaviors.PayloadUnbatchSize, -1), 3)
+		if index == 0 {
+			batchID = payload.GetString(behaviors.PayloadUnbatchBatchID, "")
+			assert.True(batchID != "")
+		}
+		assert.Equal(payload.GetString(behaviors.PayloadUnbatchBatchID, ""), batchID)
+		return nil
+	})
+	mutex.Lock()
+	assert.Equal(causations, []string{batchID, batchID, batchID})
+	mutex.Unlock()
+	first, _ := accessor.PeekFirst()
+	assert.Equal(first.Payload().GetString("name", ""), "a")
+	last, _ := accessor.PeekLast()
+	assert.Equal(last.Payload().GetString(cells.PayloadDefault, ""), "c")
+}
+
+// EOF
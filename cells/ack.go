@@ -0,0 +1,212 @@
+// Tideland Go Cells - Acknowledgement
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// ACKED EVENT
+//--------------------
+
+// ackedEvent is an event delivered in ack mode. It stays in the
+// queue of its subscription until it is acknowledged.
+type ackedEvent struct {
+	Event
+	queue  *ackQueue
+	seq    uint64
+	target *cell
+}
+
+//--------------------
+// ACK QUEUE
+//--------------------
+
+// ackQueue keeps the unacknowledged events of one subscription
+// in ack mode.
+type ackQueue struct {
+	mutex           sync.Mutex
+	maxRedeliveries int
+	seq             uint64
+	pending         map[uint64]*ackedEvent
+}
+
+// newAckQueue creates the queue for a subscription.
+func newAckQueue(maxRedeliveries int) *ackQueue {
+	if maxRedeliveries < 0 {
+		maxRedeliveries = 0
+	}
+	return &ackQueue{
+		maxRedeliveries: maxRedeliveries,
+		pending:         make(map[uint64]*ackedEvent),
+	}
+}
+
+// deliver keeps the event and passes it to the subscriber.
+func (q *ackQueue) deliver(sc *cell, event Event) error {
+	q.mutex.Lock()
+	q.seq++
+	ae := &ackedEvent{
+		Event:  event,
+		queue:  q,
+		seq:    q.seq,
+		target: sc,
+	}
+	q.pending[ae.seq] = ae
+	q.mutex.Unlock()
+	return sc.ProcessEvent(ae)
+}
+
+// ack removes a processed event.
+func (q *ackQueue) ack(ae *ackedEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.pending, ae.seq)
+}
+
+// redeliver passes the pending events not delivered to the
+// passed subscriber, e.g. after its restart, in their original
+// order again.
+func (q *ackQueue) redeliver(sc *cell) error {
+	q.mutex.Lock()
+	var aes []*ackedEvent
+	for _, ae := range q.pending {
+		if ae.target != sc {
+			ae.target = sc
+			aes = append(aes, ae)
+		}
+	}
+	q.mutex.Unlock()
+	sort.Slice(aes, func(i, j int) bool {
+		return aes[i].seq < aes[j].seq
+	})
+	if len(aes) > 0 {
+		logger.Infof("redelivering %d unacknowledged events to cell %q", len(aes), sc.id)
+	}
+	for _, ae := range aes {
+		if err := sc.ProcessEvent(ae); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//--------------------
+// ACK QUEUES
+//--------------------
+
+// ackQueues manages the ack mode subscriptions of an emitter. They
+// are kept when a subscriber stops, so it receives the unacknowledged
+// events again after a restart and a new subscription.
+type ackQueues struct {
+	mutex  sync.RWMutex
+	queues map[string]*ackQueue
+}
+
+// newAckQueues creates the ack queue manager.
+func newAckQueues() *ackQueues {
+	return &ackQueues{
+		queues: make(map[string]*ackQueue),
+	}
+}
+
+// add adds a queue for the subscriber if it does not exist yet.
+func (aqs *ackQueues) add(subscriberID string, maxRedeliveries int) {
+	aqs.mutex.Lock()
+	defer aqs.mutex.Unlock()
+	if _, ok := aqs.queues[subscriberID]; !ok {
+		aqs.queues[subscriberID] = newAckQueue(maxRedeliveries)
+	}
+}
+
+// remove deletes the queue of the subscriber.
+func (aqs *ackQueues) remove(subscriberID string) {
+	aqs.mutex.Lock()
+	defer aqs.mutex.Unlock()
+	delete(aqs.queues, subscriberID)
+}
+
+// queue returns the queue of the subscriber, nil if it has
+// been subscribed without ack mode.
+func (aqs *ackQueues) queue(subscriberID string) *ackQueue {
+	aqs.mutex.RLock()
+	defer aqs.mutex.RUnlock()
+	if len(aqs.queues) == 0 {
+		return nil
+	}
+	return aqs.queues[subscriberID]
+}
+
+//--------------------
+// ENVIRONMENT AND CELL
+//--------------------
+
+// SubscribeAcked implements the Environment interface.
+func (env *environment) SubscribeAcked(emitterID string, maxRedeliveries int, subscriberIDs ...string) error {
+	ec, err := env.cells.cell(emitterID)
+	if err != nil {
+		return err
+	}
+	for _, subscriberID := range subscriberIDs {
+		ec.acks.add(subscriberID, maxRedeliveries)
+	}
+	return env.Subscribe(emitterID, subscriberIDs...)
+}
+
+// redeliver passes the unacknowledged events of the emitter
+// to newly subscribed cells.
+func (env *environment) redeliver(emitterID string, subscriberIDs []string) error {
+	ec, err := env.cells.cell(emitterID)
+	if err != nil {
+		return err
+	}
+	for _, subscriberID := range subscriberIDs {
+		q := ec.acks.queue(subscriberID)
+		if q == nil {
+			continue
+		}
+		sc, err := env.cells.cell(subscriberID)
+		if err != nil {
+			return err
+		}
+		if err := q.redeliver(sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processAcked lets the behavior process an event delivered in
+// ack mode. Failed events are delivered again until the maximum
+// number of redeliveries is reached. Only then the error is
+// returned.
+func (c *cell) processAcked(ae *ackedEvent, event Event) error {
+	var err error
+	for delivery := 0; delivery <= ae.queue.maxRedeliveries; delivery++ {
+		if err = c.dispatch(event); err == nil {
+			ae.queue.ack(ae)
+			return nil
+		}
+		logger.Warningf("cell %q failed processing acked event %q (delivery %d): %v", c.id, ae.Topic(), delivery+1, err)
+	}
+	// Maximum redeliveries reached, drop the event.
+	ae.queue.ack(ae)
+	atomic.AddUint64(&c.dropped, 1)
+	return err
+}
+
+// EOF
@@ -0,0 +1,172 @@
+// Tideland Go Cells - Topic Aliases
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// WithAliasLogging lets the environment log each emitter still
+// using an aliased topic once, so the remaining producers can be
+// found during a migration.
+func WithAliasLogging() Option {
+	return func(env *environment) {
+		env.aliasLogging = true
+	}
+}
+
+//--------------------
+// STATISTICS
+//--------------------
+
+// TopicAliasStats tells how often an old topic still has been
+// used since its alias was set, and by which emitters.
+type TopicAliasStats struct {
+	Old      string
+	New      string
+	Uses     uint64
+	Emitters []string
+}
+
+//--------------------
+// TOPIC ALIASES
+//--------------------
+
+// topicAlias contains the new topic of an aliased one and
+// its usage.
+type topicAlias struct {
+	topic    string
+	uses     uint64
+	mutex    sync.Mutex
+	emitters map[string]struct{}
+}
+
+// used counts the usage by the emitter and tells if it is
+// the first one of this emitter.
+func (ta *topicAlias) used(emitterID string) bool {
+	atomic.AddUint64(&ta.uses, 1)
+	ta.mutex.Lock()
+	defer ta.mutex.Unlock()
+	if _, ok := ta.emitters[emitterID]; ok {
+		return false
+	}
+	ta.emitters[emitterID] = struct{}{}
+	return true
+}
+
+// topicAliases manages the aliased topics of an environment. The
+// map is replaced on changes, so emitting only needs to load it.
+type topicAliases struct {
+	mutex   sync.Mutex
+	aliases atomic.Value
+}
+
+// load returns the current aliases.
+func (tas *topicAliases) load() map[string]*topicAlias {
+	aliases, _ := tas.aliases.Load().(map[string]*topicAlias)
+	return aliases
+}
+
+// set sets or with an empty new topic removes the alias of
+// the old topic.
+func (tas *topicAliases) set(old, new string) error {
+	tas.mutex.Lock()
+	defer tas.mutex.Unlock()
+	current := tas.load()
+	if old == "" || old == new {
+		return errors.New(ErrTopicAlias, errorMessages, old, new)
+	}
+	if _, ok := current[new]; ok {
+		return errors.New(ErrTopicAlias, errorMessages, old, new)
+	}
+	aliases := make(map[string]*topicAlias, len(current)+1)
+	for topic, ta := range current {
+		if ta.topic == old && new != "" {
+			return errors.New(ErrTopicAlias, errorMessages, old, new)
+		}
+		aliases[topic] = ta
+	}
+	if new == "" {
+		delete(aliases, old)
+	} else {
+		aliases[old] = &topicAlias{
+			topic:    new,
+			emitters: make(map[string]struct{}),
+		}
+	}
+	tas.aliases.Store(aliases)
+	return nil
+}
+
+// apply renames the event if its topic is aliased.
+func (tas *topicAliases) apply(env *environment, emitterID string, event Event) Event {
+	aliases := tas.load()
+	if len(aliases) == 0 {
+		return event
+	}
+	ta, ok := aliases[event.Topic()]
+	if !ok {
+		return event
+	}
+	if ta.used(emitterID) && env.aliasLogging {
+		logger.Warningf("%q emits aliased topic %q, use %q instead", emitterID, event.Topic(), ta.topic)
+	}
+	return &adaptedEvent{event, ta.topic, event.Payload()}
+}
+
+// stats returns the usage of the aliases sorted by the
+// old topics.
+func (tas *topicAliases) stats() []TopicAliasStats {
+	aliases := tas.load()
+	if len(aliases) == 0 {
+		return nil
+	}
+	stats := make([]TopicAliasStats, 0, len(aliases))
+	for old, ta := range aliases {
+		s := TopicAliasStats{
+			Old:  old,
+			New:  ta.topic,
+			Uses: atomic.LoadUint64(&ta.uses),
+		}
+		ta.mutex.Lock()
+		for emitterID := range ta.emitters {
+			s.Emitters = append(s.Emitters, emitterID)
+		}
+		ta.mutex.Unlock()
+		sort.Strings(s.Emitters)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Old < stats[j].Old
+	})
+	return stats
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// AliasTopic implements the Environment interface.
+func (env *environment) AliasTopic(old, new string) error {
+	return env.aliases.set(old, new)
+}
+
+// EOF
@@ -0,0 +1,157 @@
+// Tideland Go Cells - Backfill
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// EVENT ITERATOR
+//--------------------
+
+// HistoricalEvent describes an event out of the past which
+// shall be emitted to the cell with the given ID.
+type HistoricalEvent struct {
+	ID        string
+	EventTime time.Time
+	Topic     string
+	Payload   interface{}
+}
+
+// EventIterator provides the historical events for a backfill.
+// Next returns nil when no more events exist.
+type EventIterator interface {
+	Next(ctx context.Context) (*HistoricalEvent, error)
+}
+
+// BackfillProgress describes the progress of a backfill.
+type BackfillProgress struct {
+	Events    int
+	EventTime time.Time
+	Done      bool
+}
+
+// BackfillReporter can be implemented by event iterators to
+// be informed about the progress of the backfill. Progress is
+// called after each emitted event and when the backfill is done.
+type BackfillReporter interface {
+	Progress(progress BackfillProgress)
+}
+
+// sliceEventIterator iterates over a slice of historical events.
+type sliceEventIterator struct {
+	events []HistoricalEvent
+}
+
+// NewSliceEventIterator creates an event iterator for the passed
+// historical events.
+func NewSliceEventIterator(events ...HistoricalEvent) EventIterator {
+	return &sliceEventIterator{events}
+}
+
+// Next implements the EventIterator interface.
+func (i *sliceEventIterator) Next(ctx context.Context) (*HistoricalEvent, error) {
+	if len(i.events) == 0 {
+		return nil, nil
+	}
+	he := i.events[0]
+	i.events = i.events[1:]
+	return &he, nil
+}
+
+//--------------------
+// BACKFILL
+//--------------------
+
+// backfillKey is the context key for the event time of
+// backfilled events.
+type backfillKey struct{}
+
+// IsBackfill returns true if the event has been emitted by a
+// backfill or during the processing of a backfilled event.
+func IsBackfill(event Event) bool {
+	_, ok := backfillTime(event)
+	return ok
+}
+
+// EventTime returns the original time of a backfilled event or
+// of the backfilled event it has been emitted for. Otherwise it
+// is the timestamp of the event.
+func EventTime(event Event) time.Time {
+	if t, ok := backfillTime(event); ok {
+		return t
+	}
+	return event.Timestamp()
+}
+
+// backfillTime returns the event time stored in the context.
+func backfillTime(event Event) (time.Time, bool) {
+	if event.Context() == nil {
+		return time.Time{}, false
+	}
+	t, ok := event.Context().Value(backfillKey{}).(time.Time)
+	return t, ok
+}
+
+// Backfill implements the Environment interface.
+func (env *environment) Backfill(ctx context.Context, source EventIterator) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// The events are processed after returning, so they must
+	// not be canceled together with the backfill.
+	detached := context.WithoutCancel(ctx)
+	reporter, _ := source.(BackfillReporter)
+	progress := BackfillProgress{}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-env.ctx.Done():
+			return errors.New(ErrStopping, errorMessages, "environment")
+		default:
+		}
+		he, err := source.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if he == nil {
+			break
+		}
+		eventTime := he.EventTime.UTC()
+		ectx := context.WithValue(detached, backfillKey{}, eventTime)
+		e, err := newEvent(ectx, env, env.id, he.Topic, he.Payload)
+		if err != nil {
+			return err
+		}
+		e.(*event).timestamp = eventTime
+		if err := env.Emit(he.ID, e); err != nil {
+			return err
+		}
+		progress.Events++
+		progress.EventTime = eventTime
+		if reporter != nil {
+			reporter.Progress(progress)
+		}
+	}
+	progress.Done = true
+	if reporter != nil {
+		reporter.Progress(progress)
+	}
+	return nil
+}
+
+// EOF
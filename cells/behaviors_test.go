@@ -12,7 +12,12 @@ package cells_test
 //--------------------
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tideland/gocells/cells"
@@ -59,6 +64,30 @@ func (b *nullBehavior) ProcessEvent(event cells.Event) error { return nil }
 
 func (b *nullBehavior) Recover(r interface{}) error { return nil }
 
+// describedBehavior does nothing but describes itself.
+type describedBehavior struct {
+	nullBehavior
+	config map[string]interface{}
+}
+
+var _ cells.BehaviorDescriptor = (*describedBehavior)(nil)
+
+func (b *describedBehavior) Descriptor() (string, map[string]interface{}) {
+	return "described", b.config
+}
+
+// dependentBehavior does nothing but depends on other cells.
+type dependentBehavior struct {
+	nullBehavior
+	dependencies []string
+}
+
+var _ cells.BehaviorDependencies = (*dependentBehavior)(nil)
+
+func (b *dependentBehavior) DependsOn() []string {
+	return b.dependencies
+}
+
 // collectBehavior collects and re-emits all events, returns them
 // on the topic "processed" and delets all collected on the
 // topic "reset".
@@ -260,4 +289,629 @@ func (b *sleepBehavior) EmitTimeout() time.Duration {
 	return 2 * time.Second
 }
 
+// burstBehavior emits a burst of events from a number of
+// goroutines concurrently.
+type burstBehavior struct {
+	cell       cells.Cell
+	goroutines int
+	emits      int
+}
+
+var _ cells.Behavior = (*burstBehavior)(nil)
+
+func newBurstBehavior(goroutines, emits int) *burstBehavior {
+	return &burstBehavior{
+		goroutines: goroutines,
+		emits:      emits,
+	}
+}
+
+func (b *burstBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *burstBehavior) Terminate() error {
+	return nil
+}
+
+func (b *burstBehavior) ProcessEvent(event cells.Event) error {
+	var wg sync.WaitGroup
+	for g := 0; g < b.goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < b.emits; i++ {
+				b.cell.EmitNew(event.Context(), "burst", g*b.emits+i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (b *burstBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// contextKey is the key for test values in contexts.
+type contextKey struct{}
+
+// contextBehavior waits until the context of an event is done
+// and reports the context value and error.
+type contextBehavior struct {
+	reportc chan string
+}
+
+var _ cells.Behavior = (*contextBehavior)(nil)
+
+func newContextBehavior() *contextBehavior {
+	return &contextBehavior{
+		reportc: make(chan string, 10),
+	}
+}
+
+func (b *contextBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *contextBehavior) Terminate() error {
+	return nil
+}
+
+func (b *contextBehavior) ProcessEvent(event cells.Event) error {
+	ctx := event.Context()
+	<-ctx.Done()
+	b.reportc <- fmt.Sprintf("%v / %v", ctx.Value(contextKey{}), ctx.Err())
+	return nil
+}
+
+func (b *contextBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// reportingIterator records the progress of a backfill.
+type reportingIterator struct {
+	cells.EventIterator
+	progress []cells.BackfillProgress
+}
+
+func (i *reportingIterator) Progress(progress cells.BackfillProgress) {
+	i.progress = append(i.progress, progress)
+}
+
+// inFlightBehavior does concurrent external calls and records
+// the maximum number of calls in flight.
+type inFlightBehavior struct {
+	cell    cells.Cell
+	current int64
+	max     int64
+	wg      sync.WaitGroup
+}
+
+func (b *inFlightBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *inFlightBehavior) Terminate() error {
+	return nil
+}
+
+func (b *inFlightBehavior) ProcessEvent(event cells.Event) error {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.cell.InFlight(event.Context(), func() error {
+			current := atomic.AddInt64(&b.current, 1)
+			for {
+				max := atomic.LoadInt64(&b.max)
+				if current <= max || atomic.CompareAndSwapInt64(&b.max, max, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&b.current, -1)
+			return nil
+		})
+	}()
+	return nil
+}
+
+func (b *inFlightBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// handoffBehavior counts events and takes over the counter
+// of a replaced handoff behavior.
+type handoffBehavior struct {
+	cell    cells.Cell
+	version int
+	count   int
+}
+
+var _ cells.BehaviorHandoff = (*handoffBehavior)(nil)
+
+func (b *handoffBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *handoffBehavior) Terminate() error {
+	return nil
+}
+
+func (b *handoffBehavior) ProcessEvent(event cells.Event) error {
+	b.count++
+	return b.cell.EmitNew(event.Context(), "count", cells.PayloadValues{
+		"version": b.version,
+		"count":   b.count,
+	})
+}
+
+func (b *handoffBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+func (b *handoffBehavior) Handoff(prev cells.Behavior) error {
+	hb, ok := prev.(*handoffBehavior)
+	if !ok {
+		return fmt.Errorf("cannot take over %T", prev)
+	}
+	b.count = hb.count
+	return nil
+}
+
+// forwardBehavior emits the received events to its subscribers
+// and ignores errors of stopped ones.
+type forwardBehavior struct {
+	cell cells.Cell
+}
+
+func (b *forwardBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *forwardBehavior) Terminate() error {
+	return nil
+}
+
+func (b *forwardBehavior) ProcessEvent(event cells.Event) error {
+	b.cell.Emit(event)
+	return nil
+}
+
+func (b *forwardBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// renameBehavior emits the payload of the received events with
+// its own topic and passes the errors of emitting to a channel.
+type renameBehavior struct {
+	cell  cells.Cell
+	topic string
+	errc  chan error
+}
+
+func (b *renameBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *renameBehavior) Terminate() error {
+	return nil
+}
+
+func (b *renameBehavior) ProcessEvent(event cells.Event) error {
+	b.errc <- b.cell.EmitNew(event.Context(), b.topic, event.Payload())
+	return nil
+}
+
+func (b *renameBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// bufferBehavior holds the received events until it is flushed.
+type bufferBehavior struct {
+	cell   cells.Cell
+	events []cells.Event
+}
+
+func (b *bufferBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *bufferBehavior) Terminate() error {
+	return nil
+}
+
+func (b *bufferBehavior) ProcessEvent(event cells.Event) error {
+	b.events = append(b.events, event)
+	return nil
+}
+
+func (b *bufferBehavior) Flush(ctx context.Context) error {
+	events := b.events
+	b.events = nil
+	for _, event := range events {
+		if err := b.cell.Emit(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bufferBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// freshContextBehavior emits new events with the topic and the
+// payload of the received ones but a fresh context.
+type freshContextBehavior struct {
+	cell cells.Cell
+}
+
+func (b *freshContextBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *freshContextBehavior) Terminate() error {
+	return nil
+}
+
+func (b *freshContextBehavior) ProcessEvent(event cells.Event) error {
+	return b.cell.EmitNew(context.Background(), event.Topic(), event.Payload())
+}
+
+func (b *freshContextBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// blockingBehavior waits for the end of the context of events
+// with the topic "block" and reports its error. Other events
+// are emitted.
+type blockingBehavior struct {
+	cell    cells.Cell
+	reportc chan error
+}
+
+func (b *blockingBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *blockingBehavior) Terminate() error {
+	return nil
+}
+
+func (b *blockingBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() != "block" {
+		return b.cell.EmitNew(event.Context(), event.Topic(), event.Payload())
+	}
+	<-event.Context().Done()
+	b.reportc <- event.Context().Err()
+	return nil
+}
+
+func (b *blockingBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// failingBehavior returns an error for events with the topic
+// "fail" and collects all others.
+type failingBehavior struct {
+	sink cells.EventSink
+}
+
+func (b *failingBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *failingBehavior) Terminate() error {
+	return nil
+}
+
+func (b *failingBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() == "fail" {
+		return errors.New("failed")
+	}
+	b.sink.Push(event)
+	return nil
+}
+
+func (b *failingBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// orderedBehavior records the payloads of the events per key
+// and the maximum number of concurrently processed events.
+type orderedBehavior struct {
+	mutex     sync.Mutex
+	active    int
+	maxActive int
+	seen      map[string][]int
+}
+
+func newOrderedBehavior() *orderedBehavior {
+	return &orderedBehavior{
+		seen: make(map[string][]int),
+	}
+}
+
+func (b *orderedBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *orderedBehavior) Terminate() error {
+	return nil
+}
+
+func (b *orderedBehavior) ProcessEvent(event cells.Event) error {
+	b.mutex.Lock()
+	b.active++
+	if b.active > b.maxActive {
+		b.maxActive = b.active
+	}
+	b.mutex.Unlock()
+	time.Sleep(time.Millisecond)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.active--
+	key := event.Payload().GetString("key", "")
+	b.seen[key] = append(b.seen[key], event.Payload().GetInt("n", -1))
+	return nil
+}
+
+func (b *orderedBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// stallBehavior blocks with events with the topic "stall" until
+// the release channel is closed and collects all others.
+type stallBehavior struct {
+	releasec chan struct{}
+	sink     cells.EventSink
+}
+
+func (b *stallBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *stallBehavior) Terminate() error {
+	return nil
+}
+
+func (b *stallBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() == "stall" {
+		<-b.releasec
+		return nil
+	}
+	b.sink.Push(event)
+	return nil
+}
+
+func (b *stallBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// messageEvent is an own event implementation, e.g. wrapping
+// a message of a broker.
+type messageEvent struct {
+	topic string
+	value string
+}
+
+func (e *messageEvent) Context() context.Context {
+	return nil
+}
+
+func (e *messageEvent) Timestamp() time.Time {
+	return time.Time{}
+}
+
+func (e *messageEvent) Topic() string {
+	return e.topic
+}
+
+func (e *messageEvent) Payload() cells.Payload {
+	return cells.NewPayload(e.value)
+}
+
+func (e *messageEvent) ID() string {
+	return ""
+}
+
+func (e *messageEvent) Emitter() string {
+	return ""
+}
+
+func (e *messageEvent) String() string {
+	return e.topic
+}
+
+// ackBehavior fails processing a number of times, negative
+// for always, before it collects the events. If a block channel
+// is set it waits for its closing before.
+type ackBehavior struct {
+	sink     cells.EventSink
+	failures int
+	attempts int
+	blockc   chan struct{}
+}
+
+func (b *ackBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *ackBehavior) Terminate() error {
+	return nil
+}
+
+func (b *ackBehavior) ProcessEvent(event cells.Event) error {
+	if b.blockc != nil {
+		<-b.blockc
+	}
+	b.attempts++
+	if b.failures != 0 {
+		if b.failures > 0 {
+			b.failures--
+		}
+		return errors.New("failing")
+	}
+	_, err := b.sink.Push(event)
+	return err
+}
+
+func (b *ackBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// transactionalBehavior records its unit of work callbacks. It fails
+// for the topics "fail", "fail-begin", and "fail-commit" and panics
+// for "panic".
+type transactionalBehavior struct {
+	mutex sync.Mutex
+	calls []string
+	topic string
+}
+
+var _ cells.BehaviorTransactional = (*transactionalBehavior)(nil)
+
+func (b *transactionalBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+func (b *transactionalBehavior) Terminate() error {
+	return nil
+}
+
+func (b *transactionalBehavior) ProcessEvent(event cells.Event) error {
+	switch event.Topic() {
+	case "fail":
+		return errors.New("failed")
+	case "panic":
+		panic("panicked")
+	}
+	b.record("process " + event.Topic())
+	return nil
+}
+
+func (b *transactionalBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+func (b *transactionalBehavior) Begin(event cells.Event) error {
+	b.topic = event.Topic()
+	b.record("begin " + event.Topic())
+	if event.Topic() == "fail-begin" {
+		return errors.New("begin failed")
+	}
+	return nil
+}
+
+func (b *transactionalBehavior) Commit() error {
+	if b.topic == "fail-commit" {
+		return errors.New("commit failed")
+	}
+	b.record("commit")
+	return nil
+}
+
+func (b *transactionalBehavior) Rollback(err error) {
+	if cells.IsEventRecoveringError(err) {
+		b.record("rollback recovering")
+		return
+	}
+	b.record("rollback " + err.Error())
+}
+
+func (b *transactionalBehavior) record(call string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = append(b.calls, call)
+}
+
+func (b *transactionalBehavior) recorded() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.calls...)
+}
+
+// snapshotBehavior counts and forwards the received events. The
+// count is its snapshot, it can be requested with "count?".
+type snapshotBehavior struct {
+	c     cells.Cell
+	count int
+}
+
+var _ cells.BehaviorSnapshotter = (*snapshotBehavior)(nil)
+
+func (b *snapshotBehavior) Init(c cells.Cell) error {
+	b.c = c
+	return nil
+}
+
+func (b *snapshotBehavior) Terminate() error {
+	return nil
+}
+
+func (b *snapshotBehavior) ProcessEvent(event cells.Event) error {
+	if event.Topic() == "count?" {
+		payload, ok := cells.HasWaiterPayload(event)
+		if ok {
+			payload.GetWaiter().Set(b.count)
+		}
+		return nil
+	}
+	b.count++
+	return b.c.Emit(event)
+}
+
+func (b *snapshotBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+func (b *snapshotBehavior) Snapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(b.count)), nil
+}
+
+func (b *snapshotBehavior) RestoreSnapshot(data []byte) error {
+	count, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+	b.count = count
+	return nil
+}
+
+// stateBehavior counts the events per topic in the cell state.
+type stateBehavior struct {
+	c cells.Cell
+}
+
+func (b *stateBehavior) Init(c cells.Cell) error {
+	b.c = c
+	return nil
+}
+
+func (b *stateBehavior) Terminate() error {
+	return nil
+}
+
+func (b *stateBehavior) ProcessEvent(event cells.Event) error {
+	value, _, err := b.c.State().Get(event.Topic())
+	if err != nil {
+		return err
+	}
+	count, _ := strconv.Atoi(string(value))
+	return b.c.State().Put(event.Topic(), []byte(strconv.Itoa(count+1)))
+}
+
+func (b *stateBehavior) Recover(r interface{}) error {
+	return nil
+}
+
 // EOF
@@ -0,0 +1,73 @@
+// Tideland Go Cells - Causation
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+)
+
+//--------------------
+// CAUSATION
+//--------------------
+
+// causationKey is the context key for the ID of the event
+// during whose processing new events are emitted.
+type causationKey struct{}
+
+// CausationID returns the ID of the event during whose processing
+// the passed one has been emitted. It is only set in environments
+// with an ID generator and if the behavior emits the new event with
+// the context of the processed one. Forwarded events keep their own
+// ID, here the causation ID is empty too.
+func CausationID(event Event) string {
+	ctx := event.Context()
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(causationKey{}).(string)
+	if id == event.ID() {
+		return ""
+	}
+	return id
+}
+
+// withCausation returns a context bound to the environment which
+// marks new events emitted with it as caused by the event with
+// the passed ID.
+func withCausation(ctx context.Context, id string) context.Context {
+	pctx := ctx.(*processingContext)
+	return &processingContext{
+		Context:   pctx.Context,
+		env:       pctx.env,
+		causation: id,
+		values:    pctx.values,
+	}
+}
+
+//--------------------
+// OBSERVER
+//--------------------
+
+// Observer is called with each event emitted inside of the
+// environment, by cells as well as from the outside. It is called
+// synchronously, so it has to be fast and must not block.
+type Observer func(event Event)
+
+// WithObserver sets an observer of all emitted events, e.g. for
+// the tracking of their lineage.
+func WithObserver(observer Observer) Option {
+	return func(env *environment) {
+		env.observer = observer
+	}
+}
+
+// EOF
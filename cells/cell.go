@@ -15,6 +15,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tideland/golib/errors"
@@ -105,22 +106,56 @@ func (cs *connections) do(f func(c *cell) error) error {
 
 // cell for event processing.
 type cell struct {
+	emitted            uint64
+	pending            int64
+	processed          uint64
+	dropped            uint64
+	errors             uint64
+	processingNanos    uint64
+	highWatermark      int64
+	lastProgress       int64
+	goroutine          int64
+	stalled            int32
+	fanoutMutex        sync.Mutex
+	enqueueMutex       sync.RWMutex
 	env                *environment
 	id                 string
+	instanceID         string
 	measuringID        string
 	eventc             chan Event
+	behaviorMutex      sync.RWMutex
 	behavior           Behavior
+	replacec           chan *replacement
 	emitters           *connections
 	subscribers        *connections
+	acks               *ackQueues
+	transforms         *transforms
 	recoveringNumber   int
 	recoveringDuration time.Duration
 	emitTimeoutTicker  *time.Ticker
 	emitTimeout        int
 	loop               loop.Loop
+	started            time.Time
+	traces             *traceBuffer
+	inFlight           *inFlight
+	dependencies       []string
+	processTimeout     time.Duration
+	slowProcessing     bool
+	emitLimiter        *emitLimiter
+	errorPolicy        *ErrorPolicy
+	concurrency        int
+	orderBy            func(event Event) string
+	options            []CellOption
+	restartOnStall     func() (Behavior, error)
+	fanout             atomic.Value
+	primary            atomic.Value
+	inline             bool
+	contextValues      atomic.Value
+	alignment          alignment
 }
 
 // newCell create a new cell around a behavior.
-func newCell(env *environment, id string, behavior Behavior) (*cell, error) {
+func newCell(env *environment, id string, behavior Behavior, options ...CellOption) (*cell, error) {
 	logger.Infof("cell '%s' starts", id)
 	// Init cell runtime.
 	c := &cell{
@@ -128,9 +163,20 @@ func newCell(env *environment, id string, behavior Behavior) (*cell, error) {
 		id:                id,
 		measuringID:       identifier.Identifier("cells", env.id, "cell", id),
 		behavior:          behavior,
+		replacec:          make(chan *replacement),
 		emitters:          newConnections(),
 		subscribers:       newConnections(),
+		acks:              newAckQueues(),
+		transforms:        newTransforms(),
 		emitTimeoutTicker: time.NewTicker(5 * time.Second),
+		started:           time.Now(),
+		options:           options,
+	}
+	c.inFlight = newInFlight(c.measuringID)
+	if env.idGenerator != nil {
+		c.instanceID = env.idGenerator()
+	} else {
+		c.instanceID = identifier.NewUUID().String()
 	}
 	// Set configuration.
 	if bebs, ok := behavior.(BehaviorEventBufferSize); ok {
@@ -166,6 +212,12 @@ func newCell(env *environment, id string, behavior Behavior) (*cell, error) {
 	} else {
 		c.emitTimeout = int(maxEmitTimeout.Seconds() / 5)
 	}
+	for _, option := range options {
+		option(c)
+	}
+	if err := c.checkDependencies(); err != nil {
+		return nil, err
+	}
 	// Init behavior.
 	if err := behavior.Init(c); err != nil {
 		return nil, errors.Annotate(err, ErrCellInit, errorMessages, id)
@@ -185,10 +237,68 @@ func (c *cell) ID() string {
 	return c.id
 }
 
+// InstanceID implements the Cell interface.
+func (c *cell) InstanceID() string {
+	return c.instanceID
+}
+
 // Emit implements the Cell interface.
 func (c *cell) Emit(event Event) error {
-	return c.SubscribersDo(func(cs Subscriber) error {
-		return cs.ProcessEvent(event)
+	if c.emitLimiter != nil {
+		c.emitLimiter.wait(c.env.ctx.Done())
+	}
+	if c.env.fanoutOrder == OrderedFanout {
+		c.fanoutMutex.Lock()
+		defer c.fanoutMutex.Unlock()
+	}
+	var id string
+	if c.env.idGenerator != nil && event.ID() == "" {
+		// Event has been created outside of the environment.
+		id = c.env.idGenerator()
+	}
+	if event.Emitter() != c.id || id != "" {
+		if ee, ok := event.(*emittedEvent); ok {
+			event = ee.Event
+			if id == "" {
+				id = ee.id
+			}
+		}
+		if event.Emitter() != c.id || id != "" {
+			event = &emittedEvent{event, c.id, id}
+		}
+	}
+	event = c.env.aliases.apply(c.env, c.id, event)
+	if c.env.strict != nil {
+		if err := c.checkEmit(event.Topic()); err != nil {
+			return err
+		}
+	}
+	atomic.AddUint64(&c.emitted, 1)
+	if c.env.observer != nil {
+		c.env.observer(event)
+	}
+	selected, ok := c.selectSubscribers(event)
+	deliver := func(sc *cell, offer bool) error {
+		if ok && !containsID(selected, sc.id) {
+			return nil
+		}
+		event, ok := c.transforms.apply(sc.id, event)
+		if !ok {
+			return nil
+		}
+		if q := c.acks.queue(sc.id); q != nil {
+			return q.deliver(sc, event)
+		}
+		if offer {
+			return sc.offerEvent(event)
+		}
+		return sc.ProcessEvent(event)
+	}
+	if primary, _ := c.primary.Load().(string); primary != "" {
+		return c.emitPrimaryFirst(primary, deliver)
+	}
+	return c.subscribers.do(func(sc *cell) error {
+		return deliver(sc, false)
 	})
 }
 
@@ -197,7 +307,10 @@ func (c *cell) EmitNew(ctx context.Context, topic string, payload interface{}) e
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	event, err := NewEvent(ctx, topic, payload)
+	if len(c.env.contextKeys) > 0 {
+		ctx = c.restoreContextValues(ctx)
+	}
+	event, err := newEvent(ctx, c.env, c.id, topic, payload)
 	if err != nil {
 		return err
 	}
@@ -206,16 +319,27 @@ func (c *cell) EmitNew(ctx context.Context, topic string, payload interface{}) e
 
 // ProcessEvent implements the Subscriber interface.
 func (c *cell) ProcessEvent(event Event) error {
+	if c.env.scheduler != nil {
+		return c.env.scheduler.enqueue(c, event)
+	}
+	if c.inline {
+		return c.processInline(event)
+	}
 	emitTimeoutTicks := 0
+	c.enqueueMutex.RLock()
+	defer c.enqueueMutex.RUnlock()
+	c.enqueued()
 	for {
 		select {
 		case c.eventc <- event:
 			return nil
 		case <-c.loop.IsStopping():
+			c.rejected()
 			return errors.New(ErrInactive, errorMessages, c.id)
 		case <-c.emitTimeoutTicker.C:
 			emitTimeoutTicks++
 			if emitTimeoutTicks > c.emitTimeout {
+				c.rejected()
 				op := fmt.Sprintf("emitting %q to %q", event.Topic(), c.id)
 				return errors.New(ErrTimeout, errorMessages, op)
 			}
@@ -225,7 +349,7 @@ func (c *cell) ProcessEvent(event Event) error {
 
 // ProcessNewEvent implements the Subscriber interface.
 func (c *cell) ProcessNewEvent(ctx context.Context, topic string, payload interface{}) error {
-	event, err := NewEvent(ctx, topic, payload)
+	event, err := newEvent(ctx, c.env, "", topic, payload)
 	if err != nil {
 		return err
 	}
@@ -264,24 +388,201 @@ func (c *cell) backendLoop(l loop.Loop) error {
 	totalCellsID := identifier.Identifier("cells", c.env.ID(), "total-cells")
 	monitoring.IncrVariable(totalCellsID)
 	defer monitoring.DecrVariable(totalCellsID)
+	if c.env.stallMaxIdle > 0 {
+		atomic.StoreInt64(&c.goroutine, goroutineID())
+	}
+
+	var w *workers
+	if c.concurrency > 1 {
+		w = c.startWorkers()
+		defer w.stop()
+	}
+	terminate := func() error {
+		w.stop()
+		return c.behavior.Terminate()
+	}
+	// processOrDispatch processes the event or passes it to
+	// the workers. Events are held back while the cell aligns
+	// to a checkpoint barrier.
+	processOrDispatch := func(event Event) error {
+		return c.align(event, func(event Event) error {
+			if w != nil {
+				w.dispatch(event)
+				return nil
+			}
+			return c.process(event)
+		}, w.wait)
+	}
 
 	for {
 		select {
 		case <-l.ShallStop():
-			return c.behavior.Terminate()
+			return terminate()
+		case <-c.env.gate():
+		}
+		// Stopping has priority, e.g. a stalled cell returning
+		// from its behavior after being replaced must not take
+		// the events queued for the restarted cell.
+		select {
+		case <-l.ShallStop():
+			return terminate()
+		default:
+		}
+		select {
+		case <-l.ShallStop():
+			return terminate()
 		case event := <-c.eventc:
 			if event == nil {
 				panic("received illegal nil event!")
 			}
-			measuring := monitoring.BeginMeasuring(c.measuringID)
-			err := c.behavior.ProcessEvent(event)
-			measuring.EndMeasuring()
-			if err != nil {
+			if err := processOrDispatch(event); err != nil {
 				logger.Errorf("cell %q processed event %q with error: %v", c.id, event.Topic(), err)
 				return err
 			}
+		case err := <-w.errors():
+			return err
+		case r := <-w.panics():
+			panic(r)
+		case r := <-c.replacec:
+			// Drain the events queued before the replacement.
+			for n := len(c.eventc); n > 0; n-- {
+				event := <-c.eventc
+				if err := processOrDispatch(event); err != nil {
+					logger.Errorf("cell %q processed event %q with error: %v", c.id, event.Topic(), err)
+					r.donec <- err
+					return err
+				}
+			}
+			if w != nil {
+				w.wait()
+				select {
+				case err := <-w.errors():
+					r.donec <- err
+					return err
+				default:
+				}
+			}
+			r.donec <- c.handoff(r.behavior)
+		}
+	}
+}
+
+// process lets the behavior process one event.
+func (c *cell) process(event Event) error {
+	var err error
+	start := time.Now()
+	panicked := true
+	defer func() {
+		if c.traces != nil {
+			if panicked {
+				c.traces.record(event, start, errors.New(ErrEventRecovering, errorMessages, "panic"))
+			} else {
+				c.traces.record(event, start, err)
+			}
+		}
+		if panicked || err != nil {
+			atomic.AddUint64(&c.errors, 1)
+		}
+		elapsed := time.Since(start)
+		atomic.AddUint64(&c.processingNanos, uint64(elapsed))
+		if c.env.stallMaxIdle > 0 {
+			c.progressed(start.Add(elapsed))
+		}
+		atomic.AddUint64(&c.processed, 1)
+		atomic.AddInt64(&c.pending, -1)
+	}()
+	if c.env.panicReports != nil {
+		defer c.recoverPanic(event)
+	}
+	ae, acked := event.(*ackedEvent)
+	switch {
+	case c.env.idGenerator != nil && event.ID() != "":
+		// Mark events emitted during processing as caused by this one.
+		ctx := withCausation(bindContext(event.Context(), c.env.ctx), event.ID())
+		event = &processingEvent{event, ctx}
+	case !isBoundTo(event.Context(), c.env.ctx):
+		event = &processingEvent{event, bindContext(event.Context(), c.env.ctx)}
+	}
+	if len(c.env.contextKeys) > 0 && c.concurrency <= 1 && !c.inline {
+		// Keep the context values for events emitted during processing.
+		values, _ := event.Context().Value(contextValuesKey{}).(contextValues)
+		c.contextValues.Store(values)
+		defer c.contextValues.Store(contextValues(nil))
+	}
+	var tctx *timeoutContext
+	if c.processTimeout > 0 {
+		var cancel func()
+		tctx, cancel = c.withProcessTimeout(event)
+		defer cancel()
+		event = &processingEvent{event, tctx}
+	}
+	measuring := monitoring.BeginMeasuring(c.measuringID)
+	defer measuring.EndMeasuring()
+	if acked {
+		err = c.processAcked(ae, event)
+	} else {
+		err = c.dispatch(event)
+	}
+	panicked = false
+	if err == nil && tctx != nil && tctx.exceeded() {
+		// Count the timeout as error, the policy decides if
+		// the cell keeps working.
+		op := fmt.Sprintf("processing %q in cell %q", event.Topic(), c.id)
+		err = errors.New(ErrTimeout, errorMessages, op)
+		monitoring.IncrVariable(identifier.Identifier(c.measuringID, "process-timeouts"))
+		return c.handleTimeout(event, err)
+	}
+	if err != nil {
+		return c.handleError(event, err)
+	}
+	return nil
+}
+
+// dispatch passes the event to the behavior. Commands and
+// configurations are processed separately.
+func (c *cell) dispatch(event Event) error {
+	switch event.Topic() {
+	case TopicCommand:
+		return c.processCommand(event)
+	case TopicConfigure:
+		if bc, ok := c.behavior.(BehaviorConfigurable); ok {
+			return c.configure(bc, event)
+		}
+	case TopicFlush:
+		if bf, ok := c.behavior.(BehaviorFlusher); ok {
+			return c.flush(bf, event)
+		}
+	case topicDrain:
+		if bf, ok := c.behavior.(BehaviorFlusher); ok {
+			return bf.Flush(event.Context())
+		}
+		return nil
+	case topicRestoreSnapshot:
+		return c.restoreSnapshot(event)
+	case topicProbe:
+		return c.forwardProbe(event)
+	}
+	if tb, ok := c.behavior.(BehaviorTransactional); ok {
+		return c.transact(tb, event)
+	}
+	return c.behavior.ProcessEvent(event)
+}
+
+// configure passes the configuration to the behavior. Errors are
+// only replied to a waiting sender, so the cell keeps running.
+func (c *cell) configure(bc BehaviorConfigurable, event Event) error {
+	err := bc.Configure(event.Payload())
+	if err != nil {
+		logger.Warningf("cell %q cannot be configured: %v", c.id, err)
+	}
+	if payload, ok := HasWaiterPayload(event); ok {
+		if err != nil {
+			payload.GetWaiter().Set(err)
+		} else {
+			payload.GetWaiter().Set(PayloadValues{PayloadCommand: CommandConfigure})
 		}
 	}
+	return nil
 }
 
 // checkRecovering checks if the cell may recover after a panic. It will
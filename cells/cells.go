@@ -13,6 +13,8 @@ package cells
 
 import (
 	"context"
+	"io"
+	"iter"
 	"time"
 )
 
@@ -27,7 +29,16 @@ type Environment interface {
 	ID() string
 
 	// StartCell starts a new cell with a given ID and its behavior.
-	StartCell(id string, behavior Behavior) error
+	// Options like WithTraceBuffer() configure the cell.
+	StartCell(id string, behavior Behavior, options ...CellOption) error
+
+	// ReplaceCell replaces the behavior of the cell with the given ID.
+	// Events queued before are still processed by the old behavior,
+	// later ones by the new behavior. Subscriptions stay untouched. If
+	// the new behavior implements BehaviorHandoff it takes over the
+	// state of the old one. Afterwards the cell emits an event with
+	// the topic TopicHandoffCompleted.
+	ReplaceCell(id string, behavior Behavior) error
 
 	// StopCell stops and removes the cell with the given ID.
 	StopCell(id string) error
@@ -39,6 +50,55 @@ type Environment interface {
 	// events of the first cell.
 	Subscribe(emitterID string, subscriberIDs ...string) error
 
+	// SubscribeAcked works like Subscribe but in ack mode. The emitter
+	// keeps each event until the subscriber processed it without error.
+	// Failed events are redelivered up to maxRedeliveries times. Events
+	// not processed by a stopped subscriber are redelivered after its
+	// restart and new subscription. The ack mode is kept until the
+	// subscriber is unsubscribed.
+	SubscribeAcked(emitterID string, maxRedeliveries int, subscriberIDs ...string) error
+
+	// SubscribeWith works like Subscribe for one subscriber but adapts
+	// the events emitted to it with the transform, e.g. renaming topics
+	// or projecting payload keys. So no intermediate mapper cell is
+	// needed. The transform is kept until the subscriber is unsubscribed.
+	SubscribeWith(emitterID, subscriberID string, transform Transform) error
+
+	// SubscribeChannel subscribes a channel to the cell with the given
+	// ID, so code outside of cells like HTTP handlers, CLIs, or tests
+	// can range over its emitted events. The cell emits blocking when
+	// the buffer is full. The returned function cancels the subscription
+	// and closes the channel, it is closed when the environment stops
+	// too.
+	SubscribeChannel(id string, buffer int) (<-chan Event, func(), error)
+
+	// Events returns the events emitted by the cell with the given ID
+	// as a sequence for ranging. The subscription is established when
+	// ranging starts and canceled when the loop ends, the context is
+	// done, or the environment stops. If the cell does not exist the
+	// sequence is empty.
+	Events(ctx context.Context, id string) iter.Seq[Event]
+
+	// AliasTopic lets all events emitted with the old topic be
+	// delivered with the new one, so producers and consumers can be
+	// migrated gradually. The usage of the old topic is contained in
+	// the statistics. An empty new topic removes the alias.
+	AliasTopic(old, new string) error
+
+	// SetFanout sets the strategy selecting the subscribers of the
+	// cell with the given ID receiving its emitted events. Default
+	// is Broadcast() to all, AnyOne() lets them compete for the
+	// events, and Sharded() selects them by a key of the events.
+	SetFanout(id string, strategy FanoutStrategy) error
+
+	// SetPrimarySubscriber marks one subscriber of the emitter as
+	// primary. Emitted events are delivered to it first, waiting for
+	// free capacity in its queue like always. Only if it accepted an
+	// event the other subscribers are offered it on a best-effort
+	// basis, dropping it if their queues are full. An empty ID
+	// removes the primary.
+	SetPrimarySubscriber(emitterID, subscriberID string) error
+
 	// Subscribers returns the subscribers of the passed ID.
 	Subscribers(id string) ([]string, error)
 
@@ -52,10 +112,116 @@ type Environment interface {
 	// with a given ID.
 	EmitNew(ctx context.Context, id, topic string, payload interface{}) error
 
+	// EmitAll emits several events to cells with all-or-nothing
+	// semantics. Only if the queues of all target cells can take
+	// their events they are enqueued, otherwise none is and an
+	// error is returned. So correlated events don't leave partial
+	// downstream state when a queue overflows. The capacity check
+	// is atomic against all other emitters of the target cells.
+	EmitAll(ctx context.Context, emits ...Emit) error
+
+	// SetMissingCellHandler sets a handler called when events are
+	// emitted to a cell which does not exist. If it returns a behavior
+	// the cell is started with it on demand, so cells can be created
+	// lazily for keys like device IDs without racy checks. A nil
+	// handler removes it.
+	SetMissingCellHandler(handler MissingCellHandler)
+
 	// Request sends a request containing a payload waiter to the
 	// cell with the given ID. The response will be returned as payload.
 	Request(ctx context.Context, id, topic string, timeout time.Duration) (Payload, error)
 
+	// RequestAll sends a request with the payload to the cells with
+	// the given IDs concurrently and gathers their responses by ID.
+	// The context sets the shared deadline. If not all cells respond
+	// the received responses are returned together with an error
+	// naming the failed cells.
+	RequestAll(ctx context.Context, ids []string, topic string, payload interface{}) (map[string]Payload, error)
+
+	// Backfill emits the historical events of the source with their
+	// original event time as timestamp while live events are still
+	// processed. Backfilled events and those emitted during their
+	// processing can be detected with IsBackfill(), their event time
+	// is returned by EventTime(). The call blocks until the source
+	// is exhausted, the context is done, or an emit fails. In case
+	// of a done context its error is returned. The events keep the
+	// values of the context but are not canceled with it.
+	Backfill(ctx context.Context, source EventIterator) error
+
+	// Trace returns the last processed events of the cell with the
+	// given ID if it has been started with WithTraceBuffer(), the
+	// oldest first.
+	Trace(id string) ([]TraceEntry, error)
+
+	// QueueDepth returns the number of events emitted to the cell
+	// with the given ID and not yet completely processed.
+	QueueDepth(id string) (int, error)
+
+	// Stats returns the counters of all cells like processed,
+	// dropped, and failed events, the current and highest queue
+	// depth, and the average processing time. It is cheap enough
+	// to be polled, e.g. by a behavior scaling cells.
+	Stats() EnvironmentStats
+
+	// Barrier waits until the cells with the given IDs, or all
+	// cells if none is passed, have processed all their queued
+	// events. Events emitted from outside of those cells after
+	// the call may be missed. If the context is done before a
+	// timeout error is returned.
+	Barrier(ctx context.Context, ids ...string) error
+
+	// Checkpoint takes a consistent snapshot of all cells. Barriers
+	// are injected into the cells without emitters and flow through
+	// the topology. Each cell snapshots its behavior once it received
+	// the barriers of all its emitters, so the offset of the source
+	// at injection time plus the snapshots form a recovery point.
+	// Topologies containing cycles return an error.
+	Checkpoint(ctx context.Context, offset int64) (*Checkpoint, error)
+
+	// RestoreCheckpoint restores the snapshots of the checkpoint
+	// into the behaviors of the running cells.
+	RestoreCheckpoint(ctx context.Context, cp *Checkpoint) error
+
+	// Probe sends a probe along the route of cells and returns
+	// the latencies of its arrivals in each cell. Probes pass the
+	// queues of the cells but are not processed by the behaviors.
+	Probe(ctx context.Context, route ...string) (*ProbeResult, error)
+
+	// StartGated closes the gate of the environment. Cells can be
+	// started and subscribed and events can be emitted, but no
+	// event will be processed until Release() is called. So
+	// topologies can be completely wired before the first events
+	// are processed. Emitted events are buffered by the cells, so
+	// the number of early emits is limited by their buffer sizes.
+	StartGated()
+
+	// Release opens the gate closed by StartGated().
+	Release()
+
+	// WriteDOT writes the current topology of the cells with their
+	// queue usage and the rates of the subscriptions in the GraphViz
+	// DOT format.
+	WriteDOT(w io.Writer) error
+
+	// WriteMermaid writes the same topology as WriteDOT() as a
+	// Mermaid flowchart.
+	WriteMermaid(w io.Writer) error
+
+	// SaveTopology writes the cells with behaviors implementing
+	// BehaviorDescriptor and all subscriptions into the store.
+	SaveTopology(store TopologyStore) error
+
+	// RestoreTopology starts the cells of the stored topology not
+	// yet running using the factory and establishes the stored
+	// subscriptions between existing cells.
+	RestoreTopology(store TopologyStore, factory BehaviorFactory) error
+
+	// Drain flushes the cells with behaviors implementing
+	// BehaviorFlusher in the order of the subscriptions, waits
+	// until all events are processed, and stops the environment.
+	// So no buffered events are lost at shutdown.
+	Drain(ctx context.Context) error
+
 	// Stop manages the proper finalization of an environment.
 	Stop() error
 }
@@ -73,7 +239,15 @@ type Cell interface {
 	// can be started multiple times but has to use different IDs.
 	ID() string
 
-	// Emit emits an event to all subscribers of a cell.
+	// InstanceID returns the unique ID of this start of the cell. It
+	// is created by the ID generator of the environment, or is a UUID
+	// if the environment has none.
+	InstanceID() string
+
+	// Emit emits an event to all subscribers of a cell. If the
+	// environment is configured with OrderedFanout concurrent
+	// emits are observed by all subscribers in the same order.
+	// Subscribers receive the event with the cell ID as emitter.
 	Emit(event Event) error
 
 	// EmitNew creates an event and emits it to all subscribers of a cell.
@@ -81,6 +255,16 @@ type Cell interface {
 
 	// SubscribersDo calls the passed function for each subscriber.
 	SubscribersDo(f func(s Subscriber) error) error
+
+	// InFlight executes an external call of the behavior. If the
+	// cell has been started with MaxInFlight() it waits for a free
+	// slot first, or until the context is done. Waiting and calling
+	// times are measured separately.
+	InFlight(ctx context.Context, call func() error) error
+
+	// State returns the key/value store of the cell state. It is
+	// managed by the environment and part of checkpoints.
+	State() KV
 }
 
 //--------------------
@@ -131,6 +315,69 @@ type BehaviorEmitTimeout interface {
 	EmitTimeout() time.Duration
 }
 
+// BehaviorHandoff is an additional optional interface for a behavior
+// replacing another one with Environment.ReplaceCell(). Handoff is
+// called after Init() with the previous behavior, so the new one can
+// take over its state like counters or windows.
+type BehaviorHandoff interface {
+	Handoff(prev Behavior) error
+}
+
+// BehaviorCommandHandler is an additional optional interface for a
+// behavior processing commands sent with TopicCommand itself. Otherwise
+// the standard commands are passed to ProcessEvent() with the topics
+// TopicReset, TopicStatus, TopicFlush, and TopicConfigure.
+type BehaviorCommandHandler interface {
+	ProcessCommand(cmd *Command) error
+}
+
+// BehaviorDependencies is an additional optional interface for a behavior
+// declaring the IDs of the cells which have to run before its cell starts,
+// e.g. the targets of a router. See also the cell option After().
+type BehaviorDependencies interface {
+	DependsOn() []string
+}
+
+// BehaviorConfigurable is an additional optional interface for a behavior
+// which can be tuned while running, e.g. its rates, thresholds, or window
+// sizes. Configure is called with the payload of events with the topic
+// TopicConfigure or of the command CommandConfigure instead of ProcessEvent.
+// An invalid configuration is returned as error to a waiting sender, the
+// cell keeps running with its previous configuration.
+type BehaviorConfigurable interface {
+	Configure(config Payload) error
+}
+
+// BehaviorTransactional is an additional optional interface for a behavior
+// coordinating external transactional resources like database transactions.
+// Begin is called before ProcessEvent, Commit after its successful return.
+// If Begin, ProcessEvent, or Commit fail or ProcessEvent panics, Rollback
+// is called with the reason. Events emitted during processing are not held
+// back until the commit.
+type BehaviorTransactional interface {
+	Begin(event Event) error
+	Commit() error
+	Rollback(err error)
+}
+
+// BehaviorSnapshotter is an additional optional interface for a behavior
+// keeping state which shall be part of checkpoints. Snapshot returns the
+// serialized state when the cell is aligned to a checkpoint barrier,
+// RestoreSnapshot sets the state when the checkpoint is restored.
+type BehaviorSnapshotter interface {
+	Snapshot() ([]byte, error)
+	RestoreSnapshot(data []byte) error
+}
+
+// BehaviorFlusher is an additional optional interface for a behavior
+// buffering events, e.g. in batches or bursts. Flush is called with
+// events with the topic TopicFlush or the command CommandFlush instead
+// of ProcessEvent and emits all the behavior holds. Environment.Drain()
+// flushes those behaviors before stopping.
+type BehaviorFlusher interface {
+	Flush(ctx context.Context) error
+}
+
 //--------------------
 // SUBSCRIBER
 //--------------------
@@ -12,7 +12,16 @@ package cells_test
 //--------------------
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -359,6 +368,1990 @@ func TestEnvironmentScenario(t *testing.T) {
 	assert.True(ok)
 }
 
+// TestEnvironmentFanoutOrder tests the delivery order of
+// concurrent emits to multiple subscribers.
+func TestEnvironmentFanoutOrder(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	payloads := func(sink cells.EventSink) []int {
+		var ps []int
+		sink.Do(func(index int, event cells.Event) error {
+			ps = append(ps, event.Payload().GetDefault(-1).(int))
+			return nil
+		})
+		return ps
+	}
+
+	for _, order := range []cells.FanoutOrder{cells.UnorderedFanout, cells.OrderedFanout} {
+		env := cells.NewEnvironment("fanout-order", int(order), cells.WithFanoutOrder(order))
+
+		fooSink := cells.NewEventSink(0)
+		barSink := cells.NewEventSink(0)
+		assert.Nil(env.StartCell("burst", newBurstBehavior(10, 20)))
+		assert.Nil(env.StartCell("foo", newCollectBehavior(fooSink)))
+		assert.Nil(env.StartCell("bar", newCollectBehavior(barSink)))
+		assert.Nil(env.Subscribe("burst", "foo", "bar"))
+
+		err := env.EmitNew(ctx, "burst", "go", nil)
+		assert.Nil(err)
+
+		time.Sleep(500 * time.Millisecond)
+
+		assert.Length(fooSink, 200)
+		assert.Length(barSink, 200)
+		if order == cells.OrderedFanout {
+			assert.Equal(payloads(fooSink), payloads(barSink))
+		}
+
+		assert.Nil(env.Stop())
+	}
+}
+
+// TestEnvironmentGated tests the gated start of an environment.
+func TestEnvironmentGated(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("gated")
+	defer env.Stop()
+
+	env.StartGated()
+
+	fooSink := cells.NewEventSink(0)
+	barSink := cells.NewEventSink(0)
+	assert.Nil(env.StartCell("foo", newCollectBehavior(fooSink)))
+	assert.Nil(env.EmitNew(context.Background(), "foo", "lorem", 1))
+	assert.Nil(env.StartCell("bar", newCollectBehavior(barSink)))
+	assert.Nil(env.Subscribe("foo", "bar"))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(fooSink, 0)
+	assert.Length(barSink, 0)
+
+	env.Release()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(fooSink, 1)
+	assert.Length(barSink, 1)
+}
+
+// TestEnvironmentTopology tests the rendering of the topology.
+func TestEnvironmentTopology(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("topology")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	assert.Nil(env.StartCell("foo", newCollectBehavior(sink)))
+	assert.Nil(env.StartCell("bar", newCollectBehavior(sink)))
+	assert.Nil(env.StartCell("baz", newCollectBehavior(sink)))
+	assert.Nil(env.Subscribe("foo", "bar", "baz"))
+	assert.Nil(env.Subscribe("bar", "baz"))
+
+	var dot bytes.Buffer
+	err := env.WriteDOT(&dot)
+	assert.Nil(err)
+	assert.Contents(`digraph "topology" {`, dot.String())
+	assert.Contents(`"foo" [label="foo (0/16)"];`, dot.String())
+	assert.Contents(`"foo" -> "bar";`, dot.String())
+	assert.Contents(`"foo" -> "baz";`, dot.String())
+	assert.Contents(`"bar" -> "baz";`, dot.String())
+
+	err = env.EmitNew(context.Background(), "foo", "lorem", 1)
+	assert.Nil(err)
+	time.Sleep(100 * time.Millisecond)
+
+	var mermaid bytes.Buffer
+	err = env.WriteMermaid(&mermaid)
+	assert.Nil(err)
+	assert.Contents("graph LR", mermaid.String())
+	assert.Contents(`c0["bar (0/16)"]`, mermaid.String())
+	assert.Contents(`c2["foo (0/16)"]`, mermaid.String())
+	assert.Contents("c2 -->|", mermaid.String())
+	assert.Contents("/s| c0", mermaid.String())
+}
+
+// TestConnect tests forwarding events between environments.
+func TestConnect(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	envA := cells.NewEnvironment("connect-a")
+	defer envA.Stop()
+	envB := cells.NewEnvironment("connect-b")
+	defer envB.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	sinkB := cells.NewEventSink(0)
+	envA.StartCell("a", newCollectBehavior(sinkA))
+	envB.StartCell("b", newCollectBehavior(sinkB))
+
+	_, err := cells.Connect(envA, envB, cells.Route{From: "a", To: "missing"})
+	assert.True(cells.IsInvalidIDError(err))
+
+	conn, err := cells.Connect(envA, envB,
+		cells.Route{From: "a", To: "b", Topics: []string{"ping"}},
+		cells.Route{From: "b", To: "a", Reverse: true},
+	)
+	assert.Nil(err)
+
+	// Forwarded from A to B but not back again.
+	envA.EmitNew(context.Background(), "a", "ping", 1)
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(sinkA, 1)
+	assert.Length(sinkB, 1)
+
+	// Topic is not routed from A to B.
+	envA.EmitNew(context.Background(), "a", "pong", 2)
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(sinkA, 2)
+	assert.Length(sinkB, 1)
+
+	// Forwarded from B to A but not back again.
+	envB.EmitNew(context.Background(), "b", "ping", 3)
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(sinkA, 3)
+	assert.Length(sinkB, 2)
+
+	err = conn.Disconnect()
+	assert.Nil(err)
+	envA.EmitNew(context.Background(), "a", "ping", 4)
+	time.Sleep(100 * time.Millisecond)
+	assert.Length(sinkA, 4)
+	assert.Length(sinkB, 2)
+}
+
+// TestEventContext tests the cancellation of event contexts by
+// the emitter and by stopping the environment.
+func TestEventContext(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("event-context")
+
+	behavior := newContextBehavior()
+	env.StartCell("context", behavior)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "foo"))
+	env.EmitNew(ctx, "context", "cancel", nil)
+	cancel()
+	assert.Equal(<-behavior.reportc, "foo / context canceled")
+
+	ctx = context.WithValue(context.Background(), contextKey{}, "bar")
+	env.EmitNew(ctx, "context", "stop", nil)
+	time.Sleep(50 * time.Millisecond)
+	err := env.Stop()
+	assert.Nil(err)
+	assert.Equal(<-behavior.reportc, "bar / context canceled")
+}
+
+// TestEventEmitter tests the emitter identity of events.
+func TestEventEmitter(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("event-emitter")
+	defer env.Stop()
+
+	sinkB := cells.NewEventSink(0)
+	sinkC := cells.NewEventSink(0)
+	env.StartCell("a", newEmitBehavior())
+	env.StartCell("b", newCollectBehavior(sinkB))
+	env.StartCell("c", newCollectBehavior(sinkC))
+	env.Subscribe("a", "c")
+	env.Subscribe("b", "c")
+
+	env.EmitNew(context.Background(), "a", "foo", 1)
+	env.EmitNew(context.Background(), "b", "bar", 2)
+	err := env.Barrier(context.Background())
+	assert.Nil(err)
+
+	first, ok := sinkB.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Emitter(), env.ID())
+	emitters := map[string]string{}
+	sinkC.Do(func(index int, event cells.Event) error {
+		emitters[event.Topic()] = event.Emitter()
+		return nil
+	})
+	assert.Equal(emitters, map[string]string{
+		"sleep!": "a",
+		"bar":    "b",
+	})
+
+	event, err := cells.NewEvent(context.Background(), "baz", nil)
+	assert.Nil(err)
+	assert.Equal(event.Emitter(), "")
+}
+
+// TestCustomEvent tests the emitting of own event implementations.
+func TestCustomEvent(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	var mutex sync.Mutex
+	var observed []string
+	env := cells.NewEnvironment("custom-event",
+		cells.WithIDGenerator(cells.NewULIDGenerator()),
+		cells.WithObserver(func(event cells.Event) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			observed = append(observed, event.Topic()+"/"+cells.CausationID(event))
+		}))
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("forward", &forwardBehavior{})
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.Subscribe("forward", "collect")
+
+	message := &messageEvent{topic: "message", value: "foo"}
+	err := env.Emit("forward", message)
+	assert.Nil(err)
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+
+	assert.Length(sink, 1)
+	event, _ := sink.PeekFirst()
+	assert.Equal(event.Topic(), "message")
+	assert.Equal(event.Emitter(), "forward")
+	assert.Equal(event.Payload().GetDefault(nil), "foo")
+	assert.Length(event.ID(), 26)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(observed, []string{"message/", "message/", "message/"})
+}
+
+// TestBackfill tests the emitting of historical events.
+func TestBackfill(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("backfill")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("collect", newCollectBehavior(sink))
+
+	past := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	source := &reportingIterator{
+		EventIterator: cells.NewSliceEventIterator(
+			cells.HistoricalEvent{ID: "collect", EventTime: past, Topic: "history", Payload: 1},
+			cells.HistoricalEvent{ID: "collect", EventTime: past.Add(time.Minute), Topic: "history", Payload: 2},
+		),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := env.Backfill(ctx, source)
+	cancel()
+	assert.Nil(err)
+	env.EmitNew(context.Background(), "collect", "live", 3)
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+
+	assert.Length(sink, 3)
+	sink.Do(func(index int, event cells.Event) error {
+		switch index {
+		case 0, 1:
+			assert.True(cells.IsBackfill(event))
+			assert.Nil(event.Context().Err())
+			assert.Equal(event.Timestamp(), past.Add(time.Duration(index)*time.Minute))
+			assert.Equal(cells.EventTime(event), event.Timestamp())
+		case 2:
+			assert.False(cells.IsBackfill(event))
+			assert.Equal(cells.EventTime(event), event.Timestamp())
+		}
+		return nil
+	})
+	assert.Equal(source.progress, []cells.BackfillProgress{
+		{Events: 1, EventTime: past},
+		{Events: 2, EventTime: past.Add(time.Minute)},
+		{Events: 2, EventTime: past.Add(time.Minute), Done: true},
+	})
+
+	err = env.Backfill(context.Background(), cells.NewSliceEventIterator(
+		cells.HistoricalEvent{ID: "unknown", EventTime: past, Topic: "history"},
+	))
+	assert.True(cells.IsInvalidIDError(err))
+
+	// A done context stops the backfill.
+	err = env.Backfill(ctx, cells.NewSliceEventIterator(
+		cells.HistoricalEvent{ID: "collect", EventTime: past, Topic: "history"},
+	))
+	assert.Equal(err, context.Canceled)
+}
+
+// TestReplay tests the filtered replay of historical events.
+func TestReplay(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("replay")
+	defer env.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	sinkB := cells.NewEventSink(0)
+	env.StartCell("a", newCollectBehavior(sinkA))
+	env.StartCell("b", newCollectBehavior(sinkB))
+
+	past := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	history := func() cells.EventIterator {
+		events := []cells.HistoricalEvent{}
+		for i := 0; i < 10; i++ {
+			id, topic := "a", "foo"
+			if i%2 == 1 {
+				id, topic = "b", "bar"
+			}
+			events = append(events, cells.HistoricalEvent{
+				ID:        id,
+				EventTime: past.Add(time.Duration(i) * time.Second),
+				Topic:     topic,
+				Payload:   i,
+			})
+		}
+		return cells.NewSliceEventIterator(events...)
+	}
+	filter := cells.ReplayFilter{
+		From:   past.Add(2 * time.Second),
+		To:     past.Add(7 * time.Second),
+		Speed:  100,
+		DryRun: true,
+	}
+
+	report, err := cells.Replay(context.Background(), env, history(), filter)
+	assert.Nil(err)
+	assert.Equal(report.Events, 6)
+	assert.Equal(report.Cells, map[string]int{"a": 3, "b": 3})
+	assert.Length(sinkA, 0)
+
+	filter.Topics = []string{"foo"}
+	filter.DryRun = false
+	report, err = cells.Replay(context.Background(), env, history(), filter)
+	assert.Nil(err)
+	assert.Equal(report.Events, 3)
+	assert.Equal(report.Cells, map[string]int{"a": 3})
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+	assert.Length(sinkA, 3)
+	assert.Length(sinkB, 0)
+	first, ok := sinkA.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Timestamp(), past.Add(2*time.Second))
+}
+
+// TestReplaceCell tests the replacement of a behavior with
+// the handoff of its state.
+func TestReplaceCell(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("replace-cell")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("counter", &handoffBehavior{version: 1})
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.Subscribe("counter", "collect")
+
+	for i := 0; i < 5; i++ {
+		env.EmitNew(context.Background(), "counter", "event", i)
+	}
+	err := env.ReplaceCell("counter", &handoffBehavior{version: 2})
+	assert.Nil(err)
+	for i := 0; i < 5; i++ {
+		env.EmitNew(context.Background(), "counter", "event", i)
+	}
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+
+	assert.Length(sink, 11)
+	sink.Do(func(index int, event cells.Event) error {
+		switch {
+		case index < 5:
+			assert.Equal(event.Payload().GetInt("version", 0), 1)
+			assert.Equal(event.Payload().GetInt("count", 0), index+1)
+		case index == 5:
+			assert.Equal(event.Topic(), cells.TopicHandoffCompleted)
+			assert.Equal(event.Payload().GetString(cells.PayloadHandoffCell, ""), "counter")
+		default:
+			assert.Equal(event.Payload().GetInt("version", 0), 2)
+			assert.Equal(event.Payload().GetInt("count", 0), index)
+		}
+		return nil
+	})
+
+	err = env.ReplaceCell("collect", &handoffBehavior{version: 3})
+	assert.True(cells.IsHandoffError(err))
+	err = env.ReplaceCell("unknown", &handoffBehavior{version: 3})
+	assert.True(cells.IsInvalidIDError(err))
+}
+
+// TestSubscribeAcked tests the redelivery of failed events.
+func TestSubscribeAcked(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("subscribe-acked")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	ab := &ackBehavior{sink: sink, failures: 2}
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("ack", ab)
+	err := env.SubscribeAcked("source", 3, "ack")
+	assert.Nil(err)
+
+	env.EmitNew(context.Background(), "source", "event", 1)
+	env.EmitNew(context.Background(), "source", "event", 2)
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+
+	assert.Length(sink, 2)
+	assert.Equal(ab.attempts, 4)
+}
+
+// TestSubscribeAckedRestart tests the redelivery of unprocessed
+// events after the restart of a subscriber.
+func TestSubscribeAckedRestart(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("subscribe-acked-restart")
+	defer env.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	blockc := make(chan struct{})
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("ack", &ackBehavior{sink: sinkA, blockc: blockc})
+	err := env.SubscribeAcked("source", 0, "ack")
+	assert.Nil(err)
+
+	for i := 1; i <= 3; i++ {
+		env.EmitNew(context.Background(), "source", "event", i)
+	}
+	err = env.Barrier(context.Background(), "source")
+	assert.Nil(err)
+
+	// Stop the blocked subscriber, so not all events are processed.
+	stoppedc := make(chan error)
+	go func() {
+		stoppedc <- env.StopCell("ack")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(blockc)
+	assert.Nil(<-stoppedc)
+
+	sinkB := cells.NewEventSink(0)
+	env.StartCell("ack", &ackBehavior{sink: sinkB})
+	err = env.Subscribe("source", "ack")
+	assert.Nil(err)
+	err = env.Barrier(context.Background(), "ack")
+	assert.Nil(err)
+
+	values := []int{}
+	collect := func(index int, event cells.Event) error {
+		values = append(values, event.Payload().GetInt(cells.PayloadDefault, 0))
+		return nil
+	}
+	sinkA.Do(collect)
+	sinkB.Do(collect)
+	assert.Equal(values, []int{1, 2, 3})
+}
+
+// TestSubscribeWith tests the transformation of events
+// for individual subscribers.
+func TestSubscribeWith(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("subscribe-with")
+	defer env.Stop()
+
+	plainSink := cells.NewEventSink(0)
+	renamedSink := cells.NewEventSink(0)
+	projectedSink := cells.NewEventSink(0)
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("plain", newCollectBehavior(plainSink))
+	env.StartCell("renamed", newCollectBehavior(renamedSink))
+	env.StartCell("projected", newCollectBehavior(projectedSink))
+	env.Subscribe("source", "plain")
+	err := env.SubscribeWith("source", "renamed", cells.RenameTopics(map[string]string{"a": "b"}))
+	assert.Nil(err)
+	project := cells.ProjectPayload("x")
+	err = env.SubscribeWith("source", "projected", func(event cells.Event) (cells.Event, bool) {
+		if event.Topic() == "skip" {
+			return nil, false
+		}
+		return project(event)
+	})
+	assert.Nil(err)
+	err = env.SubscribeWith("source", "unknown", nil)
+	assert.True(cells.IsInvalidIDError(err))
+
+	env.EmitNew(ctx, "source", "a", cells.PayloadValues{"x": 1, "y": 2})
+	env.EmitNew(ctx, "source", "skip", cells.PayloadValues{"x": 3, "y": 4})
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+
+	topics := func(sink cells.EventSink) []string {
+		ts := []string{}
+		sink.Do(func(index int, event cells.Event) error {
+			ts = append(ts, event.Topic())
+			return nil
+		})
+		return ts
+	}
+	assert.Equal(topics(plainSink), []string{"a", "skip"})
+	assert.Equal(topics(renamedSink), []string{"b", "skip"})
+	assert.Equal(topics(projectedSink), []string{"a"})
+	first, ok := projectedSink.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Payload().GetInt("x", 0), 1)
+	assert.Equal(first.Payload().GetInt("y", 0), 0)
+	assert.Equal(first.Emitter(), "source")
+
+	// Unsubscribing removes the transform.
+	env.Unsubscribe("source", "renamed")
+	env.Subscribe("source", "renamed")
+	env.EmitNew(ctx, "source", "a", nil)
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Equal(topics(renamedSink), []string{"b", "skip", "a"})
+}
+
+// TestSendCommand tests the standard command envelope.
+func TestSendCommand(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("send-command")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.EmitNew(ctx, "collect", "event", 1)
+	env.EmitNew(ctx, "collect", "event", 2)
+	err := env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Length(sink, 2)
+
+	reply, err := cells.SendCommand(ctx, env, "collect", cells.CommandReset, nil, time.Second)
+	assert.Nil(err)
+	assert.Equal(reply.GetString(cells.PayloadCommand, ""), cells.CommandReset)
+	assert.Length(sink, 0)
+
+	_, err = cells.SendCommand(ctx, env, "collect", "explode", nil, time.Second)
+	assert.True(cells.IsUnknownCommandError(err))
+	_, err = cells.SendCommand(ctx, env, "unknown", cells.CommandReset, nil, time.Second)
+	assert.True(cells.IsInvalidIDError(err))
+}
+
+// TestMaxInFlight tests the limiting of concurrent external calls.
+func TestMaxInFlight(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("max-in-flight")
+	defer env.Stop()
+
+	limited := &inFlightBehavior{}
+	unlimited := &inFlightBehavior{}
+	env.StartCell("limited", limited, cells.MaxInFlight(3))
+	env.StartCell("unlimited", unlimited)
+
+	for i := 0; i < 10; i++ {
+		env.EmitNew(context.Background(), "limited", "call", i)
+		env.EmitNew(context.Background(), "unlimited", "call", i)
+	}
+	err := env.Barrier(context.Background())
+	assert.Nil(err)
+	limited.wg.Wait()
+	unlimited.wg.Wait()
+
+	assert.Equal(limited.max, int64(3))
+	assert.True(unlimited.max > 3)
+}
+
+// TestSubscribeChannel tests consuming emitted events with a channel.
+func TestSubscribeChannel(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("subscribe-channel")
+	defer env.Stop()
+
+	env.StartCell("source", &forwardBehavior{})
+	_, _, err := env.SubscribeChannel("unknown", 0)
+	assert.True(cells.IsInvalidIDError(err))
+	eventc, cancel, err := env.SubscribeChannel("source", 0)
+	assert.Nil(err)
+
+	go func() {
+		for _, topic := range []string{"a", "b", "c"} {
+			env.EmitNew(ctx, "source", topic, nil)
+		}
+	}()
+	topics := []string{}
+	for event := range eventc {
+		assert.Equal(event.Emitter(), "source")
+		topics = append(topics, event.Topic())
+		if len(topics) == 3 {
+			cancel()
+		}
+	}
+	assert.Equal(topics, []string{"a", "b", "c"})
+	subscribers, err := env.Subscribers("source")
+	assert.Nil(err)
+	assert.Length(subscribers, 0)
+
+	// Canceling twice is fine, stopping the environment closes
+	// the channel of a not consuming subscriber.
+	cancel()
+	eventc, _, err = env.SubscribeChannel("source", 1)
+	assert.Nil(err)
+	for i := 0; i < 5; i++ {
+		env.EmitNew(ctx, "source", "d", nil)
+	}
+	env.Stop()
+	for range eventc {
+	}
+}
+
+// TestEvents tests ranging over the emitted events of a cell.
+func TestEvents(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("events")
+	defer env.Stop()
+
+	env.StartCell("source", &forwardBehavior{})
+	subscribed := func() int {
+		subscribers, err := env.Subscribers("source")
+		assert.Nil(err)
+		return len(subscribers)
+	}
+	emit := func(topics ...string) {
+		// Wait for the subscription of the ranging loop.
+		for subscribed() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for _, topic := range topics {
+			env.EmitNew(ctx, "source", topic, nil)
+		}
+	}
+
+	// Ending the loop cancels the subscription.
+	go emit("a", "b", "c")
+	topics := []string{}
+	for event := range env.Events(ctx, "source") {
+		assert.Equal(event.Emitter(), "source")
+		topics = append(topics, event.Topic())
+		if len(topics) == 3 {
+			break
+		}
+	}
+	assert.Equal(topics, []string{"a", "b", "c"})
+	assert.Equal(subscribed(), 0)
+
+	// Canceling the context ends the loop too.
+	cctx, cancel := context.WithCancel(ctx)
+	receivedc := make(chan struct{})
+	go func() {
+		emit("d")
+		<-receivedc
+		cancel()
+	}()
+	topics = []string{}
+	for event := range env.Events(cctx, "source") {
+		topics = append(topics, event.Topic())
+		close(receivedc)
+	}
+	assert.Equal(topics, []string{"d"})
+
+	// Unknown cells have no events.
+	for range env.Events(ctx, "unknown") {
+		t.Fatalf("unknown cell emitted event")
+	}
+}
+
+// TestEmitAll tests emitting several events all-or-nothing.
+func TestEmitAll(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("emit-all")
+	defer env.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	sinkB := cells.NewEventSink(0)
+	env.StartGated()
+	env.StartCell("a", newCollectBehavior(sinkA))
+	env.StartCell("b", newCollectBehavior(sinkB))
+
+	err := env.EmitAll(ctx, cells.Emit{ID: "a", Topic: "x", Payload: 1}, cells.Emit{ID: "unknown", Topic: "x", Payload: 1})
+	assert.True(cells.IsInvalidIDError(err))
+
+	// Fill the queue of b until only one event fits.
+	for i := 0; i < 15; i++ {
+		env.EmitNew(ctx, "b", "fill", i)
+	}
+	err = env.EmitAll(ctx,
+		cells.Emit{ID: "a", Topic: "x", Payload: 1},
+		cells.Emit{ID: "b", Topic: "x", Payload: 1},
+		cells.Emit{ID: "b", Topic: "y", Payload: 2},
+	)
+	assert.True(cells.IsQueueFullError(err))
+	err = env.EmitAll(ctx, cells.Emit{ID: "a", Topic: "z", Payload: 3}, cells.Emit{ID: "b", Topic: "z", Payload: 3})
+	assert.Nil(err)
+
+	env.Release()
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Equal(sinkA.Len(), 1)
+	assert.Equal(sinkB.Len(), 16)
+	first, ok := sinkA.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Topic(), "z")
+}
+
+// TestEmitAllConcurrent tests the all-or-nothing semantics of
+// EmitAll() while other emitters fill the queue concurrently.
+func TestEmitAllConcurrent(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+
+	// The observer lets concurrent emitters try to fill the queue
+	// of b between the capacity check and the enqueueing.
+	var env cells.Environment
+	var wg sync.WaitGroup
+	var once sync.Once
+	observer := func(event cells.Event) {
+		if event.Topic() != "all" {
+			return
+		}
+		once.Do(func() {
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					env.EmitNew(ctx, "b", "live", nil)
+				}()
+			}
+			time.Sleep(50 * time.Millisecond)
+		})
+	}
+	env = cells.NewEnvironment("emit-all-concurrent", cells.WithObserver(observer))
+	defer env.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	sinkB := cells.NewEventSink(0)
+	env.StartGated()
+	env.StartCell("a", newCollectBehavior(sinkA))
+	env.StartCell("b", newCollectBehavior(sinkB))
+
+	// Fill the queue of b until only two events fit.
+	for i := 0; i < 14; i++ {
+		env.EmitNew(ctx, "b", "fill", i)
+	}
+	err := env.EmitAll(ctx,
+		cells.Emit{ID: "a", Topic: "all", Payload: 1},
+		cells.Emit{ID: "b", Topic: "all", Payload: 1},
+		cells.Emit{ID: "b", Topic: "all", Payload: 2},
+	)
+	assert.Nil(err)
+
+	env.Release()
+	wg.Wait()
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Equal(sinkA.Len(), 1)
+	assert.Equal(sinkB.Len(), 18)
+}
+
+// TestMissingCellHandler tests spawning cells on demand.
+func TestMissingCellHandler(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("missing-cell-handler")
+	defer env.Stop()
+
+	err := env.EmitNew(ctx, "device-1", "reading", 1)
+	assert.True(cells.IsInvalidIDError(err))
+
+	var mutex sync.Mutex
+	sinks := map[string]cells.EventSink{}
+	env.SetMissingCellHandler(func(id string) (cells.Behavior, bool) {
+		if !strings.HasPrefix(id, "device-") {
+			return nil, false
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		sink := cells.NewEventSink(0)
+		sinks[id] = sink
+		return newCollectBehavior(sink), true
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := env.EmitNew(ctx, fmt.Sprintf("device-%d", i%2), "reading", i)
+			assert.Nil(err)
+		}(i)
+	}
+	wg.Wait()
+	err = env.EmitNew(ctx, "other", "reading", 1)
+	assert.True(cells.IsInvalidIDError(err))
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Length(sinks, 2)
+	assert.Equal(sinks["device-0"].Len(), 5)
+	assert.Equal(sinks["device-1"].Len(), 5)
+	assert.True(env.HasCell("device-0"))
+	assert.False(env.HasCell("other"))
+}
+
+// TestErrorPolicy tests the handling of errors returned by behaviors.
+func TestErrorPolicy(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	emitAll := func(env cells.Environment, id string) {
+		for _, topic := range []string{"a", "fail", "b"} {
+			env.EmitNew(ctx, id, topic, nil)
+		}
+		// Stopped cells never reach the barrier.
+		bctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		env.Barrier(bctx, id)
+	}
+
+	// Default stops the cell.
+	env := cells.NewEnvironment("error-policy-default")
+	defer env.Stop()
+	sink := cells.NewEventSink(0)
+	env.StartCell("stopping", &failingBehavior{sink})
+	emitAll(env, "stopping")
+	assert.Equal(sink.Len(), 1)
+
+	// Continue with override per cell.
+	env = cells.NewEnvironment("error-policy-continue", cells.WithErrorPolicy(cells.ContinueAndCount))
+	defer env.Stop()
+	continuingSink := cells.NewEventSink(0)
+	stoppingSink := cells.NewEventSink(0)
+	env.StartCell("continuing", &failingBehavior{continuingSink})
+	env.StartCell("stopping", &failingBehavior{stoppingSink}, cells.OnError(cells.StopCellOnError))
+	emitAll(env, "continuing")
+	emitAll(env, "stopping")
+	assert.Equal(continuingSink.Len(), 2)
+	assert.Equal(stoppingSink.Len(), 1)
+
+	// Escalate to supervisor.
+	env = cells.NewEnvironment("error-policy-escalate",
+		cells.WithErrorPolicy(cells.EscalateToSupervisor),
+		cells.WithSupervisor("supervisor"),
+	)
+	defer env.Stop()
+	workerSink := cells.NewEventSink(0)
+	supervisorSink := cells.NewEventSink(0)
+	env.StartCell("supervisor", newCollectBehavior(supervisorSink))
+	env.StartCell("worker", &failingBehavior{workerSink})
+	emitAll(env, "worker")
+	err := env.Barrier(ctx, "supervisor")
+	assert.Nil(err)
+	assert.Equal(workerSink.Len(), 2)
+	assert.Equal(supervisorSink.Len(), 1)
+	escalated, ok := supervisorSink.PeekFirst()
+	assert.True(ok)
+	assert.Equal(escalated.Topic(), cells.TopicCellError)
+	assert.Equal(escalated.Payload().GetString(cells.PayloadCellErrorID, ""), "worker")
+	assert.Equal(escalated.Payload().GetString(cells.PayloadCellErrorTopic, ""), "fail")
+	assert.Equal(escalated.Payload().GetString(cells.PayloadCellError, ""), "failed")
+}
+
+// TestRequestAll tests requesting several cells at once.
+func TestRequestAll(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	env := cells.NewEnvironment("request-all")
+	defer env.Stop()
+
+	env.StartCell("a", newCollectBehavior(cells.NewEventSink(0)))
+	env.StartCell("b", newCollectBehavior(cells.NewEventSink(0)))
+	env.StartCell("null", &nullBehavior{})
+
+	replies, err := env.RequestAll(ctx, []string{"a", "b"}, cells.TopicProcessed, nil)
+	assert.Nil(err)
+	assert.Length(replies, 2)
+	_, ok := replies["a"].GetDefault(nil).(cells.EventSink)
+	assert.True(ok)
+
+	replies, err = env.RequestAll(ctx, []string{"a", "b", "null", "unknown"}, cells.TopicProcessed, nil)
+	assert.True(cells.IsRequestAllError(err))
+	assert.ErrorMatch(err, `.*requests to cells null, unknown failed.*`)
+	assert.Length(replies, 2)
+	assert.NotNil(replies["b"])
+}
+
+// TestConcurrencyOrderBy tests the concurrent processing of
+// events keeping the order per key.
+func TestConcurrencyOrderBy(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("concurrency-order-by")
+	defer env.Stop()
+
+	byKey := func(event cells.Event) string {
+		return event.Payload().GetString("key", "")
+	}
+	behavior := newOrderedBehavior()
+	err := env.StartCell("ordered", behavior, cells.Concurrency(4), cells.OrderBy(byKey))
+	assert.Nil(err)
+
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta"}
+	for n := 0; n < 20; n++ {
+		for _, key := range keys {
+			env.EmitNew(ctx, "ordered", "process", cells.PayloadValues{"key": key, "n": n})
+		}
+	}
+	bctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.Nil(env.Barrier(bctx, "ordered"))
+
+	behavior.mutex.Lock()
+	defer behavior.mutex.Unlock()
+	assert.True(behavior.maxActive > 1)
+	assert.True(behavior.maxActive <= 4)
+	for _, key := range keys {
+		ns := behavior.seen[key]
+		assert.Length(ns, 20)
+		for i, n := range ns {
+			assert.Equal(n, i, key)
+		}
+	}
+}
+
+// TestStats tests the statistics of the cells of an environment.
+func TestStats(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("stats", cells.WithErrorPolicy(cells.ContinueAndCount))
+	defer env.Stop()
+
+	env.StartGated()
+	env.StartCell("failing", &failingBehavior{cells.NewEventSink(0)})
+	for i := 0; i < 10; i++ {
+		env.EmitNew(ctx, "failing", "ok", i)
+	}
+	env.EmitNew(ctx, "failing", "fail", nil)
+	env.EmitNew(ctx, "failing", "fail", nil)
+
+	stats := env.Stats()
+	assert.Equal(stats.ID, env.ID())
+	cs, ok := stats.Cell("failing")
+	assert.True(ok)
+	assert.Equal(cs.QueueDepth, 12)
+	assert.Equal(cs.QueueHighWatermark, 12)
+	assert.Equal(cs.Processed, uint64(0))
+
+	env.Release()
+	bctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.Nil(env.Barrier(bctx, "failing"))
+
+	cs, ok = env.Stats().Cell("failing")
+	assert.True(ok)
+	assert.Equal(cs.QueueDepth, 0)
+	assert.Equal(cs.QueueHighWatermark, 12)
+	assert.Equal(cs.Processed, uint64(12))
+	assert.Equal(cs.Errors, uint64(2))
+	assert.Equal(cs.Dropped, uint64(0))
+	assert.True(cs.AverageProcessing > 0)
+	_, ok = env.Stats().Cell("unknown")
+	assert.False(ok)
+}
+
+// TestStallDetection tests the detection and restart of
+// stalled cells.
+func TestStallDetection(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("stall-detection",
+		cells.WithStallDetection(50*time.Millisecond),
+		cells.WithSupervisor("supervisor"),
+	)
+	defer env.Stop()
+
+	releasec := make(chan struct{})
+	defer close(releasec)
+	alerts := cells.NewEventSink(0)
+	restartedSink := cells.NewEventSink(0)
+	restart := func() (cells.Behavior, error) {
+		return &stallBehavior{releasec, restartedSink}, nil
+	}
+	env.StartCell("supervisor", newCollectBehavior(alerts))
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("stalling", &stallBehavior{releasec, cells.NewEventSink(0)}, cells.RestartOnStall(restart))
+	env.StartCell("quiet", &stallBehavior{releasec, cells.NewEventSink(0)})
+	env.Subscribe("source", "stalling")
+
+	env.EmitNew(ctx, "stalling", "stall", nil)
+	env.EmitNew(ctx, "stalling", "a", nil)
+	env.EmitNew(ctx, "stalling", "b", nil)
+
+	for i := 0; i < 200 && alerts.Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(alerts.Len(), 1)
+	alert, _ := alerts.PeekFirst()
+	assert.Equal(alert.Topic(), cells.TopicCellStalled)
+	assert.Equal(alert.Payload().GetString(cells.PayloadCellStalledID, ""), "stalling")
+	assert.True(alert.Payload().GetBool(cells.PayloadCellStalledRestarted, false))
+	assert.True(alert.Payload().GetDuration(cells.PayloadCellStalledIdle, 0) > 50*time.Millisecond)
+	assert.Contents("ProcessEvent", alert.Payload().GetString(cells.PayloadCellStalledStack, ""))
+
+	// The restarted cell processes the queued events and
+	// keeps the subscriptions.
+	env.EmitNew(ctx, "source", "c", nil)
+	for i := 0; i < 200 && restartedSink.Len() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(restartedSink.Len(), 3)
+	assert.Equal(alerts.Len(), 1)
+}
+
+// TestFanout tests the different fan-out strategies.
+func TestFanout(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("fanout")
+	defer env.Stop()
+
+	ids := []string{"a", "b", "c"}
+	sinks := map[string]cells.EventSink{}
+	env.StartCell("source", &forwardBehavior{})
+	for _, id := range ids {
+		sinks[id] = cells.NewEventSink(0)
+		env.StartCell(id, newCollectBehavior(sinks[id]))
+		env.Subscribe("source", id)
+	}
+	err := env.SetFanout("unknown", cells.AnyOne())
+	assert.True(cells.IsInvalidIDError(err))
+	emitAll := func(n int) map[string]int {
+		for i := 0; i < n; i++ {
+			env.EmitNew(ctx, "source", "go", cells.PayloadValues{"key": i % 3})
+		}
+		err := env.Barrier(ctx)
+		assert.Nil(err)
+		counts := map[string]int{}
+		for _, id := range ids {
+			counts[id] = sinks[id].Len()
+			sinks[id].Clear()
+		}
+		return counts
+	}
+
+	// Broadcast as default.
+	assert.Equal(emitAll(3), map[string]int{"a": 3, "b": 3, "c": 3})
+
+	// Any one subscriber, round robin.
+	err = env.SetFanout("source", cells.AnyOne())
+	assert.Nil(err)
+	assert.Equal(emitAll(6), map[string]int{"a": 2, "b": 2, "c": 2})
+
+	// Sharded by key.
+	err = env.SetFanout("source", cells.Sharded(func(event cells.Event) string {
+		return event.Payload().GetString("key", "")
+	}))
+	assert.Nil(err)
+	counts := emitAll(30)
+	total := 0
+	for _, id := range ids {
+		total += counts[id]
+		assert.True(counts[id]%10 == 0, id)
+	}
+	assert.Equal(total, 30)
+
+	// And back to broadcast.
+	err = env.SetFanout("source", cells.Broadcast())
+	assert.Nil(err)
+	assert.Equal(emitAll(3), map[string]int{"a": 3, "b": 3, "c": 3})
+}
+
+// TestAliasTopic tests the renaming of aliased topics.
+func TestAliasTopic(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("alias-topic", cells.WithAliasLogging())
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("producer", &forwardBehavior{})
+	env.StartCell("consumer", newCollectBehavior(sink))
+	env.Subscribe("producer", "consumer")
+
+	assert.Nil(env.AliasTopic("order", "order-placed"))
+	assert.True(cells.IsTopicAliasError(env.AliasTopic("x", "x")))
+	assert.True(cells.IsTopicAliasError(env.AliasTopic("order-placed", "order-v3")))
+	assert.True(cells.IsTopicAliasError(env.AliasTopic("other", "order")))
+
+	env.EmitNew(ctx, "producer", "order", 1)
+	env.EmitNew(ctx, "producer", "order-placed", 2)
+	env.EmitNew(ctx, "producer", "order", 3)
+	assert.Nil(env.Barrier(ctx))
+
+	topics := []string{}
+	sink.Do(func(index int, event cells.Event) error {
+		topics = append(topics, event.Topic())
+		return nil
+	})
+	assert.Equal(topics, []string{"order-placed", "order-placed", "order-placed"})
+	stats := env.Stats()
+	assert.Length(stats.Aliases, 1)
+	assert.Equal(stats.Aliases[0], cells.TopicAliasStats{
+		Old:      "order",
+		New:      "order-placed",
+		Uses:     2,
+		Emitters: []string{"alias-topic"},
+	})
+
+	// Removing the alias.
+	assert.Nil(env.AliasTopic("order", ""))
+	sink.Clear()
+	env.EmitNew(ctx, "producer", "order", 4)
+	assert.Nil(env.Barrier(ctx))
+	first, ok := sink.PeekFirst()
+	assert.True(ok)
+	assert.Equal(first.Topic(), "order")
+	assert.Length(env.Stats().Aliases, 0)
+}
+
+// TestInline tests the synchronous processing of inline cells.
+func TestInline(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("inline")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	err := env.StartCell("inline", &failingBehavior{sink}, cells.Inline())
+	assert.Nil(err)
+
+	// Processed before emitting returns.
+	err = env.EmitNew(ctx, "inline", "a", 1)
+	assert.Nil(err)
+	assert.Length(sink, 1)
+	err = env.EmitNew(ctx, "inline", "b", 2)
+	assert.Nil(err)
+	assert.Length(sink, 2)
+	stats, ok := env.Stats().Cell("inline")
+	assert.True(ok)
+	assert.Equal(stats.Processed, uint64(2))
+	assert.Equal(stats.QueueDepth, 0)
+
+	// Errors are returned to the emitter and stop the cell.
+	err = env.EmitNew(ctx, "inline", "fail", 3)
+	assert.ErrorMatch(err, "failed")
+	err = env.EmitNew(ctx, "inline", "c", 4)
+	assert.True(cells.IsInactiveError(err))
+	assert.Length(sink, 2)
+}
+
+// TestTransactional tests the unit of work callbacks of
+// transactional behaviors.
+func TestTransactional(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("transactional", cells.WithErrorPolicy(cells.ContinueAndCount))
+	defer env.Stop()
+
+	behavior := &transactionalBehavior{}
+	env.StartCell("transactional", behavior)
+	for _, topic := range []string{"a", "fail", "fail-begin", "fail-commit", "panic", "b"} {
+		env.EmitNew(ctx, "transactional", topic, nil)
+	}
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(behavior.recorded(), []string{
+		"begin a",
+		"process a",
+		"commit",
+		"begin fail",
+		"rollback failed",
+		"begin fail-begin",
+		"rollback begin failed",
+		"begin fail-commit",
+		"process fail-commit",
+		"rollback commit failed",
+		"begin panic",
+		"rollback recovering",
+		"begin b",
+		"process b",
+		"commit",
+	})
+}
+
+// TestCheckpoint tests the consistent snapshots of checkpoints
+// and their restoring.
+func TestCheckpoint(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("checkpoint")
+	defer env.Stop()
+
+	count := func(id string) int {
+		payload, err := env.Request(ctx, id, "count?", time.Second)
+		assert.Nil(err)
+		return payload.GetInt(cells.PayloadDefault, -1)
+	}
+
+	for _, id := range []string{"source", "a", "b", "sink"} {
+		env.StartCell(id, &snapshotBehavior{})
+	}
+	env.StartCell("forward", &forwardBehavior{})
+	env.Subscribe("source", "a", "b")
+	env.Subscribe("a", "sink", "forward")
+	env.Subscribe("b", "sink")
+
+	// Snapshots contain all events emitted before the checkpoint.
+	for i := 0; i < 100; i++ {
+		env.EmitNew(ctx, "source", "event", i)
+	}
+	cp, err := env.Checkpoint(ctx, 4711)
+	assert.Nil(err)
+	assert.Equal(cp.ID, uint64(1))
+	assert.Equal(cp.Offset, int64(4711))
+	assert.Length(cp.Snapshots, 4)
+	assert.Equal(string(cp.Snapshots["source"]), "100")
+	assert.Equal(string(cp.Snapshots["a"]), "100")
+	assert.Equal(string(cp.Snapshots["b"]), "100")
+	assert.Equal(string(cp.Snapshots["sink"]), "200")
+
+	// Restoring resets the state to the checkpoint.
+	for i := 0; i < 10; i++ {
+		env.EmitNew(ctx, "source", "event", i)
+	}
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(count("sink"), 220)
+	err = env.RestoreCheckpoint(ctx, cp)
+	assert.Nil(err)
+	assert.Equal(count("source"), 100)
+	assert.Equal(count("sink"), 200)
+
+	// Next checkpoint.
+	cp, err = env.Checkpoint(ctx, 4712)
+	assert.Nil(err)
+	assert.Equal(cp.ID, uint64(2))
+	assert.Equal(string(cp.Snapshots["sink"]), "200")
+
+	// Snapshots can only be restored by snapshotters.
+	cp.Snapshots["forward"] = []byte("1")
+	err = env.RestoreCheckpoint(ctx, cp)
+	assert.True(cells.IsRestoreSnapshotError(err))
+}
+
+// TestCheckpointCycle tests the rejection of checkpoints of
+// topologies containing cycles.
+func TestCheckpointCycle(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("checkpoint-cycle")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("a", &snapshotBehavior{})
+	env.StartCell("b", &stallBehavior{nil, sink})
+	env.Subscribe("source", "a")
+	env.Subscribe("a", "b")
+	env.Subscribe("b", "a")
+
+	cp, err := env.Checkpoint(ctx, 0)
+	assert.Nil(cp)
+	assert.True(cells.IsCyclicTopologyError(err))
+
+	// No events are held back.
+	for i := 0; i < 10; i++ {
+		env.EmitNew(ctx, "source", "event", i)
+	}
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(sink, 10)
+
+	// Without the cycle the checkpoint is taken.
+	env.Unsubscribe("b", "a")
+	cp, err = env.Checkpoint(ctx, 0)
+	assert.Nil(err)
+	assert.Equal(string(cp.Snapshots["a"]), "10")
+}
+
+// TestState tests the key/value state of cells.
+func TestState(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	store := cells.NewMemoryStateStore()
+	env := cells.NewEnvironment("state", cells.WithStateStore(store))
+	defer env.Stop()
+
+	kv := store.Namespace("counter")
+	count := func(topic string) string {
+		value, _, err := kv.Get(topic)
+		assert.Nil(err)
+		return string(value)
+	}
+
+	env.StartCell("counter", &stateBehavior{})
+	for _, topic := range []string{"a", "b", "a"} {
+		env.EmitNew(ctx, "counter", topic, nil)
+	}
+	assert.Nil(env.Barrier(ctx))
+	keys, err := kv.Keys()
+	assert.Nil(err)
+	assert.Equal(keys, []string{"a", "b"})
+	assert.Equal(count("a"), "2")
+
+	// The state survives a restart of the cell.
+	env.StopCell("counter")
+	env.StartCell("counter", &stateBehavior{})
+	env.EmitNew(ctx, "counter", "a", nil)
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(count("a"), "3")
+
+	// The state is part of checkpoints.
+	cp, err := env.Checkpoint(ctx, 0)
+	assert.Nil(err)
+	assert.Length(cp.Snapshots, 0)
+	assert.Equal(cp.States, map[string]map[string][]byte{
+		"counter": {"a": []byte("3"), "b": []byte("1")},
+	})
+	env.EmitNew(ctx, "counter", "a", nil)
+	env.EmitNew(ctx, "counter", "c", nil)
+	assert.Nil(env.Barrier(ctx))
+	assert.Equal(count("a"), "4")
+	err = env.RestoreCheckpoint(ctx, cp)
+	assert.Nil(err)
+	keys, err = kv.Keys()
+	assert.Nil(err)
+	assert.Equal(keys, []string{"a", "b"})
+	assert.Equal(count("a"), "3")
+}
+
+// TestAutoCheckpoint tests the checkpoints taken in an interval
+// and their snapshot stores.
+func TestAutoCheckpoint(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "auto-checkpoint")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	store := cells.NewFileSnapshotStore(dir, 2)
+
+	cp, err := store.LatestCheckpoint()
+	assert.Nil(err)
+	assert.Nil(cp)
+
+	env := cells.NewEnvironment("auto-checkpoint",
+		cells.WithAutoCheckpoint(20*time.Millisecond, store),
+		cells.WithCheckpointOffset(func() int64 { return 42 }))
+	env.StartCell("counter", &snapshotBehavior{})
+	for i := 0; i < 10; i++ {
+		env.EmitNew(ctx, "counter", "event", i)
+	}
+	assert.Nil(env.Barrier(ctx))
+
+	// Wait for checkpoints containing all events.
+	for i := 0; i < 100; i++ {
+		cp, err = store.LatestCheckpoint()
+		assert.Nil(err)
+		if cp != nil && cp.ID > 3 && string(cp.Snapshots["counter"]) == "10" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	env.Stop()
+	assert.Equal(cp.Offset, int64(42))
+	assert.Equal(string(cp.Snapshots["counter"]), "10")
+	files, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	assert.Nil(err)
+	assert.Length(files, 2)
+
+	// Restore in a new environment.
+	env = cells.NewEnvironment("auto-checkpoint")
+	defer env.Stop()
+	env.StartCell("counter", &snapshotBehavior{})
+	assert.Nil(env.RestoreCheckpoint(ctx, cp))
+	payload, err := env.Request(ctx, "counter", "count?", time.Second)
+	assert.Nil(err)
+	assert.Equal(payload.GetInt(cells.PayloadDefault, -1), 10)
+
+	// Corrupt checkpoints are detected.
+	sort.Strings(files)
+	data, err := ioutil.ReadFile(files[1])
+	assert.Nil(err)
+	data = bytes.Replace(data, []byte(`"Offset":42`), []byte(`"Offset":43`), 1)
+	assert.Nil(ioutil.WriteFile(files[1], data, 0644))
+	_, err = store.LatestCheckpoint()
+	assert.True(cells.IsCorruptCheckpointError(err))
+
+	// Key/value stores keep the last checkpoints too.
+	kv := cells.NewMemoryStateStore().Namespace("checkpoints")
+	kvStore := cells.NewKVSnapshotStore(kv, 1)
+	for id := uint64(1); id <= 3; id++ {
+		err = kvStore.SaveCheckpoint(&cells.Checkpoint{ID: id, Taken: time.Now()})
+		assert.Nil(err)
+	}
+	keys, err := kv.Keys()
+	assert.Nil(err)
+	assert.Length(keys, 1)
+	cp, err = kvStore.LatestCheckpoint()
+	assert.Nil(err)
+	assert.Equal(cp.ID, uint64(3))
+}
+
+// TestProbe tests the probing of the latencies along a route.
+func TestProbe(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("probe")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("a", &forwardBehavior{})
+	env.StartCell("b", newCollectBehavior(sink))
+	env.Subscribe("a", "b")
+
+	result, err := env.Probe(ctx, "a", "b", "a")
+	assert.Nil(err)
+	assert.Length(result.Hops, 3)
+	var total time.Duration
+	for i, id := range []string{"a", "b", "a"} {
+		assert.Equal(result.Hops[i].ID, id)
+		total += result.Hops[i].Latency
+	}
+	assert.Equal(result.Total, total)
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(sink, 0)
+
+	_, err = env.Probe(ctx, "a", "missing")
+	assert.True(cells.IsInvalidIDError(err))
+}
+
+// TestPrimarySubscriber tests the delivery to a primary subscriber
+// before the best-effort ones.
+func TestPrimarySubscriber(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("primary-subscriber")
+	defer env.Stop()
+
+	journal := cells.NewEventSink(0)
+	tap := &stallBehavior{
+		releasec: make(chan struct{}),
+		sink:     cells.NewEventSink(0),
+	}
+	env.StartCell("source", &forwardBehavior{})
+	env.StartCell("journal", newCollectBehavior(journal))
+	env.StartCell("tap", tap)
+	env.StartCell("other", &nullBehavior{})
+	env.Subscribe("source", "journal", "tap")
+
+	err := env.SetPrimarySubscriber("unknown", "journal")
+	assert.True(cells.IsInvalidIDError(err))
+	err = env.SetPrimarySubscriber("source", "other")
+	assert.True(cells.IsInvalidIDError(err))
+	err = env.SetPrimarySubscriber("source", "journal")
+	assert.Nil(err)
+
+	// The blocked tap doesn't block the journal.
+	env.EmitNew(ctx, "source", "stall", nil)
+	for i := 0; i < 100; i++ {
+		env.EmitNew(ctx, "source", "event", i)
+	}
+	assert.Nil(env.Barrier(ctx, "source", "journal"))
+	assert.Length(journal, 101)
+	close(tap.releasec)
+	assert.Nil(env.Barrier(ctx))
+	assert.True(tap.sink.Len() < 100)
+	stats, ok := env.Stats().Cell("tap")
+	assert.True(ok)
+	assert.Equal(int(stats.Dropped), 100-tap.sink.Len())
+
+	// Without primary all subscribers are served equally.
+	err = env.SetPrimarySubscriber("source", "")
+	assert.Nil(err)
+	tap.sink.Clear()
+	for i := 0; i < 10; i++ {
+		env.EmitNew(ctx, "source", "event", i)
+	}
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(tap.sink, 10)
+}
+
+// TestPanicReports tests the reporting of panics to the
+// supervisor and additional cells.
+func TestPanicReports(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("panic-reports",
+		cells.WithSupervisor("supervisor"),
+		cells.WithPanicReports(cells.RedactKeys("password"), "dead-letters"),
+	)
+	defer env.Stop()
+
+	supervisorSink := cells.NewEventSink(0)
+	deadLetterSink := cells.NewEventSink(0)
+	workerSink := cells.NewEventSink(0)
+	env.StartCell("supervisor", newCollectBehavior(supervisorSink))
+	env.StartCell("dead-letters", newCollectBehavior(deadLetterSink))
+	env.StartCell("worker", newCollectBehavior(workerSink))
+
+	env.EmitNew(ctx, "worker", panicTopic, cells.PayloadValues{
+		"user":     "john",
+		"password": "secret",
+	})
+	env.EmitNew(ctx, "worker", "after", nil)
+	assert.Nil(env.Barrier(ctx))
+
+	// The worker recovered.
+	assert.Length(workerSink, 1)
+
+	// Both got the report.
+	assert.Length(supervisorSink, 1)
+	assert.Length(deadLetterSink, 1)
+	report, ok := deadLetterSink.PeekFirst()
+	assert.True(ok)
+	assert.Equal(report.Topic(), cells.TopicCellPanic)
+	payload := report.Payload()
+	assert.Equal(payload.GetString(cells.PayloadCellPanicID, ""), "worker")
+	assert.Equal(payload.GetString(cells.PayloadCellPanicReason, ""), "ouch!")
+	assert.Equal(payload.GetString(cells.PayloadCellPanicTopic, ""), panicTopic)
+	assert.True(strings.Contains(payload.GetString(cells.PayloadCellPanicStack, ""), "collectBehavior).ProcessEvent"))
+	assert.Equal(payload.Get(cells.PayloadCellPanicPayload, nil), cells.PayloadValues{
+		"user":     "john",
+		"password": cells.RedactedValue,
+	})
+}
+
+// TestStrictMode tests the rejection of unregistered topics.
+func TestStrictMode(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("strict-mode",
+		cells.StrictMode(),
+		cells.WithTopics("a", "b"),
+	)
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	errc := make(chan error, 2)
+	env.StartCell("forwarder", &forwardBehavior{})
+	env.StartCell("registered", &renameBehavior{topic: "b", errc: errc})
+	env.StartCell("unregistered", &renameBehavior{topic: "x", errc: errc})
+	env.StartCell("collector", newCollectBehavior(sink))
+	env.Subscribe("forwarder", "collector")
+
+	// Registered topics, commands, and requests are emitted.
+	assert.Nil(env.EmitNew(ctx, "forwarder", "a", 1))
+	assert.Nil(env.EmitNew(ctx, "forwarder", "b", 2))
+	assert.Nil(env.EmitNew(ctx, "forwarder", "start!", 3))
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(sink, 3)
+
+	// Unregistered ones are rejected.
+	err := env.EmitNew(ctx, "forwarder", "x", 4)
+	assert.True(cells.IsUnregisteredTopicError(err))
+
+	// Also when emitted by a cell. Emitting without subscribers
+	// is only logged.
+	assert.Nil(env.EmitNew(ctx, "registered", "a", 5))
+	assert.Nil(<-errc)
+	assert.Nil(env.EmitNew(ctx, "unregistered", "a", 6))
+	assert.True(cells.IsUnregisteredTopicError(<-errc))
+}
+
+// TestDrain tests flushing buffering behaviors before stopping.
+func TestDrain(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("drain")
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("second", &bufferBehavior{})
+	env.StartCell("first", &bufferBehavior{})
+	env.StartCell("forwarder", &forwardBehavior{})
+	env.StartCell("collector", newCollectBehavior(sink))
+	env.Subscribe("first", "forwarder")
+	env.Subscribe("forwarder", "second")
+	env.Subscribe("second", "collector")
+
+	// Flushing a single cell.
+	env.EmitNew(ctx, "first", "a", 1)
+	reply, err := env.Request(ctx, "first", cells.TopicFlush, time.Second)
+	assert.Nil(err)
+	assert.Equal(reply.GetString(cells.PayloadCommand, ""), cells.CommandFlush)
+	assert.Nil(env.Barrier(ctx))
+	assert.Length(sink, 0)
+
+	// Draining flushes both buffers in order.
+	env.EmitNew(ctx, "first", "b", 2)
+	env.EmitNew(ctx, "first", "c", 3)
+	assert.Nil(env.Drain(ctx))
+	assert.Length(sink, 3)
+	topics := []string{}
+	sink.Do(func(index int, event cells.Event) error {
+		topics = append(topics, event.Topic())
+		return nil
+	})
+	assert.Equal(topics, []string{"a", "b", "c"})
+
+	// The environment has been stopped.
+	err = env.EmitNew(ctx, "first", "d", 4)
+	assert.ErrorMatch(err, `.*cell with ID "first" does not exist.*`)
+}
+
+// TestContextKeys tests the propagation of context values
+// through cells emitting with fresh contexts.
+func TestContextKeys(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	for _, keyed := range []bool{true, false} {
+		assert.Logf("keyed %v", keyed)
+		var env cells.Environment
+		if keyed {
+			env = cells.NewEnvironment("context-keys", cells.WithContextKeys(contextKey{}))
+		} else {
+			env = cells.NewEnvironment("context-keys")
+		}
+		sink := cells.NewEventSink(0)
+		env.StartCell("fresh", &freshContextBehavior{})
+		env.StartCell("collect", newCollectBehavior(sink))
+		env.Subscribe("fresh", "collect")
+
+		ctx := context.WithValue(context.Background(), contextKey{}, "tenant-a")
+		env.EmitNew(ctx, "fresh", "a", nil)
+		env.EmitNew(context.Background(), "fresh", "b", nil)
+		err := env.Barrier(context.Background())
+		assert.Nil(err)
+		assert.Length(sink, 2)
+
+		event, _ := sink.PeekFirst()
+		values := cells.ContextValues(event)
+		if keyed {
+			assert.Equal(event.Context().Value(contextKey{}), "tenant-a")
+			assert.Equal(values[contextKey{}], "tenant-a")
+		} else {
+			assert.Nil(event.Context().Value(contextKey{}))
+			assert.Empty(values)
+		}
+		event, _ = sink.PeekLast()
+		assert.Nil(event.Context().Value(contextKey{}))
+		assert.Empty(cells.ContextValues(event))
+		env.Stop()
+	}
+
+	ctx := cells.RestoreContextValues(nil, map[interface{}]interface{}{contextKey{}: "tenant-b"})
+	assert.Equal(ctx.Value(contextKey{}), "tenant-b")
+}
+
+// TestIDGenerators tests the generation of sortable IDs.
+func TestIDGenerators(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	generators := map[string]struct {
+		gen     cells.IDGenerator
+		pattern string
+	}{
+		"ulid":    {cells.NewULIDGenerator(), `^[0-9A-HJKMNP-TV-Z]{26}$`},
+		"uuid-v7": {cells.NewUUIDv7Generator(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+	for name, g := range generators {
+		assert.Logf("generator %s", name)
+		pattern := regexp.MustCompile(g.pattern)
+		last := ""
+		for i := 0; i < 10000; i++ {
+			id := g.gen()
+			assert.True(pattern.MatchString(id))
+			assert.True(id > last)
+			last = id
+		}
+	}
+
+	env := cells.NewEnvironment(cells.WithIDGenerator(cells.NewULIDGenerator()))
+	defer env.Stop()
+	assert.True(regexp.MustCompile(`^[0-9A-Z]{26}$`).MatchString(env.ID()))
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("collect", newCollectBehavior(sink))
+	for i := 0; i < 10; i++ {
+		env.EmitNew(context.Background(), "collect", "id", i)
+	}
+	err := env.Barrier(context.Background())
+	assert.Nil(err)
+	last := ""
+	sink.Do(func(index int, event cells.Event) error {
+		assert.True(event.ID() > last)
+		last = event.ID()
+		return nil
+	})
+	assert.True(regexp.MustCompile(`^[0-9A-Z]{26}$`).MatchString(cells.InspectCell(env, "collect").InstanceID()))
+}
+
+// TestDependencies tests the starting of cells depending on others.
+func TestDependencies(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("dependencies")
+	defer env.Stop()
+
+	err := env.StartCell("router", &dependentBehavior{dependencies: []string{"a", "b"}})
+	assert.True(cells.IsMissingDependencyError(err))
+	assert.False(env.HasCell("router"))
+	err = env.StartCell("a", &nullBehavior{}, cells.After("b"))
+	assert.True(cells.IsMissingDependencyError(err))
+
+	err = env.StartCell("b", &nullBehavior{})
+	assert.Nil(err)
+	err = env.StartCell("a", &nullBehavior{}, cells.After("b"))
+	assert.Nil(err)
+	err = env.StartCell("router", &dependentBehavior{dependencies: []string{"a", "b"}})
+	assert.Nil(err)
+
+	// Restoring starts the cells in dependency order.
+	store := cells.NewMemoryTopologyStore()
+	store.SaveTopology(&cells.Topology{
+		Cells: []cells.TopologyCell{
+			{ID: "router", Kind: "dependent", Config: map[string]interface{}{"after": "target"}},
+			{ID: "target", Kind: "dependent"},
+		},
+	})
+	factory := func(kind string, config map[string]interface{}) (cells.Behavior, error) {
+		if after, ok := config["after"].(string); ok {
+			return &dependentBehavior{dependencies: []string{after}}, nil
+		}
+		return &dependentBehavior{}, nil
+	}
+	restored := cells.NewEnvironment("dependencies-restored")
+	defer restored.Stop()
+	err = restored.RestoreTopology(store, factory)
+	assert.Nil(err)
+	assert.True(restored.HasCell("router"))
+	assert.True(restored.HasCell("target"))
+
+	store.SaveTopology(&cells.Topology{
+		Cells: []cells.TopologyCell{
+			{ID: "router", Kind: "dependent", Config: map[string]interface{}{"after": "missing"}},
+		},
+	})
+	missing := cells.NewEnvironment("dependencies-missing")
+	defer missing.Stop()
+	err = missing.RestoreTopology(store, factory)
+	assert.True(cells.IsMissingDependencyError(err))
+}
+
+// TestProcessTimeout tests the canceling of too long processings.
+func TestProcessTimeout(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("process-timeout")
+	defer env.Stop()
+
+	// The slow processing event is emitted asynchronously, so
+	// the sink signals its arrival.
+	checker := func(events cells.EventSinkAccessor) (bool, cells.Payload, error) {
+		return events.Len() > 0, nil, nil
+	}
+	sink, waiter := cells.NewCheckedEventSink(0, checker)
+	behavior := &blockingBehavior{reportc: make(chan error, 1)}
+	env.StartCell("slow", behavior, cells.ProcessTimeout(50*time.Millisecond), cells.SlowProcessingEvents(), cells.WithTraceBuffer(10))
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.Subscribe("slow", "collect")
+
+	env.EmitNew(context.Background(), "slow", "block", nil)
+	select {
+	case err := <-behavior.reportc:
+		assert.Equal(err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		assert.Fail("process timeout not reached")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := waiter.Wait(ctx)
+	assert.Nil(err)
+
+	// The cell keeps working and emits with contexts not canceled.
+	env.EmitNew(context.Background(), "slow", "ok", nil)
+	err = env.Barrier(context.Background())
+	assert.Nil(err)
+	assert.Length(sink, 2)
+	event, _ := sink.PeekFirst()
+	assert.Equal(event.Topic(), cells.TopicSlowProcessing)
+	assert.Equal(event.Payload().GetString(cells.PayloadSlowTopic, ""), "block")
+	assert.Equal(event.Payload().GetDuration(cells.PayloadSlowTimeout, 0), 50*time.Millisecond)
+	event, _ = sink.PeekLast()
+	assert.Equal(event.Topic(), "ok")
+	assert.Nil(event.Context().Err())
+
+	entries, err := env.Trace("slow")
+	assert.Nil(err)
+	assert.Length(entries, 2)
+	assert.True(cells.IsTimeoutError(entries[0].Err))
+	assert.Nil(entries[1].Err)
+}
+
+// TestProcessTimeoutErrorPolicy tests the handling of process
+// timeouts by the error policy.
+func TestProcessTimeoutErrorPolicy(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("process-timeout-error-policy", cells.WithSupervisor("supervisor"))
+	defer env.Stop()
+
+	checker := func(events cells.EventSinkAccessor) (bool, cells.Payload, error) {
+		return events.Len() > 0, nil, nil
+	}
+	supervisorSink, waiter := cells.NewCheckedEventSink(0, checker)
+	sink := cells.NewEventSink(0)
+	behavior := &blockingBehavior{reportc: make(chan error, 1)}
+	env.StartCell("supervisor", newCollectBehavior(supervisorSink))
+	env.StartCell("slow", behavior, cells.ProcessTimeout(50*time.Millisecond), cells.OnError(cells.EscalateToSupervisor))
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.Subscribe("slow", "collect")
+
+	env.EmitNew(ctx, "slow", "block", nil)
+	wctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_, err := waiter.Wait(wctx)
+	assert.Nil(err)
+	escalated, ok := supervisorSink.PeekFirst()
+	assert.True(ok)
+	assert.Equal(escalated.Topic(), cells.TopicCellError)
+	assert.Equal(escalated.Payload().GetString(cells.PayloadCellErrorID, ""), "slow")
+	assert.Equal(escalated.Payload().GetString(cells.PayloadCellErrorTopic, ""), "block")
+	assert.Contents("needed too long", escalated.Payload().GetString(cells.PayloadCellError, ""))
+
+	// The cell keeps working.
+	env.EmitNew(ctx, "slow", "ok", nil)
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Length(sink, 1)
+}
+
+// TestEmitRateLimit tests the shaping of emits.
+func TestEmitRateLimit(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("emit-rate-limit")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+	env.StartCell("limited", &forwardBehavior{}, cells.EmitRateLimit(100, 5))
+	env.StartCell("unlimited", &forwardBehavior{})
+	env.StartCell("collect", newCollectBehavior(sink))
+	env.Subscribe("limited", "collect")
+	env.Subscribe("unlimited", "collect")
+
+	measure := func(id string) time.Duration {
+		start := time.Now()
+		for i := 0; i < 15; i++ {
+			env.EmitNew(context.Background(), id, "emit", i)
+		}
+		err := env.Barrier(context.Background())
+		assert.Nil(err)
+		return time.Since(start)
+	}
+	// Burst of 5, then 10 emits at 100 per second.
+	assert.True(measure("limited") >= 90*time.Millisecond)
+	assert.True(measure("unlimited") < 90*time.Millisecond)
+	assert.Length(sink, 30)
+}
+
+// TestPersistentTopology tests the restoring of a persisted topology.
+func TestPersistentTopology(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	store := cells.NewMemoryTopologyStore()
+	factory := func(kind string, config map[string]interface{}) (cells.Behavior, error) {
+		if kind != "described" {
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+		return &describedBehavior{config: config}, nil
+	}
+
+	envA := cells.NewEnvironment("persistent-topology-a", cells.WithTopologyStore(store, factory))
+	envA.StartCell("static", &nullBehavior{})
+	envA.StartCell("dynamic", &describedBehavior{config: map[string]interface{}{"n": 1}})
+	envA.Subscribe("static", "dynamic")
+	envA.Subscribe("dynamic", "static")
+	envA.Stop()
+
+	envB := cells.NewEnvironment("persistent-topology-b", cells.WithTopologyStore(store, factory))
+	defer envB.Stop()
+	assert.True(envB.HasCell("dynamic"))
+	assert.False(envB.HasCell("static"))
+	subs, err := envB.Subscribers("dynamic")
+	assert.Nil(err)
+	assert.Empty(subs)
+
+	envB.StartCell("static", &nullBehavior{})
+	subs, err = envB.Subscribers("static")
+	assert.Nil(err)
+	assert.Equal(subs, []string{"dynamic"})
+	subs, err = envB.Subscribers("dynamic")
+	assert.Nil(err)
+	assert.Equal(subs, []string{"static"})
+
+	envC := cells.NewEnvironment("persistent-topology-c")
+	defer envC.Stop()
+	err = envC.SaveTopology(store)
+	assert.Nil(err)
+	err = envB.SaveTopology(store)
+	assert.Nil(err)
+	err = envC.RestoreTopology(store, func(kind string, config map[string]interface{}) (cells.Behavior, error) {
+		return nil, fmt.Errorf("no behaviors")
+	})
+	assert.True(cells.IsRestoreCellError(err))
+	err = envC.RestoreTopology(store, factory)
+	assert.Nil(err)
+	assert.True(envC.HasCell("dynamic"))
+}
+
+// TestEnvironmentBarrier tests waiting for drained cells.
+func TestEnvironmentBarrier(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("barrier")
+	defer env.Stop()
+
+	sinkA := cells.NewEventSink(0)
+	sinkB := cells.NewEventSink(0)
+	sinkC := cells.NewEventSink(0)
+	env.StartCell("a", newCollectBehavior(sinkA))
+	env.StartCell("b", newCollectBehavior(sinkB))
+	env.StartCell("c", newCollectBehavior(sinkC))
+	env.Subscribe("a", "b")
+	env.Subscribe("b", "c")
+
+	for i := 0; i < 100; i++ {
+		env.EmitNew(context.Background(), "a", "barrier", i)
+	}
+	err := env.Barrier(context.Background(), "a", "b", "c")
+	assert.Nil(err)
+	assert.Length(sinkA, 100)
+	assert.Length(sinkB, 100)
+	assert.Length(sinkC, 100)
+
+	err = env.Barrier(context.Background(), "a", "unknown")
+	assert.True(cells.IsInvalidIDError(err))
+
+	env.StartCell("blocking", newContextBehavior())
+	env.EmitNew(context.Background(), "blocking", "block", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = env.Barrier(ctx)
+	assert.True(cells.IsTimeoutError(err))
+}
+
+// TestCellTrace tests the tracing of processed events.
+func TestCellTrace(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("cell-trace")
+	defer env.Stop()
+
+	env.StartCell("traced", newCollectBehavior(cells.NewEventSink(0)), cells.WithTraceBuffer(3))
+	env.StartCell("untraced", newCollectBehavior(cells.NewEventSink(0)))
+
+	for i := 0; i < 5; i++ {
+		env.EmitNew(context.Background(), "traced", fmt.Sprintf("topic-%d", i), i)
+		env.EmitNew(context.Background(), "untraced", fmt.Sprintf("topic-%d", i), i)
+	}
+	err := env.Barrier(context.Background())
+	assert.Nil(err)
+
+	trace, err := env.Trace("traced")
+	assert.Nil(err)
+	assert.Length(trace, 3)
+	for i, entry := range trace {
+		assert.Equal(entry.Topic, fmt.Sprintf("topic-%d", i+2))
+		assert.Contents(fmt.Sprintf("%d", i+2), entry.Payload)
+		assert.Nil(entry.Err)
+	}
+
+	trace, err = env.Trace("untraced")
+	assert.Nil(err)
+	assert.Length(trace, 0)
+
+	_, err = env.Trace("unknown")
+	assert.True(cells.IsInvalidIDError(err))
+}
+
 //--------------------
 // BENCHMARKS
 //--------------------
@@ -395,4 +2388,20 @@ func BenchmarkSmpleEmitStandardMonitoring(b *testing.B) {
 	}
 }
 
+// BenchmarkSmallPayloadEmitNew is an emitting of new events with a
+// single payload value to one cell with the null monitor.
+func BenchmarkSmallPayloadEmitNew(b *testing.B) {
+	monitoring.SetBackend(monitoring.NewNullBackend())
+	env := cells.NewEnvironment("small-payload-emit-new")
+	defer env.Stop()
+
+	env.StartCell("null", &nullBehavior{})
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		env.EmitNew(ctx, "null", "foo", "bar")
+	}
+}
+
 // EOF
@@ -0,0 +1,376 @@
+// Tideland Go Cells - Cell Test
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package celltest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TestedID is the ID of the cell running the tested behavior.
+	TestedID = "tested"
+
+	// RecorderID is the ID of the cell recording the emitted events.
+	RecorderID = "recorder"
+
+	// defaultTimeout is the time AssertEmitted() waits for a
+	// matching event.
+	defaultTimeout = time.Second
+)
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// DeterministicEnvironment creates an environment processing the
+// events of all cells one at a time in the order they have been
+// emitted. The IDs of the events are generated by a counter. So
+// repeated runs of a test lead to the same interleavings and IDs.
+func DeterministicEnvironment(options ...cells.Option) cells.Environment {
+	var counter uint64
+	options = append([]cells.Option{
+		cells.WithIDGenerator(func() string {
+			return fmt.Sprintf("%016d", atomic.AddUint64(&counter, 1))
+		}),
+	}, options...)
+	options = append(options, cells.WithDeterministicScheduling())
+	idParts := make([]interface{}, len(options)+1)
+	idParts[0] = "celltest"
+	for i, option := range options {
+		idParts[i+1] = option
+	}
+	return cells.NewEnvironment(idParts...)
+}
+
+//--------------------
+// TESTER
+//--------------------
+
+// Tester runs a behavior in its own environment and records
+// the events it emits.
+type Tester struct {
+	env     cells.Environment
+	sink    cells.EventSink
+	timeout time.Duration
+}
+
+// NewTester starts the behavior with the ID TestedID in a new
+// environment and subscribes a recorder to it.
+func NewTester(behavior cells.Behavior, options ...cells.CellOption) (*Tester, error) {
+	t := &Tester{
+		env:     cells.NewEnvironment("celltest"),
+		sink:    cells.NewEventSink(0),
+		timeout: defaultTimeout,
+	}
+	if err := t.env.StartCell(TestedID, behavior, options...); err != nil {
+		t.env.Stop()
+		return nil, err
+	}
+	if err := t.env.StartCell(RecorderID, &recorderBehavior{t.sink}); err != nil {
+		t.env.Stop()
+		return nil, err
+	}
+	if err := t.env.Subscribe(TestedID, RecorderID); err != nil {
+		t.env.Stop()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Environment returns the environment of the tester, e.g. to
+// start and subscribe more cells.
+func (t *Tester) Environment() cells.Environment {
+	return t.env
+}
+
+// SetTimeout sets the time AssertEmitted() waits for a
+// matching event. Default is one second.
+func (t *Tester) SetTimeout(timeout time.Duration) {
+	t.timeout = timeout
+}
+
+// Emit emits a new event to the tested behavior.
+func (t *Tester) Emit(topic string, payload interface{}) error {
+	return t.env.EmitNew(context.Background(), TestedID, topic, payload)
+}
+
+// Emitted waits until the tested cell and the recorder processed
+// their queued events and returns the events emitted so far.
+func (t *Tester) Emitted() []cells.Event {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	t.env.Barrier(ctx, TestedID, RecorderID)
+	events := []cells.Event{}
+	t.sink.Do(func(index int, event cells.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	return events
+}
+
+// Reset drops the recorded events.
+func (t *Tester) Reset() error {
+	return t.sink.Clear()
+}
+
+// Stop terminates the environment of the tester.
+func (t *Tester) Stop() error {
+	return t.env.Stop()
+}
+
+// recorderBehavior records all received events.
+type recorderBehavior struct {
+	sink cells.EventSink
+}
+
+// Init implements the cells.Behavior interface.
+func (b *recorderBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *recorderBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *recorderBehavior) ProcessEvent(event cells.Event) error {
+	_, err := b.sink.Push(event)
+	return err
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *recorderBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+//--------------------
+// MATCHER
+//--------------------
+
+// EventMatcher checks if an emitted event is the expected one.
+type EventMatcher interface {
+	fmt.Stringer
+
+	// Match returns true if the event is the expected one.
+	Match(event cells.Event) bool
+}
+
+// matcher implements the EventMatcher interface.
+type matcher struct {
+	description string
+	topic       string
+	values      cells.PayloadValues
+	match       func(event cells.Event) bool
+}
+
+// MatchTopic expects an event with the given topic.
+func MatchTopic(topic string) EventMatcher {
+	return &matcher{
+		description: fmt.Sprintf("event with topic %q", topic),
+		topic:       topic,
+	}
+}
+
+// MatchPayload expects an event with the given topic and at least
+// the passed payload values. Failed assertions show the differences
+// to the payloads of the emitted events with this topic.
+func MatchPayload(topic string, values cells.PayloadValues) EventMatcher {
+	return &matcher{
+		description: fmt.Sprintf("event with topic %q and payload", topic),
+		topic:       topic,
+		values:      values,
+	}
+}
+
+// MatchFunc expects an event accepted by the function.
+func MatchFunc(description string, match func(event cells.Event) bool) EventMatcher {
+	return &matcher{
+		description: description,
+		match:       match,
+	}
+}
+
+// Match implements the EventMatcher interface.
+func (m *matcher) Match(event cells.Event) bool {
+	if m.match != nil {
+		return m.match(event)
+	}
+	if event.Topic() != m.topic {
+		return false
+	}
+	for key, expected := range m.values {
+		actual := event.Payload().Get(key, nil)
+		if !reflect.DeepEqual(expected, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// String implements the fmt.Stringer interface.
+func (m *matcher) String() string {
+	if m.values == nil {
+		return m.description
+	}
+	return m.description + "\n" + indent(Dump(cells.NewPayload(m.values)))
+}
+
+//--------------------
+// ASSERTIONS
+//--------------------
+
+// AssertEmitted waits until the tested behavior emitted an event
+// matching the expectation and returns it. Otherwise the test fails
+// with a dump of all emitted events.
+func AssertEmitted(t testing.TB, tester *Tester, match EventMatcher) cells.Event {
+	t.Helper()
+	deadline := time.Now().Add(tester.timeout)
+	for {
+		events := tester.Emitted()
+		for _, event := range events {
+			if match.Match(event) {
+				return event
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no emitted event matches\n\nexpected:\n%s\n\nemitted:\n%s",
+				indent(match.String()), indent(report(match, events)))
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// report describes the emitted events for a failed assertion.
+// Events with the expected topic show the payload differences.
+func report(match EventMatcher, events []cells.Event) string {
+	if len(events) == 0 {
+		return "(none)"
+	}
+	m, _ := match.(*matcher)
+	parts := []string{}
+	for _, event := range events {
+		part := Dump(event)
+		if m != nil && m.values != nil && m.topic == event.Topic() {
+			part = fmt.Sprintf("%s\ndiff (-expected +actual):\n%s",
+				part, indent(Diff(m.values, payloadValues(event.Payload()))))
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n")
+}
+
+//--------------------
+// DUMP AND DIFF
+//--------------------
+
+// Dump returns a human-readable representation of an event
+// or a payload, one payload value per line ordered by key.
+func Dump(v interface{}) string {
+	switch tv := v.(type) {
+	case cells.Event:
+		head := fmt.Sprintf("event %q", tv.Topic())
+		if tv.Emitter() != "" {
+			head += fmt.Sprintf(" from %q", tv.Emitter())
+		}
+		head += " at " + tv.Timestamp().Format(time.RFC3339Nano)
+		return head + "\n" + indent(Dump(tv.Payload()))
+	case cells.Payload:
+		values := payloadValues(tv)
+		if len(values) == 0 {
+			return "(empty payload)"
+		}
+		lines := []string{}
+		for _, key := range sortedKeys(values) {
+			lines = append(lines, formatValue(key, values[key]))
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return fmt.Sprintf("%#v", v)
+	}
+}
+
+// Diff returns the differences between the expected and the actual
+// payload values line by line. Expected values are marked with
+// a minus, actual values with a plus. Actual values without an
+// expectation are ignored.
+func Diff(expected, actual cells.PayloadValues) string {
+	lines := []string{}
+	for _, key := range sortedKeys(expected) {
+		ev := expected[key]
+		av, ok := actual[key]
+		switch {
+		case !ok:
+			lines = append(lines, "- "+formatValue(key, ev), "+ "+key+": (missing)")
+		case !reflect.DeepEqual(ev, av):
+			lines = append(lines, "- "+formatValue(key, ev), "+ "+formatValue(key, av))
+		default:
+			lines = append(lines, "  "+formatValue(key, ev))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// payloadValues returns the values of a payload.
+func payloadValues(payload cells.Payload) cells.PayloadValues {
+	values := cells.PayloadValues{}
+	payload.Do(func(key string, value interface{}) error {
+		values[key] = value
+		return nil
+	})
+	return values
+}
+
+// sortedKeys returns the keys of the payload values in order.
+func sortedKeys(values cells.PayloadValues) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue formats one payload value together with its type.
+func formatValue(key string, value interface{}) string {
+	switch tv := value.(type) {
+	case string:
+		return fmt.Sprintf("%s: %q (string)", key, tv)
+	case time.Time:
+		return fmt.Sprintf("%s: %s (time.Time)", key, tv.Format(time.RFC3339Nano))
+	case nil:
+		return fmt.Sprintf("%s: nil", key)
+	default:
+		return fmt.Sprintf("%s: %v (%T)", key, tv, tv)
+	}
+}
+
+// indent indents all lines of the text.
+func indent(text string) string {
+	return "    " + strings.Replace(text, "\n", "\n    ", -1)
+}
+
+// EOF
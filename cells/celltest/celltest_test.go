@@ -0,0 +1,209 @@
+// Tideland Go Cells - Cell Test - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package celltest_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/celltest"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestAssertEmitted tests matching emitted events.
+func TestAssertEmitted(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	tester, err := celltest.NewTester(&doubleBehavior{})
+	assert.Nil(err)
+	defer tester.Stop()
+
+	tester.Emit("a", 1)
+	tester.Emit("b", 2)
+
+	event := celltest.AssertEmitted(t, tester, celltest.MatchTopic("a"))
+	assert.Equal(event.Emitter(), celltest.TestedID)
+	celltest.AssertEmitted(t, tester, celltest.MatchPayload("b", cells.PayloadValues{
+		"in":  2,
+		"out": 4,
+	}))
+	celltest.AssertEmitted(t, tester, celltest.MatchFunc("doubled", func(event cells.Event) bool {
+		return event.Payload().GetInt("out", 0) == 2
+	}))
+	assert.Length(tester.Emitted(), 2)
+
+	assert.Nil(tester.Reset())
+	assert.Length(tester.Emitted(), 0)
+}
+
+// TestAssertEmittedFailure tests the output of failed assertions.
+func TestAssertEmittedFailure(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	tester, err := celltest.NewTester(&doubleBehavior{})
+	assert.Nil(err)
+	defer tester.Stop()
+	tester.SetTimeout(50 * time.Millisecond)
+
+	tester.Emit("a", 1)
+
+	ft := &failingT{TB: t}
+	event := celltest.AssertEmitted(ft, tester, celltest.MatchPayload("a", cells.PayloadValues{
+		"in":  1,
+		"out": 3,
+		"tag": "x",
+	}))
+	assert.Nil(event)
+	assert.Contents(`event "a" from "tested"`, ft.message)
+	assert.Contents("  in: 1 (int)", ft.message)
+	assert.Contents("- out: 3 (int)", ft.message)
+	assert.Contents("+ out: 2 (int)", ft.message)
+	assert.Contents(`- tag: "x" (string)`, ft.message)
+	assert.Contents("+ tag: (missing)", ft.message)
+}
+
+// TestDiff tests the diff of payload values.
+func TestDiff(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	diff := celltest.Diff(cells.PayloadValues{
+		"a": 1,
+		"b": "x",
+	}, cells.PayloadValues{
+		"a": 1,
+		"b": "y",
+		"c": true,
+	})
+	assert.Equal(diff, "  a: 1 (int)\n- b: \"x\" (string)\n+ b: \"y\" (string)")
+	assert.Equal(celltest.Dump(cells.NewPayload(nil)), "(empty payload)")
+}
+
+// TestDeterministicEnvironment tests the reproducible processing
+// of events in a pipeline of cells.
+func TestDeterministicEnvironment(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	run := func() []string {
+		env := celltest.DeterministicEnvironment()
+		defer env.Stop()
+		trace := &trace{}
+		for _, id := range []string{"in", "left", "right", "out"} {
+			assert.Nil(env.StartCell(id, &traceBehavior{trace: trace}))
+		}
+		assert.Nil(env.Subscribe("in", "left", "right"))
+		assert.Nil(env.Subscribe("left", "out"))
+		assert.Nil(env.Subscribe("right", "out"))
+		for _, topic := range []string{"a", "b", "c"} {
+			assert.Nil(env.EmitNew(context.Background(), "in", topic, nil))
+		}
+		assert.Nil(env.Barrier(context.Background(), "in", "left", "right", "out"))
+		return trace.entries()
+	}
+
+	first := run()
+	assert.Length(first, 15)
+	assert.Equal(strings.Join(first[:5], " "), "in:a:0000000000000005 in:b:0000000000000006 in:c:0000000000000007 left:a:0000000000000005 right:a:0000000000000005")
+	for i := 0; i < 5; i++ {
+		assert.Equal(run(), first)
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// doubleBehavior emits the doubled default payload value.
+type doubleBehavior struct {
+	cell cells.Cell
+}
+
+func (b *doubleBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *doubleBehavior) Terminate() error {
+	return nil
+}
+
+func (b *doubleBehavior) ProcessEvent(event cells.Event) error {
+	in := event.Payload().GetInt(cells.PayloadDefault, 0)
+	return b.cell.EmitNew(event.Context(), event.Topic(), cells.PayloadValues{
+		"in":  in,
+		"out": in * 2,
+	})
+}
+
+func (b *doubleBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// trace records the processed events of all cells.
+type trace struct {
+	mutex sync.Mutex
+	all   []string
+}
+
+func (t *trace) add(entry string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.all = append(t.all, entry)
+}
+
+func (t *trace) entries() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string{}, t.all...)
+}
+
+// traceBehavior traces and emits the received events.
+type traceBehavior struct {
+	cell  cells.Cell
+	trace *trace
+}
+
+func (b *traceBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *traceBehavior) Terminate() error {
+	return nil
+}
+
+func (b *traceBehavior) ProcessEvent(event cells.Event) error {
+	b.trace.add(b.cell.ID() + ":" + event.Topic() + ":" + event.ID())
+	return b.cell.Emit(event)
+}
+
+func (b *traceBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// failingT records the message of a failed test.
+type failingT struct {
+	testing.TB
+	message string
+}
+
+func (t *failingT) Fatalf(format string, args ...interface{}) {
+	t.message = fmt.Sprintf(format, args...)
+}
+
+// EOF
@@ -0,0 +1,28 @@
+// Tideland Go Cells - Cell Test
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package celltest helps testing behaviors. A Tester runs a behavior
+// in its own environment and records the events it emits. AssertEmitted()
+// waits for an event matching the expectation. If none arrives the test
+// fails with a readable dump of all emitted events and the differences
+// between the expected and the actual payloads.
+//
+//     tester, err := celltest.NewTester(behaviors.NewCounterBehavior(counter))
+//     ...
+//     defer tester.Stop()
+//     tester.Emit("count", []string{"a"})
+//     celltest.AssertEmitted(t, tester, celltest.MatchPayload("counter:a", cells.PayloadValues{
+//         cells.PayloadDefault: int64(1),
+//     }))
+//
+// DeterministicEnvironment() creates an environment processing the
+// events of all cells one at a time in the order they have been emitted
+// and numbering the event IDs. So tests of pipelines see the same
+// interleavings in each run.
+package celltest
+
+// EOF
@@ -0,0 +1,122 @@
+// Tideland Go Cells - Channel Subscription
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CHANNEL BEHAVIOR
+//--------------------
+
+// channelBehavior passes the received events to a channel.
+type channelBehavior struct {
+	env   *environment
+	out   chan Event
+	donec chan struct{}
+}
+
+// Init the behavior.
+func (b *channelBehavior) Init(c Cell) error {
+	return nil
+}
+
+// Terminate the behavior. The channel is closed, so ranging
+// consumers end.
+func (b *channelBehavior) Terminate() error {
+	close(b.out)
+	return nil
+}
+
+// ProcessEvent passes the event to the channel. It waits until
+// the consumer receives it, the subscription is canceled, or
+// the environment stops.
+func (b *channelBehavior) ProcessEvent(event Event) error {
+	select {
+	case b.out <- event:
+	case <-b.donec:
+	case <-b.env.ctx.Done():
+	}
+	return nil
+}
+
+// Recover from an error.
+func (b *channelBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// SubscribeChannel implements the Environment interface.
+func (env *environment) SubscribeChannel(id string, buffer int) (<-chan Event, func(), error) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	b := &channelBehavior{
+		env:   env,
+		out:   make(chan Event, buffer),
+		donec: make(chan struct{}),
+	}
+	n := atomic.AddUint64(&env.channels, 1)
+	channelID := fmt.Sprintf("%s:channel-%d", id, n)
+	if err := env.StartCell(channelID, b); err != nil {
+		return nil, nil, err
+	}
+	if err := env.Subscribe(id, channelID); err != nil {
+		env.StopCell(channelID)
+		return nil, nil, err
+	}
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(b.donec)
+			env.StopCell(channelID)
+		})
+	}
+	return b.out, cancel, nil
+}
+
+// Events implements the Environment interface.
+func (env *environment) Events(ctx context.Context, id string) iter.Seq[Event] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return func(yield func(Event) bool) {
+		eventc, cancel, err := env.SubscribeChannel(id, 0)
+		if err != nil {
+			logger.Warningf("cannot range over events of cell %q: %v", id, err)
+			return
+		}
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-eventc:
+				if !ok || !yield(event) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,419 @@
+// Tideland Go Cells - Checkpoint
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// topicCheckpointBarrier labels the barriers flowing through
+	// the topology during a checkpoint.
+	topicCheckpointBarrier = "checkpoint-barrier!"
+
+	// topicRestoreSnapshot lets a cell restore the snapshot
+	// of its behavior and its state.
+	topicRestoreSnapshot = "restore-snapshot!"
+
+	// payloadSnapshot contains the snapshot of a behavior.
+	payloadSnapshot = "checkpoint:snapshot"
+
+	// payloadState contains the snapshot of a cell state.
+	payloadState = "checkpoint:state"
+)
+
+//--------------------
+// CHECKPOINT
+//--------------------
+
+// Checkpoint is a consistent recovery point of an environment. It
+// contains the offset of the source, e.g. a journal, passed when the
+// checkpoint has been started, the snapshots of all behaviors
+// implementing BehaviorSnapshotter, and the non-empty cell states.
+// After restoring them the source has to be replayed starting at
+// the offset.
+type Checkpoint struct {
+	ID        uint64
+	Offset    int64
+	Taken     time.Time
+	Snapshots map[string][]byte
+	States    map[string]map[string][]byte
+}
+
+// checkpoints serializes the checkpoints of an environment.
+type checkpoints struct {
+	mutex sync.Mutex
+	id    uint64
+}
+
+// checkpointRun collects the snapshots of one checkpoint.
+type checkpointRun struct {
+	mutex     sync.Mutex
+	cp        *Checkpoint
+	waiting   map[string]bool
+	err       error
+	donec     chan struct{}
+	abortc    chan struct{}
+	abortOnce sync.Once
+}
+
+// report adds the snapshots of a cell. The run is done when
+// all cells reported.
+func (r *checkpointRun) report(id string, data []byte, state map[string][]byte, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.waiting[id] {
+		return
+	}
+	delete(r.waiting, id)
+	if err != nil && r.err == nil {
+		r.err = errors.Annotate(err, ErrCheckpoint, errorMessages, r.cp.ID, id)
+	}
+	if data != nil {
+		r.cp.Snapshots[id] = data
+	}
+	if state != nil {
+		r.cp.States[id] = state
+	}
+	if len(r.waiting) == 0 {
+		close(r.donec)
+	}
+}
+
+// abort lets the cells release the events held for the run.
+func (r *checkpointRun) abort() {
+	r.abortOnce.Do(func() {
+		close(r.abortc)
+	})
+}
+
+// aborted checks if the run has been aborted.
+func (r *checkpointRun) aborted() bool {
+	select {
+	case <-r.abortc:
+		return true
+	default:
+		return false
+	}
+}
+
+// barrierEvent is the barrier of a checkpoint run.
+type barrierEvent struct {
+	Event
+	run *checkpointRun
+}
+
+// newBarrierEvent creates a barrier emitted by the given emitter.
+func newBarrierEvent(env *environment, emitter string, run *checkpointRun) Event {
+	event, _ := newEvent(context.Background(), env, emitter, topicCheckpointBarrier, nil)
+	return &barrierEvent{event, run}
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// Checkpoint implements the Environment interface.
+func (env *environment) Checkpoint(ctx context.Context, offset int64) (*Checkpoint, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	env.checkpoints.mutex.Lock()
+	defer env.checkpoints.mutex.Unlock()
+	env.checkpoints.id++
+	run := &checkpointRun{
+		cp: &Checkpoint{
+			ID:        env.checkpoints.id,
+			Offset:    offset,
+			Taken:     time.Now().UTC(),
+			Snapshots: make(map[string][]byte),
+			States:    make(map[string]map[string][]byte),
+		},
+		waiting: make(map[string]bool),
+		donec:   make(chan struct{}),
+		abortc:  make(chan struct{}),
+	}
+	// Cells in cycles would wait for the barriers of their
+	// downstream emitters forever.
+	if id, ok := cycleOf(env.cells.topology()); ok {
+		return nil, errors.New(ErrCyclicTopology, errorMessages, id, "checkpoint")
+	}
+	cs, err := env.cells.cellsOf()
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return run.cp, nil
+	}
+	var sources []*cell
+	for _, c := range cs {
+		run.waiting[c.id] = true
+		if len(c.emitterIDs()) == 0 {
+			sources = append(sources, c)
+		}
+	}
+	// Inject the barriers into the sources.
+	for _, c := range sources {
+		if err := c.ProcessEvent(newBarrierEvent(env, env.id, run)); err != nil {
+			run.report(c.id, nil, nil, err)
+		}
+	}
+	select {
+	case <-run.donec:
+	case <-ctx.Done():
+		run.abort()
+		return nil, errors.Annotate(ctx.Err(), ErrTimeout, errorMessages, "checkpoint")
+	}
+	if run.err != nil {
+		return nil, run.err
+	}
+	return run.cp, nil
+}
+
+// cycleOf returns the ID of a cell being part of a cycle
+// if the topology contains one.
+func cycleOf(nodes []topologyNode) (string, bool) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	subscribers := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		subscribers[node.id] = node.subscribers
+	}
+	states := make(map[string]int, len(nodes))
+	var visit func(id string) (string, bool)
+	visit = func(id string) (string, bool) {
+		states[id] = visiting
+		for _, sid := range subscribers[id] {
+			switch states[sid] {
+			case visiting:
+				return sid, true
+			case unvisited:
+				if cid, ok := visit(sid); ok {
+					return cid, true
+				}
+			}
+		}
+		states[id] = visited
+		return "", false
+	}
+	for _, node := range nodes {
+		if states[node.id] == unvisited {
+			if id, ok := visit(node.id); ok {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// RestoreCheckpoint implements the Environment interface.
+func (env *environment) RestoreCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	restores := make(map[string]PayloadValues)
+	for id, data := range cp.Snapshots {
+		restores[id] = PayloadValues{payloadSnapshot: data}
+	}
+	for id, state := range cp.States {
+		if restores[id] == nil {
+			restores[id] = PayloadValues{}
+		}
+		restores[id][payloadState] = state
+	}
+	ids := make([]string, 0, len(restores))
+	for id := range restores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if _, err := env.requestOne(ctx, id, topicRestoreSnapshot, restores[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// alignment contains the state of a cell waiting for the
+// barriers of all its emitters.
+type alignment struct {
+	mutex    sync.Mutex
+	run      *checkpointRun
+	arrived  map[string]bool
+	complete bool
+	held     []Event
+}
+
+// check returns the events held for an aborted or outdated run
+// and if the event has to be held back, because its emitter
+// already passed the barrier.
+func (a *alignment) check(event Event, barrier *barrierEvent) ([]Event, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var released []Event
+	if a.run != nil && (a.run.aborted() || (barrier != nil && barrier.run != a.run)) {
+		released = a.reset()
+	}
+	if barrier == nil && a.run != nil && (a.complete || a.arrived[event.Emitter()]) {
+		a.held = append(a.held, event)
+		return released, true
+	}
+	return released, false
+}
+
+// arrive marks the barrier of the emitter as arrived and
+// returns true if those of all expected emitters arrived.
+func (a *alignment) arrive(barrier *barrierEvent, expected []string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.run == nil {
+		a.run = barrier.run
+		a.arrived = make(map[string]bool)
+	}
+	a.arrived[barrier.Emitter()] = true
+	for _, id := range expected {
+		if !a.arrived[id] {
+			return false
+		}
+	}
+	a.complete = true
+	return true
+}
+
+// finish ends the alignment and returns the held events.
+func (a *alignment) finish() []Event {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.reset()
+}
+
+// reset clears the alignment and returns the held events.
+func (a *alignment) reset() []Event {
+	held := a.held
+	a.run = nil
+	a.arrived = nil
+	a.complete = false
+	a.held = nil
+	return held
+}
+
+// emitterIDs returns the IDs of the cells the cell is subscribed to.
+func (c *cell) emitterIDs() []string {
+	var ids []string
+	c.emitters.do(func(ec *cell) error {
+		ids = append(ids, ec.id)
+		return nil
+	})
+	return ids
+}
+
+// align passes the event to the process function unless the cell
+// is aligning to a checkpoint and the emitter of the event already
+// passed its barrier. Once the barriers of all emitters arrived the
+// behavior is snapshot after waiting for the dispatched events, the
+// barrier is passed to the subscribers, and the held events are
+// processed.
+func (c *cell) align(event Event, process func(event Event) error, wait func()) error {
+	barrier, isBarrier := event.(*barrierEvent)
+	released, hold := c.alignment.check(event, barrier)
+	for _, event := range released {
+		if err := process(event); err != nil {
+			return err
+		}
+	}
+	if hold {
+		return nil
+	}
+	if !isBarrier {
+		return process(event)
+	}
+	atomic.AddInt64(&c.pending, -1)
+	expected := c.emitterIDs()
+	if len(expected) == 0 {
+		expected = []string{c.env.id}
+	}
+	if !c.alignment.arrive(barrier, expected) {
+		return nil
+	}
+	if wait != nil {
+		wait()
+	}
+	var data []byte
+	var err error
+	if bs, ok := c.currentBehavior().(BehaviorSnapshotter); ok {
+		data, err = bs.Snapshot()
+	}
+	state, serr := c.snapshotState()
+	if err == nil {
+		err = serr
+	}
+	barrier.run.report(c.id, data, state, err)
+	c.subscribers.do(func(sc *cell) error {
+		if err := sc.ProcessEvent(newBarrierEvent(c.env, c.id, barrier.run)); err != nil {
+			barrier.run.report(sc.id, nil, nil, err)
+		}
+		return nil
+	})
+	for _, event := range c.alignment.finish() {
+		if err := process(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSnapshot lets the behavior restore the snapshot passed
+// as payload, restores the state, and replies to the waiting sender.
+func (c *cell) restoreSnapshot(event Event) error {
+	var err error
+	if data, ok := event.Payload().Get(payloadSnapshot, nil).([]byte); ok {
+		if bs, ok := c.behavior.(BehaviorSnapshotter); ok {
+			if rerr := bs.RestoreSnapshot(data); rerr != nil {
+				err = errors.Annotate(rerr, ErrRestoreSnapshot, errorMessages, c.id)
+			}
+		} else {
+			err = errors.New(ErrRestoreSnapshot, errorMessages, c.id)
+		}
+	}
+	if state, ok := event.Payload().Get(payloadState, nil).(map[string][]byte); ok && err == nil {
+		if rerr := c.restoreState(state); rerr != nil {
+			err = errors.Annotate(rerr, ErrRestoreSnapshot, errorMessages, c.id)
+		}
+	}
+	if payload, ok := HasWaiterPayload(event); ok {
+		if err != nil {
+			payload.GetWaiter().Set(err)
+		} else {
+			payload.GetWaiter().Set(PayloadValues{})
+		}
+	}
+	return nil
+}
+
+// EOF
@@ -0,0 +1,367 @@
+// Tideland Go Cells - Codec
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CODEC
+//--------------------
+
+// Codec encodes and decodes events.
+type Codec interface {
+	// Name returns the name of the codec.
+	Name() string
+
+	// Encode encodes ID, timestamp, emitter, topic, and payload of the event.
+	Encode(event cells.Event) ([]byte, error)
+
+	// Decode decodes an event. The passed context is used as
+	// context of the event.
+	Decode(ctx context.Context, data []byte) (cells.Event, error)
+}
+
+// Default returns the default codec used as wire format.
+func Default() Codec {
+	return NewMsgpackCodec()
+}
+
+//--------------------
+// TYPE REGISTRY
+//--------------------
+
+// registry contains the registered custom types.
+var registry = struct {
+	mutex  sync.RWMutex
+	names  map[reflect.Type]string
+	types  map[string]reflect.Type
+	fields map[reflect.Type][]reflect.StructField
+}{
+	names:  make(map[reflect.Type]string),
+	types:  make(map[string]reflect.Type),
+	fields: make(map[reflect.Type][]reflect.StructField),
+}
+
+func init() {
+	gob.Register(time.Time{})
+	gob.Register(time.Duration(0))
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// Register registers a custom type of payload values with a unique
+// name. Values have to be structs or pointers to structs, only their
+// exported fields are encoded. Decoded values have the same type as
+// the registered one.
+func Register(name string, value interface{}) error {
+	t := reflect.TypeOf(value)
+	st := t
+	if st != nil && st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st == nil || st.Kind() != reflect.Struct {
+		return errors.New(ErrUnsupportedType, errorMessages, t)
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.types[name]; ok {
+		return errors.New(ErrDuplicateRegistration, errorMessages, name)
+	}
+	registry.names[t] = name
+	registry.types[name] = t
+	fields := []reflect.StructField{}
+	for i := 0; i < st.NumField(); i++ {
+		if field := st.Field(i); field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	registry.fields[st] = fields
+	gob.RegisterName(name, value)
+	return nil
+}
+
+// registeredName returns the name of a registered type.
+func registeredName(t reflect.Type) (string, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	name, ok := registry.names[t]
+	return name, ok
+}
+
+// registeredType returns the type registered with the name.
+func registeredType(name string) (reflect.Type, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// exportedFields returns the exported fields of a struct type.
+func exportedFields(t reflect.Type) []reflect.StructField {
+	registry.mutex.RLock()
+	fields, ok := registry.fields[t]
+	registry.mutex.RUnlock()
+	if ok {
+		return fields
+	}
+	fields = []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// assign sets the generic decoded value to the destination,
+// converting it if needed.
+func assign(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if sv.Kind() == reflect.String && dst.Kind() != reflect.String {
+			break
+		}
+		if sv.Type().ConvertibleTo(dst.Type()) {
+			dst.Set(sv.Convert(dst.Type()))
+			return nil
+		}
+	case reflect.Ptr:
+		v := reflect.New(dst.Type().Elem())
+		if err := assign(v.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Slice:
+		items, ok := src.([]interface{})
+		if !ok {
+			break
+		}
+		v := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(v.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Array:
+		items, ok := src.([]interface{})
+		if !ok || len(items) != dst.Len() {
+			break
+		}
+		for i, item := range items {
+			if err := assign(dst.Index(i), item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		v := reflect.MakeMap(dst.Type())
+		for key, value := range genericMap(src) {
+			kv := reflect.New(dst.Type().Key()).Elem()
+			if err := assign(kv, key); err != nil {
+				return err
+			}
+			vv := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(vv, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(kv, vv)
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Struct:
+		values, ok := src.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, field := range exportedFields(dst.Type()) {
+			if value, ok := values[field.Name]; ok {
+				if err := assign(dst.FieldByIndex(field.Index), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return errors.New(ErrUnsupportedType, errorMessages, fmt.Sprintf("%T as %v", src, dst.Type()))
+}
+
+// genericMap returns the entries of a decoded map.
+func genericMap(src interface{}) map[interface{}]interface{} {
+	entries := make(map[interface{}]interface{})
+	switch m := src.(type) {
+	case map[string]interface{}:
+		for key, value := range m {
+			entries[key] = value
+		}
+	case map[interface{}]interface{}:
+		entries = m
+	}
+	return entries
+}
+
+// instantiate creates a value of the registered type out of
+// its decoded fields.
+func instantiate(name string, fields map[string]interface{}) (interface{}, error) {
+	t, ok := registeredType(name)
+	if !ok {
+		return nil, errors.New(ErrUnregisteredType, errorMessages, name)
+	}
+	v := reflect.New(t).Elem()
+	if err := assign(v, fields); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+//--------------------
+// DEADLINES
+//--------------------
+
+// eventDeadline returns the absolute deadline of the event context
+// and the budget remaining until then.
+func eventDeadline(event cells.Event) (time.Time, time.Duration, bool) {
+	ctx := event.Context()
+	if ctx == nil {
+		return time.Time{}, 0, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	return deadline.UTC(), time.Until(deadline), true
+}
+
+// withDeadline derives the context of a decoded event from the
+// transmitted deadline and budget. The clocks of sender and receiver
+// may differ, so the earlier of the absolute deadline and the local
+// time plus the budget is used. The context is released latest when
+// the deadline is reached.
+func withDeadline(ctx context.Context, deadline time.Time, budget time.Duration) context.Context {
+	if deadline.IsZero() {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if local := time.Now().Add(budget); local.Before(deadline) {
+		deadline = local
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	_ = cancel
+	return ctx
+}
+
+//--------------------
+// DECODED EVENT
+//--------------------
+
+// decodedEvent implements the cells.Event interface for
+// decoded events keeping their original timestamp.
+type decodedEvent struct {
+	id        string
+	ctx       context.Context
+	timestamp time.Time
+	topic     string
+	payload   cells.Payload
+	emitter   string
+}
+
+// newDecodedEvent creates an event out of the decoded parts.
+func newDecodedEvent(ctx context.Context, id string, timestamp time.Time, emitter, topic string, values map[string]interface{}, deadline time.Time, budget time.Duration) (cells.Event, error) {
+	if topic == "" {
+		return nil, errors.New(ErrMissingTopic, errorMessages)
+	}
+	return &decodedEvent{
+		id:        id,
+		ctx:       withDeadline(ctx, deadline, budget),
+		timestamp: timestamp.UTC(),
+		topic:     topic,
+		payload:   cells.NewPayload(cells.PayloadValues(values)),
+		emitter:   emitter,
+	}, nil
+}
+
+// ID implements the cells.Event interface.
+func (e *decodedEvent) ID() string {
+	return e.id
+}
+
+// Context implements the cells.Event interface.
+func (e *decodedEvent) Context() context.Context {
+	return e.ctx
+}
+
+// Timestamp implements the cells.Event interface.
+func (e *decodedEvent) Timestamp() time.Time {
+	return e.timestamp
+}
+
+// Topic implements the cells.Event interface.
+func (e *decodedEvent) Topic() string {
+	return e.topic
+}
+
+// Payload implements the cells.Event interface.
+func (e *decodedEvent) Payload() cells.Payload {
+	return e.payload
+}
+
+// Emitter implements the cells.Event interface.
+func (e *decodedEvent) Emitter() string {
+	return e.emitter
+}
+
+// String implements the fmt.Stringer interface.
+func (e *decodedEvent) String() string {
+	return fmt.Sprintf("<timestamp: %s / topic: '%s' / payload: %v>", e.timestamp.Format(time.RFC3339Nano), e.topic, e.payload)
+}
+
+// payloadValues returns the values of an event payload.
+func payloadValues(event cells.Event) map[string]interface{} {
+	values := make(map[string]interface{})
+	if event.Payload() == nil {
+		return values
+	}
+	event.Payload().Do(func(key string, value interface{}) error {
+		values[key] = value
+		return nil
+	})
+	return values
+}
+
+// EOF
@@ -0,0 +1,193 @@
+// Tideland Go Cells - Codec - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/codec"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// order is a custom payload value type.
+type order struct {
+	ID       string
+	Quantity int
+	Price    float64
+	Tags     []string
+	Placed   time.Time
+	internal string
+}
+
+func init() {
+	codec.Register("codec_test.order", order{})
+}
+
+// TestRegister tests the registration of custom types.
+func TestRegister(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	err := codec.Register("codec_test.order", order{})
+	assert.ErrorMatch(err, `.*type "codec_test.order" is already registered`)
+	err = codec.Register("codec_test.int", 42)
+	assert.ErrorMatch(err, `.*type int is not supported`)
+}
+
+// TestCodecs tests the round trip of events with all codecs.
+func TestCodecs(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	now := time.Now()
+	o := order{
+		ID:       "o-4711",
+		Quantity: 3,
+		Price:    9.99,
+		Tags:     []string{"express", "gift"},
+		Placed:   now,
+		internal: "hidden",
+	}
+	event, err := cells.NewEvent(ctx, "order", cells.PayloadValues{
+		"bool":     true,
+		"int":      -12345,
+		"float":    47.11,
+		"string":   "foo",
+		"bytes":    []byte{1, 2, 3},
+		"time":     now,
+		"duration": 5 * time.Second,
+		"list":     []interface{}{1, "two", 3.0},
+		"map":      map[string]interface{}{"a": 1},
+		"order":    o,
+	})
+	assert.Nil(err)
+
+	for _, c := range []codec.Codec{codec.NewMsgpackCodec(), codec.NewGobCodec()} {
+		assert.Logf("codec %s", c.Name())
+		data, err := c.Encode(event)
+		assert.Nil(err)
+		decoded, err := c.Decode(ctx, data)
+		assert.Nil(err)
+		assert.Equal(decoded.Context(), ctx)
+		assert.Equal(decoded.Topic(), "order")
+		assert.Equal(decoded.Emitter(), "")
+		assert.True(decoded.Timestamp().Equal(event.Timestamp()))
+		payload := decoded.Payload()
+		assert.Equal(payload.GetBool("bool", false), true)
+		assert.Equal(payload.GetInt("int", 0), -12345)
+		assert.Equal(payload.GetFloat64("float", 0.0), 47.11)
+		assert.Equal(payload.GetString("string", ""), "foo")
+		assert.True(payload.GetTime("time", time.Time{}).Equal(now))
+		assert.Equal(payload.GetDuration("duration", 0), 5*time.Second)
+		assert.Equal(payload.Get("bytes", nil), []byte{1, 2, 3})
+		do2, ok := payload.Get("order", nil).(order)
+		assert.True(ok)
+		assert.Equal(do2.ID, o.ID)
+		assert.Equal(do2.Quantity, o.Quantity)
+		assert.Equal(do2.Price, o.Price)
+		assert.Equal(do2.Tags, o.Tags)
+		assert.True(do2.Placed.Equal(now))
+		assert.Equal(do2.internal, "")
+	}
+
+	// JSON decodes the generic types.
+	c := codec.NewJSONCodec()
+	data, err := c.Encode(event)
+	assert.Nil(err)
+	decoded, err := c.Decode(ctx, data)
+	assert.Nil(err)
+	assert.Equal(decoded.Topic(), "order")
+	assert.Equal(decoded.Payload().GetFloat64("int", 0.0), -12345.0)
+	assert.Equal(decoded.Payload().GetString("string", ""), "foo")
+
+	// Default is msgpack.
+	assert.Equal(codec.Default().Name(), "msgpack")
+}
+
+// TestCodecDeadlines tests the propagation of event deadlines.
+func TestCodecDeadlines(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	withDeadline, err := cells.NewEvent(ctx, "deadline", nil)
+	assert.Nil(err)
+	withoutDeadline, err := cells.NewEvent(context.Background(), "none", nil)
+	assert.Nil(err)
+
+	for _, c := range []codec.Codec{codec.NewMsgpackCodec(), codec.NewGobCodec(), codec.NewJSONCodec()} {
+		data, err := c.Encode(withDeadline)
+		assert.Nil(err, c.Name())
+		decoded, err := c.Decode(context.Background(), data)
+		assert.Nil(err, c.Name())
+		decodedDeadline, ok := decoded.Context().Deadline()
+		assert.True(ok, c.Name())
+		assert.False(decodedDeadline.After(deadline), c.Name())
+		assert.True(decodedDeadline.After(deadline.Add(-time.Second)), c.Name())
+
+		data, err = c.Encode(withoutDeadline)
+		assert.Nil(err, c.Name())
+		decoded, err = c.Decode(context.Background(), data)
+		assert.Nil(err, c.Name())
+		_, ok = decoded.Context().Deadline()
+		assert.False(ok, c.Name())
+	}
+}
+
+// TestCodecErrors tests the handling of invalid data.
+func TestCodecErrors(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+
+	for _, c := range []codec.Codec{codec.NewMsgpackCodec(), codec.NewGobCodec(), codec.NewJSONCodec()} {
+		assert.Logf("codec %s", c.Name())
+		_, err := c.Decode(ctx, []byte{0xc1, 0x00})
+		assert.True(codec.IsDecodingError(err))
+	}
+
+	event, err := cells.NewEvent(ctx, "foo", cells.PayloadValues{
+		"func": func() {},
+	})
+	assert.Nil(err)
+	_, err = codec.NewMsgpackCodec().Encode(event)
+	assert.True(codec.IsEncodingError(err))
+}
+
+//--------------------
+// BENCHMARKS
+//--------------------
+
+// BenchmarkMsgpackDecode decodes events with typical payload keys.
+func BenchmarkMsgpackDecode(b *testing.B) {
+	ctx := context.Background()
+	event, _ := cells.NewEvent(ctx, "measurement", cells.PayloadValues{
+		"device":      "d-4711",
+		"temperature": 21.5,
+		"humidity":    48,
+		"battery":     87,
+	})
+	c := codec.NewMsgpackCodec()
+	data, _ := c.Encode(event)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Decode(ctx, data)
+	}
+}
+
+// EOF
@@ -0,0 +1,27 @@
+// Tideland Go Cells - Codec
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package codec provides encodings of events for their transport
+// or storage outside of an environment. Besides JSON the codecs
+// use gob and msgpack. Msgpack is the default wire format due to
+// its compactness and speed.
+//
+// Custom types used as payload values have to be registered with
+//
+//     codec.Register("myapp.Order", Order{})
+//
+// once before encoding or decoding. Registered values are decoded
+// as their registered type, others like unregistered structs as
+// their generic representation.
+//
+// If the context of an event has a deadline the codecs encode it
+// together with the remaining budget. Decoded events get a context
+// with the earlier of this deadline and the local time plus the
+// budget, so deadlines are kept across process boundaries.
+package codec
+
+// EOF
@@ -0,0 +1,55 @@
+// Tideland Go Cells - Codec - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrEncoding = iota + 1
+	ErrDecoding
+	ErrUnsupportedType
+	ErrUnregisteredType
+	ErrDuplicateRegistration
+	ErrMissingTopic
+)
+
+var errorMessages = errors.Messages{
+	ErrEncoding:              "cannot encode event with %s",
+	ErrDecoding:              "cannot decode event with %s",
+	ErrUnsupportedType:       "type %v is not supported",
+	ErrUnregisteredType:      "type %q is not registered",
+	ErrDuplicateRegistration: "type %q is already registered",
+	ErrMissingTopic:          "decoded event has no topic",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsEncodingError checks if an error signals a failed encoding.
+func IsEncodingError(err error) bool {
+	return errors.IsError(err, ErrEncoding)
+}
+
+// IsDecodingError checks if an error signals a failed decoding.
+func IsDecodingError(err error) bool {
+	return errors.IsError(err, ErrDecoding)
+}
+
+// EOF
@@ -0,0 +1,83 @@
+// Tideland Go Cells - Codec - Gob
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// GOB CODEC
+//--------------------
+
+// gobEvent is the wire format of the gob codec.
+type gobEvent struct {
+	ID        string
+	Timestamp time.Time
+	Emitter   string
+	Topic     string
+	Payload   map[string]interface{}
+	Deadline  time.Time
+	Budget    time.Duration
+}
+
+// gobCodec implements the Codec interface.
+type gobCodec struct{}
+
+// NewGobCodec creates a codec using the gob format. Custom
+// types of payload values have to be registered with Register().
+func NewGobCodec() Codec {
+	return gobCodec{}
+}
+
+// Name implements the Codec interface.
+func (c gobCodec) Name() string {
+	return "gob"
+}
+
+// Encode implements the Codec interface.
+func (c gobCodec) Encode(event cells.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	ge := gobEvent{
+		ID:        event.ID(),
+		Timestamp: event.Timestamp(),
+		Emitter:   event.Emitter(),
+		Topic:     event.Topic(),
+		Payload:   payloadValues(event),
+	}
+	if deadline, budget, ok := eventDeadline(event); ok {
+		ge.Deadline = deadline
+		ge.Budget = budget
+	}
+	if err := gob.NewEncoder(&buf).Encode(ge); err != nil {
+		return nil, errors.Annotate(err, ErrEncoding, errorMessages, c.Name())
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements the Codec interface.
+func (c gobCodec) Decode(ctx context.Context, data []byte) (cells.Event, error) {
+	var ge gobEvent
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ge); err != nil {
+		return nil, errors.Annotate(err, ErrDecoding, errorMessages, c.Name())
+	}
+	return newDecodedEvent(ctx, ge.ID, ge.Timestamp, ge.Emitter, ge.Topic, ge.Payload, ge.Deadline, ge.Budget)
+}
+
+// EOF
@@ -0,0 +1,87 @@
+// Tideland Go Cells - Codec - JSON
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// JSON CODEC
+//--------------------
+
+// jsonEvent is the wire format of the JSON codec.
+type jsonEvent struct {
+	ID        string                 `json:"id,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Emitter   string                 `json:"emitter,omitempty"`
+	Topic     string                 `json:"topic"`
+	Payload   map[string]interface{} `json:"payload"`
+	Deadline  *time.Time             `json:"deadline,omitempty"`
+	Budget    time.Duration          `json:"budget,omitempty"`
+}
+
+// jsonCodec implements the Codec interface.
+type jsonCodec struct{}
+
+// NewJSONCodec creates a codec using the JSON format. Here the
+// decoded payload values are the generic JSON types, so numbers
+// are float64 and registered types are maps of their fields.
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+// Name implements the Codec interface.
+func (c jsonCodec) Name() string {
+	return "json"
+}
+
+// Encode implements the Codec interface.
+func (c jsonCodec) Encode(event cells.Event) ([]byte, error) {
+	je := jsonEvent{
+		ID:        event.ID(),
+		Timestamp: event.Timestamp(),
+		Emitter:   event.Emitter(),
+		Topic:     event.Topic(),
+		Payload:   payloadValues(event),
+	}
+	if deadline, budget, ok := eventDeadline(event); ok {
+		je.Deadline = &deadline
+		je.Budget = budget
+	}
+	data, err := json.Marshal(je)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrEncoding, errorMessages, c.Name())
+	}
+	return data, nil
+}
+
+// Decode implements the Codec interface.
+func (c jsonCodec) Decode(ctx context.Context, data []byte) (cells.Event, error) {
+	var je jsonEvent
+	if err := json.Unmarshal(data, &je); err != nil {
+		return nil, errors.Annotate(err, ErrDecoding, errorMessages, c.Name())
+	}
+	var deadline time.Time
+	if je.Deadline != nil {
+		deadline = *je.Deadline
+	}
+	return newDecodedEvent(ctx, je.ID, je.Timestamp, je.Emitter, je.Topic, je.Payload, deadline, je.Budget)
+}
+
+// EOF
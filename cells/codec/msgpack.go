@@ -0,0 +1,678 @@
+// Tideland Go Cells - Codec - Msgpack
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package codec
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Extension types used by the msgpack codec.
+const (
+	extTimestamp  = -1
+	extDuration   = 1
+	extRegistered = 2
+)
+
+// Keys of the encoded events.
+const (
+	keyID        = "id"
+	keyTimestamp = "timestamp"
+	keyEmitter   = "emitter"
+	keyTopic     = "topic"
+	keyPayload   = "payload"
+	keyDeadline  = "deadline"
+	keyBudget    = "budget"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+//--------------------
+// MSGPACK CODEC
+//--------------------
+
+// msgpackCodec implements the Codec interface.
+type msgpackCodec struct{}
+
+// NewMsgpackCodec creates a codec using the msgpack format. Events
+// are encoded as map with the keys "id", "timestamp", "emitter",
+// "topic", and "payload", events with a deadline additionally with
+// "deadline" and the remaining "budget". Timestamps use the standard extension
+// type -1, durations the extension type 1, and registered types
+// the extension type 2 containing the registered name and the map
+// of their fields.
+func NewMsgpackCodec() Codec {
+	return msgpackCodec{}
+}
+
+// Name implements the Codec interface.
+func (c msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+// Encode implements the Codec interface.
+func (c msgpackCodec) Encode(event cells.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	e := &msgpackEncoder{&buf}
+	deadline, budget, hasDeadline := eventDeadline(event)
+	if hasDeadline {
+		e.writeMapLen(7)
+		e.writeString(keyDeadline)
+		e.writeTime(deadline)
+		e.writeString(keyBudget)
+		if err := e.encode(reflect.ValueOf(budget)); err != nil {
+			return nil, errors.Annotate(err, ErrEncoding, errorMessages, c.Name())
+		}
+	} else {
+		e.writeMapLen(5)
+	}
+	e.writeString(keyID)
+	e.writeString(event.ID())
+	e.writeString(keyTimestamp)
+	e.writeTime(event.Timestamp())
+	e.writeString(keyEmitter)
+	e.writeString(event.Emitter())
+	e.writeString(keyTopic)
+	e.writeString(event.Topic())
+	e.writeString(keyPayload)
+	if err := e.encode(reflect.ValueOf(payloadValues(event))); err != nil {
+		return nil, errors.Annotate(err, ErrEncoding, errorMessages, c.Name())
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements the Codec interface.
+func (c msgpackCodec) Decode(ctx context.Context, data []byte) (cells.Event, error) {
+	d := &msgpackDecoder{data: data}
+	raw, err := d.decode()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrDecoding, errorMessages, c.Name())
+	}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(ErrDecoding, errorMessages, c.Name())
+	}
+	id, _ := fields[keyID].(string)
+	timestamp, _ := fields[keyTimestamp].(time.Time)
+	emitter, _ := fields[keyEmitter].(string)
+	topic, _ := fields[keyTopic].(string)
+	values, _ := fields[keyPayload].(map[string]interface{})
+	deadline, _ := fields[keyDeadline].(time.Time)
+	budget, _ := fields[keyBudget].(time.Duration)
+	return newDecodedEvent(ctx, id, timestamp, emitter, topic, values, deadline, budget)
+}
+
+//--------------------
+// MSGPACK ENCODER
+//--------------------
+
+// msgpackEncoder writes values in the msgpack format.
+type msgpackEncoder struct {
+	buf *bytes.Buffer
+}
+
+// encode writes any supported value.
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(0xc0)
+		return nil
+	}
+	if name, ok := registeredName(v.Type()); ok {
+		return e.writeRegistered(name, v)
+	}
+	switch v.Type() {
+	case timeType:
+		e.writeTime(v.Interface().(time.Time))
+		return nil
+	case durationType:
+		var data [8]byte
+		binary.BigEndian.PutUint64(data[:], uint64(v.Int()))
+		e.writeExt(extDuration, data[:])
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32:
+		e.buf.WriteByte(0xca)
+		e.writeBigEndian(uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.buf.WriteByte(0xcb)
+		e.writeBigEndian(math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			e.writeBinary(data)
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		e.writeArrayLen(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		e.writeMapLen(v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.writeStruct(v)
+	default:
+		return errors.New(ErrUnsupportedType, errorMessages, v.Type())
+	}
+	return nil
+}
+
+// writeStruct writes the exported fields of a struct as map.
+func (e *msgpackEncoder) writeStruct(v reflect.Value) error {
+	fields := exportedFields(v.Type())
+	e.writeMapLen(len(fields))
+	for _, field := range fields {
+		e.writeString(field.Name)
+		if err := e.encode(v.FieldByIndex(field.Index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRegistered writes a value of a registered type.
+func (e *msgpackEncoder) writeRegistered(name string, v reflect.Value) error {
+	var buf bytes.Buffer
+	ee := &msgpackEncoder{&buf}
+	ee.writeString(name)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		v = v.Elem()
+	}
+	if err := ee.writeStruct(v); err != nil {
+		return err
+	}
+	e.writeExt(extRegistered, buf.Bytes())
+	return nil
+}
+
+// writeTime writes a time with the timestamp extension.
+func (e *msgpackEncoder) writeTime(t time.Time) {
+	var data [12]byte
+	binary.BigEndian.PutUint32(data[:4], uint32(t.Nanosecond()))
+	binary.BigEndian.PutUint64(data[4:], uint64(t.Unix()))
+	e.writeExt(extTimestamp, data[:])
+}
+
+// writeInt writes a signed integer as compact as possible.
+func (e *msgpackEncoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.writeBigEndian(uint64(i), 1)
+	case i >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.writeBigEndian(uint64(i), 2)
+	case i >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.writeBigEndian(uint64(i), 4)
+	default:
+		e.buf.WriteByte(0xd3)
+		e.writeBigEndian(uint64(i), 8)
+	}
+}
+
+// writeUint writes an unsigned integer as compact as possible.
+func (e *msgpackEncoder) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.writeBigEndian(u, 1)
+	case u <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.writeBigEndian(u, 2)
+	case u <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.writeBigEndian(u, 4)
+	default:
+		e.buf.WriteByte(0xcf)
+		e.writeBigEndian(u, 8)
+	}
+}
+
+// writeString writes a string.
+func (e *msgpackEncoder) writeString(s string) {
+	l := len(s)
+	switch {
+	case l < 32:
+		e.buf.WriteByte(0xa0 | byte(l))
+	case l <= math.MaxUint8:
+		e.buf.WriteByte(0xd9)
+		e.writeBigEndian(uint64(l), 1)
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xda)
+		e.writeBigEndian(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdb)
+		e.writeBigEndian(uint64(l), 4)
+	}
+	e.buf.WriteString(s)
+}
+
+// writeBinary writes a byte slice.
+func (e *msgpackEncoder) writeBinary(data []byte) {
+	l := len(data)
+	switch {
+	case l <= math.MaxUint8:
+		e.buf.WriteByte(0xc4)
+		e.writeBigEndian(uint64(l), 1)
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xc5)
+		e.writeBigEndian(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xc6)
+		e.writeBigEndian(uint64(l), 4)
+	}
+	e.buf.Write(data)
+}
+
+// writeArrayLen writes the header of an array.
+func (e *msgpackEncoder) writeArrayLen(l int) {
+	switch {
+	case l < 16:
+		e.buf.WriteByte(0x90 | byte(l))
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xdc)
+		e.writeBigEndian(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdd)
+		e.writeBigEndian(uint64(l), 4)
+	}
+}
+
+// writeMapLen writes the header of a map.
+func (e *msgpackEncoder) writeMapLen(l int) {
+	switch {
+	case l < 16:
+		e.buf.WriteByte(0x80 | byte(l))
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xde)
+		e.writeBigEndian(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdf)
+		e.writeBigEndian(uint64(l), 4)
+	}
+}
+
+// writeExt writes an extension type.
+func (e *msgpackEncoder) writeExt(typ int8, data []byte) {
+	l := len(data)
+	switch {
+	case l == 1:
+		e.buf.WriteByte(0xd4)
+	case l == 2:
+		e.buf.WriteByte(0xd5)
+	case l == 4:
+		e.buf.WriteByte(0xd6)
+	case l == 8:
+		e.buf.WriteByte(0xd7)
+	case l == 16:
+		e.buf.WriteByte(0xd8)
+	case l <= math.MaxUint8:
+		e.buf.WriteByte(0xc7)
+		e.writeBigEndian(uint64(l), 1)
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xc8)
+		e.writeBigEndian(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xc9)
+		e.writeBigEndian(uint64(l), 4)
+	}
+	e.buf.WriteByte(byte(typ))
+	e.buf.Write(data)
+}
+
+// writeBigEndian writes the lowest n bytes of u in big endian order.
+func (e *msgpackEncoder) writeBigEndian(u uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.buf.WriteByte(byte(u >> (uint(i) * 8)))
+	}
+}
+
+//--------------------
+// MSGPACK DECODER
+//--------------------
+
+// msgpackDecoder reads values in the msgpack format.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+// read returns the next n bytes.
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("unexpected end of data at %d", d.pos)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// readUint reads an unsigned big endian integer of n bytes.
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// decode reads the next value.
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int(c), nil
+	case c >= 0xe0:
+		return int(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		l, err := d.readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.read(int(l))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, data...), nil
+	case 0xc7, 0xc8, 0xc9:
+		l, err := d.readUint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(int(l))
+	case 0xca:
+		u, err := d.readUint(4)
+		return float32(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 && int64(u) == int64(int(u)) {
+			return int(u), nil
+		}
+		return u, nil
+	case 0xd0:
+		u, err := d.readUint(1)
+		return int(int8(u)), err
+	case 0xd1:
+		u, err := d.readUint(2)
+		return int(int16(u)), err
+	case 0xd2:
+		u, err := d.readUint(4)
+		return int(int32(u)), err
+	case 0xd3:
+		u, err := d.readUint(8)
+		return int(int64(u)), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		l, err := d.readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(l))
+	case 0xdc, 0xdd:
+		l, err := d.readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(l))
+	case 0xde, 0xdf:
+		l, err := d.readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(l))
+	}
+	return nil, fmt.Errorf("invalid format byte 0x%02x at %d", c, d.pos-1)
+}
+
+// decodeString reads a string of length l.
+func (d *msgpackDecoder) decodeString(l int) (interface{}, error) {
+	data, err := d.read(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// decodeArray reads an array with l items.
+func (d *msgpackDecoder) decodeArray(l int) (interface{}, error) {
+	if l > len(d.data)-d.pos {
+		return nil, fmt.Errorf("invalid array length %d at %d", l, d.pos)
+	}
+	items := make([]interface{}, l)
+	for i := range items {
+		item, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// decodeMap reads a map with l entries. Maps with only string
+// keys are returned as map[string]interface{}.
+func (d *msgpackDecoder) decodeMap(l int) (interface{}, error) {
+	if l > len(d.data)-d.pos {
+		return nil, fmt.Errorf("invalid map length %d at %d", l, d.pos)
+	}
+	m := make(map[string]interface{}, l)
+	var gm map[interface{}]interface{}
+	for i := 0; i < l; i++ {
+		skey, isString, err := d.decodeStringKey()
+		if err != nil {
+			return nil, err
+		}
+		var key interface{}
+		if !isString {
+			if key, err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if isString && gm == nil {
+			m[skey] = value
+			continue
+		}
+		if gm == nil {
+			// First key which is no string.
+			gm = make(map[interface{}]interface{}, l)
+			for k, v := range m {
+				gm[k] = v
+			}
+		}
+		if isString {
+			key = skey
+		}
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("invalid map key type %T", key)
+		}
+		gm[key] = value
+	}
+	if gm != nil {
+		return gm, nil
+	}
+	return m, nil
+}
+
+// decodeStringKey reads a map key if it is a string. It is
+// interned, so the keys of many decoded events share one string.
+func (d *msgpackDecoder) decodeStringKey() (string, bool, error) {
+	if d.pos >= len(d.data) {
+		return "", false, nil
+	}
+	c := d.data[d.pos]
+	var l uint64
+	switch {
+	case c&0xe0 == 0xa0:
+		d.pos++
+		l = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xda, c == 0xdb:
+		d.pos++
+		var err error
+		if l, err = d.readUint(1 << (c - 0xd9)); err != nil {
+			return "", false, err
+		}
+	default:
+		return "", false, nil
+	}
+	data, err := d.read(int(l))
+	if err != nil {
+		return "", false, err
+	}
+	return cells.InternKeyBytes(data), true, nil
+}
+
+// decodeExt reads an extension type with l bytes of data.
+func (d *msgpackDecoder) decodeExt(l int) (interface{}, error) {
+	tb, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.read(l)
+	if err != nil {
+		return nil, err
+	}
+	switch int8(tb[0]) {
+	case extTimestamp:
+		switch l {
+		case 4:
+			return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+		case 8:
+			u := binary.BigEndian.Uint64(data)
+			return time.Unix(int64(u&0x3ffffffff), int64(u>>34)).UTC(), nil
+		case 12:
+			nsec := binary.BigEndian.Uint32(data[:4])
+			sec := int64(binary.BigEndian.Uint64(data[4:]))
+			return time.Unix(sec, int64(nsec)).UTC(), nil
+		}
+	case extDuration:
+		if l == 8 {
+			return time.Duration(binary.BigEndian.Uint64(data)), nil
+		}
+	case extRegistered:
+		ed := &msgpackDecoder{data: data}
+		raw, err := ed.decode()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := raw.(string)
+		if !ok {
+			break
+		}
+		raw, err = ed.decode()
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := raw.(map[string]interface{})
+		return instantiate(name, fields)
+	}
+	return nil, fmt.Errorf("invalid extension type %d with length %d", int8(tb[0]), l)
+}
+
+// EOF
@@ -0,0 +1,133 @@
+// Tideland Go Cells - Command
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// COMMAND
+//--------------------
+
+// Command is the standard envelope for operations on cells like
+// reset, status, flush, and configure. It is sent as payload of
+// an event with the topic TopicCommand and contains the name, the
+// arguments, and an optional waiter for the reply.
+type Command struct {
+	Name   string
+	Args   Payload
+	waiter PayloadWaiter
+}
+
+// CommandOf returns the command contained in an event with the
+// topic TopicCommand.
+func CommandOf(event Event) (*Command, bool) {
+	if event.Topic() != TopicCommand {
+		return nil, false
+	}
+	payload := event.Payload()
+	name := payload.GetString(PayloadCommand, "")
+	if name == "" {
+		return nil, false
+	}
+	cmd := &Command{
+		Name: name,
+		Args: NewPayload(payload.Get(PayloadCommandArgs, nil)),
+	}
+	cmd.waiter, _ = payload.Get(PayloadCommandReplyWaiter, nil).(PayloadWaiter)
+	return cmd, true
+}
+
+// Reply answers the command if the sender waits for it. Only
+// the first reply is delivered.
+func (cmd *Command) Reply(values interface{}) {
+	if cmd.waiter != nil {
+		cmd.waiter.Set(values)
+	}
+}
+
+// SendCommand sends the command with the arguments to the cell with
+// the given ID and waits for the reply. An error returned by the cell
+// is returned too.
+func SendCommand(ctx context.Context, env Environment, id, name string, args PayloadValues, timeout time.Duration) (Payload, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	waiter := NewPayloadWaiter()
+	err := env.EmitNew(ctx, id, TopicCommand, PayloadValues{
+		PayloadCommand:            name,
+		PayloadCommandArgs:        args,
+		PayloadCommandReplyWaiter: waiter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error() != nil {
+		return nil, reply.Error()
+	}
+	return reply, nil
+}
+
+// commandTopics maps the standard commands to the topics
+// understood by the behaviors.
+var commandTopics = map[string]string{
+	CommandConfigure: TopicConfigure,
+	CommandFlush:     TopicFlush,
+	CommandReset:     TopicReset,
+	CommandStatus:    TopicStatus,
+}
+
+// processCommand lets the behavior process a command. Behaviors not
+// implementing BehaviorCommandHandler receive the standard commands
+// with their own topics and the arguments as payload, so they can
+// reply like to requests. If the behavior doesn't reply the command
+// name is returned to confirm the processing.
+func (c *cell) processCommand(event Event) error {
+	cmd, ok := CommandOf(event)
+	if !ok {
+		logger.Warningf("cell %q received invalid command", c.id)
+		return nil
+	}
+	var err error
+	if ch, ok := c.behavior.(BehaviorCommandHandler); ok {
+		err = ch.ProcessCommand(cmd)
+	} else {
+		topic, ok := commandTopics[cmd.Name]
+		if !ok {
+			cmd.Reply(errors.New(ErrUnknownCommand, errorMessages, c.id, cmd.Name))
+			return nil
+		}
+		payload := (&payload{waiter: cmd.waiter}).Apply(cmd.Args)
+		err = c.dispatch(&adaptedEvent{event, topic, payload})
+	}
+	if err != nil {
+		cmd.Reply(err)
+		return err
+	}
+	cmd.Reply(PayloadValues{
+		PayloadCommand: cmd.Name,
+	})
+	return nil
+}
+
+// EOF
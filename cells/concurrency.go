@@ -0,0 +1,172 @@
+// Tideland Go Cells - Concurrency
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// Concurrency lets the cell process up to n events in parallel, so
+// the behavior has to be safe for concurrent calls of ProcessEvent().
+// Without OrderBy() the events are processed in no defined order.
+// Context values of the environment are not restored implicitly for
+// events emitted during concurrent processing, their context has to
+// be passed instead.
+func Concurrency(n int) CellOption {
+	return func(c *cell) {
+		c.concurrency = n
+	}
+}
+
+// OrderBy keeps the order of the events with the same key when the
+// cell has been started with Concurrency(). Events are hashed by their
+// key to a fixed worker, so e.g. the events per user or per device
+// are processed in order while different keys are processed in
+// parallel. A worker busy with a key delays the following events of
+// other keys on the same worker.
+func OrderBy(key func(event Event) string) CellOption {
+	return func(c *cell) {
+		c.orderBy = key
+	}
+}
+
+//--------------------
+// WORKERS
+//--------------------
+
+// workers process the events of a cell concurrently.
+type workers struct {
+	cell     *cell
+	key      func(event Event) string
+	queues   []chan Event
+	errc     chan error
+	panicc   chan interface{}
+	busy     sync.WaitGroup
+	running  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// startWorkers starts the workers of a cell with concurrency.
+// Without a key all workers share one queue.
+func (c *cell) startWorkers() *workers {
+	w := &workers{
+		cell:   c,
+		key:    c.orderBy,
+		errc:   make(chan error, c.concurrency),
+		panicc: make(chan interface{}, c.concurrency),
+	}
+	if w.key == nil {
+		w.queues = []chan Event{make(chan Event)}
+	} else {
+		w.queues = make([]chan Event, c.concurrency)
+		for i := range w.queues {
+			w.queues[i] = make(chan Event, 1)
+		}
+	}
+	for i := 0; i < c.concurrency; i++ {
+		w.running.Add(1)
+		go w.work(w.queues[i%len(w.queues)])
+	}
+	return w
+}
+
+// dispatch passes the event to the queue of its worker.
+func (w *workers) dispatch(event Event) {
+	queue := w.queues[0]
+	if w.key != nil {
+		h := fnv.New32a()
+		h.Write([]byte(w.key(event)))
+		queue = w.queues[h.Sum32()%uint32(len(w.queues))]
+	}
+	w.busy.Add(1)
+	queue <- event
+}
+
+// wait blocks until all dispatched events are processed. It
+// returns immediately for a cell without workers.
+func (w *workers) wait() {
+	if w == nil {
+		return
+	}
+	w.busy.Wait()
+}
+
+// errors returns the channel of processing errors. It is nil
+// for a cell without workers.
+func (w *workers) errors() <-chan error {
+	if w == nil {
+		return nil
+	}
+	return w.errc
+}
+
+// panics returns the channel of processing panics. It is nil
+// for a cell without workers.
+func (w *workers) panics() <-chan interface{} {
+	if w == nil {
+		return nil
+	}
+	return w.panicc
+}
+
+// stop lets the workers process the queued events and
+// waits until they are done.
+func (w *workers) stop() {
+	if w == nil {
+		return
+	}
+	w.stopOnce.Do(func() {
+		for _, queue := range w.queues {
+			close(queue)
+		}
+		w.running.Wait()
+	})
+}
+
+// work processes the events of the queue.
+func (w *workers) work(queue <-chan Event) {
+	defer w.running.Done()
+	for event := range queue {
+		w.process(event)
+	}
+}
+
+// process lets the cell process one event. Errors and panics
+// are passed to the backend of the cell, only the first ones
+// are kept until they are received.
+func (w *workers) process(event Event) {
+	defer w.busy.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			select {
+			case w.panicc <- r:
+			default:
+			}
+		}
+	}()
+	if err := w.cell.process(event); err != nil {
+		logger.Errorf("cell %q processed event %q with error: %v", w.cell.id, event.Topic(), err)
+		select {
+		case w.errc <- err:
+		default:
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,195 @@
+// Tideland Go Cells - Connect
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// ROUTE
+//--------------------
+
+// Route defines which events of one environment are forwarded
+// to the other one. Events emitted by the cell From are forwarded
+// to the cell To. If Topics are set only events with those topics
+// are forwarded. Routes go from the first to the second passed
+// environment, Reverse lets them go the other way.
+type Route struct {
+	From    string
+	To      string
+	Topics  []string
+	Reverse bool
+}
+
+// routeTrailKey is the context key for the IDs of the
+// environments a routed event already passed.
+type routeTrailKey struct{}
+
+// routeTrail returns the IDs of the environments the context
+// already passed.
+func routeTrail(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	trail, _ := ctx.Value(routeTrailKey{}).([]string)
+	return trail
+}
+
+// withRouteTrail returns a context containing the trail
+// extended by the passed environment ID.
+func withRouteTrail(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	trail := routeTrail(ctx)
+	extended := make([]string, len(trail), len(trail)+1)
+	copy(extended, trail)
+	return context.WithValue(ctx, routeTrailKey{}, append(extended, id))
+}
+
+//--------------------
+// ROUTER BEHAVIOR
+//--------------------
+
+// routerBehavior forwards the received events into another
+// environment.
+type routerBehavior struct {
+	cell   Cell
+	target Environment
+	to     string
+	topics map[string]bool
+}
+
+// Init implements the Behavior interface.
+func (b *routerBehavior) Init(c Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate implements the Behavior interface.
+func (b *routerBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent implements the Behavior interface. Events which
+// already passed the target environment are dropped to prevent
+// loops.
+func (b *routerBehavior) ProcessEvent(event Event) error {
+	if len(b.topics) > 0 && !b.topics[event.Topic()] {
+		return nil
+	}
+	trail := routeTrail(event.Context())
+	for _, id := range trail {
+		if id == b.target.ID() {
+			return nil
+		}
+	}
+	ctx := withRouteTrail(event.Context(), b.cell.Environment().ID())
+	return b.target.EmitNew(ctx, b.to, event.Topic(), event.Payload())
+}
+
+// Recover implements the Behavior interface.
+func (b *routerBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+//--------------------
+// CONNECTION
+//--------------------
+
+// Connection links two environments of the same process.
+type Connection interface {
+	// Disconnect stops forwarding events between the
+	// environments.
+	Disconnect() error
+}
+
+// routerCell identifies one started router cell.
+type routerCell struct {
+	env Environment
+	id  string
+}
+
+// connection implements the Connection interface.
+type connection struct {
+	mutex   sync.Mutex
+	routers []routerCell
+}
+
+// routerCounter helps creating unique router cell IDs.
+var routerCounter uint64
+
+// Connect links two environments inside the same process. For
+// each route a router cell is started in the emitting environment
+// and subscribed to the route's From cell. It forwards the events
+// to the To cell of the other environment. Events forwarded back
+// into an environment they already passed are dropped. So large
+// applications can be decomposed into independently owned
+// environments without a network hop.
+func Connect(envA, envB Environment, routes ...Route) (Connection, error) {
+	c := &connection{}
+	for _, route := range routes {
+		source, target := envA, envB
+		if route.Reverse {
+			source, target = envB, envA
+		}
+		if !source.HasCell(route.From) {
+			c.Disconnect()
+			return nil, errors.New(ErrInvalidID, errorMessages, route.From)
+		}
+		if !target.HasCell(route.To) {
+			c.Disconnect()
+			return nil, errors.New(ErrInvalidID, errorMessages, route.To)
+		}
+		topics := make(map[string]bool)
+		for _, topic := range route.Topics {
+			topics[topic] = true
+		}
+		id := fmt.Sprintf("router-%d:%s->%s/%s", atomic.AddUint64(&routerCounter, 1), route.From, target.ID(), route.To)
+		if err := source.StartCell(id, &routerBehavior{
+			target: target,
+			to:     route.To,
+			topics: topics,
+		}); err != nil {
+			c.Disconnect()
+			return nil, err
+		}
+		c.routers = append(c.routers, routerCell{source, id})
+		if err := source.Subscribe(route.From, id); err != nil {
+			c.Disconnect()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Disconnect implements the Connection interface.
+func (c *connection) Disconnect() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var first error
+	for _, router := range c.routers {
+		if err := router.env.StopCell(router.id); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.routers = nil
+	return first
+}
+
+// EOF
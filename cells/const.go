@@ -33,17 +33,52 @@ const (
 
 const (
 	// Often used standard topics.
-	TopicCollected = "collected?"
-	TopicCounters  = "counters?"
-	TopicProcessed = "processed?"
-	TopicReset     = "reset!"
-	TopicStatus    = "status?"
-	TopicTick      = "tick!"
+	TopicCollected        = "collected?"
+	TopicCellError        = "cell-error"
+	TopicCellPanic        = "cell-panic"
+	TopicCellStalled      = "cell-stalled"
+	TopicCommand          = "command!"
+	TopicConfigure        = "configure!"
+	TopicCounters         = "counters?"
+	TopicFlush            = "flush!"
+	TopicHandoffCompleted = "handoff-completed"
+	TopicProcessed        = "processed?"
+	TopicReset            = "reset!"
+	TopicSlowProcessing   = "slow-processing"
+	TopicStatus           = "status?"
+	TopicTick             = "tick!"
+
+	// Standard commands.
+	CommandConfigure = "configure"
+	CommandFlush     = "flush"
+	CommandReset     = "reset"
+	CommandStatus    = "status"
 
 	// Standard payload keys.
-	PayloadDefault    = "default"
-	PayloadTickerID   = "ticker:id"
-	PayloadTickerTime = "ticker:time"
+	PayloadCellError            = "cell-error:error"
+	PayloadCellErrorID          = "cell-error:id"
+	PayloadCellErrorTopic       = "cell-error:topic"
+	PayloadCellPanicEmitter     = "cell-panic:emitter"
+	PayloadCellPanicEventID     = "cell-panic:event-id"
+	PayloadCellPanicID          = "cell-panic:id"
+	PayloadCellPanicPayload     = "cell-panic:payload"
+	PayloadCellPanicReason      = "cell-panic:reason"
+	PayloadCellPanicStack       = "cell-panic:stack"
+	PayloadCellPanicTopic       = "cell-panic:topic"
+	PayloadCellStalledID        = "cell-stalled:id"
+	PayloadCellStalledIdle      = "cell-stalled:idle"
+	PayloadCellStalledQueued    = "cell-stalled:queued"
+	PayloadCellStalledRestarted = "cell-stalled:restarted"
+	PayloadCellStalledStack     = "cell-stalled:stack"
+	PayloadCommand              = "command"
+	PayloadCommandArgs          = "args"
+	PayloadCommandReplyWaiter   = "reply-waiter"
+	PayloadDefault              = "default"
+	PayloadHandoffCell          = "handoff:cell"
+	PayloadSlowTimeout          = "slow:timeout"
+	PayloadSlowTopic            = "slow:topic"
+	PayloadTickerID             = "ticker:id"
+	PayloadTickerTime           = "ticker:time"
 
 	// Default timeout for requests to cells.
 	DefaultTimeout = 5 * time.Second
@@ -0,0 +1,101 @@
+// Tideland Go Cells - Context Keys
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+)
+
+//--------------------
+// CONTEXT KEYS
+//--------------------
+
+// contextValuesKey is the context key for the context values
+// copied into an event.
+type contextValuesKey struct{}
+
+// contextValues contains the values of the context keys of
+// an environment.
+type contextValues map[interface{}]interface{}
+
+// WithContextKeys sets the keys of context values, e.g. tenant ID,
+// auth principal, or request ID, which are copied into the events
+// emitted inside the environment. Their values are restored into the
+// context of events emitted by cells during processing, even if the
+// behaviors use a fresh context instead of the one of the processed
+// event.
+func WithContextKeys(keys ...interface{}) Option {
+	return func(env *environment) {
+		env.contextKeys = append(env.contextKeys, keys...)
+	}
+}
+
+// ContextValues returns the context values copied into the event
+// when it has been created inside an environment with context keys
+// or the metadata set with WithMetadata().
+// The returned map is a copy, e.g. to be serialized by bridges.
+func ContextValues(event Event) map[interface{}]interface{} {
+	var values contextValues
+	if ctx := event.Context(); ctx != nil {
+		values, _ = ctx.Value(contextValuesKey{}).(contextValues)
+	}
+	copied := make(map[interface{}]interface{}, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+// RestoreContextValues returns a context containing the passed values,
+// e.g. after receiving them from a bridge.
+func RestoreContextValues(ctx context.Context, values map[interface{}]interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for key, value := range values {
+		if ctx.Value(key) == nil {
+			ctx = context.WithValue(ctx, key, value)
+		}
+	}
+	return ctx
+}
+
+// collectContextValues copies the values of the keys found
+// in the context.
+func collectContextValues(ctx context.Context, keys []interface{}) contextValues {
+	var values contextValues
+	for _, key := range keys {
+		if value := ctx.Value(key); value != nil {
+			if values == nil {
+				values = make(contextValues, len(keys))
+			}
+			values[key] = value
+		}
+	}
+	return values
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// restoreContextValues adds the context values of the event
+// currently processed by the cell which are missing in ctx.
+func (c *cell) restoreContextValues(ctx context.Context) context.Context {
+	values, _ := c.contextValues.Load().(contextValues)
+	if len(values) == 0 {
+		return ctx
+	}
+	return RestoreContextValues(ctx, values)
+}
+
+// EOF
@@ -0,0 +1,95 @@
+// Tideland Go Cells - Dependencies
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// DEPENDENCIES
+//--------------------
+
+// After lets a cell only start if the cells with the passed IDs
+// are already running. Otherwise StartCell() returns an error.
+// This prevents races like a router emitting to not yet started
+// cells. Behaviors can declare dependencies themselves by
+// implementing BehaviorDependencies.
+func After(ids ...string) CellOption {
+	return func(c *cell) {
+		c.dependencies = append(c.dependencies, ids...)
+	}
+}
+
+// dependenciesOf returns the IDs of the cells the behavior
+// depends on.
+func dependenciesOf(behavior Behavior) []string {
+	if bd, ok := behavior.(BehaviorDependencies); ok {
+		return bd.DependsOn()
+	}
+	return nil
+}
+
+// checkDependencies checks if all cells the cell depends on are
+// running. It is called while the registry is locked for starting
+// the cell.
+func (c *cell) checkDependencies() error {
+	ids := append(append([]string{}, c.dependencies...), dependenciesOf(c.behavior)...)
+	for _, id := range ids {
+		if _, ok := c.env.cells.cells[id]; !ok {
+			c.emitTimeoutTicker.Stop()
+			return errors.New(ErrMissingDependency, errorMessages, c.id, id)
+		}
+	}
+	return nil
+}
+
+// orderByDependencies returns the IDs of the passed behaviors
+// ordered so that each cell starts after the running ones and
+// the ones it depends on. It fails if a dependency is neither
+// running nor part of the behaviors.
+func (env *environment) orderByDependencies(ids []string, behaviors map[string]Behavior) ([]string, error) {
+	var ordered []string
+	started := make(map[string]bool)
+	remaining := ids
+	for len(remaining) > 0 {
+		var deferred []string
+		for _, id := range remaining {
+			ready := true
+			for _, dep := range dependenciesOf(behaviors[id]) {
+				if !started[dep] && !env.HasCell(dep) {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, id)
+				started[id] = true
+			} else {
+				deferred = append(deferred, id)
+			}
+		}
+		if len(deferred) == len(remaining) {
+			// No progress, so a dependency is missing or cyclic.
+			id := deferred[0]
+			for _, dep := range dependenciesOf(behaviors[id]) {
+				if !started[dep] && !env.HasCell(dep) {
+					return nil, errors.New(ErrMissingDependency, errorMessages, id, dep)
+				}
+			}
+		}
+		remaining = deferred
+	}
+	return ordered, nil
+}
+
+// EOF
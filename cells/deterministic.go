@@ -0,0 +1,148 @@
+// Tideland Go Cells - Deterministic Scheduling
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// WithDeterministicScheduling lets one goroutine of the environment
+// process the events of all cells one at a time, in the order they
+// have been emitted. The queue is unbounded, concurrency options of
+// the cells are ignored. So runs with the same external events lead
+// to the same interleavings, e.g. for reproducible pipeline tests.
+func WithDeterministicScheduling() Option {
+	return func(env *environment) {
+		env.scheduler = &scheduler{
+			signalc: make(chan struct{}, 1),
+		}
+	}
+}
+
+//--------------------
+// SCHEDULER
+//--------------------
+
+// scheduledEvent is an event waiting for the processing by a cell.
+type scheduledEvent struct {
+	cell  *cell
+	event Event
+}
+
+// scheduler contains the global queue of the events of all cells.
+type scheduler struct {
+	mutex   sync.Mutex
+	queue   []scheduledEvent
+	signalc chan struct{}
+
+	// running is locked while a cell processes an event or
+	// replaces its behavior.
+	running sync.Mutex
+}
+
+// enqueue appends the event for the cell to the queue.
+func (s *scheduler) enqueue(c *cell, event Event) error {
+	select {
+	case <-c.loop.IsStopping():
+		return errors.New(ErrInactive, errorMessages, c.id)
+	default:
+	}
+	c.enqueued()
+	s.mutex.Lock()
+	s.queue = append(s.queue, scheduledEvent{c, event})
+	s.mutex.Unlock()
+	select {
+	case s.signalc <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next returns the first queued event.
+func (s *scheduler) next() (scheduledEvent, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.queue) == 0 {
+		return scheduledEvent{}, false
+	}
+	se := s.queue[0]
+	s.queue[0] = scheduledEvent{}
+	s.queue = s.queue[1:]
+	return se, true
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// schedule processes the queued events until the
+// environment stops.
+func (env *environment) schedule() {
+	s := env.scheduler
+	for {
+		select {
+		case <-env.ctx.Done():
+			return
+		case <-s.signalc:
+		}
+		for {
+			select {
+			case <-env.ctx.Done():
+				return
+			case <-env.gate():
+			}
+			se, ok := s.next()
+			if !ok {
+				break
+			}
+			s.running.Lock()
+			se.cell.processScheduled(se.event)
+			s.running.Unlock()
+		}
+	}
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// processScheduled processes the event in the goroutine of the
+// scheduler. Panics are recovered like in the backend of the cell,
+// errors stop it.
+func (c *cell) processScheduled(event Event) {
+	select {
+	case <-c.loop.IsStopping():
+		c.rejected()
+		return
+	default:
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warningf("recovering scheduled cell %q after error: %v", c.id, r)
+			if rerr := c.behavior.Recover(r); rerr != nil {
+				c.stopInline(event, rerr)
+			}
+		}
+	}()
+	if err := c.align(event, c.process, nil); err != nil {
+		c.stopInline(event, err)
+	}
+}
+
+// EOF
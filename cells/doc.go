@@ -16,17 +16,82 @@
 //
 //     env := cells.NewEnvironment(identifier)
 //
-// and cells are added with
+// Options like
+//
+//     env := cells.NewEnvironment(identifier, cells.WithFanoutOrder(cells.OrderedFanout))
+//
+// can be passed together with the parts of the identifier. The option
+// cells.WithIDGenerator(cells.NewULIDGenerator()) gives all events
+// emitted inside the environment IDs sortable by their creation time.
+// Cells are added with
 //
 //    env.StartCell("foo", NewFooBehavior())
 //
+// Cell options like
+//
+//    env.StartCell("foo", NewFooBehavior(), cells.WithTraceBuffer(100))
+//
+// are passed after the behavior. Here env.Trace("foo") returns the
+// last 100 processed events for a postmortem. Behaviors doing external
+// calls use Cell.InFlight(), the option cells.MaxInFlight(n) limits
+// those calls to n in parallel.
+//
 // Cells then can be subscribed with
 //
 //    env.Subscribe("foo", "bar")
 //
 // so that events emitted by the "foo" cell during the processing of
 // events will be received by the "bar" cell. Each cell can have
-// multiple cells subscibed.
+// multiple cells subscibed. With
+//
+//    env.SubscribeAcked("foo", 3, "bar")
+//
+// "foo" keeps each event until "bar" processed it without error. Failed
+// events are redelivered up to three times, events not processed before
+// a stop of "bar" are delivered again once it is restarted and subscribed.
+// Simple adaptions like renamed topics don't need a mapper cell, with
+//
+//    env.SubscribeWith("foo", "bar", cells.RenameTopics(map[string]string{"a": "b"}))
+//
+// only "bar" receives the events of "foo" with the topic "a" as "b".
+//
+// Simple chains of cells can also be declared as pipeline with
+//
+//     p, err := cells.NewPipeline(env).
+//         Source("in", NewInBehavior()).
+//         Via("filter", NewFilterBehavior()).
+//         Sink("out", NewOutBehavior()).
+//         Build()
+//
+// The returned pipeline allows to emit events to its source and
+// to stop all of its cells.
+//
+// Two environments inside the same process can be linked with
+//
+//     conn, err := cells.Connect(envA, envB,
+//         cells.Route{From: "foo", To: "bar", Topics: []string{"order"}},
+//         cells.Route{From: "baz", To: "foo", Reverse: true},
+//     )
+//
+// Events emitted by "foo" in envA with the topic "order" are then
+// processed by "bar" in envB. Events are never forwarded back into
+// an environment they already passed.
+//
+// Topologies built at runtime survive restarts when the environment
+// is created with
+//
+//     env := cells.NewEnvironment(identifier, cells.WithTopologyStore(store, factory))
+//
+// Cells with behaviors implementing BehaviorDescriptor are then
+// re-created by the factory and all subscriptions are established
+// again as soon as their cells are started.
+//
+// Stateful cells can be upgraded without losing events with
+//
+//     err := env.ReplaceCell("foo", NewFooBehaviorV2())
+//
+// If the new behavior implements BehaviorHandoff it takes over the
+// state of the old one.
 //
 // Events from the outside are emitted using
 //
@@ -39,6 +104,24 @@
 //        "KeyB": true,
 //    }, ctx)
 //
+// Events without values can share cells.EmptyPayload(). Expensive
+// payloads can be passed as cells.LazyPayload(), they are only built
+// when a subscriber accesses them.
+//
+// Historical events can be injected while live events are processed with
+//
+//     err := env.Backfill(ctx, cells.NewSliceEventIterator(historicalEvents...))
+//
+// They keep their original event time as timestamp and are marked, so
+// windowing behaviors can check IsBackfill() and use EventTime().
+//
+// A slice of history can be replayed with cells.Replay() and a
+// ReplayFilter selecting topics and a time range.
+//
+// Tests can wait until cells processed all of their queued events with
+//
+//     err := env.Barrier(ctx, "foo", "bar")
+//
 // Behaviors have to implement the cells.Behavior interface. Here
 // the Init() method is called with a cells.Context. This can be
 // used inside the ProcessEvent() method to emit events to subscribers
@@ -59,7 +142,151 @@
 //        ...
 //    }
 //
+// The same request is sent to many cells concurrently with
+//
+//     replies, err := env.RequestAll(ctx, []string{"foo", "bar"}, "myRequest?", myPayload)
+//
+// The replies are returned by cell ID, the context sets the shared
+// deadline. In case of failures the received replies are returned too.
+//
 // Instructions without a response are simply done by emitting an event.
+// Standard operations like reset, status, flush, and configure are sent
+// to any cell with
+//
+//     reply, err := cells.SendCommand(ctx, env, "foo", cells.CommandReset, nil, timeout)
+//
+// The cell passes them to the behavior with the topics TopicReset,
+// TopicStatus, TopicFlush, and TopicConfigure, or as Command if the
+// behavior implements BehaviorCommandHandler. Behaviors implementing
+// BehaviorConfigurable receive configurations via Configure(), so they
+// can be tuned at runtime without restart.
+//
+// Behaviors coordinating external transactional resources implement
+// BehaviorTransactional. The cell calls Begin() before processing an
+// event, Commit() after success, and Rollback() after errors or panics.
+//
+// Context values like tenant IDs or request IDs are copied into the
+// events if their keys are configured with WithContextKeys(). Events
+// emitted by cells during processing get these values again, even if
+// the behavior uses a fresh context.
+//
+// Cells depending on others, e.g. routers emitting to their targets,
+// are started with the option After() or declare their dependencies by
+// implementing BehaviorDependencies. StartCell() fails if one of them is
+// missing, restoring a topology starts the cells in dependency order.
+//
+// The option ProcessTimeout() limits the processing of an event. When
+// exceeded its context is canceled, so stuck external calls return, and
+// with SlowProcessingEvents() the subscribers are notified. The timeout
+// is handled by the error policy, but by default the cell keeps working.
+// Runaway
+// producers are shaped with EmitRateLimit(), which delays their emits.
+//
+// Code outside of cells consumes the events emitted by a cell with
+//
+//     eventc, cancel, err := env.SubscribeChannel("my-cell", 16)
+//     defer cancel()
+//     for event := range eventc { ... }
+//
+// so no throwaway behavior is needed for HTTP handlers, CLIs, or tests.
+// Even simpler, Events() returns a sequence subscribed while ranging:
+//
+//     for event := range env.Events(ctx, "my-cell") { ... }
+//
+// Correlated events for several cells are emitted with EmitAll(). Either
+// all target queues take them or none does. A handler set with
+// SetMissingCellHandler() spawns cells on demand when events are emitted
+// to unknown IDs, e.g. one cell per device ID.
+//
+// By default a cell stops when its behavior returns an error. The option
+// WithErrorPolicy() lets the cells continue and count the errors instead,
+// or escalate them to the supervisor cell set with WithSupervisor(). The
+// cell option OnError() overrides the policy per cell.
+//
+// Cells process their events one by one. Stateless behaviors safe for
+// concurrent calls can be started with the option Concurrency() to
+// process several events in parallel. Together with OrderBy() the events
+// with the same key, e.g. per user or per device, keep their order.
+//
+//     env.StartCell("enricher", behavior, cells.Concurrency(8), cells.OrderBy(byDevice))
+//
+// Trivial stateless transforms can be started with the option Inline().
+// Events emitted to them are processed directly in the goroutine of the
+// emitter, without the hop through the queue.
+//
+// Besides the monitoring the counters of the cells are returned by
+// env.Stats(). They contain the processed, dropped, and failed events,
+// the current and highest queue depth, and the average processing time.
+//
+// The option WithStallDetection() lets the environment watch for cells
+// with queued events but no completed processing for a maximum idle time.
+// Stalls are logged with the stack of the blocked goroutine and emitted
+// to the supervisor. Cells started with RestartOnStall() are replaced by
+// a new one with a fresh behavior.
+//
+// Panics of behaviors are recovered by their cells. The option
+// WithPanicReports() additionally emits a report with the stack trace
+// and the offending event to the supervisor and to further cells, e.g.
+// one collecting dead letters. Sensitive payload values can be redacted.
+//
+// By default all subscribers receive each event emitted by a cell. With
+// env.SetFanout() this can be changed per emitting cell to AnyOne(),
+// letting the subscribers compete for the events, or to Sharded(), always
+// selecting the same subscriber for the same key of an event.
+//
+//     env.SetFanout("orders", cells.Sharded(byCustomer))
+//
+// One subscriber can be marked as primary with env.SetPrimarySubscriber().
+// Events are delivered to it first, the other subscribers are only offered
+// them afterwards and drop them if their queues are full. So e.g. a journal
+// never misses events because of a slow debugging tap.
+//
+// Topics can be renamed without changing all producers and consumers at
+// once. After env.AliasTopic("order", "order-placed") events emitted with
+// the old topic are delivered with the new one. The statistics tell how
+// often the old topic is still used and by which emitters, the option
+// WithAliasLogging() additionally logs each of them once.
+//
+// Payload keys of decoded events are interned with InternKey(), so the
+// events of high-throughput pipelines share their key strings instead of
+// allocating them again and again.
+//
+// Checkpoint() takes a consistent recovery point of all cells. Barriers
+// flow from the cells without emitters through the topology, each cell
+// holds back the events of emitters which already passed their barrier
+// until those of all emitters arrived. Then behaviors implementing
+// BehaviorSnapshotter are snapshot. Together with the offset of the
+// source they can be restored with RestoreCheckpoint(). Topologies
+// with cycles cannot be checkpointed, IsCyclicTopologyError() signals
+// them.
+//
+// Behaviors can keep simple state in the key/value store returned by
+// Cell.State(). It is managed by the environment in the namespace of
+// the cell ID, in memory by default or in a persistent store set with
+// WithStateStore(). Checkpoints contain the states of all cells.
+//
+// WithAutoCheckpoint() lets the environment take checkpoints in an
+// interval and save them in a SnapshotStore. The stores for files,
+// key/value stores, and object storages keep the last checkpoints
+// together with a checksum, LatestCheckpoint() returns the one to
+// restore after a restart.
+//
+// Probe() sends a probe along a route of cells. It passes their queues
+// but is not processed by the behaviors, so the returned latencies per
+// hop show where events are waiting.
+//
+// WithDeterministicScheduling() lets one goroutine process the events
+// of all cells one at a time in the order they have been emitted. It
+// makes interleavings reproducible, e.g. in tests of pipelines.
+//
+// StrictMode() helps finding errors in topologies during development.
+// Together with the topics registered with WithTopics() emitting others
+// returns an error, and cells emitting topics nobody subscribed to are
+// logged.
+//
+// Behaviors buffering events implement BehaviorFlusher to emit them
+// on TopicFlush. Drain() flushes those cells from the sources to the
+// sinks before it stops the environment, so shutdowns lose no data.
 package cells
 
 //--------------------
@@ -0,0 +1,122 @@
+// Tideland Go Cells - Drain
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// topicDrain lets cells with flushing behaviors flush them. Other
+// behaviors don't receive it.
+const topicDrain = "drain!"
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// Drain implements the Environment interface.
+func (env *environment) Drain(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := env.drain(ctx)
+	if err != nil {
+		logger.Errorf("cells environment %q cannot drain: %v", env.ID(), err)
+	}
+	if serr := env.Stop(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// drain flushes the cells one after the other, so buffered events
+// reach the following cells before those are flushed.
+func (env *environment) drain(ctx context.Context) error {
+	for _, id := range flushOrder(env.cells.topology()) {
+		if err := env.EmitNew(ctx, id, topicDrain, nil); err != nil {
+			return err
+		}
+		if err := env.Barrier(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushOrder returns the IDs of the cells ordered so that emitters
+// come before their subscribers. Cycles are broken at the cell with
+// the lowest ID.
+func flushOrder(nodes []topologyNode) []string {
+	emitters := make(map[string]int, len(nodes))
+	subscribers := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		subscribers[node.id] = node.subscribers
+		for _, id := range node.subscribers {
+			emitters[id]++
+		}
+	}
+	var order []string
+	done := make(map[string]bool, len(nodes))
+	for len(order) < len(nodes) {
+		var ready []string
+		for _, node := range nodes {
+			if !done[node.id] && emitters[node.id] == 0 {
+				ready = append(ready, node.id)
+			}
+		}
+		if len(ready) == 0 {
+			// Cycle, the nodes are sorted by ID.
+			for _, node := range nodes {
+				if !done[node.id] {
+					ready = append(ready, node.id)
+					break
+				}
+			}
+		}
+		sort.Strings(ready)
+		for _, id := range ready {
+			done[id] = true
+			order = append(order, id)
+			for _, sid := range subscribers[id] {
+				emitters[sid]--
+			}
+		}
+	}
+	return order
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// flush lets the behavior emit its buffered events and replies
+// to a waiting sender.
+func (c *cell) flush(bf BehaviorFlusher, event Event) error {
+	err := bf.Flush(event.Context())
+	if payload, ok := HasWaiterPayload(event); ok {
+		if err != nil {
+			payload.GetWaiter().Set(err)
+		} else {
+			payload.GetWaiter().Set(PayloadValues{PayloadCommand: CommandFlush})
+		}
+	}
+	return err
+}
+
+// EOF
@@ -0,0 +1,119 @@
+// Tideland Go Cells - Emit All
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"runtime"
+	"sort"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// EMIT
+//--------------------
+
+// Emit describes one of the events emitted together by EmitAll().
+type Emit struct {
+	ID      string
+	Topic   string
+	Payload interface{}
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// EmitAll implements the Environment interface.
+func (env *environment) EmitAll(ctx context.Context, emits ...Emit) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Check cells and topics and create the events first.
+	targets := make([]*cell, len(emits))
+	events := make([]Event, len(emits))
+	needed := make(map[*cell]int)
+	for i, emit := range emits {
+		c, err := env.target(emit.ID)
+		if err != nil {
+			return err
+		}
+		event, err := newEvent(ctx, env, env.id, emit.Topic, emit.Payload)
+		if err != nil {
+			return err
+		}
+		targets[i] = c
+		events[i] = event
+		needed[c]++
+	}
+	// Lock the queues in a stable order and check their capacity.
+	cs := make([]*cell, 0, len(needed))
+	for c := range needed {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].id < cs[j].id
+	})
+	for _, c := range cs {
+		if !c.lockQueue() {
+			return errors.New(ErrQueueFull, errorMessages, c.id, needed[c])
+		}
+		defer c.enqueueMutex.Unlock()
+	}
+	for _, c := range cs {
+		select {
+		case <-c.loop.IsStopping():
+			return errors.New(ErrInactive, errorMessages, c.id)
+		default:
+		}
+		if free := cap(c.eventc) - len(c.eventc); free < needed[c] {
+			return errors.New(ErrQueueFull, errorMessages, c.id, needed[c])
+		}
+	}
+	// All queues accept the events.
+	for i, event := range events {
+		if env.observer != nil {
+			env.observer(event)
+		}
+		c := targets[i]
+		if env.scheduler != nil || c.inline {
+			if err := c.ProcessEvent(event); err != nil {
+				return err
+			}
+			continue
+		}
+		// The queue is locked and has the capacity.
+		c.enqueued()
+		c.eventc <- event
+	}
+	return nil
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// lockQueue locks the queue of the cell exclusively. The other
+// emitters hold it shared while enqueueing, also when they are
+// waiting at a full queue. In this case locking fails.
+func (c *cell) lockQueue() bool {
+	for !c.enqueueMutex.TryLock() {
+		if len(c.eventc) == cap(c.eventc) {
+			return false
+		}
+		runtime.Gosched()
+	}
+	return true
+}
+
+// EOF
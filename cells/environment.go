@@ -13,9 +13,13 @@ package cells
 
 import (
 	"context"
+	"io"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/tideland/golib/errors"
 	"github.com/tideland/golib/identifier"
 	"github.com/tideland/golib/logger"
 )
@@ -26,21 +30,76 @@ import (
 
 // Environment implements the Environment interface.
 type environment struct {
-	id    string
-	cells *registry
+	mutex          sync.RWMutex
+	id             string
+	cells          *registry
+	fanoutOrder    FanoutOrder
+	gatec          chan struct{}
+	ctx            context.Context
+	cancel         context.CancelFunc
+	persistence    *topologyPersistence
+	idGenerator    IDGenerator
+	observer       Observer
+	contextKeys    []interface{}
+	channels       uint64
+	spawnMutex     sync.Mutex
+	missingCell    MissingCellHandler
+	errorPolicy    ErrorPolicy
+	supervisor     string
+	stallMaxIdle   time.Duration
+	aliases        topicAliases
+	aliasLogging   bool
+	checkpoints    checkpoints
+	autoCheckpoint *autoCheckpoint
+	panicReports   *panicReports
+	scheduler      *scheduler
+	topics         map[string]bool
+	strict         *strictMode
+	states         StateStore
 }
 
-// NewEnvironment creates a new environment.
+// NewEnvironment creates a new environment. Passed arguments of
+// type Option configure the environment, all others are used to
+// build its ID.
 func NewEnvironment(idParts ...interface{}) Environment {
-	var id string
-	if len(idParts) == 0 {
-		id = identifier.NewUUID().String()
-	} else {
-		id = identifier.Identifier(idParts...)
+	var options []Option
+	var parts []interface{}
+	for _, part := range idParts {
+		if option, ok := part.(Option); ok {
+			options = append(options, option)
+		} else {
+			parts = append(parts, part)
+		}
 	}
 	env := &environment{
-		id:    id,
-		cells: newRegistry(),
+		cells:  newRegistry(),
+		gatec:  make(chan struct{}),
+		states: NewMemoryStateStore(),
+	}
+	env.ctx, env.cancel = context.WithCancel(context.Background())
+	close(env.gatec)
+	for _, option := range options {
+		option(env)
+	}
+	switch {
+	case len(parts) > 0:
+		env.id = identifier.Identifier(parts...)
+	case env.idGenerator != nil:
+		env.id = env.idGenerator()
+	default:
+		env.id = identifier.NewUUID().String()
+	}
+	if env.persistence != nil {
+		env.persistence.restore(env)
+	}
+	if env.stallMaxIdle > 0 {
+		go env.watchStalls()
+	}
+	if env.scheduler != nil {
+		go env.schedule()
+	}
+	if env.autoCheckpoint != nil && env.autoCheckpoint.interval > 0 && env.autoCheckpoint.store != nil {
+		go env.takeCheckpoints()
 	}
 	runtime.SetFinalizer(env, (*environment).Stop)
 	logger.Infof("cells environment %q started", env.ID())
@@ -53,13 +112,25 @@ func (env *environment) ID() string {
 }
 
 // StartCell implements the Environment interface.
-func (env *environment) StartCell(id string, behavior Behavior) error {
-	return env.cells.startCell(env, id, behavior)
+func (env *environment) StartCell(id string, behavior Behavior, options ...CellOption) error {
+	if err := env.cells.startCell(env, id, behavior, options...); err != nil {
+		return err
+	}
+	if env.persistence != nil {
+		env.persistence.started(env, id)
+	}
+	return nil
 }
 
 // StopCell implements the Environment interface.
 func (env *environment) StopCell(id string) error {
-	return env.cells.stopCell(id)
+	if err := env.cells.stopCell(id); err != nil {
+		return err
+	}
+	if env.persistence != nil {
+		env.persistence.save(env)
+	}
+	return nil
 }
 
 // HasCell implements the Environment interface.
@@ -70,7 +141,13 @@ func (env *environment) HasCell(id string) bool {
 
 // Subscribe implements the Environment interface.
 func (env *environment) Subscribe(emitterID string, subscriberIDs ...string) error {
-	return env.cells.subscribe(emitterID, subscriberIDs...)
+	if err := env.cells.subscribe(emitterID, subscriberIDs...); err != nil {
+		return err
+	}
+	if env.persistence != nil {
+		env.persistence.save(env)
+	}
+	return env.redeliver(emitterID, subscriberIDs)
 }
 
 // Subscribers implements the Environment interface.
@@ -80,15 +157,30 @@ func (env *environment) Subscribers(id string) ([]string, error) {
 
 // Unsubscribe implements the Environment interface.
 func (env *environment) Unsubscribe(emitterID string, subscriberIDs ...string) error {
-	return env.cells.unsubscribe(emitterID, subscriberIDs...)
+	if err := env.cells.unsubscribe(emitterID, subscriberIDs...); err != nil {
+		return err
+	}
+	if env.persistence != nil {
+		env.persistence.unsubscribed(env, emitterID, subscriberIDs)
+	}
+	return nil
 }
 
 // Emit implements the Environment interface.
 func (env *environment) Emit(id string, event Event) error {
-	c, err := env.cells.cell(id)
+	c, err := env.target(id)
 	if err != nil {
 		return err
 	}
+	event = env.aliases.apply(env, env.id, event)
+	if env.strict != nil {
+		if err := env.checkTopic(event.Topic()); err != nil {
+			return err
+		}
+	}
+	if env.observer != nil {
+		env.observer(event)
+	}
 	return c.ProcessEvent(event)
 }
 
@@ -97,7 +189,7 @@ func (env *environment) EmitNew(ctx context.Context, id, topic string, payload i
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	event, err := NewEvent(ctx, topic, payload)
+	event, err := newEvent(ctx, env, env.id, topic, payload)
 	if err != nil {
 		return err
 	}
@@ -123,9 +215,99 @@ func (env *environment) Request(ctx context.Context, id, topic string, timeout t
 	return payloadOut, nil
 }
 
+// StartGated implements the Environment interface.
+func (env *environment) StartGated() {
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	select {
+	case <-env.gatec:
+		env.gatec = make(chan struct{})
+		logger.Infof("cells environment %q is gated", env.ID())
+	default:
+	}
+}
+
+// Release implements the Environment interface.
+func (env *environment) Release() {
+	env.mutex.Lock()
+	defer env.mutex.Unlock()
+	select {
+	case <-env.gatec:
+	default:
+		close(env.gatec)
+		logger.Infof("cells environment %q is released", env.ID())
+	}
+}
+
+// gate returns a channel which is closed when the environment
+// allows the processing of events.
+func (env *environment) gate() <-chan struct{} {
+	env.mutex.RLock()
+	defer env.mutex.RUnlock()
+	return env.gatec
+}
+
+// WriteDOT implements the Environment interface.
+func (env *environment) WriteDOT(w io.Writer) error {
+	return writeDOT(w, env.id, env.cells.topology())
+}
+
+// WriteMermaid implements the Environment interface.
+func (env *environment) WriteMermaid(w io.Writer) error {
+	return writeMermaid(w, env.cells.topology())
+}
+
+// QueueDepth implements the Environment interface.
+func (env *environment) QueueDepth(id string) (int, error) {
+	c, err := env.cells.cell(id)
+	if err != nil {
+		return 0, err
+	}
+	return int(atomic.LoadInt64(&c.pending)), nil
+}
+
+// Barrier implements the Environment interface.
+func (env *environment) Barrier(ctx context.Context, ids ...string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cs, err := env.cells.cellsOf(ids...)
+	if err != nil {
+		return err
+	}
+	drained := func() (uint64, bool) {
+		var processed uint64
+		for _, c := range cs {
+			processed += atomic.LoadUint64(&c.processed)
+			if atomic.LoadInt64(&c.pending) > 0 {
+				return processed, false
+			}
+		}
+		return processed, true
+	}
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// Drained twice without processing in between,
+		// so no event is passed between the cells.
+		before, ok := drained()
+		if ok {
+			if after, ok := drained(); ok && after == before {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), ErrTimeout, errorMessages, "barrier")
+		case <-ticker.C:
+		}
+	}
+}
+
 // Stop implements the Environment interface.
 func (env *environment) Stop() error {
 	runtime.SetFinalizer(env, nil)
+	env.cancel()
 	if err := env.cells.stop(); err != nil {
 		return err
 	}
@@ -0,0 +1,124 @@
+// Tideland Go Cells - Error Policy
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"github.com/tideland/golib/identifier"
+	"github.com/tideland/golib/logger"
+	"github.com/tideland/golib/monitoring"
+)
+
+//--------------------
+// ERROR POLICY
+//--------------------
+
+// ErrorPolicy decides what happens when a behavior returns an
+// error while processing an event.
+type ErrorPolicy int
+
+const (
+	// StopCellOnError stops the cell. It is the default.
+	StopCellOnError ErrorPolicy = iota
+
+	// ContinueAndCount logs the error, counts it in the monitoring
+	// variable of the cell ending with "errors", and continues with
+	// the next event.
+	ContinueAndCount
+
+	// EscalateToSupervisor emits an event with the topic TopicCellError
+	// to the supervisor cell set with WithSupervisor() and continues
+	// with the next event. Without supervisor the cell stops.
+	EscalateToSupervisor
+)
+
+// WithErrorPolicy sets the error policy of all cells of the
+// environment. It can be overridden per cell with OnError().
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(env *environment) {
+		env.errorPolicy = policy
+	}
+}
+
+// WithSupervisor sets the ID of the cell receiving the errors of
+// cells with the policy EscalateToSupervisor.
+func WithSupervisor(id string) Option {
+	return func(env *environment) {
+		env.supervisor = id
+	}
+}
+
+// OnError sets the error policy of a cell, overriding the one of
+// the environment.
+func OnError(policy ErrorPolicy) CellOption {
+	return func(c *cell) {
+		c.errorPolicy = &policy
+	}
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// handleError applies the error policy to an error returned by
+// the behavior. A returned error stops the cell.
+func (c *cell) handleError(event Event, err error) error {
+	return c.applyErrorPolicy(event, err, c.policy())
+}
+
+// handleTimeout applies the error policy to an exceeded process
+// timeout. As the behavior returned StopCellOnError continues
+// like ContinueAndCount.
+func (c *cell) handleTimeout(event Event, err error) error {
+	policy := c.policy()
+	if policy == StopCellOnError {
+		policy = ContinueAndCount
+	}
+	return c.applyErrorPolicy(event, err, policy)
+}
+
+// policy returns the error policy of the cell.
+func (c *cell) policy() ErrorPolicy {
+	if c.errorPolicy != nil {
+		return *c.errorPolicy
+	}
+	return c.env.errorPolicy
+}
+
+// applyErrorPolicy handles the error with the policy.
+func (c *cell) applyErrorPolicy(event Event, err error, policy ErrorPolicy) error {
+	switch policy {
+	case ContinueAndCount:
+		logger.Warningf("cell %q continues after processing event %q with error: %v", c.id, event.Topic(), err)
+		monitoring.IncrVariable(identifier.Identifier(c.measuringID, "errors"))
+		return nil
+	case EscalateToSupervisor:
+		if c.env.supervisor == "" || c.env.supervisor == c.id {
+			return err
+		}
+		eerr := c.env.EmitNew(context.Background(), c.env.supervisor, TopicCellError, PayloadValues{
+			PayloadCellErrorID:    c.id,
+			PayloadCellErrorTopic: event.Topic(),
+			PayloadCellError:      err.Error(),
+		})
+		if eerr != nil {
+			logger.Errorf("cell %q cannot escalate error to supervisor %q: %v", c.id, c.env.supervisor, eerr)
+			return err
+		}
+		monitoring.IncrVariable(identifier.Identifier(c.measuringID, "errors"))
+		return nil
+	}
+	return err
+}
+
+// EOF
@@ -33,22 +33,64 @@ const (
 	ErrStopping
 	ErrTimeout
 	ErrMissingScene
+	ErrInvalidPipeline
+	ErrUnknownKey
+	ErrInvalidSealedValue
+	ErrSealing
+	ErrOpening
+	ErrNotSealed
+	ErrTopologyStore
+	ErrRestoreCell
+	ErrHandoff
+	ErrUnknownCommand
+	ErrMissingDependency
+	ErrQueueFull
+	ErrRequestAll
+	ErrStalled
+	ErrTopicAlias
+	ErrCheckpoint
+	ErrRestoreSnapshot
+	ErrSnapshotStore
+	ErrCorruptCheckpoint
+	ErrUnregisteredTopic
+	ErrCyclicTopology
 )
 
 var errorMessages = map[int]string{
-	ErrCellInit:          "cell %q cannot initialize",
-	ErrCannotRecover:     "cannot recover cell %q: %v",
-	ErrDuplicateID:       "cell with ID %q is already registered",
-	ErrInvalidID:         "cell with ID %q does not exist",
-	ErrExecuteID:         "cannot %s with cell %q",
-	ErrEventRecovering:   "cell cannot recover after error %v",
-	ErrRecoveredTooOften: "cell needs too much recoverings, last error",
-	ErrNoTopic:           "event has no topic",
-	ErrNoRequest:         "cannot respond, event is no request",
-	ErrInactive:          "cell %q is inactive",
-	ErrStopping:          "%s is stopping",
-	ErrTimeout:           "needed too long for %v",
-	ErrMissingScene:      "missing scene for request",
+	ErrCellInit:           "cell %q cannot initialize",
+	ErrCannotRecover:      "cannot recover cell %q: %v",
+	ErrDuplicateID:        "cell with ID %q is already registered",
+	ErrInvalidID:          "cell with ID %q does not exist",
+	ErrExecuteID:          "cannot %s with cell %q",
+	ErrEventRecovering:    "cell cannot recover after error %v",
+	ErrRecoveredTooOften:  "cell needs too much recoverings, last error",
+	ErrNoTopic:            "event has no topic",
+	ErrNoRequest:          "cannot respond, event is no request",
+	ErrInactive:           "cell %q is inactive",
+	ErrStopping:           "%s is stopping",
+	ErrTimeout:            "needed too long for %v",
+	ErrMissingScene:       "missing scene for request",
+	ErrInvalidPipeline:    "invalid pipeline: %s",
+	ErrUnknownKey:         "cipher key %q is unknown",
+	ErrInvalidSealedValue: "value sealed with key %q is invalid",
+	ErrSealing:            "cannot seal payload value %q",
+	ErrOpening:            "cannot open payload value %q",
+	ErrNotSealed:          "payload value %q is not sealed",
+	ErrTopologyStore:      "cannot access topology store",
+	ErrRestoreCell:        "cannot restore cell %q of kind %q",
+	ErrHandoff:            "cell %q cannot hand off to new behavior",
+	ErrUnknownCommand:     "cell %q does not know command %q",
+	ErrMissingDependency:  "cell %q depends on missing cell %q",
+	ErrQueueFull:          "queue of cell %q cannot take %d events",
+	ErrRequestAll:         "requests to cells %s failed, first error: %v",
+	ErrStalled:            "cell %q stalled for %v",
+	ErrTopicAlias:         "cannot alias topic %q to %q",
+	ErrCheckpoint:         "checkpoint %d failed in cell %q",
+	ErrRestoreSnapshot:    "cannot restore snapshot of cell %q",
+	ErrSnapshotStore:      "snapshot store cannot %s checkpoint",
+	ErrCorruptCheckpoint:  "stored checkpoint %q is corrupt",
+	ErrUnregisteredTopic:  "topic %q is not registered",
+	ErrCyclicTopology:     "cell %q is part of a cycle, cannot %s",
 }
 
 //--------------------
@@ -123,4 +165,112 @@ func IsMissingSceneError(err error) bool {
 	return errors.IsError(err, ErrMissingScene)
 }
 
+// IsInvalidPipelineError checks if an error signals a wrong
+// declared or already stopped pipeline.
+func IsInvalidPipelineError(err error) bool {
+	return errors.IsError(err, ErrInvalidPipeline)
+}
+
+// IsUnknownKeyError checks if an error signals a missing
+// key of a payload cipher.
+func IsUnknownKeyError(err error) bool {
+	return errors.IsError(err, ErrUnknownKey)
+}
+
+// IsOpeningError checks if an error signals that a sealed
+// payload value cannot be opened.
+func IsOpeningError(err error) bool {
+	return errors.IsError(err, ErrOpening)
+}
+
+// IsNotSealedError checks if an error signals that a payload
+// value is not sealed.
+func IsNotSealedError(err error) bool {
+	return errors.IsError(err, ErrNotSealed)
+}
+
+// IsRestoreCellError checks if an error signals that a cell
+// of a stored topology cannot be restored.
+func IsRestoreCellError(err error) bool {
+	return errors.IsError(err, ErrRestoreCell)
+}
+
+// IsHandoffError checks if an error signals that the state of
+// a replaced behavior cannot be taken over.
+func IsHandoffError(err error) bool {
+	return errors.IsError(err, ErrHandoff)
+}
+
+// IsUnknownCommandError checks if an error signals that a cell
+// does not know a received command.
+func IsUnknownCommandError(err error) bool {
+	return errors.IsError(err, ErrUnknownCommand)
+}
+
+// IsMissingDependencyError checks if an error signals that a cell
+// cannot start because a cell it depends on is missing.
+func IsMissingDependencyError(err error) bool {
+	return errors.IsError(err, ErrMissingDependency)
+}
+
+// IsQueueFullError checks if an error signals that EmitAll() found
+// a queue without enough capacity.
+func IsQueueFullError(err error) bool {
+	return errors.IsError(err, ErrQueueFull)
+}
+
+// IsRequestAllError checks if an error signals that RequestAll()
+// did not get the replies of all cells.
+func IsRequestAllError(err error) bool {
+	return errors.IsError(err, ErrRequestAll)
+}
+
+// IsStalledError checks if an error signals a cell stopped
+// because it stalled.
+func IsStalledError(err error) bool {
+	return errors.IsError(err, ErrStalled)
+}
+
+// IsTopicAliasError checks if an error signals an invalid
+// topic alias.
+func IsTopicAliasError(err error) bool {
+	return errors.IsError(err, ErrTopicAlias)
+}
+
+// IsCheckpointError checks if an error signals a failed
+// snapshot of a cell during a checkpoint.
+func IsCheckpointError(err error) bool {
+	return errors.IsError(err, ErrCheckpoint)
+}
+
+// IsRestoreSnapshotError checks if an error signals a
+// snapshot which cannot be restored.
+func IsRestoreSnapshotError(err error) bool {
+	return errors.IsError(err, ErrRestoreSnapshot)
+}
+
+// IsSnapshotStoreError checks if an error signals a failing
+// access to a snapshot store.
+func IsSnapshotStoreError(err error) bool {
+	return errors.IsError(err, ErrSnapshotStore)
+}
+
+// IsCorruptCheckpointError checks if an error signals a stored
+// checkpoint not matching its checksum.
+func IsCorruptCheckpointError(err error) bool {
+	return errors.IsError(err, ErrCorruptCheckpoint)
+}
+
+// IsUnregisteredTopicError checks if an error signals an
+// emitted topic not registered in strict mode.
+func IsUnregisteredTopicError(err error) bool {
+	return errors.IsError(err, ErrUnregisteredTopic)
+}
+
+// IsCyclicTopologyError checks if an error signals an operation
+// not possible on topologies containing cycles.
+func IsCyclicTopologyError(err error) bool {
+	return errors.IsError(err, ErrCyclicTopology)
+}
+
 // EOF
@@ -29,7 +29,9 @@ type Event interface {
 	fmt.Stringer
 
 	// Context returns a Context that possibly has been
-	// emitted with the event.
+	// emitted with the event. When processed by a cell it
+	// carries the values and the deadline of the emitter's
+	// context and is also done when the environment stops.
 	Context() context.Context
 
 	// Timestamp returns the UTC time the event has been created.
@@ -40,28 +42,153 @@ type Event interface {
 
 	// Payload returns the payload of the event.
 	Payload() Payload
+
+	// ID returns the ID of the event. It is only set for events
+	// created inside of an environment with an ID generator,
+	// otherwise it is empty.
+	ID() string
+
+	// Emitter returns the ID of the cell that emitted the event.
+	// Events emitted from the outside by the environment return
+	// the ID of the environment, events created with NewEvent()
+	// and not yet emitted by a cell an empty string.
+	Emitter() string
 }
 
 // event implements the Event interface.
 type event struct {
+	id        string
 	ctx       context.Context
 	timestamp time.Time
 	topic     string
 	payload   Payload
+	emitter   string
+}
+
+// eventWithPayload allows to allocate an event together with
+// its payload and its processing context.
+type eventWithPayload struct {
+	event
+	p    payload
+	pctx processingContext
+}
+
+// EventOption configures an event created with NewEvent().
+type EventOption func(e *event)
+
+// WithTimestamp sets the timestamp of the event, e.g. the one of
+// a message received from a broker. It is converted to UTC.
+func WithTimestamp(timestamp time.Time) EventOption {
+	return func(e *event) {
+		e.timestamp = timestamp.UTC()
+	}
+}
+
+// WithEventID sets the ID of the event. Otherwise it gets one when
+// emitted inside an environment with an ID generator.
+func WithEventID(id string) EventOption {
+	return func(e *event) {
+		e.id = id
+	}
+}
+
+// WithMetadata adds the passed values to the context of the event.
+// They can be retrieved with ContextValues() or as context values.
+func WithMetadata(values map[interface{}]interface{}) EventOption {
+	return func(e *event) {
+		ctx := e.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		metadata, _ := ctx.Value(contextValuesKey{}).(contextValues)
+		merged := make(contextValues, len(metadata)+len(values))
+		for key, value := range metadata {
+			merged[key] = value
+		}
+		for key, value := range values {
+			ctx = context.WithValue(ctx, key, value)
+			merged[key] = value
+		}
+		e.ctx = context.WithValue(ctx, contextValuesKey{}, merged)
+	}
 }
 
 // NewEvent creates a new event with the given topic and payload.
-func NewEvent(ctx context.Context, topic string, payload interface{}) (Event, error) {
+// If the payload is no Payload it is allocated together with the
+// event. So small payloads with up to four values don't need any
+// additional allocation. Events are not pooled, they are shared
+// by subscribers and may be kept by them. Options allow to set the
+// timestamp, the ID, and metadata. Adapters wrapping foreign
+// messages may also emit own implementations of Event instead.
+func NewEvent(ctx context.Context, topic string, payload interface{}, opts ...EventOption) (Event, error) {
+	ev, err := newEvent(ctx, nil, "", topic, payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 {
+		e := ev.(*event)
+		for _, opt := range opts {
+			opt(e)
+		}
+	}
+	return ev, nil
+}
+
+// newEvent creates a new event. If an environment is passed the
+// event context is bound to its context and the event gets an
+// ID by its generator.
+func newEvent(ctx context.Context, env *environment, emitter, topic string, payload interface{}) (Event, error) {
 	if topic == "" {
 		return nil, errors.New(ErrNoTopic, errorMessages)
 	}
-	p := NewPayload(payload)
-	return &event{
-		ctx:       ctx,
-		timestamp: time.Now().UTC(),
-		topic:     topic,
-		payload:   p,
-	}, nil
+	if env != nil {
+		ctx = withoutProcessTimeout(ctx)
+	}
+	if p, ok := payload.(Payload); ok && env == nil {
+		return &event{
+			ctx:       ctx,
+			timestamp: time.Now().UTC(),
+			topic:     topic,
+			payload:   p,
+			emitter:   emitter,
+		}, nil
+	}
+	e := &eventWithPayload{
+		event: event{
+			ctx:       ctx,
+			timestamp: time.Now().UTC(),
+			topic:     topic,
+			emitter:   emitter,
+		},
+	}
+	if p, ok := payload.(Payload); ok {
+		e.event.payload = p
+	} else {
+		e.p.init(payload)
+		e.event.payload = &e.p
+	}
+	if env != nil {
+		if env.idGenerator != nil {
+			e.event.id = env.idGenerator()
+		}
+		if !isBoundTo(ctx, env.ctx) {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			e.pctx.Context = ctx
+			e.pctx.env = env.ctx
+			if len(env.contextKeys) > 0 {
+				e.pctx.values = collectContextValues(ctx, env.contextKeys)
+			}
+			e.event.ctx = &e.pctx
+		}
+	}
+	return &e.event, nil
+}
+
+// ID implements the Event interface.
+func (e *event) ID() string {
+	return e.id
 }
 
 // Timestamp implements the Event interface.
@@ -84,6 +211,11 @@ func (e *event) Context() context.Context {
 	return e.ctx
 }
 
+// Emitter implements the Event interface.
+func (e *event) Emitter() string {
+	return e.emitter
+}
+
 // String implements the Stringer interface.
 func (e *event) String() string {
 	timeStr := e.timestamp.Format(time.RFC3339Nano)
@@ -94,6 +226,152 @@ func (e *event) String() string {
 	return fmt.Sprintf("<timestamp: %s / topic: '%s' / payload: %s>", timeStr, e.topic, payloadStr)
 }
 
+//--------------------
+// PROCESSING CONTEXT
+//--------------------
+
+// processingContext binds the context of an event to the
+// context of an environment. It carries the values and the
+// deadline of the event context and is done when the event
+// context or the environment context is done.
+type processingContext struct {
+	context.Context
+	env       context.Context
+	causation string
+	values    contextValues
+	once      sync.Once
+	done      chan struct{}
+}
+
+// bindContext returns the context bound to the environment context.
+func bindContext(ctx, envctx context.Context) context.Context {
+	ctx = withoutProcessTimeout(ctx)
+	if isBoundTo(ctx, envctx) {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &processingContext{
+		Context: ctx,
+		env:     envctx,
+	}
+}
+
+// isBoundTo checks if the context is already bound to the
+// environment context.
+func isBoundTo(ctx, envctx context.Context) bool {
+	pctx, ok := ctx.(*processingContext)
+	return ok && pctx.env == envctx
+}
+
+// Done implements the context.Context interface.
+func (c *processingContext) Done() <-chan struct{} {
+	if c.Context.Done() == nil {
+		return c.env.Done()
+	}
+	c.once.Do(func() {
+		c.done = make(chan struct{})
+		// The callback of the context not done first is removed,
+		// so long-living environment contexts don't collect them.
+		var mutex sync.Mutex
+		var closeOnce sync.Once
+		var stopCtx, stopEnv func() bool
+		closeDone := func() {
+			closeOnce.Do(func() { close(c.done) })
+			mutex.Lock()
+			defer mutex.Unlock()
+			stopCtx()
+			stopEnv()
+		}
+		mutex.Lock()
+		stopCtx = context.AfterFunc(c.Context, closeDone)
+		stopEnv = context.AfterFunc(c.env, closeDone)
+		mutex.Unlock()
+	})
+	return c.done
+}
+
+// Value implements the context.Context interface.
+func (c *processingContext) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case causationKey:
+		if c.causation != "" {
+			return c.causation
+		}
+	case contextValuesKey:
+		if c.values != nil {
+			return c.values
+		}
+	}
+	return c.Context.Value(key)
+}
+
+// Err implements the context.Context interface.
+func (c *processingContext) Err() error {
+	select {
+	case <-c.Done():
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		return c.env.Err()
+	default:
+		return nil
+	}
+}
+
+// processingEvent replaces the context of an event emitted
+// from the outside of an environment.
+type processingEvent struct {
+	Event
+	ctx context.Context
+}
+
+// Context implements the Event interface.
+func (e *processingEvent) Context() context.Context {
+	return e.ctx
+}
+
+// emittedEvent replaces the emitter of an event passed on
+// by another cell. Events created without ID get one here
+// if the environment has an ID generator.
+type emittedEvent struct {
+	Event
+	emitter string
+	id      string
+}
+
+// ID implements the Event interface.
+func (e *emittedEvent) ID() string {
+	if e.id != "" {
+		return e.id
+	}
+	return e.Event.ID()
+}
+
+// Emitter implements the Event interface.
+func (e *emittedEvent) Emitter() string {
+	return e.emitter
+}
+
+// adaptedEvent replaces topic and payload of an event, e.g. for
+// commands or transformed subscriptions.
+type adaptedEvent struct {
+	Event
+	topic   string
+	payload Payload
+}
+
+// Topic implements the Event interface.
+func (e *adaptedEvent) Topic() string {
+	return e.topic
+}
+
+// Payload implements the Event interface.
+func (e *adaptedEvent) Payload() Payload {
+	return e.payload
+}
+
 //--------------------
 // EVENT SINK
 //--------------------
@@ -175,8 +453,9 @@ func (s *eventSink) Push(event Event) (int, error) {
 	if s.max > 0 && len(s.events) > s.max {
 		s.events = s.events[1:]
 	}
+	n := len(s.events)
 	s.mutex.Unlock()
-	return len(s.events), s.check()
+	return n, s.check()
 }
 
 // PullFirst implements the EventSink interface.
@@ -14,8 +14,10 @@ package cells_test
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/tideland/golib/audit"
 
@@ -49,6 +51,28 @@ func TestEvent(t *testing.T) {
 	assert.Nil(err)
 }
 
+// TestEventOptions tests the event construction with options.
+func TestEventOptions(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	timestamp := time.Date(2017, time.October, 23, 12, 0, 0, 0, time.Local)
+
+	event, err := cells.NewEvent(nil, "foo", "bar",
+		cells.WithTimestamp(timestamp),
+		cells.WithEventID("event-1"),
+		cells.WithMetadata(map[interface{}]interface{}{"tenant": "a"}),
+		cells.WithMetadata(map[interface{}]interface{}{"request": "r1"}),
+	)
+	assert.Nil(err)
+	assert.Equal(event.Timestamp(), timestamp.UTC())
+	assert.Equal(event.ID(), "event-1")
+	assert.Equal(event.Context().Value("tenant"), "a")
+	assert.Equal(cells.ContextValues(event), map[interface{}]interface{}{
+		"tenant":  "a",
+		"request": "r1",
+	})
+	assert.Equal(event.Payload().GetDefault(nil), "bar")
+}
+
 // TestPayload tests the payload creation and access.
 func TestPayload(t *testing.T) {
 	assert := audit.NewTestingAssertion(t, true)
@@ -108,6 +132,117 @@ func TestPayload(t *testing.T) {
 	assert.Length(plnab, 9)
 }
 
+// TestSmallPayload tests payloads switching from inline values
+// to a map and the allocations of events with small payloads.
+func TestSmallPayload(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	pl := cells.NewPayload(cells.PayloadValues{"a": 1, "b": 2, "c": 3, "d": 4})
+	assert.Length(pl, 4)
+	pl = pl.Apply(cells.PayloadValues{"d": 5, "e": 6})
+	assert.Length(pl, 5)
+	assert.Equal(pl.GetInt("a", 0), 1)
+	assert.Equal(pl.GetInt("d", 0), 5)
+	assert.Equal(pl.GetInt("e", 0), 6)
+	assert.Equal(pl.GetInt("f", 0), 0)
+
+	ctx := context.Background()
+	var value interface{} = 12345
+	allocs := testing.AllocsPerRun(100, func() {
+		cells.NewEvent(ctx, "small", value)
+	})
+	assert.True(allocs <= 1, "allocations per small event")
+}
+
+// TestEmptyAndLazyPayload tests the shared empty payload and
+// the building of lazy payloads with the first access.
+func TestEmptyAndLazyPayload(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	empty := cells.EmptyPayload()
+	assert.Length(empty, 0)
+	assert.True(cells.NewPayload(nil) == empty)
+	assert.Length(empty.Apply(cells.PayloadValues{"a": 1}), 1)
+	assert.Length(empty, 0)
+	allocs := testing.AllocsPerRun(100, func() {
+		cells.EmptyPayload()
+	})
+	assert.Equal(allocs, 0.0)
+
+	builds := 0
+	lazy := cells.LazyPayload(func() cells.PayloadValues {
+		builds++
+		return cells.PayloadValues{"a": 1, "b": "two"}
+	})
+	event, err := cells.NewEvent(context.Background(), "lazy", lazy)
+	assert.Nil(err)
+	assert.Equal(event.Topic(), "lazy")
+	assert.Equal(builds, 0)
+	assert.Equal(event.Payload().GetInt("a", 0), 1)
+	assert.Equal(event.Payload().GetString("b", ""), "two")
+	assert.Length(event.Payload(), 2)
+	assert.Equal(builds, 1)
+
+	lazy = cells.LazyPayload(func() cells.PayloadValues {
+		return nil
+	})
+	assert.Length(lazy, 0)
+	assert.Equal(lazy.GetDefault("none"), "none")
+}
+
+// TestSecurePayload tests sealing and opening of payload values.
+func TestSecurePayload(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	keyRing := cells.NewAEADKeyRing()
+	err := keyRing.AddAESGCMKey("one", []byte("0123456789abcdef"))
+	assert.Nil(err)
+
+	sp := cells.NewSecurePayload(cells.PayloadValues{
+		"user":   "john",
+		"secret": "top-secret",
+		"pin":    1234,
+	}, keyRing)
+	sealed, err := sp.Seal("secret", "pin")
+	assert.Nil(err)
+	assert.Equal(sealed.GetString("user", ""), "john")
+	assert.Equal(sealed.GetString("secret", ""), "")
+	assert.Equal(sealed.GetInt("pin", 0), 0)
+	assert.False(strings.Contains(sealed.String(), "top-secret"))
+
+	secret, err := sealed.Open("secret")
+	assert.Nil(err)
+	assert.Equal(secret, "top-secret")
+	pin, err := sealed.Open("pin")
+	assert.Nil(err)
+	assert.Equal(pin, 1234)
+	_, err = sealed.Open("user")
+	assert.True(cells.IsNotSealedError(err))
+
+	// Rotate the key, old values still can be opened.
+	err = keyRing.AddAESGCMKey("two", []byte("fedcba9876543210"))
+	assert.Nil(err)
+	secret, err = sealed.Open("secret")
+	assert.Nil(err)
+	assert.Equal(secret, "top-secret")
+	resealed, err := sealed.Reseal()
+	assert.Nil(err)
+	assert.Equal(resealed.Get("secret", nil).(cells.SealedValue).KeyID, "two")
+
+	keyRing.RemoveKey("one")
+	_, err = sealed.Open("secret")
+	assert.True(cells.IsOpeningError(err))
+	secret, err = resealed.Open("secret")
+	assert.Nil(err)
+	assert.Equal(secret, "top-secret")
+
+	// Applying keeps the payload secure.
+	applied, ok := resealed.Apply(cells.PayloadValues{"more": true}).(cells.SecurePayload)
+	assert.True(ok)
+	pin, err = applied.Open("pin")
+	assert.Nil(err)
+	assert.Equal(pin, 1234)
+}
+
 // TestPositiveWaitPayload waits for a payload.
 func TestPositiveWaitPayload(t *testing.T) {
 	assert := audit.NewTestingAssertion(t, true)
@@ -164,6 +299,22 @@ func TestWaitPayloadCancel(t *testing.T) {
 	assert.Nil(payload)
 }
 
+// TestInternKey tests the sharing of interned payload keys.
+func TestInternKey(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+
+	// Well-known keys.
+	key := cells.InternKeyBytes([]byte("default"))
+	assert.Equal(key, cells.PayloadDefault)
+	assert.Equal(unsafe.StringData(key), unsafe.StringData(cells.PayloadDefault))
+
+	// Learned keys.
+	first := cells.InternKey(strings.Repeat("temperature", 1))
+	second := cells.InternKeyBytes([]byte("temperature"))
+	assert.Equal(second, "temperature")
+	assert.Equal(unsafe.StringData(second), unsafe.StringData(first))
+}
+
 // TestEventSink tests the simple event sink.
 func TestEventSink(t *testing.T) {
 	assert := audit.NewTestingAssertion(t, true)
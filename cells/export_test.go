@@ -50,6 +50,10 @@ func (ci *CellInsight) ID() string {
 	return ci.c.id
 }
 
+func (ci *CellInsight) InstanceID() string {
+	return ci.c.instanceID
+}
+
 func (ci *CellInsight) EventBufferSize() int {
 	return cap(ci.c.eventc)
 }
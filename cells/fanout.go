@@ -0,0 +1,175 @@
+// Tideland Go Cells - Fan-out Strategies
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// FAN-OUT STRATEGIES
+//--------------------
+
+// FanoutStrategy selects the subscribers receiving an event emitted
+// by a cell out of the IDs of all its subscribers. They are sorted,
+// so strategies can rely on a stable order.
+type FanoutStrategy func(event Event, subscriberIDs []string) []string
+
+// Broadcast returns the default strategy emitting each event to
+// all subscribers.
+func Broadcast() FanoutStrategy {
+	return nil
+}
+
+// AnyOne returns a strategy emitting each event to exactly one of
+// the subscribers, round robin. So subscribers can be used as
+// competing consumers.
+func AnyOne() FanoutStrategy {
+	var next uint64
+	return func(event Event, subscriberIDs []string) []string {
+		if len(subscriberIDs) == 0 {
+			return nil
+		}
+		n := atomic.AddUint64(&next, 1) - 1
+		return subscriberIDs[n%uint64(len(subscriberIDs)):][:1]
+	}
+}
+
+// Sharded returns a strategy emitting each event to the one subscriber
+// its key is hashed to. So all events with the same key, e.g. of one
+// user, are processed by the same subscriber as long as the
+// subscriptions don't change.
+func Sharded(key func(event Event) string) FanoutStrategy {
+	return func(event Event, subscriberIDs []string) []string {
+		if len(subscriberIDs) == 0 {
+			return nil
+		}
+		h := fnv.New32a()
+		h.Write([]byte(key(event)))
+		i := h.Sum32() % uint32(len(subscriberIDs))
+		return subscriberIDs[i : i+1]
+	}
+}
+
+// fanout keeps the strategy of a cell.
+type fanout struct {
+	strategy FanoutStrategy
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// SetFanout implements the Environment interface.
+func (env *environment) SetFanout(id string, strategy FanoutStrategy) error {
+	c, err := env.cells.cell(id)
+	if err != nil {
+		return err
+	}
+	c.fanout.Store(fanout{strategy})
+	return nil
+}
+
+// SetPrimarySubscriber implements the Environment interface.
+func (env *environment) SetPrimarySubscriber(emitterID, subscriberID string) error {
+	c, err := env.cells.cell(emitterID)
+	if err != nil {
+		return err
+	}
+	if subscriberID != "" && !containsID(c.subscriberIDs(), subscriberID) {
+		return errors.New(ErrInvalidID, errorMessages, subscriberID)
+	}
+	c.primary.Store(subscriberID)
+	return nil
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// selectSubscribers returns the IDs of the subscribers the event is
+// emitted to. False means all subscribers.
+func (c *cell) selectSubscribers(event Event) ([]string, bool) {
+	f, ok := c.fanout.Load().(fanout)
+	if !ok || f.strategy == nil {
+		return nil, false
+	}
+	ids := c.subscriberIDs()
+	sort.Strings(ids)
+	return f.strategy(event, ids), true
+}
+
+// subscriberIDs returns the IDs of the subscribers of the cell.
+func (c *cell) subscriberIDs() []string {
+	c.subscribers.mutex.RLock()
+	defer c.subscribers.mutex.RUnlock()
+	return c.subscribers.ids()
+}
+
+// emitPrimaryFirst delivers an event to the primary subscriber and
+// only if it has been accepted offers it to the other subscribers.
+func (c *cell) emitPrimaryFirst(primary string, deliver func(sc *cell, offer bool) error) error {
+	var pc *cell
+	c.subscribers.do(func(sc *cell) error {
+		if sc.id == primary {
+			pc = sc
+		}
+		return nil
+	})
+	if pc != nil {
+		if err := deliver(pc, false); err != nil {
+			return err
+		}
+	}
+	return c.subscribers.do(func(sc *cell) error {
+		if sc == pc {
+			return nil
+		}
+		return deliver(sc, pc != nil)
+	})
+}
+
+// offerEvent enqueues the event if the queue of the cell has
+// capacity. Otherwise it is dropped.
+func (c *cell) offerEvent(event Event) error {
+	if c.env.scheduler != nil {
+		return c.env.scheduler.enqueue(c, event)
+	}
+	if c.inline {
+		return c.processInline(event)
+	}
+	c.enqueueMutex.RLock()
+	defer c.enqueueMutex.RUnlock()
+	c.enqueued()
+	select {
+	case c.eventc <- event:
+	default:
+		c.rejected()
+	}
+	return nil
+}
+
+// containsID checks if the IDs contain the passed one.
+func containsID(ids []string, id string) bool {
+	for _, cid := range ids {
+		if cid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// EOF
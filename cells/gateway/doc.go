@@ -0,0 +1,19 @@
+// Tideland Go Cells - Gateway
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package gateway provides access to the events of a cells
+// environment for clients outside of the process. The SSE handler
+// streams the events emitted by a cell as Server-Sent Events, e.g.
+// for read-only dashboards in browsers.
+//
+//     http.Handle("/events", gateway.NewSSEHandler(env, "alerts", nil))
+//
+// Clients select the topics they are interested in with the query
+// parameter "topic", e.g. "/events?topic=alert&topic=clear".
+package gateway
+
+// EOF
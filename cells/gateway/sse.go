@@ -0,0 +1,164 @@
+// Tideland Go Cells - Gateway - Server-Sent Events
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package gateway
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/codec"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// DefaultKeepAlive is the default interval of keep-alive
+	// comments sent to idle connections.
+	DefaultKeepAlive = 15 * time.Second
+
+	// sseBufferSize is the size of the channel buffer of
+	// a connection.
+	sseBufferSize = 64
+)
+
+//--------------------
+// SSE HANDLER
+//--------------------
+
+// SSEOption configures the SSE handler.
+type SSEOption func(h *sseHandler)
+
+// KeepAlive sets the interval of the keep-alive comments sent to
+// idle connections, so proxies don't close them.
+func KeepAlive(d time.Duration) SSEOption {
+	return func(h *sseHandler) {
+		if d > 0 {
+			h.keepAlive = d
+		}
+	}
+}
+
+// sseHandler streams the events of a cell as Server-Sent Events.
+type sseHandler struct {
+	env       cells.Environment
+	id        string
+	topics    map[string]bool
+	keepAlive time.Duration
+	codec     codec.Codec
+}
+
+// NewSSEHandler creates a handler streaming the events emitted by the
+// cell with the given ID as Server-Sent Events. Only the passed topics
+// are streamed, nil allows all. Each connection can narrow them with
+// the query parameter "topic". The events are sent with their topic as
+// event type, their ID, and their JSON encoding as data.
+func NewSSEHandler(env cells.Environment, id string, topics []string, opts ...SSEOption) http.Handler {
+	h := &sseHandler{
+		env:       env,
+		id:        id,
+		keepAlive: DefaultKeepAlive,
+		codec:     codec.NewJSONCodec(),
+	}
+	if topics != nil {
+		h.topics = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			h.topics[topic] = true
+		}
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	topics, err := h.connectionTopics(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	eventc, cancel, err := h.env.SubscribeChannel(h.id, sseBufferSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-eventc:
+			if !ok {
+				return
+			}
+			if topics != nil && !topics[event.Topic()] {
+				continue
+			}
+			data, err := h.codec.Encode(event)
+			if err != nil {
+				logger.Warningf("SSE handler for %q cannot encode event %q: %v", h.id, event.Topic(), err)
+				continue
+			}
+			if event.ID() != "" {
+				fmt.Fprintf(w, "id: %s\n", event.ID())
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Topic(), data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// connectionTopics returns the topics requested by the connection,
+// restricted to the allowed ones. Nil allows all.
+func (h *sseHandler) connectionTopics(r *http.Request) (map[string]bool, error) {
+	requested := r.URL.Query()["topic"]
+	if len(requested) == 0 {
+		return h.topics, nil
+	}
+	topics := make(map[string]bool, len(requested))
+	for _, topic := range requested {
+		if h.topics != nil && !h.topics[topic] {
+			return nil, fmt.Errorf("topic %q is not available", topic)
+		}
+		topics[topic] = true
+	}
+	return topics, nil
+}
+
+// EOF
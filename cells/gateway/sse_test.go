@@ -0,0 +1,91 @@
+// Tideland Go Cells - Gateway - Unit Tests - Server-Sent Events
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package gateway_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/gateway"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSSEHandler tests streaming events as Server-Sent Events.
+func TestSSEHandler(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("sse-handler")
+	defer env.Stop()
+
+	env.StartCell("alerts", behaviors.NewBroadcasterBehavior())
+	mux := http.NewServeMux()
+	mux.Handle("/alerts", gateway.NewSSEHandler(env, "alerts", []string{"raise", "clear"}, gateway.KeepAlive(20*time.Millisecond)))
+	mux.Handle("/unknown", gateway.NewSSEHandler(env, "unknown", nil))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/unknown")
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusNotFound)
+	resp, err = http.Get(server.URL + "/alerts?topic=secret")
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusBadRequest)
+
+	rctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/alerts?topic=raise", nil)
+	assert.Nil(err)
+	resp, err = http.DefaultClient.Do(req.WithContext(rctx))
+	assert.Nil(err)
+	defer resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusOK)
+	assert.Equal(resp.Header.Get("Content-Type"), "text/event-stream")
+
+	env.EmitNew(ctx, "alerts", "clear", nil)
+	env.EmitNew(ctx, "alerts", "secret", nil)
+	env.EmitNew(ctx, "alerts", "raise", cells.PayloadValues{"level": "high"})
+
+	keepAlive := false
+	var events, data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && (len(events) == 0 || !keepAlive) {
+		line := scanner.Text()
+		switch {
+		case line == ": keep-alive":
+			keepAlive = true
+		case strings.HasPrefix(line, "event: "):
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	assert.True(keepAlive)
+	assert.Equal(events, []string{"raise"})
+	assert.Length(data, 1)
+	assert.Contents("high", data[0])
+}
+
+// EOF
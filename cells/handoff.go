@@ -0,0 +1,105 @@
+// Tideland Go Cells - Handoff
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// HANDOFF
+//--------------------
+
+// replacement requests the replacement of a cell behavior.
+type replacement struct {
+	behavior Behavior
+	donec    chan error
+}
+
+// ReplaceCell implements the Environment interface.
+func (env *environment) ReplaceCell(id string, behavior Behavior) error {
+	c, err := env.cells.cell(id)
+	if err != nil {
+		return err
+	}
+	if err := c.replace(behavior); err != nil {
+		return err
+	}
+	if env.persistence != nil {
+		env.persistence.save(env)
+	}
+	return nil
+}
+
+// replace lets the backend of the cell replace its behavior
+// and waits until it is done.
+func (c *cell) replace(behavior Behavior) error {
+	r := &replacement{
+		behavior: behavior,
+		donec:    make(chan error, 1),
+	}
+	select {
+	case c.replacec <- r:
+	case <-c.loop.IsStopping():
+		return errors.New(ErrInactive, errorMessages, c.id)
+	}
+	select {
+	case err := <-r.donec:
+		return err
+	case <-c.loop.IsStopping():
+		return errors.New(ErrInactive, errorMessages, c.id)
+	}
+}
+
+// handoff initializes the next behavior, lets it take over the
+// state of the current one, and terminates the current one. It is
+// called by the backend between the processing of two events.
+func (c *cell) handoff(next Behavior) error {
+	if c.env.scheduler != nil {
+		// Don't replace the behavior while it is processing.
+		c.env.scheduler.running.Lock()
+		defer c.env.scheduler.running.Unlock()
+	}
+	prev := c.behavior
+	if err := next.Init(c); err != nil {
+		return errors.Annotate(err, ErrCellInit, errorMessages, c.id)
+	}
+	if bh, ok := next.(BehaviorHandoff); ok {
+		if err := bh.Handoff(prev); err != nil {
+			next.Terminate()
+			return errors.Annotate(err, ErrHandoff, errorMessages, c.id)
+		}
+	}
+	if err := prev.Terminate(); err != nil {
+		logger.Errorf("cell '%s' terminated replaced behavior with error: %v", c.id, err)
+	}
+	c.behaviorMutex.Lock()
+	c.behavior = next
+	c.behaviorMutex.Unlock()
+	logger.Infof("cell '%s' handed off to new behavior", c.id)
+	return c.EmitNew(context.Background(), TopicHandoffCompleted, PayloadValues{
+		PayloadHandoffCell: c.id,
+	})
+}
+
+// currentBehavior returns the behavior of the cell for
+// the access from outside of its backend.
+func (c *cell) currentBehavior() Behavior {
+	c.behaviorMutex.RLock()
+	defer c.behaviorMutex.RUnlock()
+	return c.behavior
+}
+
+// EOF
@@ -0,0 +1,135 @@
+// Tideland Go Cells - ID Generation
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// crockford is the alphabet of the Crockford base32 encoding used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+//--------------------
+// ID GENERATOR
+//--------------------
+
+// IDGenerator returns a new unique ID with each call. It has
+// to be safe for concurrent use.
+type IDGenerator func() string
+
+// WithIDGenerator sets the generator for the IDs of the events
+// emitted inside the environment, of the cell instances, and of
+// the environment itself if no ID is passed. Without a generator
+// events have no ID.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(env *environment) {
+		env.idGenerator = gen
+	}
+}
+
+// NewULIDGenerator creates a generator of ULIDs. These are 26
+// characters long, lexically sortable by their creation time in
+// milliseconds, and monotonic inside the same millisecond.
+func NewULIDGenerator() IDGenerator {
+	var mutex sync.Mutex
+	var last uint64
+	var entropy [10]byte
+	return func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		if ms <= last {
+			// Same or earlier millisecond, increment entropy.
+			ms = last
+			for i := len(entropy) - 1; i >= 0; i-- {
+				entropy[i]++
+				if entropy[i] != 0 {
+					break
+				}
+			}
+		} else {
+			rand.Read(entropy[:])
+		}
+		last = ms
+		var data [16]byte
+		data[0] = byte(ms >> 40)
+		data[1] = byte(ms >> 32)
+		data[2] = byte(ms >> 24)
+		data[3] = byte(ms >> 16)
+		data[4] = byte(ms >> 8)
+		data[5] = byte(ms)
+		copy(data[6:], entropy[:])
+		return encodeULID(data)
+	}
+}
+
+// encodeULID encodes the 128 bits of a ULID in Crockford base32.
+func encodeULID(data [16]byte) string {
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+	var id [26]byte
+	for i := 25; i >= 0; i-- {
+		id[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
+
+// NewUUIDv7Generator creates a generator of version 7 UUIDs. These
+// contain the creation time in milliseconds followed by a counter
+// and random bits, so they are sortable by their creation time.
+func NewUUIDv7Generator() IDGenerator {
+	var mutex sync.Mutex
+	var last uint64
+	var counter uint16
+	return func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var data [16]byte
+		rand.Read(data[6:])
+		ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		if ms <= last {
+			// Same or earlier millisecond, increment counter
+			// and move into the next one on overflow.
+			ms = last
+			counter++
+			if counter > 0x0fff {
+				ms++
+				counter = 0
+			}
+		} else {
+			counter = binary.BigEndian.Uint16(data[6:8]) & 0x07ff
+		}
+		last = ms
+		data[0] = byte(ms >> 40)
+		data[1] = byte(ms >> 32)
+		data[2] = byte(ms >> 24)
+		data[3] = byte(ms >> 16)
+		data[4] = byte(ms >> 8)
+		data[5] = byte(ms)
+		data[6] = 0x70 | byte(counter>>8)
+		data[7] = byte(counter)
+		data[8] = 0x80 | data[8]&0x3f
+		return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16])
+	}
+}
+
+// EOF
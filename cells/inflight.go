@@ -0,0 +1,78 @@
+// Tideland Go Cells - In-Flight
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/identifier"
+	"github.com/tideland/golib/monitoring"
+)
+
+//--------------------
+// IN-FLIGHT
+//--------------------
+
+// inFlight limits and measures the external calls of a cell.
+type inFlight struct {
+	slots      chan struct{}
+	queueID    string
+	serviceID  string
+	inFlightID string
+}
+
+// newInFlight creates the unlimited in-flight control of a cell.
+func newInFlight(measuringID string) *inFlight {
+	return &inFlight{
+		queueID:    identifier.Identifier(measuringID, "in-flight", "queue"),
+		serviceID:  identifier.Identifier(measuringID, "in-flight", "service"),
+		inFlightID: identifier.Identifier(measuringID, "in-flight"),
+	}
+}
+
+// MaxInFlight limits the number of concurrent external calls a
+// behavior does with Cell.InFlight() to n. Further calls wait
+// for a free slot. The waiting is measured as queue time, the
+// call itself as service time.
+func MaxInFlight(n int) CellOption {
+	return func(c *cell) {
+		if n > 0 {
+			c.inFlight.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// InFlight implements the Cell interface.
+func (c *cell) InFlight(ctx context.Context, call func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.inFlight.slots != nil {
+		queueing := monitoring.BeginMeasuring(c.inFlight.queueID)
+		select {
+		case c.inFlight.slots <- struct{}{}:
+			queueing.EndMeasuring()
+		case <-ctx.Done():
+			queueing.EndMeasuring()
+			return errors.New(ErrTimeout, errorMessages, "waiting for in-flight slot")
+		}
+		defer func() { <-c.inFlight.slots }()
+	}
+	monitoring.IncrVariable(c.inFlight.inFlightID)
+	defer monitoring.DecrVariable(c.inFlight.inFlightID)
+	serving := monitoring.BeginMeasuring(c.inFlight.serviceID)
+	defer serving.EndMeasuring()
+	return call()
+}
+
+// EOF
@@ -0,0 +1,76 @@
+// Tideland Go Cells - Inline Cells
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// Inline lets events emitted to the cell be processed synchronously
+// in the goroutine of the emitter, without queue and goroutine hop.
+// It is intended for trivial and stateless transforms where the hop
+// dominates the latency. As several emitters may call the behavior
+// at the same time it has to be safe for concurrent calls of
+// ProcessEvent(). Panics are passed to Recover() of the behavior,
+// errors not handled by the error policy stop the cell and are
+// returned to the emitter.
+func Inline() CellOption {
+	return func(c *cell) {
+		c.inline = true
+	}
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// processInline processes the event in the goroutine of the caller.
+func (c *cell) processInline(event Event) (err error) {
+	// Wait while the environment is paused.
+	select {
+	case <-c.loop.IsStopping():
+	case <-c.env.gate():
+	}
+	select {
+	case <-c.loop.IsStopping():
+		return errors.New(ErrInactive, errorMessages, c.id)
+	default:
+	}
+	c.enqueued()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warningf("recovering inline cell %q after error: %v", c.id, r)
+			if rerr := c.behavior.Recover(r); rerr != nil {
+				err = c.stopInline(event, rerr)
+			}
+		}
+	}()
+	if perr := c.align(event, c.process, nil); perr != nil {
+		return c.stopInline(event, perr)
+	}
+	return nil
+}
+
+// stopInline stops the inline cell after an error and returns
+// it to the emitter.
+func (c *cell) stopInline(event Event, err error) error {
+	logger.Errorf("cell %q processed event %q with error: %v", c.id, event.Topic(), err)
+	c.loop.Kill(err)
+	return err
+}
+
+// EOF
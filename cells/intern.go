@@ -0,0 +1,121 @@
+// Tideland Go Cells - Key Interning
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// maxInternedKeys limits the number of keys learned by the
+// interning table, so keys containing e.g. IDs cannot let it
+// grow unbounded.
+const maxInternedKeys = 4096
+
+//--------------------
+// KEY INTERNING
+//--------------------
+
+// internedKeys is the interning table, initialized with the
+// well-known payload keys.
+var internedKeys = func() *keyTable {
+	kt := &keyTable{
+		keys: make(map[string]string),
+	}
+	for _, key := range []string{
+		PayloadCellError,
+		PayloadCellErrorID,
+		PayloadCellErrorTopic,
+		PayloadCellStalledID,
+		PayloadCellStalledIdle,
+		PayloadCellStalledQueued,
+		PayloadCellStalledRestarted,
+		PayloadCellStalledStack,
+		PayloadCommand,
+		PayloadCommandArgs,
+		PayloadCommandReplyWaiter,
+		PayloadDefault,
+		PayloadHandoffCell,
+		PayloadSlowTimeout,
+		PayloadSlowTopic,
+		PayloadTickerID,
+		PayloadTickerTime,
+	} {
+		kt.keys[key] = key
+	}
+	return kt
+}()
+
+// keyTable maps keys to their canonical instance.
+type keyTable struct {
+	mutex sync.RWMutex
+	keys  map[string]string
+}
+
+// lookup returns the canonical instance of the key.
+func (kt *keyTable) lookup(key string) (string, bool) {
+	kt.mutex.RLock()
+	defer kt.mutex.RUnlock()
+	interned, ok := kt.keys[key]
+	return interned, ok
+}
+
+// lookupBytes returns the canonical instance of the key bytes.
+// The conversion inside the map index doesn't allocate.
+func (kt *keyTable) lookupBytes(key []byte) (string, bool) {
+	kt.mutex.RLock()
+	defer kt.mutex.RUnlock()
+	interned, ok := kt.keys[string(key)]
+	return interned, ok
+}
+
+// learn adds the key if the table is not yet full and returns
+// its canonical instance.
+func (kt *keyTable) learn(key string) string {
+	kt.mutex.Lock()
+	defer kt.mutex.Unlock()
+	if interned, ok := kt.keys[key]; ok {
+		return interned
+	}
+	if len(kt.keys) < maxInternedKeys {
+		kt.keys[key] = key
+	}
+	return key
+}
+
+// InternKey returns the canonical instance of a payload key, so
+// payloads of many events, e.g. decoded ones, share their key
+// strings instead of keeping copies. Well-known keys of the
+// package are interned from the start, others are learned until
+// the table reached its limit. Behaviors can intern their own
+// keys during initialization.
+func InternKey(key string) string {
+	if interned, ok := internedKeys.lookup(key); ok {
+		return interned
+	}
+	return internedKeys.learn(key)
+}
+
+// InternKeyBytes works like InternKey but takes the key as bytes,
+// e.g. while decoding. Interned keys are returned without
+// allocating a new string.
+func InternKeyBytes(key []byte) string {
+	if interned, ok := internedKeys.lookupBytes(key); ok {
+		return interned
+	}
+	return internedKeys.learn(string(key))
+}
+
+// EOF
@@ -0,0 +1,25 @@
+// Tideland Go Cells - Lineage
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package lineage tracks the ancestry of events inside an environment.
+// A Tracker observes all emitted events and keeps a bounded graph of
+// their IDs and causation IDs. So the chain of events and cells which
+// led to an output, e.g. an alert, can be retrieved for auditing.
+//
+//     tracker := lineage.NewTracker(100000)
+//     env := cells.NewEnvironment("alerting",
+//         cells.WithIDGenerator(cells.NewULIDGenerator()),
+//         cells.WithObserver(tracker.Observe),
+//     )
+//     ...
+//     steps, err := tracker.TraceBack(alert.ID())
+//
+// The environment needs an ID generator, and behaviors have to emit
+// new events with the context of the processed ones.
+package lineage
+
+// EOF
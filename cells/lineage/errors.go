@@ -0,0 +1,41 @@
+// Tideland Go Cells - Lineage - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package lineage
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrUnknownEvent = iota + 1
+)
+
+var errorMessages = errors.Messages{
+	ErrUnknownEvent: "event %q is unknown or already evicted",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsUnknownEventError checks if an error signals an event
+// not tracked by the tracker.
+func IsUnknownEventError(err error) bool {
+	return errors.IsError(err, ErrUnknownEvent)
+}
+
+// EOF
@@ -0,0 +1,121 @@
+// Tideland Go Cells - Lineage
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package lineage
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// STEP
+//--------------------
+
+// Step describes one event in the lineage of another one. Cells
+// contains the emitting cell and those which forwarded the event.
+type Step struct {
+	EventID     string
+	CausationID string
+	Topic       string
+	Cells       []string
+	Timestamp   time.Time
+}
+
+//--------------------
+// TRACKER
+//--------------------
+
+// Tracker keeps a bounded graph of the ancestry of events. When
+// the maximum number of events is reached the oldest ones are
+// evicted.
+type Tracker struct {
+	mutex sync.RWMutex
+	steps map[string]*Step
+	ids   []string
+	next  int
+}
+
+// NewTracker creates a tracker for the lineage of up to max events.
+func NewTracker(max int) *Tracker {
+	if max < 1 {
+		max = 1
+	}
+	return &Tracker{
+		steps: make(map[string]*Step),
+		ids:   make([]string, max),
+	}
+}
+
+// Observe records an emitted event. It is intended to be set as
+// cells.Observer of an environment. Events without ID are ignored.
+func (t *Tracker) Observe(event cells.Event) {
+	id := event.ID()
+	if id == "" {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if step, ok := t.steps[id]; ok {
+		// Event is forwarded by another cell.
+		if last := step.Cells[len(step.Cells)-1]; last != event.Emitter() {
+			step.Cells = append(step.Cells, event.Emitter())
+		}
+		return
+	}
+	if evicted := t.ids[t.next]; evicted != "" {
+		delete(t.steps, evicted)
+	}
+	t.ids[t.next] = id
+	t.next = (t.next + 1) % len(t.ids)
+	t.steps[id] = &Step{
+		EventID:     id,
+		CausationID: cells.CausationID(event),
+		Topic:       event.Topic(),
+		Cells:       []string{event.Emitter()},
+		Timestamp:   event.Timestamp(),
+	}
+}
+
+// TraceBack returns the lineage of the event with the passed ID,
+// starting with the event itself and ending with the oldest known
+// ancestor.
+func (t *Tracker) TraceBack(eventID string) ([]Step, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	step, ok := t.steps[eventID]
+	if !ok {
+		return nil, errors.New(ErrUnknownEvent, errorMessages, eventID)
+	}
+	var steps []Step
+	visited := map[string]bool{}
+	for ok && !visited[step.EventID] {
+		visited[step.EventID] = true
+		copied := *step
+		copied.Cells = append([]string{}, step.Cells...)
+		steps = append(steps, copied)
+		step, ok = t.steps[step.CausationID]
+	}
+	return steps, nil
+}
+
+// Len returns the number of tracked events.
+func (t *Tracker) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.steps)
+}
+
+// EOF
@@ -0,0 +1,112 @@
+// Tideland Go Cells - Lineage - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package lineage_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/lineage"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestTraceBack tests retrieving the lineage of an event.
+func TestTraceBack(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	tracker := lineage.NewTracker(100)
+	env := cells.NewEnvironment("lineage",
+		cells.WithIDGenerator(cells.NewULIDGenerator()),
+		cells.WithObserver(tracker.Observe),
+	)
+	defer env.Stop()
+
+	mapper := func(id string, event cells.Event) (cells.Event, error) {
+		return cells.NewEvent(event.Context(), "alert", event.Payload())
+	}
+	filter := func(event cells.Event) (bool, error) {
+		return event.Payload().GetInt(cells.PayloadDefault, 0) > 10, nil
+	}
+	env.StartCell("filter", behaviors.NewFilterBehavior(filter))
+	env.StartCell("mapper", behaviors.NewMapperBehavior(mapper))
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("filter", "mapper")
+	env.Subscribe("mapper", "collector")
+
+	env.EmitNew(ctx, "filter", "value", 5)
+	env.EmitNew(ctx, "filter", "value", 15)
+	err := env.Barrier(ctx)
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 1)
+	alert, ok := accessor.PeekFirst()
+	assert.True(ok)
+	assert.NotEmpty(alert.ID())
+
+	steps, err := tracker.TraceBack(alert.ID())
+	assert.Nil(err)
+	assert.Length(steps, 2)
+	assert.Equal(steps[0].EventID, alert.ID())
+	assert.Equal(steps[0].Topic, "alert")
+	assert.Equal(steps[0].Cells, []string{"mapper", "collector"})
+	assert.Equal(steps[0].CausationID, steps[1].EventID)
+	assert.Equal(steps[1].Topic, "value")
+	assert.Equal(steps[1].Cells, []string{env.ID(), "filter"})
+	assert.Equal(steps[1].CausationID, "")
+
+	_, err = tracker.TraceBack("unknown")
+	assert.True(lineage.IsUnknownEventError(err))
+}
+
+// TestTrackerBounds tests the eviction of the oldest events.
+func TestTrackerBounds(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	tracker := lineage.NewTracker(3)
+	env := cells.NewEnvironment("lineage-bounds",
+		cells.WithIDGenerator(cells.NewULIDGenerator()),
+		cells.WithObserver(tracker.Observe),
+	)
+	defer env.Stop()
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	for i := 0; i < 5; i++ {
+		env.EmitNew(ctx, "collector", "value", i)
+	}
+	err := env.Barrier(ctx)
+	assert.Nil(err)
+	assert.Equal(tracker.Len(), 3)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	first, ok := accessor.PeekFirst()
+	assert.True(ok)
+	_, err = tracker.TraceBack(first.ID())
+	assert.True(lineage.IsUnknownEventError(err))
+	last, ok := accessor.PeekLast()
+	assert.True(ok)
+	steps, err := tracker.TraceBack(last.ID())
+	assert.Nil(err)
+	assert.Length(steps, 1)
+}
+
+// EOF
@@ -0,0 +1,46 @@
+// Tideland Go Cells - Options
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// ENVIRONMENT OPTIONS
+//--------------------
+
+// Option allows to configure an environment. Options are passed
+// to NewEnvironment() together with the parts of the ID.
+type Option func(env *environment)
+
+// CellOption allows to configure a cell. Options are passed
+// to Environment.StartCell() together with the behavior.
+type CellOption func(c *cell)
+
+// FanoutOrder defines the guarantee for the order in which the
+// subscribers of one cell receive its emitted events.
+type FanoutOrder int
+
+const (
+	// UnorderedFanout delivers the events of concurrent emits
+	// without any coordination. So subscribers of the same cell
+	// may observe them in different orders.
+	UnorderedFanout FanoutOrder = iota
+
+	// OrderedFanout serializes the delivery of all emits of one
+	// cell. So all subscribers observe its events in the same
+	// order. Concurrent emits have to wait for each other.
+	OrderedFanout
+)
+
+// WithFanoutOrder sets the order guarantee for the delivery of
+// emitted events to subscribers. Default is UnorderedFanout.
+func WithFanoutOrder(order FanoutOrder) Option {
+	return func(env *environment) {
+		env.fanoutOrder = order
+	}
+}
+
+// EOF
@@ -0,0 +1,128 @@
+// Tideland Go Cells - Panic Reports
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// RedactedValue replaces the values of redacted payload keys
+// in panic reports.
+const RedactedValue = "[REDACTED]"
+
+//--------------------
+// PANIC REPORTS
+//--------------------
+
+// PanicRedactor returns the value of a payload key of an event as
+// it is reported after a panic, e.g. RedactedValue for secrets.
+type PanicRedactor func(key string, value interface{}) interface{}
+
+// RedactKeys returns a redactor replacing the values of the
+// passed payload keys by RedactedValue.
+func RedactKeys(keys ...string) PanicRedactor {
+	redacted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		redacted[key] = true
+	}
+	return func(key string, value interface{}) interface{} {
+		if redacted[key] {
+			return RedactedValue
+		}
+		return value
+	}
+}
+
+// panicReports contains the configuration of the panic reports.
+type panicReports struct {
+	redact PanicRedactor
+	ids    []string
+}
+
+// WithPanicReports lets the environment report panics of behaviors
+// while processing an event. The report is emitted with the topic
+// TopicCellPanic to the supervisor set with WithSupervisor() and to
+// the cells with the passed IDs, e.g. one collecting dead letters.
+// Its payload contains the cell ID, the reason, the stack trace, and
+// the topic, ID, emitter, and payload of the event. The values of the
+// payload are passed through the redactor if one is set. Afterwards
+// the cell recovers like without reporting.
+func WithPanicReports(redact PanicRedactor, ids ...string) Option {
+	return func(env *environment) {
+		env.panicReports = &panicReports{
+			redact: redact,
+			ids:    ids,
+		}
+	}
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// reportPanic emits the report of a panic while processing
+// the event.
+func (c *cell) reportPanic(event Event, reason interface{}, stack []byte) {
+	pr := c.env.panicReports
+	payload := PayloadValues{}
+	if event.Payload() != nil {
+		event.Payload().Do(func(key string, value interface{}) error {
+			if pr.redact != nil {
+				value = pr.redact(key, value)
+			}
+			payload[key] = value
+			return nil
+		})
+	}
+	report := PayloadValues{
+		PayloadCellPanicID:      c.id,
+		PayloadCellPanicReason:  fmt.Sprintf("%v", reason),
+		PayloadCellPanicStack:   string(stack),
+		PayloadCellPanicTopic:   event.Topic(),
+		PayloadCellPanicEventID: event.ID(),
+		PayloadCellPanicEmitter: event.Emitter(),
+		PayloadCellPanicPayload: payload,
+	}
+	ids := pr.ids
+	if c.env.supervisor != "" {
+		ids = append([]string{c.env.supervisor}, ids...)
+	}
+	for _, id := range ids {
+		if id == c.id {
+			continue
+		}
+		if err := c.env.EmitNew(context.Background(), id, TopicCellPanic, report); err != nil {
+			logger.Errorf("cell %q cannot report panic to %q: %v", c.id, id, err)
+		}
+	}
+}
+
+// recoverPanic reports a panic while processing the event and
+// lets it continue. It has to be deferred directly.
+func (c *cell) recoverPanic(event Event) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	defer panic(r)
+	c.reportPanic(event, r, debug.Stack())
+}
+
+// EOF
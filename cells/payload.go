@@ -96,9 +96,23 @@ type WaiterPayload interface {
 	GetWaiter() PayloadWaiter
 }
 
-// payload implements the Payload interface.
+// smallPayloadSlots is the number of values a payload stores
+// inline before it switches to a map.
+const smallPayloadSlots = 4
+
+// payloadSlot stores one inline value of a payload.
+type payloadSlot struct {
+	key   string
+	value interface{}
+}
+
+// payload implements the Payload interface. Small payloads keep
+// their values in the inline slots, only larger ones allocate
+// a map.
 type payload struct {
 	waiter PayloadWaiter
+	slots  [smallPayloadSlots]payloadSlot
+	n      int
 	values PayloadValues
 	err    error
 }
@@ -107,51 +121,122 @@ type payload struct {
 // values. In case of a Payload this is used directly, in
 // case of a PayloadValues or a map[string]interface{} their
 // content is used, and when passing any other type the
-// value is stored with the key cells.PayloadDefault.
+// value is stored with the key cells.PayloadDefault. Nil
+// returns the EmptyPayload().
 func NewPayload(values interface{}) Payload {
 	if p, ok := values.(Payload); ok {
 		return p
 	}
+	if values == nil {
+		return emptyPayload
+	}
+	p := &payload{}
+	p.init(values)
+	return p
+}
+
+// NewPayloadWaiter creates a new payload with an explicit waiter.
+func NewWaiterPayload() (WaiterPayload, PayloadWaiter) {
 	p := &payload{
-		values: PayloadValues{},
+		waiter: NewPayloadWaiter(),
 	}
+	return p, p.waiter
+}
+
+// emptyPayload is the shared payload without values.
+var emptyPayload = &payload{}
+
+// EmptyPayload returns the shared payload without values. Payloads
+// are write-once, so it can be used for all events without values
+// and avoids an allocation per event.
+func EmptyPayload() Payload {
+	return emptyPayload
+}
+
+// init sets the passed values of a new payload.
+func (p *payload) init(values interface{}) {
 	if values == nil {
-		return p
+		return
 	}
 	switch vs := values.(type) {
 	case error:
 		p.err = vs
 	case PayloadValues:
-		for key, value := range vs {
-			p.values[key] = value
-		}
+		p.setAll(vs)
 	case map[string]interface{}:
-		for key, value := range vs {
-			p.values[key] = value
-		}
+		p.setAll(vs)
 	default:
-		p.values[PayloadDefault] = values
+		p.set(PayloadDefault, values)
 	}
-	return p
 }
 
-// NewPayloadWaiter creates a new payload with an explicit waiter.
-func NewWaiterPayload() (WaiterPayload, PayloadWaiter) {
-	p := &payload{
-		waiter: NewPayloadWaiter(),
-		values: PayloadValues{},
+// set stores one value. It uses the inline slots as long as
+// possible.
+func (p *payload) set(key string, value interface{}) {
+	if p.values != nil {
+		p.values[key] = value
+		return
 	}
-	return p, p.waiter
+	for i := 0; i < p.n; i++ {
+		if p.slots[i].key == key {
+			p.slots[i].value = value
+			return
+		}
+	}
+	if p.n < smallPayloadSlots {
+		p.slots[p.n] = payloadSlot{key, value}
+		p.n++
+		return
+	}
+	p.values = make(PayloadValues, smallPayloadSlots*2)
+	for i := 0; i < p.n; i++ {
+		p.values[p.slots[i].key] = p.slots[i].value
+		p.slots[i] = payloadSlot{}
+	}
+	p.n = 0
+	p.values[key] = value
+}
+
+// setAll stores all passed values.
+func (p *payload) setAll(values map[string]interface{}) {
+	if len(values) > smallPayloadSlots && p.values == nil {
+		p.values = make(PayloadValues, len(values)+p.n)
+		for i := 0; i < p.n; i++ {
+			p.values[p.slots[i].key] = p.slots[i].value
+			p.slots[i] = payloadSlot{}
+		}
+		p.n = 0
+	}
+	for key, value := range values {
+		p.set(key, value)
+	}
+}
+
+// get retrieves one value.
+func (p *payload) get(key string) (interface{}, bool) {
+	if p.values != nil {
+		value, ok := p.values[key]
+		return value, ok
+	}
+	for i := 0; i < p.n; i++ {
+		if p.slots[i].key == key {
+			return p.slots[i].value, true
+		}
+	}
+	return nil, false
 }
 
 // Len implementes the Payload interface.
 func (p *payload) Len() int {
-	return len(p.values)
+	if p.values != nil {
+		return len(p.values)
+	}
+	return p.n
 }
 
 // Get implementes the Payload interface.
 func (p *payload) Get(key string, dv interface{}) interface{} {
-	value, ok := p.values[key]
+	value, ok := p.get(key)
 	if !ok {
 		return dv
 	}
@@ -231,16 +316,25 @@ func (p *payload) GetWaiter() PayloadWaiter {
 // Keys is specified on the Payload interface.
 func (p *payload) Keys() []string {
 	keys := []string{}
-	for key := range p.values {
+	p.Do(func(key string, value interface{}) error {
 		keys = append(keys, key)
-	}
+		return nil
+	})
 	return keys
 }
 
 // Do implementes the Payload interface.
 func (p *payload) Do(f func(key string, value interface{}) error) error {
-	for key, value := range p.values {
-		if err := f(key, value); err != nil {
+	if p.values != nil {
+		for key, value := range p.values {
+			if err := f(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i < p.n; i++ {
+		if err := f(p.slots[i].key, p.slots[i].value); err != nil {
 			return err
 		}
 	}
@@ -251,28 +345,24 @@ func (p *payload) Do(f func(key string, value interface{}) error) error {
 func (p *payload) Apply(values interface{}) Payload {
 	applied := &payload{
 		waiter: p.waiter,
-		values: PayloadValues{},
 		err:    p.err,
 	}
-	for key, value := range p.values {
-		applied.values[key] = value
-	}
+	p.Do(func(key string, value interface{}) error {
+		applied.set(key, value)
+		return nil
+	})
 	switch vs := values.(type) {
 	case Payload:
 		vs.Do(func(key string, value interface{}) error {
-			applied.values[key] = value
+			applied.set(key, value)
 			return nil
 		})
 	case PayloadValues:
-		for key, value := range vs {
-			applied.values[key] = value
-		}
+		applied.setAll(vs)
 	case map[string]interface{}:
-		for key, value := range vs {
-			applied.values[key] = value
-		}
+		applied.setAll(vs)
 	default:
-		applied.values[PayloadDefault] = values
+		applied.set(PayloadDefault, values)
 	}
 	return applied
 }
@@ -285,12 +375,117 @@ func (p *payload) Error() error {
 // String implements the fmt.Stringer interface.
 func (p *payload) String() string {
 	ps := []string{}
-	for key, value := range p.values {
+	p.Do(func(key string, value interface{}) error {
 		ps = append(ps, fmt.Sprintf("<%q: %v>", key, value))
-	}
+		return nil
+	})
 	return strings.Join(ps, ", ")
 }
 
+//--------------------
+// LAZY PAYLOAD
+//--------------------
+
+// lazyPayload builds its values with the first access.
+type lazyPayload struct {
+	once    sync.Once
+	build   func() PayloadValues
+	payload Payload
+}
+
+// LazyPayload creates a payload whose values are built by the passed
+// function only with the first access. So expensive payloads are not
+// built for events most subscribers filter out by their topic alone.
+// The function is called at most once, also for concurrent accesses.
+func LazyPayload(build func() PayloadValues) Payload {
+	return &lazyPayload{
+		build: build,
+	}
+}
+
+// values returns the payload built at the first call.
+func (p *lazyPayload) values() Payload {
+	p.once.Do(func() {
+		values := p.build()
+		if len(values) == 0 {
+			p.payload = emptyPayload
+			return
+		}
+		p.payload = NewPayload(values)
+	})
+	return p.payload
+}
+
+// Len implements the Payload interface.
+func (p *lazyPayload) Len() int {
+	return p.values().Len()
+}
+
+// Get implements the Payload interface.
+func (p *lazyPayload) Get(key string, dv interface{}) interface{} {
+	return p.values().Get(key, dv)
+}
+
+// GetDefault implements the Payload interface.
+func (p *lazyPayload) GetDefault(dv interface{}) interface{} {
+	return p.values().GetDefault(dv)
+}
+
+// GetBool implements the Payload interface.
+func (p *lazyPayload) GetBool(key string, dv bool) bool {
+	return p.values().GetBool(key, dv)
+}
+
+// GetInt implements the Payload interface.
+func (p *lazyPayload) GetInt(key string, dv int) int {
+	return p.values().GetInt(key, dv)
+}
+
+// GetFloat64 implements the Payload interface.
+func (p *lazyPayload) GetFloat64(key string, dv float64) float64 {
+	return p.values().GetFloat64(key, dv)
+}
+
+// GetString implements the Payload interface.
+func (p *lazyPayload) GetString(key, dv string) string {
+	return p.values().GetString(key, dv)
+}
+
+// GetTime implements the Payload interface.
+func (p *lazyPayload) GetTime(key string, dv time.Time) time.Time {
+	return p.values().GetTime(key, dv)
+}
+
+// GetDuration implements the Payload interface.
+func (p *lazyPayload) GetDuration(key string, dv time.Duration) time.Duration {
+	return p.values().GetDuration(key, dv)
+}
+
+// Keys implements the Payload interface.
+func (p *lazyPayload) Keys() []string {
+	return p.values().Keys()
+}
+
+// Do implements the Payload interface.
+func (p *lazyPayload) Do(f func(key string, value interface{}) error) error {
+	return p.values().Do(f)
+}
+
+// Apply implements the Payload interface.
+func (p *lazyPayload) Apply(values interface{}) Payload {
+	return p.values().Apply(values)
+}
+
+// Error implements the Payload interface.
+func (p *lazyPayload) Error() error {
+	return p.values().Error()
+}
+
+// String implements the fmt.Stringer interface.
+func (p *lazyPayload) String() string {
+	return p.values().String()
+}
+
 // HasWaiterPayload returns a potential waiter payload of
 // an event. In case the payload is no waiter payload nil
 // and false are returned.
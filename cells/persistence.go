@@ -0,0 +1,392 @@
+// Tideland Go Cells - Topology Persistence
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// TOPOLOGY
+//--------------------
+
+// BehaviorDescriptor is an additional optional interface for a behavior
+// to describe its kind and configuration. Only cells with behaviors
+// implementing it are stored as part of a persistent topology, they
+// are re-created by a BehaviorFactory.
+type BehaviorDescriptor interface {
+	Descriptor() (kind string, config map[string]interface{})
+}
+
+// BehaviorFactory creates a behavior based on its kind and
+// configuration.
+type BehaviorFactory func(kind string, config map[string]interface{}) (Behavior, error)
+
+// TopologyCell describes one cell of a persistent topology.
+type TopologyCell struct {
+	ID     string                 `json:"id"`
+	Kind   string                 `json:"kind"`
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+// TopologySubscription describes the subscribers of one emitter.
+type TopologySubscription struct {
+	Emitter     string   `json:"emitter"`
+	Subscribers []string `json:"subscribers"`
+}
+
+// Topology contains the describable cells of an environment
+// and all subscriptions.
+type Topology struct {
+	Cells         []TopologyCell         `json:"cells"`
+	Subscriptions []TopologySubscription `json:"subscriptions"`
+}
+
+// persistentTopology returns the topology of the registry. Cells
+// not implementing BehaviorDescriptor are only part of the
+// subscriptions.
+func (r *registry) persistentTopology() *Topology {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	t := &Topology{}
+	for id, rc := range r.cells {
+		if bd, ok := rc.currentBehavior().(BehaviorDescriptor); ok {
+			kind, config := bd.Descriptor()
+			t.Cells = append(t.Cells, TopologyCell{
+				ID:     id,
+				Kind:   kind,
+				Config: config,
+			})
+		}
+		subscribers := rc.subscribers.ids()
+		if len(subscribers) > 0 {
+			sort.Strings(subscribers)
+			t.Subscriptions = append(t.Subscriptions, TopologySubscription{
+				Emitter:     id,
+				Subscribers: subscribers,
+			})
+		}
+	}
+	sort.Slice(t.Cells, func(i, j int) bool {
+		return t.Cells[i].ID < t.Cells[j].ID
+	})
+	sort.Slice(t.Subscriptions, func(i, j int) bool {
+		return t.Subscriptions[i].Emitter < t.Subscriptions[j].Emitter
+	})
+	return t
+}
+
+//--------------------
+// TOPOLOGY STORE
+//--------------------
+
+// TopologyStore stores a topology.
+type TopologyStore interface {
+	// SaveTopology replaces the stored topology.
+	SaveTopology(t *Topology) error
+
+	// LoadTopology returns the stored topology. If none has
+	// been stored yet it is empty.
+	LoadTopology() (*Topology, error)
+}
+
+// memoryTopologyStore implements the TopologyStore interface
+// in memory.
+type memoryTopologyStore struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+// NewMemoryTopologyStore creates a topology store keeping the
+// topology in memory, e.g. for tests.
+func NewMemoryTopologyStore() TopologyStore {
+	return &memoryTopologyStore{}
+}
+
+// SaveTopology implements the TopologyStore interface.
+func (s *memoryTopologyStore) SaveTopology(t *Topology) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data = data
+	return nil
+}
+
+// LoadTopology implements the TopologyStore interface.
+func (s *memoryTopologyStore) LoadTopology() (*Topology, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t := &Topology{}
+	if s.data == nil {
+		return t, nil
+	}
+	if err := json.Unmarshal(s.data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// fileTopologyStore implements the TopologyStore interface
+// with a JSON file.
+type fileTopologyStore struct {
+	mutex    sync.Mutex
+	filename string
+}
+
+// NewFileTopologyStore creates a topology store writing the
+// topology as JSON into the passed file. Numbers inside of
+// the configurations are restored as float64.
+func NewFileTopologyStore(filename string) TopologyStore {
+	return &fileTopologyStore{
+		filename: filename,
+	}
+}
+
+// SaveTopology implements the TopologyStore interface.
+func (s *fileTopologyStore) SaveTopology(t *Topology) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(s.filename), filepath.Base(s.filename))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+// LoadTopology implements the TopologyStore interface.
+func (s *fileTopologyStore) LoadTopology() (*Topology, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t := &Topology{}
+	data, err := ioutil.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+//--------------------
+// ENVIRONMENT PERSISTENCE
+//--------------------
+
+// topologyPersistence contains the state of an environment
+// persisting its topology automatically.
+type topologyPersistence struct {
+	mutex   sync.Mutex
+	store   TopologyStore
+	factory BehaviorFactory
+	pending map[string]map[string]bool
+}
+
+// WithTopologyStore lets the environment restore its topology out of
+// the store when it is created and save it after each change of cells
+// or subscriptions. Subscriptions to cells not yet started, e.g. those
+// not implementing BehaviorDescriptor, are established when they
+// are started.
+func WithTopologyStore(store TopologyStore, factory BehaviorFactory) Option {
+	return func(env *environment) {
+		env.persistence = &topologyPersistence{
+			store:   store,
+			factory: factory,
+			pending: make(map[string]map[string]bool),
+		}
+	}
+}
+
+// SaveTopology implements the Environment interface.
+func (env *environment) SaveTopology(store TopologyStore) error {
+	t := env.cells.persistentTopology()
+	if env.persistence != nil {
+		env.persistence.mutex.Lock()
+		t = env.persistence.withPending(t)
+		env.persistence.mutex.Unlock()
+	}
+	if err := store.SaveTopology(t); err != nil {
+		return errors.Annotate(err, ErrTopologyStore, errorMessages)
+	}
+	return nil
+}
+
+// RestoreTopology implements the Environment interface.
+func (env *environment) RestoreTopology(store TopologyStore, factory BehaviorFactory) error {
+	_, err := env.restoreTopology(store, factory)
+	return err
+}
+
+// restoreTopology starts the stored cells and subscribes them. It
+// returns the subscriptions which could not be established.
+func (env *environment) restoreTopology(store TopologyStore, factory BehaviorFactory) (map[string]map[string]bool, error) {
+	t, err := store.LoadTopology()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrTopologyStore, errorMessages)
+	}
+	var ids []string
+	behaviors := make(map[string]Behavior)
+	for _, tc := range t.Cells {
+		if env.HasCell(tc.ID) {
+			continue
+		}
+		behavior, err := factory(tc.Kind, tc.Config)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrRestoreCell, errorMessages, tc.ID, tc.Kind)
+		}
+		ids = append(ids, tc.ID)
+		behaviors[tc.ID] = behavior
+	}
+	ids, err = env.orderByDependencies(ids, behaviors)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := env.cells.startCell(env, id, behaviors[id]); err != nil {
+			return nil, err
+		}
+	}
+	pending := make(map[string]map[string]bool)
+	for _, ts := range t.Subscriptions {
+		for _, subscriberID := range ts.Subscribers {
+			if env.HasCell(ts.Emitter) && env.HasCell(subscriberID) {
+				if err := env.cells.subscribe(ts.Emitter, subscriberID); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if pending[ts.Emitter] == nil {
+				pending[ts.Emitter] = make(map[string]bool)
+			}
+			pending[ts.Emitter][subscriberID] = true
+		}
+	}
+	return pending, nil
+}
+
+// restore restores the topology when the environment is created.
+func (tp *topologyPersistence) restore(env *environment) {
+	pending, err := env.restoreTopology(tp.store, tp.factory)
+	if err != nil {
+		logger.Errorf("cells environment %q cannot restore topology: %v", env.ID(), err)
+		return
+	}
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	tp.pending = pending
+}
+
+// started establishes the pending subscriptions of a started cell.
+func (tp *topologyPersistence) started(env *environment, id string) {
+	tp.mutex.Lock()
+	for emitterID, subscriberIDs := range tp.pending {
+		for subscriberID := range subscriberIDs {
+			if emitterID != id && subscriberID != id {
+				continue
+			}
+			if env.HasCell(emitterID) && env.HasCell(subscriberID) {
+				if err := env.cells.subscribe(emitterID, subscriberID); err == nil {
+					delete(subscriberIDs, subscriberID)
+				}
+			}
+		}
+		if len(subscriberIDs) == 0 {
+			delete(tp.pending, emitterID)
+		}
+	}
+	tp.mutex.Unlock()
+	tp.save(env)
+}
+
+// unsubscribed removes subscriptions from the pending ones.
+func (tp *topologyPersistence) unsubscribed(env *environment, emitterID string, subscriberIDs []string) {
+	tp.mutex.Lock()
+	for _, subscriberID := range subscriberIDs {
+		delete(tp.pending[emitterID], subscriberID)
+	}
+	tp.mutex.Unlock()
+	tp.save(env)
+}
+
+// save stores the current topology including the pending
+// subscriptions.
+func (tp *topologyPersistence) save(env *environment) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	t := tp.withPending(env.cells.persistentTopology())
+	if err := tp.store.SaveTopology(t); err != nil {
+		logger.Errorf("cells environment %q cannot save topology: %v", env.ID(), err)
+	}
+}
+
+// withPending adds the pending subscriptions to the topology.
+func (tp *topologyPersistence) withPending(t *Topology) *Topology {
+	if len(tp.pending) == 0 {
+		return t
+	}
+	subscriptions := make(map[string]map[string]bool)
+	for _, ts := range t.Subscriptions {
+		subscriptions[ts.Emitter] = make(map[string]bool)
+		for _, subscriberID := range ts.Subscribers {
+			subscriptions[ts.Emitter][subscriberID] = true
+		}
+	}
+	for emitterID, subscriberIDs := range tp.pending {
+		if subscriptions[emitterID] == nil {
+			subscriptions[emitterID] = make(map[string]bool)
+		}
+		for subscriberID := range subscriberIDs {
+			subscriptions[emitterID][subscriberID] = true
+		}
+	}
+	t.Subscriptions = nil
+	for emitterID, subscriberIDs := range subscriptions {
+		ts := TopologySubscription{Emitter: emitterID}
+		for subscriberID := range subscriberIDs {
+			ts.Subscribers = append(ts.Subscribers, subscriberID)
+		}
+		sort.Strings(ts.Subscribers)
+		t.Subscriptions = append(t.Subscriptions, ts)
+	}
+	sort.Slice(t.Subscriptions, func(i, j int) bool {
+		return t.Subscriptions[i].Emitter < t.Subscriptions[j].Emitter
+	})
+	return t
+}
+
+// EOF
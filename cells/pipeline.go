@@ -0,0 +1,207 @@
+// Tideland Go Cells - Pipeline
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// PIPELINE BUILDER
+//--------------------
+
+// PipelineBuilder allows the declaration of a simple chain of cells
+// where each cell is subscribed to its predecessor.
+type PipelineBuilder interface {
+	// Source sets the first cell of the pipeline. Events emitted
+	// to the pipeline will be processed by this cell.
+	Source(id string, behavior Behavior) PipelineBuilder
+
+	// Via appends an intermediate cell to the pipeline.
+	Via(id string, behavior Behavior) PipelineBuilder
+
+	// Sink sets the last cell of the pipeline.
+	Sink(id string, behavior Behavior) PipelineBuilder
+
+	// Build starts all declared cells and subscribes each one
+	// to its predecessor. In case of an error all cells already
+	// started are stopped again.
+	Build() (Pipeline, error)
+}
+
+// pipelineStage contains one declared cell of a pipeline.
+type pipelineStage struct {
+	id       string
+	behavior Behavior
+}
+
+// pipelineBuilder implements the PipelineBuilder interface.
+type pipelineBuilder struct {
+	env    Environment
+	stages []pipelineStage
+	sunk   bool
+	err    error
+}
+
+// NewPipeline creates a builder for a pipeline of cells
+// inside the passed environment.
+func NewPipeline(env Environment) PipelineBuilder {
+	return &pipelineBuilder{
+		env: env,
+	}
+}
+
+// Source implements the PipelineBuilder interface.
+func (pb *pipelineBuilder) Source(id string, behavior Behavior) PipelineBuilder {
+	if len(pb.stages) > 0 {
+		pb.fail("source %q has to be the first cell", id)
+		return pb
+	}
+	return pb.append(id, behavior)
+}
+
+// Via implements the PipelineBuilder interface.
+func (pb *pipelineBuilder) Via(id string, behavior Behavior) PipelineBuilder {
+	if len(pb.stages) == 0 {
+		pb.fail("cell %q needs a source before", id)
+		return pb
+	}
+	return pb.append(id, behavior)
+}
+
+// Sink implements the PipelineBuilder interface.
+func (pb *pipelineBuilder) Sink(id string, behavior Behavior) PipelineBuilder {
+	if len(pb.stages) == 0 {
+		pb.fail("sink %q needs a source before", id)
+		return pb
+	}
+	pb.append(id, behavior)
+	pb.sunk = true
+	return pb
+}
+
+// Build implements the PipelineBuilder interface.
+func (pb *pipelineBuilder) Build() (Pipeline, error) {
+	if pb.err != nil {
+		return nil, pb.err
+	}
+	if len(pb.stages) == 0 {
+		return nil, errors.New(ErrInvalidPipeline, errorMessages, "no cells declared")
+	}
+	p := &pipeline{
+		env: pb.env,
+	}
+	for _, stage := range pb.stages {
+		if err := pb.env.StartCell(stage.id, stage.behavior); err != nil {
+			p.Stop()
+			return nil, err
+		}
+		if len(p.ids) > 0 {
+			if err := pb.env.Subscribe(p.ids[len(p.ids)-1], stage.id); err != nil {
+				p.ids = append(p.ids, stage.id)
+				p.Stop()
+				return nil, err
+			}
+		}
+		p.ids = append(p.ids, stage.id)
+	}
+	return p, nil
+}
+
+// append adds a stage to the pipeline if the sink isn't set yet.
+func (pb *pipelineBuilder) append(id string, behavior Behavior) PipelineBuilder {
+	if pb.sunk {
+		pb.fail("cell %q cannot follow the sink", id)
+		return pb
+	}
+	pb.stages = append(pb.stages, pipelineStage{id, behavior})
+	return pb
+}
+
+// fail stores the first error during the declaration.
+func (pb *pipelineBuilder) fail(format string, id string) {
+	if pb.err == nil {
+		pb.err = errors.New(ErrInvalidPipeline, errorMessages, fmt.Sprintf(format, id))
+	}
+}
+
+//--------------------
+// PIPELINE
+//--------------------
+
+// Pipeline is the handle to a built pipeline of cells.
+type Pipeline interface {
+	// IDs returns the IDs of the cells in the order of the pipeline.
+	IDs() []string
+
+	// Emit emits an event to the source of the pipeline.
+	Emit(event Event) error
+
+	// EmitNew creates an event and emits it to the source of the pipeline.
+	EmitNew(ctx context.Context, topic string, payload interface{}) error
+
+	// Stop stops all cells of the pipeline in the order of the pipeline.
+	Stop() error
+}
+
+// pipeline implements the Pipeline interface.
+type pipeline struct {
+	env Environment
+	ids []string
+}
+
+// IDs implements the Pipeline interface.
+func (p *pipeline) IDs() []string {
+	ids := make([]string, len(p.ids))
+	copy(ids, p.ids)
+	return ids
+}
+
+// Emit implements the Pipeline interface.
+func (p *pipeline) Emit(event Event) error {
+	if len(p.ids) == 0 {
+		return errors.New(ErrInvalidPipeline, errorMessages, "pipeline is stopped")
+	}
+	return p.env.Emit(p.ids[0], event)
+}
+
+// EmitNew implements the Pipeline interface.
+func (p *pipeline) EmitNew(ctx context.Context, topic string, payload interface{}) error {
+	if len(p.ids) == 0 {
+		return errors.New(ErrInvalidPipeline, errorMessages, "pipeline is stopped")
+	}
+	return p.env.EmitNew(ctx, p.ids[0], topic, payload)
+}
+
+// Stop implements the Pipeline interface.
+func (p *pipeline) Stop() error {
+	var errs []error
+	for _, id := range p.ids {
+		if err := p.env.StopCell(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.ids = nil
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errors.Collect(errs...)
+	}
+}
+
+// EOF
@@ -0,0 +1,106 @@
+// Tideland Go Cells - Unit Tests - Pipeline
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestPipeline tests building, using, and stopping a pipeline.
+func TestPipeline(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("pipeline")
+	defer env.Stop()
+
+	inSink := cells.NewEventSink(0)
+	viaSink := cells.NewEventSink(0)
+	outSink := cells.NewEventSink(0)
+	p, err := cells.NewPipeline(env).
+		Source("in", newCollectBehavior(inSink)).
+		Via("via", newCollectBehavior(viaSink)).
+		Sink("out", newCollectBehavior(outSink)).
+		Build()
+	assert.Nil(err)
+	assert.Equal(p.IDs(), []string{"in", "via", "out"})
+
+	subs, err := env.Subscribers("in")
+	assert.Nil(err)
+	assert.Equal(subs, []string{"via"})
+	subs, err = env.Subscribers("via")
+	assert.Nil(err)
+	assert.Equal(subs, []string{"out"})
+
+	err = p.EmitNew(context.Background(), "lorem", 4711)
+	assert.Nil(err)
+	err = p.EmitNew(context.Background(), "ipsum", 1234)
+	assert.Nil(err)
+
+	err = env.Barrier(context.Background(), p.IDs()...)
+	assert.Nil(err)
+
+	assert.Length(inSink, 2)
+	assert.Length(viaSink, 2)
+	assert.Length(outSink, 2)
+
+	err = p.Stop()
+	assert.Nil(err)
+	assert.False(env.HasCell("in"))
+	assert.False(env.HasCell("via"))
+	assert.False(env.HasCell("out"))
+
+	err = p.EmitNew(context.Background(), "dolor", 0)
+	assert.True(cells.IsInvalidPipelineError(err))
+}
+
+// TestPipelineErrors tests wrong declared pipelines.
+func TestPipelineErrors(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("pipeline-errors")
+	defer env.Stop()
+
+	sink := cells.NewEventSink(0)
+
+	_, err := cells.NewPipeline(env).Build()
+	assert.True(cells.IsInvalidPipelineError(err))
+
+	_, err = cells.NewPipeline(env).
+		Via("via", newCollectBehavior(sink)).
+		Build()
+	assert.True(cells.IsInvalidPipelineError(err))
+
+	_, err = cells.NewPipeline(env).
+		Source("in", newCollectBehavior(sink)).
+		Sink("out", newCollectBehavior(sink)).
+		Via("via", newCollectBehavior(sink)).
+		Build()
+	assert.True(cells.IsInvalidPipelineError(err))
+	assert.False(env.HasCell("in"))
+
+	// Duplicate ID stops already started cells.
+	_, err = cells.NewPipeline(env).
+		Source("in", newCollectBehavior(sink)).
+		Sink("in", newCollectBehavior(sink)).
+		Build()
+	assert.True(cells.IsDuplicateIDError(err))
+	assert.False(env.HasCell("in"))
+}
+
+// EOF
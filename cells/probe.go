@@ -0,0 +1,127 @@
+// Tideland Go Cells - Probe
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// topicProbe labels the probes travelling along their route.
+	topicProbe = "probe!"
+
+	// payloadProbe contains the state of a travelling probe.
+	payloadProbe = "probe:probe"
+)
+
+//--------------------
+// PROBE
+//--------------------
+
+// ProbeHop describes the arrival of a probe in one cell of its
+// route. The latency is the duration since the arrival in the
+// previous cell, or since sending it for the first one.
+type ProbeHop struct {
+	ID      string
+	Arrived time.Time
+	Latency time.Duration
+}
+
+// ProbeResult describes the travel of a probe along its route.
+type ProbeResult struct {
+	Sent  time.Time
+	Hops  []ProbeHop
+	Total time.Duration
+}
+
+// probe is the state of a travelling probe. It is changed by
+// one cell after the other, so it needs no locking.
+type probe struct {
+	route  []string
+	result ProbeResult
+}
+
+// Probe implements the Environment interface.
+func (env *environment) Probe(ctx context.Context, route ...string) (*ProbeResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(route) == 0 {
+		return &ProbeResult{Sent: time.Now()}, nil
+	}
+	p := &probe{
+		route: route,
+		result: ProbeResult{
+			Sent: time.Now(),
+			Hops: make([]ProbeHop, 0, len(route)),
+		},
+	}
+	payloadIn, waiter := NewWaiterPayload()
+	request := payloadIn.Apply(PayloadValues{payloadProbe: p})
+	if err := env.EmitNew(ctx, route[0], topicProbe, request); err != nil {
+		return nil, err
+	}
+	payloadOut, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrTimeout, errorMessages, "probe")
+	}
+	if payloadOut.Error() != nil {
+		return nil, payloadOut.Error()
+	}
+	return &p.result, nil
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// forwardProbe records the arrival of the probe and passes it to
+// the next cell of its route, or replies to the sender if this is
+// the last one. Probes are not passed to the behavior.
+func (c *cell) forwardProbe(event Event) error {
+	payload, ok := HasWaiterPayload(event)
+	if !ok {
+		return nil
+	}
+	p, ok := event.Payload().Get(payloadProbe, nil).(*probe)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	last := p.result.Sent
+	if n := len(p.result.Hops); n > 0 {
+		last = p.result.Hops[n-1].Arrived
+	}
+	p.result.Hops = append(p.result.Hops, ProbeHop{
+		ID:      c.id,
+		Arrived: now,
+		Latency: now.Sub(last),
+	})
+	if next := len(p.result.Hops); next < len(p.route) {
+		if err := c.env.EmitNew(event.Context(), p.route[next], topicProbe, event.Payload()); err != nil {
+			payload.GetWaiter().Set(err)
+		}
+		return nil
+	}
+	p.result.Total = now.Sub(p.result.Sent)
+	payload.GetWaiter().Set(PayloadValues{})
+	return nil
+}
+
+// EOF
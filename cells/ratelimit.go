@@ -0,0 +1,97 @@
+// Tideland Go Cells - Emit Rate Limit
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/identifier"
+	"github.com/tideland/golib/monitoring"
+)
+
+//--------------------
+// EMIT LIMITER
+//--------------------
+
+// emitLimiter shapes the emits of a cell with a token bucket.
+type emitLimiter struct {
+	mutex    sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	shapedID string
+}
+
+// newEmitLimiter creates a limiter with a full bucket.
+func newEmitLimiter(measuringID string, rate float64, burst int) *emitLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &emitLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		shapedID: identifier.Identifier(measuringID, "emit-shaped"),
+	}
+}
+
+// reserve takes a token and returns how long the caller has
+// to wait for it.
+func (l *emitLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait delays an emit if the rate is exceeded. The delay is
+// measured. It ends early when the environment stops.
+func (l *emitLimiter) wait(done <-chan struct{}) {
+	delay := l.reserve()
+	if delay <= 0 {
+		return
+	}
+	shaping := monitoring.BeginMeasuring(l.shapedID)
+	defer shaping.EndMeasuring()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+}
+
+// EmitRateLimit limits the emits of a cell to rate per second with
+// bursts up to burst emits. Further emits are delayed, so a runaway
+// producer cannot starve the rest of the topology. The delays are
+// measured with the monitoring ID of the cell ending with "emit-shaped".
+func EmitRateLimit(rate float64, burst int) CellOption {
+	return func(c *cell) {
+		if rate > 0 {
+			c.emitLimiter = newEmitLimiter(c.measuringID, rate, burst)
+		}
+	}
+}
+
+// EOF
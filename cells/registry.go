@@ -49,7 +49,7 @@ func (r *registry) stop() error {
 
 // startCell starts and adds a new cell to the registry if the
 // ID does not already exist.
-func (r *registry) startCell(env *environment, id string, behavior Behavior) error {
+func (r *registry) startCell(env *environment, id string, behavior Behavior, options ...CellOption) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	// Check if the ID already exists.
@@ -57,7 +57,7 @@ func (r *registry) startCell(env *environment, id string, behavior Behavior) err
 		return errors.New(ErrDuplicateID, errorMessages, id)
 	}
 	// Create and add.
-	rc, err := newCell(env, id, behavior)
+	rc, err := newCell(env, id, behavior, options...)
 	if err != nil {
 		return err
 	}
@@ -112,6 +112,8 @@ func (r *registry) unsubscribe(emitterID string, subscriberIDs ...string) error
 	for _, subscriberID := range subscriberIDs {
 		if sc, ok := r.cells[subscriberID]; ok {
 			ec.subscribers.remove(subscriberID)
+			ec.acks.remove(subscriberID)
+			ec.transforms.remove(subscriberID)
 			sc.emitters.remove(emitterID)
 		} else {
 			return errors.New(ErrInvalidID, errorMessages, subscriberID)
@@ -131,6 +133,28 @@ func (r *registry) subscribers(emitterID string) ([]string, error) {
 	return ec.subscribers.ids(), nil
 }
 
+// cellsOf returns the cells with the given IDs or
+// all cells if no ID is passed.
+func (r *registry) cellsOf(ids ...string) ([]*cell, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	cs := []*cell{}
+	if len(ids) == 0 {
+		for _, c := range r.cells {
+			cs = append(cs, c)
+		}
+		return cs, nil
+	}
+	for _, id := range ids {
+		c, ok := r.cells[id]
+		if !ok {
+			return nil, errors.New(ErrInvalidID, errorMessages, id)
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
 // cell returns the cell with the given id.
 func (r *registry) cell(id string) (*cell, error) {
 	r.mutex.RLock()
@@ -0,0 +1,110 @@
+// Tideland Go Cells - Replay
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// REPLAY
+//--------------------
+
+// ReplayFilter selects the historical events to replay. Empty
+// topics select all topics, zero times leave the range open.
+// Speed scales the original gaps between the events, 2.0 replays
+// twice as fast, zero or less replays without any delay. DryRun
+// only counts the events instead of emitting them.
+type ReplayFilter struct {
+	Topics []string
+	From   time.Time
+	To     time.Time
+	Speed  float64
+	DryRun bool
+}
+
+// matches checks if the historical event is selected by the filter.
+func (f ReplayFilter) matches(he *HistoricalEvent) bool {
+	if !f.From.IsZero() && he.EventTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && he.EventTime.After(f.To) {
+		return false
+	}
+	if len(f.Topics) == 0 {
+		return true
+	}
+	for _, topic := range f.Topics {
+		if topic == he.Topic {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayReport tells how many events have been, or in dry-run
+// mode would have been, delivered to which cells.
+type ReplayReport struct {
+	Events int
+	Cells  map[string]int
+}
+
+// Replay emits the historical events of the source selected by the
+// filter to the environment. Like with Environment.Backfill() they
+// keep their original event time and are marked as backfill.
+func Replay(ctx context.Context, env Environment, source EventIterator, filter ReplayFilter) (ReplayReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	report := ReplayReport{
+		Cells: make(map[string]int),
+	}
+	var last time.Time
+	for {
+		he, err := source.Next(ctx)
+		if err != nil {
+			return report, err
+		}
+		if he == nil {
+			return report, nil
+		}
+		if !filter.matches(he) {
+			continue
+		}
+		if filter.DryRun {
+			if !env.HasCell(he.ID) {
+				return report, errors.New(ErrInvalidID, errorMessages, he.ID)
+			}
+		} else {
+			// Keep the gaps between the events according to the speed.
+			if filter.Speed > 0 && !last.IsZero() && he.EventTime.After(last) {
+				gap := time.Duration(float64(he.EventTime.Sub(last)) / filter.Speed)
+				select {
+				case <-time.After(gap):
+				case <-ctx.Done():
+					return report, errors.Annotate(ctx.Err(), ErrTimeout, errorMessages, "replay")
+				}
+			}
+			if err := env.Backfill(ctx, NewSliceEventIterator(*he)); err != nil {
+				return report, err
+			}
+		}
+		last = he.EventTime
+		report.Events++
+		report.Cells[he.ID]++
+	}
+}
+
+// EOF
@@ -0,0 +1,80 @@
+// Tideland Go Cells - Request All
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// RequestAll implements the Environment interface.
+func (env *environment) RequestAll(ctx context.Context, ids []string, topic string, payload interface{}) (map[string]Payload, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	replies := make(map[string]Payload, len(ids))
+	failures := make(map[string]error)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			reply, err := env.requestOne(ctx, id, topic, payload)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				failures[id] = err
+				return
+			}
+			replies[id] = reply
+		}(id)
+	}
+	wg.Wait()
+	if len(failures) > 0 {
+		failed := make([]string, 0, len(failures))
+		for id := range failures {
+			failed = append(failed, id)
+		}
+		sort.Strings(failed)
+		return replies, errors.New(ErrRequestAll, errorMessages, strings.Join(failed, ", "), failures[failed[0]])
+	}
+	return replies, nil
+}
+
+// requestOne sends one request of RequestAll() and waits for
+// its reply.
+func (env *environment) requestOne(ctx context.Context, id, topic string, payload interface{}) (Payload, error) {
+	payloadIn, waiter := NewWaiterPayload()
+	request := Payload(payloadIn)
+	if payload != nil {
+		request = payloadIn.Apply(payload)
+	}
+	if err := env.EmitNew(ctx, id, topic, request); err != nil {
+		return nil, err
+	}
+	payloadOut, err := waiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if payloadOut.Error() != nil {
+		return nil, payloadOut.Error()
+	}
+	return payloadOut, nil
+}
+
+// EOF
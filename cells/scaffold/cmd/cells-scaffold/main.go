@@ -0,0 +1,36 @@
+// Tideland Go Cells - Scaffold - Command
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Command cells-scaffold generates the skeleton of a cells application
+// out of a description file. It is intended to be used with go:generate.
+//
+//     cells-scaffold -in description.json -out directory
+package main
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"flag"
+	"os"
+
+	"github.com/tideland/gocells/cells/scaffold"
+)
+
+//--------------------
+// MAIN
+//--------------------
+
+func main() {
+	in := flag.String("in", "scaffold.json", "description file of the application")
+	out := flag.String("out", ".", "directory of the generated files")
+	flag.Parse()
+	os.Exit(scaffold.Main(*in, *out))
+}
+
+// EOF
@@ -0,0 +1,38 @@
+// Tideland Go Cells - Scaffold
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package scaffold generates the skeleton of a runnable cells
+// application out of a small description of its topology. The
+// generated main.go sets up the environment, loads the cells and
+// subscriptions from the generated topology.json, serves the
+// statistics of the environment as metrics endpoint, and shuts down
+// gracefully on SIGINT or SIGTERM. The behaviors are created by
+// their names registered in the behaviors package.
+//
+//     {
+//         "name": "orders",
+//         "metrics": ":9090",
+//         "cells": [
+//             {"id": "orders", "kind": "broadcaster"},
+//             {"id": "collector", "kind": "collector", "config": {"max": 100}}
+//         ],
+//         "subscriptions": [
+//             {"emitter": "orders", "subscribers": ["collector"]}
+//         ]
+//     }
+//
+// The description can be loaded with LoadDescription() or created in
+// code. Generate() writes both files into a directory, WriteMain() and
+// WriteTopology() into any writer. The command cells-scaffold does the
+// same for go:generate:
+//
+//     //go:generate go run github.com/tideland/gocells/cells/scaffold/cmd/cells-scaffold -in orders.json
+//
+// The generated files are a starting point and intended to be edited.
+package scaffold
+
+// EOF
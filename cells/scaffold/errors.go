@@ -0,0 +1,57 @@
+// Tideland Go Cells - Scaffold - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package scaffold
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrDescriptionFile = iota + 1
+	ErrInvalidDescription
+	ErrGenerate
+)
+
+var errorMessages = errors.Messages{
+	ErrDescriptionFile:    "cannot read description file %q",
+	ErrInvalidDescription: "invalid description: %s",
+	ErrGenerate:           "cannot generate %q",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsDescriptionFileError checks if an error signals an unreadable
+// or invalid description file.
+func IsDescriptionFileError(err error) bool {
+	return errors.IsError(err, ErrDescriptionFile)
+}
+
+// IsInvalidDescriptionError checks if an error signals an
+// inconsistent description.
+func IsInvalidDescriptionError(err error) bool {
+	return errors.IsError(err, ErrInvalidDescription)
+}
+
+// IsGenerateError checks if an error signals a failed
+// generation of a file.
+func IsGenerateError(err error) bool {
+	return errors.IsError(err, ErrGenerate)
+}
+
+// EOF
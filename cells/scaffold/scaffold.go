@@ -0,0 +1,299 @@
+// Tideland Go Cells - Scaffold
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package scaffold
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// MainFile is the name of the generated program.
+	MainFile = "main.go"
+
+	// TopologyFile is the name of the generated topology.
+	TopologyFile = "topology.json"
+)
+
+//--------------------
+// DESCRIPTION
+//--------------------
+
+// Description describes the application to generate. The cells
+// and subscriptions are those of a persistent topology, the kinds
+// of the cells are the names of registered behaviors.
+type Description struct {
+	// Name is the ID of the environment.
+	Name string `json:"name"`
+
+	// Package is the package of the generated program,
+	// by default main.
+	Package string `json:"package,omitempty"`
+
+	// Metrics is the default address of the metrics endpoint.
+	// If empty the endpoint is disabled by default.
+	Metrics string `json:"metrics,omitempty"`
+
+	cells.Topology
+}
+
+// LoadDescription reads a description from a JSON file.
+func LoadDescription(filename string) (*Description, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrDescriptionFile, errorMessages, filename)
+	}
+	d := &Description{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, errors.Annotate(err, ErrDescriptionFile, errorMessages, filename)
+	}
+	return d, nil
+}
+
+// Validate checks if the description is complete and consistent. The
+// kinds of the cells have to be registered behaviors, the emitters and
+// subscribers have to be described cells.
+func (d *Description) Validate() error {
+	if d.Name == "" {
+		return errors.New(ErrInvalidDescription, errorMessages, "missing name")
+	}
+	kinds := make(map[string]bool)
+	for _, kind := range behaviors.Registered() {
+		kinds[kind] = true
+	}
+	ids := make(map[string]bool)
+	for _, tc := range d.Cells {
+		switch {
+		case tc.ID == "":
+			return errors.New(ErrInvalidDescription, errorMessages, "cell without ID")
+		case ids[tc.ID]:
+			return errors.New(ErrInvalidDescription, errorMessages, fmt.Sprintf("duplicate cell %q", tc.ID))
+		case !kinds[tc.Kind]:
+			return errors.New(ErrInvalidDescription, errorMessages, fmt.Sprintf("cell %q has unknown kind %q", tc.ID, tc.Kind))
+		}
+		ids[tc.ID] = true
+	}
+	for _, ts := range d.Subscriptions {
+		if !ids[ts.Emitter] {
+			return errors.New(ErrInvalidDescription, errorMessages, fmt.Sprintf("unknown emitter %q", ts.Emitter))
+		}
+		for _, subscriberID := range ts.Subscribers {
+			if !ids[subscriberID] {
+				return errors.New(ErrInvalidDescription, errorMessages, fmt.Sprintf("unknown subscriber %q", subscriberID))
+			}
+		}
+	}
+	return nil
+}
+
+// pkg returns the package of the generated program.
+func (d *Description) pkg() string {
+	if d.Package == "" {
+		return "main"
+	}
+	return d.Package
+}
+
+//--------------------
+// GENERATOR
+//--------------------
+
+// Generate validates the description and writes the program and the
+// topology into the directory. Existing files are replaced.
+func Generate(dir string, d *Description) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	files := []struct {
+		name  string
+		write func(io.Writer, *Description) error
+	}{
+		{MainFile, WriteMain},
+		{TopologyFile, WriteTopology},
+	}
+	for _, file := range files {
+		var buf bytes.Buffer
+		if err := file.write(&buf, d); err != nil {
+			return err
+		}
+		filename := filepath.Join(dir, file.name)
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			return errors.Annotate(err, ErrGenerate, errorMessages, filename)
+		}
+	}
+	return nil
+}
+
+// WriteMain writes the formatted program of the description.
+func WriteMain(w io.Writer, d *Description) error {
+	var buf bytes.Buffer
+	err := mainTemplate.Execute(&buf, map[string]string{
+		"Name":     d.Name,
+		"Package":  d.pkg(),
+		"Metrics":  d.Metrics,
+		"Topology": TopologyFile,
+	})
+	if err != nil {
+		return errors.Annotate(err, ErrGenerate, errorMessages, MainFile)
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Annotate(err, ErrGenerate, errorMessages, MainFile)
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+// WriteTopology writes the topology of the description as JSON
+// readable by cells.NewFileTopologyStore().
+func WriteTopology(w io.Writer, d *Description) error {
+	t := d.Topology
+	if t.Cells == nil {
+		t.Cells = []cells.TopologyCell{}
+	}
+	if t.Subscriptions == nil {
+		t.Subscriptions = []cells.TopologySubscription{}
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return errors.Annotate(err, ErrGenerate, errorMessages, TopologyFile)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Main is the implementation of the command cells-scaffold. It
+// generates the files of the description file into the directory.
+func Main(descriptionFile, dir string) int {
+	d, err := LoadDescription(descriptionFile)
+	if err == nil {
+		err = Generate(dir, d)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cells-scaffold: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+//--------------------
+// TEMPLATES
+//--------------------
+
+// mainTemplate is the template of the generated program.
+var mainTemplate = template.Must(template.New(MainFile).Parse(`// Code generated by cells-scaffold for {{printf "%q" .Name}}.
+// It is a starting point and intended to be edited.
+
+package {{.Package}}
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+)
+
+// name is the ID of the environment.
+const name = {{printf "%q" .Name}}
+
+var (
+	topologyFile = flag.String("topology", {{printf "%q" .Topology}}, "file containing the cells and subscriptions")
+	metricsAddr  = flag.String("metrics", {{printf "%q" .Metrics}}, "address of the metrics endpoint, empty to disable it")
+	stopTimeout  = flag.Duration("stop-timeout", 10*time.Second, "maximum duration of the graceful shutdown")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		logger.Errorf("%s failed: %v", name, err)
+		os.Exit(1)
+	}
+}
+
+// run sets up the environment and runs it until a signal is received.
+func run() error {
+	env := cells.NewEnvironment(name)
+	defer env.Stop()
+
+	// Own behaviors have to be registered with behaviors.Register()
+	// before to be used in the topology.
+	if err := env.RestoreTopology(cells.NewFileTopologyStore(*topologyFile), behaviors.New); err != nil {
+		return err
+	}
+
+	var server *http.Server
+	if *metricsAddr != "" {
+		server = serveMetrics(env, *metricsAddr)
+	}
+	logger.Infof("%s is running", name)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	<-sigc
+	logger.Infof("%s is shutting down", name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *stopTimeout)
+	defer cancel()
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warningf("metrics endpoint stopped with error: %v", err)
+		}
+	}
+	return env.Barrier(ctx)
+}
+
+// serveMetrics serves the statistics of the environment as JSON.
+func serveMetrics(env cells.Environment, addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(env.Stats())
+	})
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("metrics endpoint failed: %v", err)
+		}
+	}()
+	return server
+}
+`))
+
+// EOF
@@ -0,0 +1,122 @@
+// Tideland Go Cells - Scaffold - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package scaffold_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/scaffold"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const description = `{
+	"name": "orders",
+	"metrics": ":9090",
+	"cells": [
+		{"id": "orders", "kind": "broadcaster"},
+		{"id": "collector", "kind": "collector", "config": {"max": 100}}
+	],
+	"subscriptions": [
+		{"emitter": "orders", "subscribers": ["collector"]}
+	]
+}`
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestGenerate tests the generating of an application.
+func TestGenerate(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	dir, err := ioutil.TempDir("", "scaffold")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	descriptionFile := filepath.Join(dir, "orders.json")
+	err = ioutil.WriteFile(descriptionFile, []byte(description), 0644)
+	assert.Nil(err)
+
+	assert.Equal(scaffold.Main(descriptionFile, dir), 0)
+
+	// The program is valid Go using the description.
+	source, err := ioutil.ReadFile(filepath.Join(dir, scaffold.MainFile))
+	assert.Nil(err)
+	file, err := parser.ParseFile(token.NewFileSet(), scaffold.MainFile, source, 0)
+	assert.Nil(err)
+	assert.Equal(file.Name.Name, "main")
+	assert.True(strings.Contains(string(source), `const name = "orders"`))
+	assert.True(strings.Contains(string(source), `":9090"`))
+
+	// The topology can be restored.
+	env := cells.NewEnvironment("scaffold")
+	defer env.Stop()
+	store := cells.NewFileTopologyStore(filepath.Join(dir, scaffold.TopologyFile))
+	err = env.RestoreTopology(store, behaviors.New)
+	assert.Nil(err)
+	assert.True(env.HasCell("orders"))
+	assert.True(env.HasCell("collector"))
+	subscribers, err := env.Subscribers("orders")
+	assert.Nil(err)
+	assert.Equal(subscribers, []string{"collector"})
+}
+
+// TestValidate tests the validation of descriptions.
+func TestValidate(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	tests := []struct {
+		d   *scaffold.Description
+		err string
+	}{
+		{&scaffold.Description{}, "missing name"},
+		{&scaffold.Description{
+			Name: "test",
+			Topology: cells.Topology{
+				Cells: []cells.TopologyCell{{ID: "a", Kind: "collector"}, {ID: "a", Kind: "collector"}},
+			},
+		}, `duplicate cell "a"`},
+		{&scaffold.Description{
+			Name: "test",
+			Topology: cells.Topology{
+				Cells: []cells.TopologyCell{{ID: "a", Kind: "unknown"}},
+			},
+		}, `unknown kind "unknown"`},
+		{&scaffold.Description{
+			Name: "test",
+			Topology: cells.Topology{
+				Cells:         []cells.TopologyCell{{ID: "a", Kind: "collector"}},
+				Subscriptions: []cells.TopologySubscription{{Emitter: "a", Subscribers: []string{"b"}}},
+			},
+		}, `unknown subscriber "b"`},
+	}
+	for _, test := range tests {
+		err := scaffold.Generate(os.TempDir(), test.d)
+		assert.True(scaffold.IsInvalidDescriptionError(err))
+		assert.ErrorMatch(err, ".*"+test.err+".*")
+	}
+
+	_, err := scaffold.LoadDescription("/does/not/exist.json")
+	assert.True(scaffold.IsDescriptionFileError(err))
+}
+
+// EOF
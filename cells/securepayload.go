@@ -0,0 +1,261 @@
+// Tideland Go Cells - Secure Payload
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// PAYLOAD CIPHER
+//--------------------
+
+// SealedValue is an encrypted payload value. It contains the ID
+// of the key used for the encryption so that it can be opened
+// after a key rotation too.
+type SealedValue struct {
+	KeyID      string
+	Ciphertext []byte
+}
+
+// String implements the fmt.Stringer interface. It never shows
+// the ciphertext.
+func (sv SealedValue) String() string {
+	return fmt.Sprintf("<sealed with %q>", sv.KeyID)
+}
+
+// PayloadCipher encrypts and decrypts payload values.
+type PayloadCipher interface {
+	// Seal encrypts the plaintext with the current key.
+	Seal(plaintext []byte) (SealedValue, error)
+
+	// Open decrypts a sealed value with the key it has
+	// been sealed with.
+	Open(sealed SealedValue) ([]byte, error)
+}
+
+// AEADKeyRing is a PayloadCipher using AEAD ciphers. It contains
+// multiple keys to support the rotation of them. Sealing is
+// always done with the latest added key while opening uses the
+// key the value has been sealed with.
+type AEADKeyRing struct {
+	mutex   sync.RWMutex
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewAEADKeyRing creates an empty key ring.
+func NewAEADKeyRing() *AEADKeyRing {
+	return &AEADKeyRing{
+		aeads: make(map[string]cipher.AEAD),
+	}
+}
+
+// AddKey adds an AEAD cipher with the given key ID. It will be
+// used for all following sealings.
+func (kr *AEADKeyRing) AddKey(id string, aead cipher.AEAD) {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	kr.aeads[id] = aead
+	kr.current = id
+}
+
+// AddAESGCMKey adds an AES-GCM cipher for the passed key. The
+// key has to be 16, 24, or 32 bytes long.
+func (kr *AEADKeyRing) AddAESGCMKey(id string, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	kr.AddKey(id, aead)
+	return nil
+}
+
+// RemoveKey removes a retired key. Values sealed with it
+// cannot be opened anymore.
+func (kr *AEADKeyRing) RemoveKey(id string) {
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+	delete(kr.aeads, id)
+	if kr.current == id {
+		kr.current = ""
+	}
+}
+
+// Seal implements the PayloadCipher interface.
+func (kr *AEADKeyRing) Seal(plaintext []byte) (SealedValue, error) {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	aead, ok := kr.aeads[kr.current]
+	if !ok {
+		return SealedValue{}, errors.New(ErrUnknownKey, errorMessages, kr.current)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return SealedValue{}, err
+	}
+	return SealedValue{
+		KeyID:      kr.current,
+		Ciphertext: aead.Seal(nonce, nonce, plaintext, []byte(kr.current)),
+	}, nil
+}
+
+// Open implements the PayloadCipher interface.
+func (kr *AEADKeyRing) Open(sealed SealedValue) ([]byte, error) {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+	aead, ok := kr.aeads[sealed.KeyID]
+	if !ok {
+		return nil, errors.New(ErrUnknownKey, errorMessages, sealed.KeyID)
+	}
+	size := aead.NonceSize()
+	if len(sealed.Ciphertext) < size {
+		return nil, errors.New(ErrInvalidSealedValue, errorMessages, sealed.KeyID)
+	}
+	nonce, ciphertext := sealed.Ciphertext[:size], sealed.Ciphertext[size:]
+	return aead.Open(nil, nonce, ciphertext, []byte(sealed.KeyID))
+}
+
+//--------------------
+// SECURE PAYLOAD
+//--------------------
+
+// SecurePayload is a payload where selected values can be sealed
+// by encryption. Sealed values are returned by the getters as
+// SealedValue, so they stay encrypted while the payload is queued
+// or logged. Only Open() returns the plain value.
+type SecurePayload interface {
+	Payload
+
+	// Seal returns a new secure payload with the values of
+	// the passed keys encrypted.
+	Seal(keys ...string) (SecurePayload, error)
+
+	// Open returns the decrypted value of the passed key.
+	Open(key string) (interface{}, error)
+
+	// Reseal returns a new secure payload with all sealed
+	// values encrypted again using the current key of the
+	// cipher. It is used after a key rotation.
+	Reseal() (SecurePayload, error)
+}
+
+// securePayload implements the SecurePayload interface.
+type securePayload struct {
+	Payload
+
+	cipher PayloadCipher
+}
+
+// sealedContent is used to encode any payload value.
+type sealedContent struct {
+	Value interface{}
+}
+
+// NewSecurePayload creates a secure payload containing the passed
+// values, which are handled like in NewPayload(). The passed cipher
+// is used for sealing and opening of values. Those are encoded with
+// encoding/gob, so own types have to be registered with gob.Register().
+func NewSecurePayload(values interface{}, cipher PayloadCipher) SecurePayload {
+	return &securePayload{
+		Payload: NewPayload(values),
+		cipher:  cipher,
+	}
+}
+
+// Seal implements the SecurePayload interface.
+func (p *securePayload) Seal(keys ...string) (SecurePayload, error) {
+	sealed := PayloadValues{}
+	for _, key := range keys {
+		value := p.Get(key, nil)
+		if value == nil {
+			continue
+		}
+		if _, ok := value.(SealedValue); ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(sealedContent{value}); err != nil {
+			return nil, errors.Annotate(err, ErrSealing, errorMessages, key)
+		}
+		sv, err := p.cipher.Seal(buf.Bytes())
+		if err != nil {
+			return nil, errors.Annotate(err, ErrSealing, errorMessages, key)
+		}
+		sealed[key] = sv
+	}
+	return p.apply(sealed), nil
+}
+
+// Open implements the SecurePayload interface.
+func (p *securePayload) Open(key string) (interface{}, error) {
+	sv, ok := p.Get(key, nil).(SealedValue)
+	if !ok {
+		return nil, errors.New(ErrNotSealed, errorMessages, key)
+	}
+	plaintext, err := p.cipher.Open(sv)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrOpening, errorMessages, key)
+	}
+	var content sealedContent
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&content); err != nil {
+		return nil, errors.Annotate(err, ErrOpening, errorMessages, key)
+	}
+	return content.Value, nil
+}
+
+// Reseal implements the SecurePayload interface.
+func (p *securePayload) Reseal() (SecurePayload, error) {
+	plain := PayloadValues{}
+	keys := []string{}
+	for _, key := range p.Keys() {
+		if _, ok := p.Get(key, nil).(SealedValue); !ok {
+			continue
+		}
+		value, err := p.Open(key)
+		if err != nil {
+			return nil, err
+		}
+		plain[key] = value
+		keys = append(keys, key)
+	}
+	return p.apply(plain).Seal(keys...)
+}
+
+// Apply implements the Payload interface. The returned
+// payload is a secure payload using the same cipher.
+func (p *securePayload) Apply(values interface{}) Payload {
+	return p.apply(values)
+}
+
+// apply creates a new secure payload with the applied values.
+func (p *securePayload) apply(values interface{}) *securePayload {
+	return &securePayload{
+		Payload: p.Payload.Apply(values),
+		cipher:  p.cipher,
+	}
+}
+
+// EOF
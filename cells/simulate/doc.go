@@ -0,0 +1,29 @@
+// Tideland Go Cells - Simulate
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package simulate runs synthetic load against the cells of an
+// environment for capacity planning before a production deployment.
+// Generators create events with a constant rate, Poisson distributed,
+// in bursts, or replay them from a JSON lines file. A simulation
+// emits them to their target cells and reports the throughput, the
+// end-to-end latencies, and the statistics of all cells.
+//
+//     sim := simulate.New(env,
+//         simulate.Load{"parser", simulate.Poisson("line", 500, nil)},
+//         simulate.Load{"parser", simulate.Bursty("line", 5000, 100, time.Second, nil)},
+//     )
+//     sim.Measure("alerter")
+//     report, err := sim.Run(ctx, time.Minute)
+//     fmt.Println(report)
+//
+// Latencies are measured from the emitting of a generated event until
+// an event derived from it reaches one of the measured cells. So the
+// behaviors in between have to emit new events with the context of
+// the processed ones.
+package simulate
+
+// EOF
@@ -0,0 +1,49 @@
+// Tideland Go Cells - Simulate - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package simulate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrReplayFile = iota + 1
+	ErrNoLoad
+)
+
+var errorMessages = errors.Messages{
+	ErrReplayFile: "cannot read replay file %q",
+	ErrNoLoad:     "simulation has no load",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsReplayFileError checks if an error signals an unreadable
+// or invalid replay file.
+func IsReplayFileError(err error) bool {
+	return errors.IsError(err, ErrReplayFile)
+}
+
+// IsNoLoadError checks if an error signals a simulation
+// without any load.
+func IsNoLoadError(err error) bool {
+	return errors.IsError(err, ErrNoLoad)
+}
+
+// EOF
@@ -0,0 +1,174 @@
+// Tideland Go Cells - Simulate - Generators
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package simulate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"context"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/codec"
+)
+
+//--------------------
+// GENERATOR
+//--------------------
+
+// Generator creates the synthetic events of a simulation.
+type Generator interface {
+	// Next returns the pause before the next event, its topic,
+	// and its payload. False signals the end of the events.
+	Next() (pause time.Duration, topic string, payload interface{}, ok bool)
+}
+
+// PayloadFunc creates the payload of the n-th generated event.
+// Without one the number itself is the payload.
+type PayloadFunc func(n int) interface{}
+
+// payload returns the payload of the n-th event.
+func (pf PayloadFunc) payload(n int) interface{} {
+	if pf == nil {
+		return n
+	}
+	return pf(n)
+}
+
+// rateGenerator creates events with pauses returned by a function.
+type rateGenerator struct {
+	topic   string
+	payload PayloadFunc
+	pause   func(n int) time.Duration
+	n       int
+}
+
+// Next implements the Generator interface.
+func (g *rateGenerator) Next() (time.Duration, string, interface{}, bool) {
+	n := g.n
+	g.n++
+	return g.pause(n), g.topic, g.payload.payload(n), true
+}
+
+// ConstantRate creates events with the given rate per second.
+func ConstantRate(topic string, rate float64, payload PayloadFunc) Generator {
+	interval := time.Duration(float64(time.Second) / rate)
+	return &rateGenerator{
+		topic:   topic,
+		payload: payload,
+		pause: func(n int) time.Duration {
+			if n == 0 {
+				return 0
+			}
+			return interval
+		},
+	}
+}
+
+// Poisson creates events arriving independently with the given
+// average rate per second, so the pauses are exponentially
+// distributed.
+func Poisson(topic string, rate float64, payload PayloadFunc) Generator {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &rateGenerator{
+		topic:   topic,
+		payload: payload,
+		pause: func(n int) time.Duration {
+			return time.Duration(rnd.ExpFloat64() / rate * float64(time.Second))
+		},
+	}
+}
+
+// Bursty creates bursts of events with the given rate per second
+// and size. Between the bursts the generator idles.
+func Bursty(topic string, rate float64, burst int, idle time.Duration, payload PayloadFunc) Generator {
+	interval := time.Duration(float64(time.Second) / rate)
+	return &rateGenerator{
+		topic:   topic,
+		payload: payload,
+		pause: func(n int) time.Duration {
+			switch {
+			case n == 0:
+				return 0
+			case n%burst == 0:
+				return idle
+			default:
+				return interval
+			}
+		},
+	}
+}
+
+// replayGenerator creates the events read from a file.
+type replayGenerator struct {
+	events []cells.Event
+	speed  float64
+	n      int
+}
+
+// ReplayFile creates the events stored in a JSON lines file, e.g.
+// written by the archiver behavior. Each line contains a timestamp,
+// a topic, and a payload. Speed scales the original gaps between
+// the events, 2.0 replays twice as fast, zero or less without any
+// delay.
+func ReplayFile(filename string, speed float64) (Generator, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrReplayFile, errorMessages, filename)
+	}
+	defer f.Close()
+	jc := codec.NewJSONCodec()
+	g := &replayGenerator{
+		speed: speed,
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		event, err := jc.Decode(context.Background(), scanner.Bytes())
+		if err != nil {
+			return nil, errors.Annotate(err, ErrReplayFile, errorMessages, filename)
+		}
+		g.events = append(g.events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Annotate(err, ErrReplayFile, errorMessages, filename)
+	}
+	return g, nil
+}
+
+// Next implements the Generator interface.
+func (g *replayGenerator) Next() (time.Duration, string, interface{}, bool) {
+	if g.n >= len(g.events) {
+		return 0, "", nil, false
+	}
+	event := g.events[g.n]
+	var pause time.Duration
+	if g.n > 0 && g.speed > 0 {
+		gap := event.Timestamp().Sub(g.events[g.n-1].Timestamp())
+		pause = time.Duration(float64(gap) / g.speed)
+	}
+	g.n++
+	values := cells.PayloadValues{}
+	event.Payload().Do(func(key string, value interface{}) error {
+		values[key] = value
+		return nil
+	})
+	return pause, event.Topic(), values, true
+}
+
+// EOF
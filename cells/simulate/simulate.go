@@ -0,0 +1,288 @@
+// Tideland Go Cells - Simulate
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package simulate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tideland/golib/errors"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// ProbeID is the ID of the cell measuring the latencies.
+const ProbeID = "simulate-probe"
+
+// sentKey is the context key of the time a generated
+// event has been emitted.
+type sentKey struct{}
+
+//--------------------
+// REPORT
+//--------------------
+
+// Latency contains the distribution of the measured latencies.
+type Latency struct {
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// newLatency calculates the distribution of the latencies.
+func newLatency(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	quantile := func(q float64) time.Duration {
+		return latencies[int(q*float64(len(latencies)-1))]
+	}
+	return Latency{
+		Min:  latencies[0],
+		Mean: sum / time.Duration(len(latencies)),
+		P50:  quantile(0.5),
+		P90:  quantile(0.9),
+		P99:  quantile(0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+// Report contains the results of a simulation. Emitted counts
+// the generated events accepted by their targets, Failed those
+// which could not be emitted, and Received the events reaching
+// the measured cells.
+type Report struct {
+	Duration   time.Duration
+	Emitted    int
+	Failed     int
+	Received   int
+	EmitRate   float64
+	Throughput float64
+	Latency    Latency
+	Stats      cells.EnvironmentStats
+}
+
+// String implements the fmt.Stringer interface.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "duration    %v\n", r.Duration)
+	fmt.Fprintf(&b, "emitted     %d (%.1f/s), %d failed\n", r.Emitted, r.EmitRate, r.Failed)
+	fmt.Fprintf(&b, "received    %d (%.1f/s)\n", r.Received, r.Throughput)
+	fmt.Fprintf(&b, "latency     min %v / mean %v / p50 %v / p90 %v / p99 %v / max %v\n",
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	for _, cs := range r.Stats.Cells {
+		fmt.Fprintf(&b, "cell %-20q processed %d, dropped %d, errors %d, queue max %d, avg %v\n",
+			cs.ID, cs.Processed, cs.Dropped, cs.Errors, cs.QueueHighWatermark, cs.AverageProcessing)
+	}
+	return b.String()
+}
+
+//--------------------
+// SIMULATION
+//--------------------
+
+// Load describes the events a generator emits to a target cell.
+type Load struct {
+	Target    string
+	Generator Generator
+}
+
+// Simulation runs loads against the cells of an environment.
+type Simulation struct {
+	env   cells.Environment
+	loads []Load
+	probe *probeBehavior
+}
+
+// New creates a simulation of the loads in the environment.
+func New(env cells.Environment, loads ...Load) *Simulation {
+	return &Simulation{
+		env:   env,
+		loads: loads,
+	}
+}
+
+// Measure subscribes a probe to the cells with the given IDs.
+// It measures the latencies of all events they emit.
+func (s *Simulation) Measure(ids ...string) error {
+	if s.probe == nil {
+		probe := &probeBehavior{}
+		if err := s.env.StartCell(ProbeID, probe); err != nil {
+			return err
+		}
+		s.probe = probe
+	}
+	for _, id := range ids {
+		if err := s.env.Subscribe(id, ProbeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run emits the generated events for the given duration, or until
+// all generators ended if it is zero, and reports the results.
+func (s *Simulation) Run(ctx context.Context, duration time.Duration) (*Report, error) {
+	if len(s.loads) == 0 {
+		return nil, errors.New(ErrNoLoad, errorMessages)
+	}
+	// Emitted events get the values but not the deadline
+	// of the simulation.
+	parent := ctx
+	if duration > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	if s.probe != nil {
+		s.probe.reset()
+	}
+	var emitted, failed int64
+	var wg sync.WaitGroup
+	started := time.Now()
+	for _, load := range s.loads {
+		wg.Add(1)
+		go func(load Load) {
+			defer wg.Done()
+			e, f := s.run(ctx, parent, load)
+			atomic.AddInt64(&emitted, int64(e))
+			atomic.AddInt64(&failed, int64(f))
+		}(load)
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+	// Let the cells work off their queues.
+	bctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.env.Barrier(bctx)
+	report := &Report{
+		Duration: elapsed,
+		Emitted:  int(emitted),
+		Failed:   int(failed),
+		EmitRate: float64(emitted) / elapsed.Seconds(),
+		Stats:    s.env.Stats(),
+	}
+	if s.probe != nil {
+		latencies := s.probe.latencies()
+		report.Received = len(latencies)
+		report.Throughput = float64(len(latencies)) / elapsed.Seconds()
+		report.Latency = newLatency(latencies)
+	}
+	return report, nil
+}
+
+// run emits the events of one load until the context is done
+// or its generator ends.
+func (s *Simulation) run(ctx, parent context.Context, load Load) (int, int) {
+	emitted, failed := 0, 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		pause, topic, payload, ok := load.Generator.Next()
+		if !ok {
+			return emitted, failed
+		}
+		if pause > 0 {
+			timer.Reset(pause)
+			select {
+			case <-ctx.Done():
+				return emitted, failed
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return emitted, failed
+		}
+		ectx := context.WithValue(parent, sentKey{}, time.Now())
+		if err := s.env.EmitNew(ectx, load.Target, topic, payload); err != nil {
+			failed++
+			continue
+		}
+		emitted++
+	}
+}
+
+//--------------------
+// PROBE
+//--------------------
+
+// probeBehavior measures the latencies of the received events.
+type probeBehavior struct {
+	mutex    sync.Mutex
+	measured []time.Duration
+}
+
+// Init implements the cells.Behavior interface.
+func (b *probeBehavior) Init(c cells.Cell) error {
+	return nil
+}
+
+// Terminate implements the cells.Behavior interface.
+func (b *probeBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent implements the cells.Behavior interface.
+func (b *probeBehavior) ProcessEvent(event cells.Event) error {
+	ctx := event.Context()
+	if ctx == nil {
+		return nil
+	}
+	sent, ok := ctx.Value(sentKey{}).(time.Time)
+	if !ok {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.measured = append(b.measured, time.Since(sent))
+	return nil
+}
+
+// Recover implements the cells.Behavior interface.
+func (b *probeBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// reset drops the measured latencies.
+func (b *probeBehavior) reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.measured = nil
+}
+
+// latencies returns a copy of the measured latencies.
+func (b *probeBehavior) latencies() []time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]time.Duration(nil), b.measured...)
+}
+
+// EOF
@@ -0,0 +1,144 @@
+// Tideland Go Cells - Simulate - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package simulate_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/simulate"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestSimulation tests running a load and reporting the results.
+func TestSimulation(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("simulation")
+	defer env.Stop()
+
+	env.StartCell("in", &forwardBehavior{})
+	env.StartCell("out", &forwardBehavior{})
+	env.Subscribe("in", "out")
+
+	sim := simulate.New(env)
+	_, err := sim.Run(ctx, time.Second)
+	assert.True(simulate.IsNoLoadError(err))
+
+	sim = simulate.New(env,
+		simulate.Load{Target: "in", Generator: simulate.ConstantRate("a", 200, nil)},
+		simulate.Load{Target: "in", Generator: simulate.Poisson("b", 200, nil)},
+		simulate.Load{Target: "unknown", Generator: simulate.ConstantRate("c", 100, nil)},
+	)
+	err = sim.Measure("out")
+	assert.Nil(err)
+	report, err := sim.Run(ctx, 250*time.Millisecond)
+	assert.Nil(err)
+	assert.True(report.Emitted > 50)
+	assert.True(report.Failed > 10)
+	assert.Equal(report.Received, report.Emitted)
+	assert.True(report.Latency.Max >= report.Latency.P50)
+	assert.True(report.Latency.P50 >= report.Latency.Min)
+	out, ok := report.Stats.Cell("out")
+	assert.True(ok)
+	assert.Equal(out.Processed, uint64(report.Emitted))
+	assert.Contents(`cell "out"`, report.String())
+}
+
+// TestBursty tests the pauses of the bursty generator.
+func TestBursty(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	g := simulate.Bursty("burst", 1000, 3, time.Second, func(n int) interface{} {
+		return n * 10
+	})
+
+	pauses := []time.Duration{}
+	for i := 0; i < 7; i++ {
+		pause, topic, payload, ok := g.Next()
+		assert.True(ok)
+		assert.Equal(topic, "burst")
+		assert.Equal(payload, i*10)
+		pauses = append(pauses, pause)
+	}
+	ms := time.Millisecond
+	assert.Equal(pauses, []time.Duration{0, ms, ms, time.Second, ms, ms, time.Second})
+}
+
+// TestReplayFile tests replaying events from a JSON lines file.
+func TestReplayFile(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	dir, err := ioutil.TempDir("", "simulate")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "events.jsonl")
+	lines := `{"timestamp":"2017-10-01T12:00:00Z","topic":"a","payload":{"x":1}}
+{"timestamp":"2017-10-01T12:00:02Z","topic":"b","payload":{"x":2}}
+`
+	err = ioutil.WriteFile(filename, []byte(lines), 0644)
+	assert.Nil(err)
+
+	g, err := simulate.ReplayFile(filename, 2.0)
+	assert.Nil(err)
+	pause, topic, payload, ok := g.Next()
+	assert.True(ok)
+	assert.Equal(pause, time.Duration(0))
+	assert.Equal(topic, "a")
+	assert.Equal(payload, cells.PayloadValues{"x": 1.0})
+	pause, topic, _, ok = g.Next()
+	assert.True(ok)
+	assert.Equal(pause, time.Second)
+	assert.Equal(topic, "b")
+	_, _, _, ok = g.Next()
+	assert.False(ok)
+
+	_, err = simulate.ReplayFile(filepath.Join(dir, "missing.jsonl"), 1.0)
+	assert.True(simulate.IsReplayFileError(err))
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// forwardBehavior emits all events with their context.
+type forwardBehavior struct {
+	cell cells.Cell
+}
+
+func (b *forwardBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+func (b *forwardBehavior) Terminate() error {
+	return nil
+}
+
+func (b *forwardBehavior) ProcessEvent(event cells.Event) error {
+	return b.cell.EmitNew(event.Context(), event.Topic(), event.Payload())
+}
+
+func (b *forwardBehavior) Recover(r interface{}) error {
+	return nil
+}
+
+// EOF
@@ -0,0 +1,400 @@
+// Tideland Go Cells - Snapshot Store
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// checkpointKeyPrefix starts the keys of stored checkpoints.
+	checkpointKeyPrefix = "checkpoint-"
+
+	// checkpointKeySuffix ends the keys of stored checkpoints.
+	checkpointKeySuffix = ".json"
+)
+
+//--------------------
+// SNAPSHOT STORE
+//--------------------
+
+// SnapshotStore stores checkpoints.
+type SnapshotStore interface {
+	// SaveCheckpoint stores the checkpoint and removes
+	// those exceeding the retention.
+	SaveCheckpoint(cp *Checkpoint) error
+
+	// LatestCheckpoint returns the latest stored checkpoint.
+	// If none has been stored yet it is nil.
+	LatestCheckpoint() (*Checkpoint, error)
+}
+
+// storedCheckpoint is the envelope of a stored checkpoint
+// containing its checksum.
+type storedCheckpoint struct {
+	Checksum   string          `json:"checksum"`
+	Checkpoint json.RawMessage `json:"checkpoint"`
+}
+
+// encodeCheckpoint returns the checkpoint as JSON together
+// with its SHA-256 checksum.
+func encodeCheckpoint(cp *Checkpoint) ([]byte, error) {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return json.Marshal(storedCheckpoint{
+		Checksum:   hex.EncodeToString(sum[:]),
+		Checkpoint: data,
+	})
+}
+
+// decodeCheckpoint verifies the checksum and returns the
+// decoded checkpoint.
+func decodeCheckpoint(key string, data []byte) (*Checkpoint, error) {
+	var stored storedCheckpoint
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, errors.Annotate(err, ErrCorruptCheckpoint, errorMessages, key)
+	}
+	sum := sha256.Sum256(stored.Checkpoint)
+	if hex.EncodeToString(sum[:]) != stored.Checksum {
+		return nil, errors.New(ErrCorruptCheckpoint, errorMessages, key)
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(stored.Checkpoint, cp); err != nil {
+		return nil, errors.Annotate(err, ErrCorruptCheckpoint, errorMessages, key)
+	}
+	return cp, nil
+}
+
+// checkpointKey returns the key of a checkpoint. The keys sort
+// in the order the checkpoints have been taken.
+func checkpointKey(cp *Checkpoint) string {
+	return fmt.Sprintf("%s%020d-%020d%s", checkpointKeyPrefix, cp.Taken.UnixNano(), cp.ID, checkpointKeySuffix)
+}
+
+// isCheckpointKey checks if the key is the one of a checkpoint.
+func isCheckpointKey(key string) bool {
+	return strings.HasPrefix(key, checkpointKeyPrefix) && strings.HasSuffix(key, checkpointKeySuffix)
+}
+
+// kvSnapshotStore implements the SnapshotStore interface
+// based on a key/value store.
+type kvSnapshotStore struct {
+	mutex  sync.Mutex
+	kv     KV
+	retain int
+}
+
+// NewKVSnapshotStore creates a snapshot store keeping the last retain
+// checkpoints in the key/value store, all if retain is 0. Any embedded
+// database like bbolt can be used by implementing KV for a bucket.
+func NewKVSnapshotStore(kv KV, retain int) SnapshotStore {
+	return &kvSnapshotStore{
+		kv:     kv,
+		retain: retain,
+	}
+}
+
+// SaveCheckpoint implements the SnapshotStore interface.
+func (s *kvSnapshotStore) SaveCheckpoint(cp *Checkpoint) error {
+	data, err := encodeCheckpoint(cp)
+	if err != nil {
+		return errors.Annotate(err, ErrSnapshotStore, errorMessages, "save")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.kv.Put(checkpointKey(cp), data); err != nil {
+		return errors.Annotate(err, ErrSnapshotStore, errorMessages, "save")
+	}
+	if s.retain <= 0 {
+		return nil
+	}
+	keys, err := s.keys()
+	if err != nil {
+		return errors.Annotate(err, ErrSnapshotStore, errorMessages, "save")
+	}
+	for len(keys) > s.retain {
+		if err := s.kv.Delete(keys[0]); err != nil {
+			return errors.Annotate(err, ErrSnapshotStore, errorMessages, "save")
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// LatestCheckpoint implements the SnapshotStore interface.
+func (s *kvSnapshotStore) LatestCheckpoint() (*Checkpoint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys, err := s.keys()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrSnapshotStore, errorMessages, "load")
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	key := keys[len(keys)-1]
+	data, ok, err := s.kv.Get(key)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrSnapshotStore, errorMessages, "load")
+	}
+	if !ok {
+		return nil, nil
+	}
+	return decodeCheckpoint(key, data)
+}
+
+// keys returns the sorted keys of the stored checkpoints.
+func (s *kvSnapshotStore) keys() ([]string, error) {
+	all, err := s.kv.Keys()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range all {
+		if isCheckpointKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//--------------------
+// FILE SNAPSHOT STORE
+//--------------------
+
+// directoryKV implements the KV interface with one file
+// per key in a directory.
+type directoryKV struct {
+	dir string
+}
+
+// NewFileSnapshotStore creates a snapshot store writing the last
+// retain checkpoints as files into the directory, all if retain is 0.
+func NewFileSnapshotStore(dir string, retain int) SnapshotStore {
+	return NewKVSnapshotStore(&directoryKV{dir}, retain)
+}
+
+// Get implements the KV interface.
+func (kv *directoryKV) Get(key string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(kv.dir, key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Put implements the KV interface.
+func (kv *directoryKV) Put(key string, value []byte) error {
+	if err := os.MkdirAll(kv.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(kv.dir, "."+key)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(kv.dir, key))
+}
+
+// Delete implements the KV interface.
+func (kv *directoryKV) Delete(key string) error {
+	err := os.Remove(filepath.Join(kv.dir, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Keys implements the KV interface.
+func (kv *directoryKV) Keys() ([]string, error) {
+	infos, err := ioutil.ReadDir(kv.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, info := range infos {
+		if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			keys = append(keys, info.Name())
+		}
+	}
+	return keys, nil
+}
+
+//--------------------
+// OBJECT SNAPSHOT STORE
+//--------------------
+
+// ObjectStorage is the small interface to an object storage like
+// S3, GCS, or minio needed by the object snapshot store.
+type ObjectStorage interface {
+	// PutObject writes the content with the given key.
+	PutObject(ctx context.Context, key string, content []byte) error
+
+	// GetObject returns the content of the object with the key.
+	GetObject(ctx context.Context, key string) ([]byte, error)
+
+	// DeleteObject removes the object with the key.
+	DeleteObject(ctx context.Context, key string) error
+
+	// ListObjects returns the keys of the objects starting
+	// with the prefix.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+// objectKV implements the KV interface for an object storage.
+type objectKV struct {
+	storage ObjectStorage
+	prefix  string
+}
+
+// NewObjectSnapshotStore creates a snapshot store writing the last
+// retain checkpoints as objects with the key prefix into the object
+// storage, all if retain is 0.
+func NewObjectSnapshotStore(storage ObjectStorage, prefix string, retain int) SnapshotStore {
+	return NewKVSnapshotStore(&objectKV{storage, prefix}, retain)
+}
+
+// Get implements the KV interface. The keys are those of
+// listed objects, so they exist.
+func (kv *objectKV) Get(key string) ([]byte, bool, error) {
+	data, err := kv.storage.GetObject(context.Background(), kv.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Put implements the KV interface.
+func (kv *objectKV) Put(key string, value []byte) error {
+	return kv.storage.PutObject(context.Background(), kv.prefix+key, value)
+}
+
+// Delete implements the KV interface.
+func (kv *objectKV) Delete(key string) error {
+	return kv.storage.DeleteObject(context.Background(), kv.prefix+key)
+}
+
+// Keys implements the KV interface.
+func (kv *objectKV) Keys() ([]string, error) {
+	objects, err := kv.storage.ListObjects(context.Background(), kv.prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, strings.TrimPrefix(object, kv.prefix))
+	}
+	return keys, nil
+}
+
+//--------------------
+// AUTO CHECKPOINT
+//--------------------
+
+// autoCheckpoint contains the configuration of the checkpoints
+// taken in an interval.
+type autoCheckpoint struct {
+	interval time.Duration
+	store    SnapshotStore
+	offset   func() int64
+}
+
+// WithAutoCheckpoint lets the environment take a checkpoint in each
+// interval and save it in the store. Failing checkpoints are logged.
+// The offset of the checkpoints is returned by the function set with
+// WithCheckpointOffset(), otherwise it is 0.
+func WithAutoCheckpoint(interval time.Duration, store SnapshotStore) Option {
+	return func(env *environment) {
+		if env.autoCheckpoint == nil {
+			env.autoCheckpoint = &autoCheckpoint{}
+		}
+		env.autoCheckpoint.interval = interval
+		env.autoCheckpoint.store = store
+	}
+}
+
+// WithCheckpointOffset sets the function returning the offset of
+// the source, e.g. a journal, for the automatic checkpoints.
+func WithCheckpointOffset(offset func() int64) Option {
+	return func(env *environment) {
+		if env.autoCheckpoint == nil {
+			env.autoCheckpoint = &autoCheckpoint{}
+		}
+		env.autoCheckpoint.offset = offset
+	}
+}
+
+// takeCheckpoints takes and saves the checkpoints until the
+// environment stops.
+func (env *environment) takeCheckpoints() {
+	ac := env.autoCheckpoint
+	ticker := time.NewTicker(ac.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-env.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var offset int64
+		if ac.offset != nil {
+			offset = ac.offset()
+		}
+		ctx, cancel := context.WithTimeout(env.ctx, ac.interval)
+		cp, err := env.Checkpoint(ctx, offset)
+		cancel()
+		if err == nil {
+			err = ac.store.SaveCheckpoint(cp)
+		}
+		if err != nil && env.ctx.Err() == nil {
+			logger.Errorf("cells environment %q cannot take checkpoint: %v", env.ID(), err)
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,66 @@
+// Tideland Go Cells - Spawning
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// MISSING CELL HANDLER
+//--------------------
+
+// MissingCellHandler is called when an event is emitted to a cell
+// which does not exist. If it returns a behavior and true the cell
+// is started with it and receives the event, e.g. one aggregator
+// per device ID derived from the cell ID.
+type MissingCellHandler func(id string) (Behavior, bool)
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// SetMissingCellHandler implements the Environment interface.
+func (env *environment) SetMissingCellHandler(handler MissingCellHandler) {
+	env.spawnMutex.Lock()
+	defer env.spawnMutex.Unlock()
+	env.missingCell = handler
+}
+
+// target returns the cell events are emitted to. If it doesn't
+// exist the missing cell handler may spawn it.
+func (env *environment) target(id string) (*cell, error) {
+	c, err := env.cells.cell(id)
+	if err == nil || !IsInvalidIDError(err) {
+		return c, err
+	}
+	env.spawnMutex.Lock()
+	defer env.spawnMutex.Unlock()
+	if env.missingCell == nil {
+		return nil, err
+	}
+	// Another emit may have spawned the cell meanwhile.
+	if c, serr := env.cells.cell(id); serr == nil {
+		return c, nil
+	}
+	behavior, ok := env.missingCell(id)
+	if !ok || behavior == nil {
+		return nil, err
+	}
+	if err := env.StartCell(id, behavior); err != nil {
+		return nil, err
+	}
+	logger.Infof("cell %q spawned by missing cell handler", id)
+	return env.cells.cell(id)
+}
+
+// EOF
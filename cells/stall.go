@@ -0,0 +1,258 @@
+// Tideland Go Cells - Stall Detection
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// minStallCheckInterval is the minimum interval the
+	// cells are checked for stalls.
+	minStallCheckInterval = 10 * time.Millisecond
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// WithStallDetection lets the environment watch for cells with queued
+// events which did not complete processing an event within maxIdle,
+// e.g. because the behavior is blocked. A stall is logged together
+// with the stack of the goroutine of the cell and emitted with the
+// topic TopicCellStalled to the supervisor set with WithSupervisor().
+// Cells started with RestartOnStall() are restarted.
+func WithStallDetection(maxIdle time.Duration) Option {
+	return func(env *environment) {
+		env.stallMaxIdle = maxIdle
+	}
+}
+
+// RestartOnStall lets a stalled cell be replaced by a new one with
+// the same ID, options, and subscriptions, running a behavior created
+// by the factory. The queued events are passed to the new cell, the
+// blocked goroutine of the stalled one is abandoned.
+func RestartOnStall(factory func() (Behavior, error)) CellOption {
+	return func(c *cell) {
+		c.restartOnStall = factory
+	}
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// watchStalls checks the cells for stalls until the
+// environment stops.
+func (env *environment) watchStalls() {
+	interval := env.stallMaxIdle / 4
+	if interval < minStallCheckInterval {
+		interval = minStallCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-env.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		select {
+		case <-env.gate():
+		default:
+			// Gated cells don't process.
+			continue
+		}
+		cs, _ := env.cells.cellsOf()
+		now := time.Now()
+		for _, c := range cs {
+			if idle, ok := c.isStalled(now, env.stallMaxIdle); ok {
+				env.handleStall(c, idle)
+			}
+		}
+	}
+}
+
+// handleStall reports a stalled cell and restarts it if wanted.
+func (env *environment) handleStall(c *cell, idle time.Duration) {
+	queued := int(atomic.LoadInt64(&c.pending))
+	stack := goroutineStack(atomic.LoadInt64(&c.goroutine))
+	logger.Errorf("cell %q stalled for %v with %d queued events:\n%s", c.id, idle, queued, stack)
+	restarted := false
+	if c.restartOnStall != nil {
+		if err := env.restartStalled(c, idle); err != nil {
+			logger.Errorf("cell %q cannot be restarted after stall: %v", c.id, err)
+		} else {
+			restarted = true
+		}
+	}
+	if env.supervisor == "" || env.supervisor == c.id {
+		return
+	}
+	err := env.EmitNew(context.Background(), env.supervisor, TopicCellStalled, PayloadValues{
+		PayloadCellStalledID:        c.id,
+		PayloadCellStalledIdle:      idle,
+		PayloadCellStalledQueued:    queued,
+		PayloadCellStalledStack:     stack,
+		PayloadCellStalledRestarted: restarted,
+	})
+	if err != nil {
+		logger.Errorf("cell %q cannot report stall to supervisor %q: %v", c.id, env.supervisor, err)
+	}
+}
+
+// restartStalled replaces the stalled cell by a new one and passes
+// the queued events to it.
+func (env *environment) restartStalled(old *cell, idle time.Duration) error {
+	behavior, err := old.restartOnStall()
+	if err != nil {
+		return err
+	}
+	c, err := env.cells.replaceCell(env, old, behavior)
+	if err != nil {
+		return err
+	}
+	old.emitTimeoutTicker.Stop()
+	old.loop.Kill(errors.New(ErrStalled, errorMessages, old.id, idle))
+	for {
+		select {
+		case event := <-old.eventc:
+			if err := c.ProcessEvent(event); err != nil {
+				logger.Errorf("cell %q lost event %q after restart: %v", c.id, event.Topic(), err)
+			}
+		default:
+			logger.Warningf("cell %q restarted after stall", c.id)
+			return nil
+		}
+	}
+}
+
+//--------------------
+// REGISTRY
+//--------------------
+
+// replaceCell starts a new cell with the ID, options, and
+// subscriptions of the old one and replaces it.
+func (r *registry) replaceCell(env *environment, old *cell, behavior Behavior) (*cell, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cells[old.id] != old {
+		return nil, errors.New(ErrInvalidID, errorMessages, old.id)
+	}
+	c, err := newCell(env, old.id, behavior, old.options...)
+	if err != nil {
+		return nil, err
+	}
+	peer := func(pc *cell) *cell {
+		if pc == old {
+			return c
+		}
+		return pc
+	}
+	old.emitters.do(func(ec *cell) error {
+		ec = peer(ec)
+		ec.subscribers.remove(old.id)
+		ec.subscribers.add(c)
+		c.emitters.add(ec)
+		return nil
+	})
+	old.subscribers.do(func(sc *cell) error {
+		sc = peer(sc)
+		sc.emitters.remove(old.id)
+		sc.emitters.add(c)
+		c.subscribers.add(sc)
+		return nil
+	})
+	if f := old.fanout.Load(); f != nil {
+		c.fanout.Store(f)
+	}
+	if p := old.primary.Load(); p != nil {
+		c.primary.Store(p)
+	}
+	r.cells[old.id] = c
+	return c, nil
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// isStalled checks if the cell has queued events but made no
+// progress since maxIdle. A stall is reported only once.
+func (c *cell) isStalled(now time.Time, maxIdle time.Duration) (time.Duration, bool) {
+	if atomic.LoadInt64(&c.pending) <= 0 {
+		return 0, false
+	}
+	idle := now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastProgress)))
+	if idle <= maxIdle {
+		return 0, false
+	}
+	return idle, atomic.CompareAndSwapInt32(&c.stalled, 0, 1)
+}
+
+// progressed marks the progress of the cell.
+func (c *cell) progressed(t time.Time) {
+	atomic.StoreInt64(&c.lastProgress, t.UnixNano())
+	atomic.StoreInt32(&c.stalled, 0)
+}
+
+//--------------------
+// GOROUTINES
+//--------------------
+
+// goroutineID returns the ID of the current goroutine. It is
+// only used to find its stack for stall reports.
+func goroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStack returns the stack of the goroutine with the ID.
+func goroutineStack(id int64) string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	prefix := []byte(fmt.Sprintf("goroutine %d ", id))
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return string(stack)
+		}
+	}
+	return fmt.Sprintf("goroutine %d not found", id)
+}
+
+// EOF
@@ -0,0 +1,180 @@
+// Tideland Go Cells - State
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync"
+)
+
+//--------------------
+// KEY/VALUE STATE
+//--------------------
+
+// KV is the key/value store of the state of one cell.
+type KV interface {
+	// Get returns the value of the key and if it exists.
+	Get(key string) ([]byte, bool, error)
+
+	// Put sets the value of the key.
+	Put(key string, value []byte) error
+
+	// Delete removes the key.
+	Delete(key string) error
+
+	// Keys returns the sorted keys.
+	Keys() ([]string, error)
+}
+
+// StateStore provides the key/value stores of the cells. Each cell
+// uses its own namespace, which is its ID. So the state survives a
+// restart of a cell with the same ID.
+type StateStore interface {
+	// Namespace returns the key/value store of the namespace.
+	// Multiple calls return stores accessing the same data.
+	Namespace(namespace string) KV
+}
+
+// WithStateStore sets the store of the cell states. Default is
+// a store keeping the states in memory.
+func WithStateStore(store StateStore) Option {
+	return func(env *environment) {
+		if store != nil {
+			env.states = store
+		}
+	}
+}
+
+// State implements the Cell interface.
+func (c *cell) State() KV {
+	return c.env.states.Namespace(c.id)
+}
+
+// snapshotState returns a copy of the state of the cell. It is
+// nil if the state is empty.
+func (c *cell) snapshotState() (map[string][]byte, error) {
+	kv := c.State()
+	keys, err := kv.Keys()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	state := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, ok, err := kv.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			state[key] = value
+		}
+	}
+	return state, nil
+}
+
+// restoreState replaces the state of the cell.
+func (c *cell) restoreState(state map[string][]byte) error {
+	kv := c.State()
+	keys, err := kv.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, ok := state[key]; !ok {
+			if err := kv.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	for key, value := range state {
+		if err := kv.Put(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//--------------------
+// MEMORY STATE STORE
+//--------------------
+
+// memoryStateStore implements the StateStore interface in memory.
+type memoryStateStore struct {
+	mutex      sync.RWMutex
+	namespaces map[string]map[string][]byte
+}
+
+// NewMemoryStateStore creates a state store keeping the
+// states in memory.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{
+		namespaces: make(map[string]map[string][]byte),
+	}
+}
+
+// Namespace implements the StateStore interface.
+func (s *memoryStateStore) Namespace(namespace string) KV {
+	return &memoryKV{s, namespace}
+}
+
+// memoryKV implements the KV interface for one namespace
+// of the memory state store.
+type memoryKV struct {
+	store     *memoryStateStore
+	namespace string
+}
+
+// Get implements the KV interface.
+func (kv *memoryKV) Get(key string) ([]byte, bool, error) {
+	kv.store.mutex.RLock()
+	defer kv.store.mutex.RUnlock()
+	value, ok := kv.store.namespaces[kv.namespace][key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), value...), true, nil
+}
+
+// Put implements the KV interface.
+func (kv *memoryKV) Put(key string, value []byte) error {
+	kv.store.mutex.Lock()
+	defer kv.store.mutex.Unlock()
+	values, ok := kv.store.namespaces[kv.namespace]
+	if !ok {
+		values = make(map[string][]byte)
+		kv.store.namespaces[kv.namespace] = values
+	}
+	values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements the KV interface.
+func (kv *memoryKV) Delete(key string) error {
+	kv.store.mutex.Lock()
+	defer kv.store.mutex.Unlock()
+	delete(kv.store.namespaces[kv.namespace], key)
+	return nil
+}
+
+// Keys implements the KV interface.
+func (kv *memoryKV) Keys() ([]string, error) {
+	kv.store.mutex.RLock()
+	defer kv.store.mutex.RUnlock()
+	values := kv.store.namespaces[kv.namespace]
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// EOF
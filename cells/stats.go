@@ -0,0 +1,124 @@
+// Tideland Go Cells - Statistics
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------
+// STATISTICS
+//--------------------
+
+// CellStats contains the counters of one cell since its start.
+type CellStats struct {
+	ID                 string
+	Started            time.Time
+	Emitted            uint64
+	Processed          uint64
+	Dropped            uint64
+	Errors             uint64
+	QueueDepth         int
+	QueueHighWatermark int
+	AverageProcessing  time.Duration
+}
+
+// EnvironmentStats contains the statistics of all cells of an
+// environment, sorted by their IDs, and the usage of aliased topics.
+type EnvironmentStats struct {
+	ID      string
+	Taken   time.Time
+	Cells   []CellStats
+	Aliases []TopicAliasStats
+}
+
+// Cell returns the statistics of the cell with the given ID.
+func (es EnvironmentStats) Cell(id string) (CellStats, bool) {
+	i := sort.Search(len(es.Cells), func(i int) bool {
+		return es.Cells[i].ID >= id
+	})
+	if i < len(es.Cells) && es.Cells[i].ID == id {
+		return es.Cells[i], true
+	}
+	return CellStats{}, false
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// Stats implements the Environment interface.
+func (env *environment) Stats() EnvironmentStats {
+	cs, _ := env.cells.cellsOf()
+	stats := EnvironmentStats{
+		ID:      env.id,
+		Taken:   time.Now(),
+		Cells:   make([]CellStats, len(cs)),
+		Aliases: env.aliases.stats(),
+	}
+	for i, c := range cs {
+		stats.Cells[i] = c.stats()
+	}
+	sort.Slice(stats.Cells, func(i, j int) bool {
+		return stats.Cells[i].ID < stats.Cells[j].ID
+	})
+	return stats
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// stats returns the current counters of the cell.
+func (c *cell) stats() CellStats {
+	s := CellStats{
+		ID:                 c.id,
+		Started:            c.started,
+		Emitted:            atomic.LoadUint64(&c.emitted),
+		Processed:          atomic.LoadUint64(&c.processed),
+		Dropped:            atomic.LoadUint64(&c.dropped),
+		Errors:             atomic.LoadUint64(&c.errors),
+		QueueDepth:         int(atomic.LoadInt64(&c.pending)),
+		QueueHighWatermark: int(atomic.LoadInt64(&c.highWatermark)),
+	}
+	if s.Processed > 0 {
+		s.AverageProcessing = time.Duration(atomic.LoadUint64(&c.processingNanos) / s.Processed)
+	}
+	return s
+}
+
+// enqueued counts a new pending event and keeps the
+// high-watermark of the queue.
+func (c *cell) enqueued() {
+	depth := atomic.AddInt64(&c.pending, 1)
+	if depth == 1 && c.env.stallMaxIdle > 0 {
+		// The idle time of a stall starts now.
+		c.progressed(time.Now())
+	}
+	for {
+		high := atomic.LoadInt64(&c.highWatermark)
+		if depth <= high || atomic.CompareAndSwapInt64(&c.highWatermark, high, depth) {
+			return
+		}
+	}
+}
+
+// rejected uncounts a pending event which could not be
+// enqueued and counts it as dropped.
+func (c *cell) rejected() {
+	atomic.AddInt64(&c.pending, -1)
+	atomic.AddUint64(&c.dropped, 1)
+}
+
+// EOF
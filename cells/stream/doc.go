@@ -0,0 +1,27 @@
+// Tideland Go Cells - Stream
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package stream provides a functional facade for building chains of
+// cells. Each stage starts a cell with a standard behavior and subscribes
+// it to the previous one, so the result is an ordinary topology.
+//
+//     err := stream.From(env, "orders").
+//         Filter(isPaid).
+//         Map(toInvoice).
+//         To("invoicer")
+//
+// Typed stages work on the default payload values of the events:
+//
+//     s := stream.MapT(stream.From(env, "prices"), func(p int) (float64, error) {
+//         return float64(p) / 100, nil
+//     })
+//
+// The IDs of the stage cells are built out of the ID of the source, the
+// kind of the stage, and a number, e.g. "orders:filter-1".
+package stream
+
+// EOF
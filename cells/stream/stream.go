@@ -0,0 +1,146 @@
+// Tideland Go Cells - Stream
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package stream
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// STREAM
+//--------------------
+
+// Stream is a chain of cells beginning at a source cell.
+type Stream struct {
+	env    cells.Environment
+	source string
+	last   string
+	err    error
+}
+
+// From starts a stream at the cell with the passed ID.
+func From(env cells.Environment, id string) *Stream {
+	s := &Stream{
+		env:    env,
+		source: id,
+		last:   id,
+	}
+	if !env.HasCell(id) {
+		s.err = fmt.Errorf("stream source cell %q does not exist", id)
+	}
+	return s
+}
+
+// Via appends a stage with the passed behavior. The kind is
+// used for the ID of the stage cell.
+func (s *Stream) Via(kind string, behavior cells.Behavior) *Stream {
+	if s.err != nil {
+		return s
+	}
+	id := s.nextID(kind)
+	if err := s.env.StartCell(id, behavior); err != nil {
+		s.err = err
+		return s
+	}
+	if err := s.env.Subscribe(s.last, id); err != nil {
+		s.err = err
+		return s
+	}
+	s.last = id
+	return s
+}
+
+// Filter appends a stage only passing the events matching the filter.
+func (s *Stream) Filter(f behaviors.Filter) *Stream {
+	return s.Via("filter", behaviors.NewFilterBehavior(f))
+}
+
+// Map appends a stage mapping the events.
+func (s *Stream) Map(m behaviors.Mapper) *Stream {
+	return s.Via("map", behaviors.NewMapperBehavior(m))
+}
+
+// Window appends a stage pushing the numeric default payload values
+// of the events into the window and emitting its statistics after each
+// one. The window is owned by the stage afterwards.
+func (s *Stream) Window(w *window.Window) *Stream {
+	return s.Via("window", newWindowBehavior(w))
+}
+
+// To subscribes the passed cells to the last stage and returns
+// the first error occurred while building the stream.
+func (s *Stream) To(ids ...string) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.env.Subscribe(s.last, ids...)
+}
+
+// ID returns the ID of the last cell of the stream, e.g. to
+// subscribe it later.
+func (s *Stream) ID() string {
+	return s.last
+}
+
+// Err returns the first error occurred while building the stream.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// nextID returns the first free ID for a stage cell.
+func (s *Stream) nextID(kind string) string {
+	for n := 1; ; n++ {
+		id := fmt.Sprintf("%s:%s-%d", s.source, kind, n)
+		if !s.env.HasCell(id) {
+			return id
+		}
+	}
+}
+
+//--------------------
+// TYPED STAGES
+//--------------------
+
+// MapT appends a stage mapping the default payload values of type In
+// to values of type Out. Events with other payloads are dropped, as
+// well as those the function returns an error for. Those are logged.
+func MapT[In, Out any](s *Stream, f func(in In) (Out, error)) *Stream {
+	return s.Map(func(id string, event cells.Event) (cells.Event, error) {
+		in, ok := event.Payload().GetDefault(nil).(In)
+		if !ok {
+			return nil, nil
+		}
+		out, err := f(in)
+		if err != nil {
+			logger.Warningf("stream stage %q cannot map event %q: %v", id, event.Topic(), err)
+			return nil, nil
+		}
+		return cells.NewEvent(event.Context(), event.Topic(), out)
+	})
+}
+
+// FilterT appends a stage only passing events with default payload
+// values of type T matching the filter.
+func FilterT[T any](s *Stream, f func(value T) bool) *Stream {
+	return s.Filter(func(event cells.Event) (bool, error) {
+		value, ok := event.Payload().GetDefault(nil).(T)
+		return ok && f(value), nil
+	})
+}
+
+// EOF
@@ -0,0 +1,78 @@
+// Tideland Go Cells - Stream - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package stream_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/stream"
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestStream tests building a stream of stages.
+func TestStream(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	env := cells.NewEnvironment("stream")
+	defer env.Stop()
+
+	env.StartCell("source", behaviors.NewBroadcasterBehavior())
+	env.StartCell("collector", behaviors.NewCollectorBehavior(100))
+
+	s := stream.From(env, "source").Filter(func(event cells.Event) (bool, error) {
+		return event.Topic() == "number", nil
+	})
+	s = stream.MapT(s, strconv.Atoi)
+	s = stream.FilterT(s, func(n int) bool {
+		return n%2 == 0
+	})
+	err := s.Window(window.New(time.Minute, 3)).To("collector")
+	assert.Nil(err)
+	assert.Equal(s.ID(), "source:window-1")
+	assert.True(env.HasCell("source:filter-1"))
+	assert.True(env.HasCell("source:map-1"))
+	assert.True(env.HasCell("source:filter-2"))
+
+	for i := 1; i <= 10; i++ {
+		env.EmitNew(ctx, "source", "number", strconv.Itoa(i))
+		env.EmitNew(ctx, "source", "other", strconv.Itoa(i))
+	}
+	env.EmitNew(ctx, "source", "number", "no number")
+	err = env.Barrier(ctx)
+	assert.Nil(err)
+
+	accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+	assert.Nil(err)
+	assert.Length(accessor, 5)
+	event, _ := accessor.PeekLast()
+	assert.Equal(event.Topic(), stream.TopicWindow)
+	stats, ok := event.Payload().GetDefault(nil).(window.Stats)
+	assert.True(ok)
+	assert.Equal(stats.Count, 3)
+	assert.Equal(stats.Sum, 24.0)
+
+	err = stream.From(env, "missing").Filter(nil).To("collector")
+	assert.NotNil(err)
+}
+
+// EOF
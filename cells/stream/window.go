@@ -0,0 +1,80 @@
+// Tideland Go Cells - Stream - Window
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package stream
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// TopicWindow labels an event containing the window.Stats
+	// of a window stage as default payload.
+	TopicWindow = "stream:window"
+)
+
+//--------------------
+// WINDOW BEHAVIOR
+//--------------------
+
+// windowBehavior pushes numeric values into a window.
+type windowBehavior struct {
+	cell   cells.Cell
+	window *window.Window
+}
+
+// newWindowBehavior creates the behavior of a window stage.
+func newWindowBehavior(w *window.Window) cells.Behavior {
+	return &windowBehavior{
+		window: w,
+	}
+}
+
+// Init the behavior.
+func (b *windowBehavior) Init(c cells.Cell) error {
+	b.cell = c
+	return nil
+}
+
+// Terminate the behavior.
+func (b *windowBehavior) Terminate() error {
+	return nil
+}
+
+// ProcessEvent pushes the value and emits the statistics.
+func (b *windowBehavior) ProcessEvent(event cells.Event) error {
+	var value float64
+	switch v := event.Payload().GetDefault(nil).(type) {
+	case int:
+		value = float64(v)
+	case int64:
+		value = float64(v)
+	case float64:
+		value = v
+	default:
+		return nil
+	}
+	b.window.Push(cells.EventTime(event), value)
+	return b.cell.EmitNew(event.Context(), TopicWindow, b.window.Stats())
+}
+
+// Recover from an error.
+func (b *windowBehavior) Recover(err interface{}) error {
+	b.window.Reset()
+	return nil
+}
+
+// EOF
@@ -0,0 +1,128 @@
+// Tideland Go Cells - Strict Mode
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// standardTopics are emitted by the environment itself, so they
+// are always registered.
+var standardTopics = map[string]bool{
+	TopicCellError:        true,
+	TopicCellPanic:        true,
+	TopicCellStalled:      true,
+	TopicHandoffCompleted: true,
+	TopicSlowProcessing:   true,
+}
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// WithTopics registers the topics emitted inside the environment.
+// Multiple calls add the topics. Together with StrictMode() emitting
+// unregistered topics fails.
+func WithTopics(topics ...string) Option {
+	return func(env *environment) {
+		if env.topics == nil {
+			env.topics = make(map[string]bool)
+		}
+		for _, topic := range topics {
+			env.topics[topic] = true
+		}
+	}
+}
+
+// StrictMode lets the environment check the emitted events to find
+// errors in topologies during development. If topics are registered
+// with WithTopics() emitting others returns an error. The standard
+// topics of the environment, commands ending with "!", and requests
+// ending with "?" are always allowed. Additionally cells emitting a
+// topic without any subscriber are logged once per cell and topic,
+// so dead branches are found.
+func StrictMode() Option {
+	return func(env *environment) {
+		env.strict = &strictMode{
+			unconsumed: make(map[string]bool),
+		}
+	}
+}
+
+//--------------------
+// STRICT MODE
+//--------------------
+
+// strictMode contains the cells and topics already logged
+// as unconsumed.
+type strictMode struct {
+	mutex      sync.Mutex
+	unconsumed map[string]bool
+}
+
+// logUnconsumed logs the first emitting of the topic by the
+// cell without subscribers.
+func (s *strictMode) logUnconsumed(id, topic string) {
+	key := id + "/" + topic
+	s.mutex.Lock()
+	logged := s.unconsumed[key]
+	s.unconsumed[key] = true
+	s.mutex.Unlock()
+	if !logged {
+		logger.Warningf("cell %q emits topic %q without subscribers", id, topic)
+	}
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// checkTopic returns an error if topics are registered and
+// the topic is not one of them.
+func (env *environment) checkTopic(topic string) error {
+	if len(env.topics) == 0 || env.topics[topic] || standardTopics[topic] {
+		return nil
+	}
+	if strings.HasSuffix(topic, "!") || strings.HasSuffix(topic, "?") {
+		return nil
+	}
+	return errors.New(ErrUnregisteredTopic, errorMessages, topic)
+}
+
+//--------------------
+// CELL
+//--------------------
+
+// checkEmit checks the topic of an event emitted by the cell
+// in strict mode.
+func (c *cell) checkEmit(topic string) error {
+	if err := c.env.checkTopic(topic); err != nil {
+		return err
+	}
+	c.subscribers.mutex.RLock()
+	n := len(c.subscribers.cells)
+	c.subscribers.mutex.RUnlock()
+	if n == 0 {
+		c.env.strict.logUnconsumed(c.id, topic)
+	}
+	return nil
+}
+
+// EOF
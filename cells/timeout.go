@@ -0,0 +1,100 @@
+// Tideland Go Cells - Process Timeout
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/golib/logger"
+)
+
+//--------------------
+// PROCESS TIMEOUT
+//--------------------
+
+// ProcessTimeout limits the duration of the processing of one event
+// by the behavior. When it is exceeded the context of the event is
+// canceled, so external calls using it return. The behavior has to
+// return though, it cannot be interrupted. The timeout is counted as
+// error in the trace buffer and the monitoring variable of the cell
+// ending with "process-timeouts". Then it is handled by the error
+// policy of the cell, only StopCellOnError keeps the cell working
+// like ContinueAndCount.
+func ProcessTimeout(d time.Duration) CellOption {
+	return func(c *cell) {
+		if d > 0 {
+			c.processTimeout = d
+		}
+	}
+}
+
+// SlowProcessingEvents lets a cell with a process timeout emit an
+// event with the topic TopicSlowProcessing to its subscribers when
+// the timeout is exceeded. The payload contains the topic of the
+// slow event and the timeout. The event is emitted asynchronously
+// when the timeout fires, so it is not ordered with the events the
+// cell emits while processing.
+func SlowProcessingEvents() CellOption {
+	return func(c *cell) {
+		c.slowProcessing = true
+	}
+}
+
+// timeoutContext is the context of an event during processing
+// with a timeout. Events emitted with it are based on the original
+// context, so they are not canceled by the timeout.
+type timeoutContext struct {
+	context.Context
+	parent context.Context
+}
+
+// withProcessTimeout returns the context for the processing of
+// the event with the timeout of the cell.
+func (c *cell) withProcessTimeout(event Event) (*timeoutContext, func()) {
+	parent := event.Context()
+	ctx, cancel := context.WithTimeout(parent, c.processTimeout)
+	tctx := &timeoutContext{ctx, parent}
+	stop := context.AfterFunc(ctx, func() {
+		if !tctx.exceeded() {
+			return
+		}
+		logger.Warningf("cell %q exceeds process timeout %v with event %q", c.id, c.processTimeout, event.Topic())
+		if c.slowProcessing {
+			c.EmitNew(parent, TopicSlowProcessing, PayloadValues{
+				PayloadSlowTopic:   event.Topic(),
+				PayloadSlowTimeout: c.processTimeout,
+			})
+		}
+	})
+	return tctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// exceeded checks if the process timeout has been exceeded and
+// not the original context is done.
+func (c *timeoutContext) exceeded() bool {
+	return c.Err() == context.DeadlineExceeded && c.parent.Err() == nil
+}
+
+// withoutProcessTimeout returns the original context of an event
+// processed with a timeout.
+func withoutProcessTimeout(ctx context.Context) context.Context {
+	if tctx, ok := ctx.(*timeoutContext); ok {
+		return tctx.parent
+	}
+	return ctx
+}
+
+// EOF
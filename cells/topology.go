@@ -0,0 +1,121 @@
+// Tideland Go Cells - Topology
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------
+// TOPOLOGY
+//--------------------
+
+// topologyNode describes one cell of the environment for
+// the rendering of the topology.
+type topologyNode struct {
+	id          string
+	subscribers []string
+	queueLen    int
+	queueCap    int
+	emitRate    float64
+}
+
+// label returns the label of the node containing the
+// queue usage.
+func (tn topologyNode) label() string {
+	return fmt.Sprintf("%s (%d/%d)", tn.id, tn.queueLen, tn.queueCap)
+}
+
+// edgeLabel returns the label for the edges of the node
+// containing its emit rate if it already emitted events.
+func (tn topologyNode) edgeLabel() string {
+	if tn.emitRate <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f/s", tn.emitRate)
+}
+
+// topology returns the nodes of all cells sorted by their ID.
+func (r *registry) topology() []topologyNode {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	nodes := []topologyNode{}
+	for id, rc := range r.cells {
+		subscribers := rc.subscribers.ids()
+		sort.Strings(subscribers)
+		node := topologyNode{
+			id:          id,
+			subscribers: subscribers,
+			queueLen:    len(rc.eventc),
+			queueCap:    cap(rc.eventc),
+		}
+		elapsed := time.Since(rc.started).Seconds()
+		if emitted := atomic.LoadUint64(&rc.emitted); emitted > 0 && elapsed > 0 {
+			node.emitRate = float64(emitted) / elapsed
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].id < nodes[j].id
+	})
+	return nodes
+}
+
+// writeDOT renders the topology in the GraphViz DOT format.
+func writeDOT(w io.Writer, name string, nodes []topologyNode) error {
+	lines := []string{fmt.Sprintf("digraph %q {", name)}
+	for _, node := range nodes {
+		lines = append(lines, fmt.Sprintf("\t%q [label=%q];", node.id, node.label()))
+	}
+	for _, node := range nodes {
+		attrs := ""
+		if label := node.edgeLabel(); label != "" {
+			attrs = fmt.Sprintf(" [label=%q]", label)
+		}
+		for _, subscriber := range node.subscribers {
+			lines = append(lines, fmt.Sprintf("\t%q -> %q%s;", node.id, subscriber, attrs))
+		}
+	}
+	lines = append(lines, "}")
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// writeMermaid renders the topology as Mermaid flowchart. Cell IDs
+// are replaced by generated node IDs, they are only used as labels.
+func writeMermaid(w io.Writer, nodes []topologyNode) error {
+	nodeIDs := make(map[string]string)
+	lines := []string{"graph LR"}
+	for i, node := range nodes {
+		nodeIDs[node.id] = fmt.Sprintf("c%d", i)
+		label := strings.Replace(node.label(), `"`, "#quot;", -1)
+		lines = append(lines, fmt.Sprintf("\t%s[\"%s\"]", nodeIDs[node.id], label))
+	}
+	for _, node := range nodes {
+		arrow := "-->"
+		if label := node.edgeLabel(); label != "" {
+			arrow = fmt.Sprintf("-->|%s|", label)
+		}
+		for _, subscriber := range node.subscribers {
+			lines = append(lines, fmt.Sprintf("\t%s %s %s", nodeIDs[node.id], arrow, nodeIDs[subscriber]))
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// EOF
@@ -0,0 +1,119 @@
+// Tideland Go Cells - Trace
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// maxTracePayloadLen is the maximum length of the payload
+// summary in trace entries.
+const maxTracePayloadLen = 128
+
+//--------------------
+// TRACE
+//--------------------
+
+// TraceEntry describes one event processed by a cell.
+type TraceEntry struct {
+	Timestamp time.Time
+	Topic     string
+	Payload   string
+	Duration  time.Duration
+	Err       error
+}
+
+// String implements the fmt.Stringer interface.
+func (te TraceEntry) String() string {
+	return fmt.Sprintf("<%s / %q / %s / %v / %v>",
+		te.Timestamp.Format(time.RFC3339Nano), te.Topic, te.Payload, te.Duration, te.Err)
+}
+
+// traceBuffer is a ring buffer for the last processed events.
+type traceBuffer struct {
+	mutex   sync.Mutex
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+// newTraceBuffer creates a trace buffer with the given size.
+func newTraceBuffer(size int) *traceBuffer {
+	return &traceBuffer{
+		entries: make([]TraceEntry, size),
+	}
+}
+
+// record adds the processing of an event to the buffer.
+func (tb *traceBuffer) record(event Event, start time.Time, err error) {
+	payload := "none"
+	if event.Payload() != nil {
+		payload = event.Payload().String()
+		if len(payload) > maxTracePayloadLen {
+			payload = payload[:maxTracePayloadLen] + "..."
+		}
+	}
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	tb.entries[tb.next] = TraceEntry{
+		Timestamp: start,
+		Topic:     event.Topic(),
+		Payload:   payload,
+		Duration:  time.Since(start),
+		Err:       err,
+	}
+	tb.next = (tb.next + 1) % len(tb.entries)
+	if tb.next == 0 {
+		tb.full = true
+	}
+}
+
+// trace returns the recorded entries, the oldest first.
+func (tb *traceBuffer) trace() []TraceEntry {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	if !tb.full {
+		return append([]TraceEntry{}, tb.entries[:tb.next]...)
+	}
+	return append(append([]TraceEntry{}, tb.entries[tb.next:]...), tb.entries[:tb.next]...)
+}
+
+// WithTraceBuffer lets the cell retain the last n processed events
+// with a summary of their payload, the processing duration, and a
+// potential error. They can be retrieved with Environment.Trace().
+func WithTraceBuffer(n int) CellOption {
+	return func(c *cell) {
+		if n > 0 {
+			c.traces = newTraceBuffer(n)
+		}
+	}
+}
+
+// Trace implements the Environment interface.
+func (env *environment) Trace(id string) ([]TraceEntry, error) {
+	c, err := env.cells.cell(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.traces == nil {
+		return nil, nil
+	}
+	return c.traces.trace(), nil
+}
+
+// EOF
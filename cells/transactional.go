@@ -0,0 +1,51 @@
+// Tideland Go Cells - Transactional Behaviors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CELL
+//--------------------
+
+// transact lets a transactional behavior process the event as
+// one unit of work.
+func (c *cell) transact(tb BehaviorTransactional, event Event) error {
+	if err := tb.Begin(event); err != nil {
+		tb.Rollback(err)
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			// Processing panicked, roll back before recovering.
+			r := recover()
+			tb.Rollback(errors.New(ErrEventRecovering, errorMessages, r))
+			panic(r)
+		}
+	}()
+	err := c.behavior.ProcessEvent(event)
+	done = true
+	if err != nil {
+		tb.Rollback(err)
+		return err
+	}
+	if err := tb.Commit(); err != nil {
+		tb.Rollback(err)
+		return err
+	}
+	return nil
+}
+
+// EOF
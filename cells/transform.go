@@ -0,0 +1,122 @@
+// Tideland Go Cells - Transform
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cells
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+)
+
+//--------------------
+// TRANSFORM
+//--------------------
+
+// Transform adapts an event emitted to a subscriber. If it returns
+// false the event is not delivered to the subscriber.
+type Transform func(event Event) (Event, bool)
+
+// RenameTopics returns a transform renaming the topics contained
+// in the mapping. Other events are passed unchanged.
+func RenameTopics(mapping map[string]string) Transform {
+	return func(event Event) (Event, bool) {
+		topic, ok := mapping[event.Topic()]
+		if !ok {
+			return event, true
+		}
+		return &adaptedEvent{event, topic, event.Payload()}, true
+	}
+}
+
+// ProjectPayload returns a transform reducing the payload of the
+// events to the passed keys.
+func ProjectPayload(keys ...string) Transform {
+	return func(event Event) (Event, bool) {
+		values := PayloadValues{}
+		for _, key := range keys {
+			if value := event.Payload().Get(key, nil); value != nil {
+				values[key] = value
+			}
+		}
+		return &adaptedEvent{event, event.Topic(), NewPayload(values)}, true
+	}
+}
+
+//--------------------
+// TRANSFORMS
+//--------------------
+
+// transforms manages the transforms of the subscribers of an emitter.
+type transforms struct {
+	mutex      sync.RWMutex
+	transforms map[string]Transform
+}
+
+// newTransforms creates the transform manager.
+func newTransforms() *transforms {
+	return &transforms{
+		transforms: make(map[string]Transform),
+	}
+}
+
+// set sets the transform of a subscriber.
+func (ts *transforms) set(subscriberID string, transform Transform) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.transforms[subscriberID] = transform
+}
+
+// remove deletes the transform of a subscriber.
+func (ts *transforms) remove(subscriberID string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	delete(ts.transforms, subscriberID)
+}
+
+// apply transforms the event for the subscriber if a
+// transform is set.
+func (ts *transforms) apply(subscriberID string, event Event) (Event, bool) {
+	ts.mutex.RLock()
+	if len(ts.transforms) == 0 {
+		ts.mutex.RUnlock()
+		return event, true
+	}
+	transform, ok := ts.transforms[subscriberID]
+	ts.mutex.RUnlock()
+	if !ok {
+		return event, true
+	}
+	return transform(event)
+}
+
+//--------------------
+// ENVIRONMENT
+//--------------------
+
+// SubscribeWith implements the Environment interface.
+func (env *environment) SubscribeWith(emitterID, subscriberID string, transform Transform) error {
+	ec, err := env.cells.cell(emitterID)
+	if err != nil {
+		return err
+	}
+	// Set the transform first, so no event passes untransformed.
+	if transform == nil {
+		ec.transforms.remove(subscriberID)
+	} else {
+		ec.transforms.set(subscriberID, transform)
+	}
+	if err := env.Subscribe(emitterID, subscriberID); err != nil {
+		ec.transforms.remove(subscriberID)
+		return err
+	}
+	return nil
+}
+
+// EOF
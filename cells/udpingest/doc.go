@@ -0,0 +1,28 @@
+// Tideland Go Cells - UDP Ingest
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package udpingest feeds events from embedded or edge devices into
+// a cells environment without a broker. Each UDP datagram contains
+// one event encoded with the msgpack codec. The listener decodes it
+// and emits topic and payload to a cell.
+//
+//     l, err := udpingest.Listen(env, ":7070", "sensors")
+//     ...
+//     defer l.Close()
+//
+// Devices only have to send a msgpack map with the keys "topic" and
+// "payload", Go programs can use the client.
+//
+//     c, err := udpingest.Dial("gateway:7070")
+//     ...
+//     err = c.Emit("temperature", 21.5)
+//
+// Like UDP itself the delivery is not guaranteed. Invalid datagrams
+// are logged and dropped.
+package udpingest
+
+// EOF
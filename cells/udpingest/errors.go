@@ -0,0 +1,41 @@
+// Tideland Go Cells - UDP Ingest - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package udpingest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrDatagramTooLarge = iota + 1
+)
+
+var errorMessages = errors.Messages{
+	ErrDatagramTooLarge: "encoded event with %d bytes exceeds maximum datagram size",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsDatagramTooLargeError checks if an error signals an event
+// too large for one datagram.
+func IsDatagramTooLargeError(err error) bool {
+	return errors.IsError(err, ErrDatagramTooLarge)
+}
+
+// EOF
@@ -0,0 +1,153 @@
+// Tideland Go Cells - UDP Ingest
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package udpingest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/codec"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	// MaxDatagramSize is the maximum size of an encoded event.
+	MaxDatagramSize = 65507
+)
+
+//--------------------
+// LISTENER
+//--------------------
+
+// Listener receives events as UDP datagrams and emits
+// them to a cell.
+type Listener struct {
+	env   cells.Environment
+	id    string
+	conn  net.PacketConn
+	codec codec.Codec
+	wg    sync.WaitGroup
+}
+
+// Listen starts listening for datagrams on the UDP address. The
+// decoded events are emitted with their topic and payload to the
+// cell with the given ID. So they get a new ID and timestamp of
+// the environment.
+func Listen(env cells.Environment, addr, id string) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{
+		env:   env,
+		id:    id,
+		conn:  conn,
+		codec: codec.NewMsgpackCodec(),
+	}
+	l.wg.Add(1)
+	go l.readLoop()
+	return l, nil
+}
+
+// Addr returns the address the listener is listening on.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close stops listening and waits until the last received
+// event is emitted.
+func (l *Listener) Close() error {
+	err := l.conn.Close()
+	l.wg.Wait()
+	return err
+}
+
+// readLoop receives and emits the datagrams until the
+// connection is closed.
+func (l *Listener) readLoop() {
+	defer l.wg.Done()
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+				continue
+			}
+			return
+		}
+		event, err := l.codec.Decode(context.Background(), buf[:n])
+		if err != nil {
+			logger.Warningf("udp ingest dropped datagram from %v: %v", from, err)
+			continue
+		}
+		if err := l.env.EmitNew(context.Background(), l.id, event.Topic(), event.Payload()); err != nil {
+			logger.Errorf("udp ingest cannot emit to %q: %v", l.id, err)
+		}
+	}
+}
+
+//--------------------
+// CLIENT
+//--------------------
+
+// Client sends events as UDP datagrams to a listener.
+type Client struct {
+	mutex sync.Mutex
+	conn  net.Conn
+	codec codec.Codec
+}
+
+// Dial creates a client sending to the UDP address of a listener.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:  conn,
+		codec: codec.NewMsgpackCodec(),
+	}, nil
+}
+
+// Emit sends an event with the topic and payload as one datagram.
+func (c *Client) Emit(topic string, payload interface{}) error {
+	event, err := cells.NewEvent(context.Background(), topic, payload)
+	if err != nil {
+		return err
+	}
+	data, err := c.codec.Encode(event)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxDatagramSize {
+		return errors.New(ErrDatagramTooLarge, errorMessages, len(data))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// Close closes the connection of the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// EOF
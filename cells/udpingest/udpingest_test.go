@@ -0,0 +1,74 @@
+// Tideland Go Cells - UDP Ingest - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package udpingest_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/udpingest"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestListenerClient tests sending events from a client
+// to a listener.
+func TestListenerClient(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	env := cells.NewEnvironment("udp-ingest")
+	defer env.Stop()
+
+	env.StartCell("collector", behaviors.NewCollectorBehavior(10))
+	l, err := udpingest.Listen(env, "127.0.0.1:0", "collector")
+	assert.Nil(err)
+	defer l.Close()
+	c, err := udpingest.Dial(l.Addr().String())
+	assert.Nil(err)
+	defer c.Close()
+
+	// Invalid datagrams are dropped.
+	raw, err := net.Dial("udp", l.Addr().String())
+	assert.Nil(err)
+	raw.Write([]byte("garbage"))
+	raw.Close()
+
+	assert.Nil(c.Emit("temperature", 21.5))
+	assert.Nil(c.Emit("humidity", cells.PayloadValues{"room": "kitchen", "value": 40}))
+	err = c.Emit("huge", make([]byte, udpingest.MaxDatagramSize))
+	assert.True(udpingest.IsDatagramTooLargeError(err))
+
+	var events []cells.Event
+	for i := 0; i < 100 && len(events) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		accessor, err := behaviors.RequestCollectedAccessor(env, "collector", time.Second)
+		assert.Nil(err)
+		events = nil
+		accessor.Do(func(index int, event cells.Event) error {
+			events = append(events, event)
+			return nil
+		})
+	}
+	assert.Length(events, 2)
+	assert.Equal(events[0].Topic(), "temperature")
+	assert.Equal(events[0].Payload().GetFloat64(cells.PayloadDefault, 0.0), 21.5)
+	assert.Equal(events[1].Topic(), "humidity")
+	assert.Equal(events[1].Payload().GetString("room", ""), "kitchen")
+}
+
+// EOF
@@ -0,0 +1,31 @@
+// Tideland Go Cells - Versioning
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package versioning lets producers and consumers of events evolve
+// independently. The payload of an event carries the schema version
+// of its topic, events without one have version 1. Upcasters convert
+// the payload values of one version of a topic into the next one and
+// are collected in a Registry.
+//
+//     r := versioning.NewRegistry()
+//     r.Register("order-placed", 1, func(pvs cells.PayloadValues) (cells.PayloadValues, error) {
+//         pvs["currency"] = "EUR"
+//         return pvs, nil
+//     })
+//
+// Subscribers declare the versions they want per topic. Events of
+// older versions are upcast before they are delivered to them.
+//
+//     versioning.Subscribe(env, r, "orders", "billing", map[string]int{
+//         "order-placed": 2,
+//     })
+//
+// Events which cannot be upcast, e.g. because they have a newer
+// version than wanted, are logged and not delivered.
+package versioning
+
+// EOF
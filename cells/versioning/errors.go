@@ -0,0 +1,64 @@
+// Tideland Go Cells - Versioning - Errors
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package versioning
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/golib/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrDuplicateUpcaster = iota + 1
+	ErrMissingUpcaster
+	ErrDowncast
+	ErrUpcast
+)
+
+var errorMessages = errors.Messages{
+	ErrDuplicateUpcaster: "upcaster of topic %q from version %d already registered",
+	ErrMissingUpcaster:   "no upcaster of topic %q from version %d",
+	ErrDowncast:          "cannot downcast topic %q from version %d to %d",
+	ErrUpcast:            "cannot upcast topic %q from version %d",
+}
+
+//--------------------
+// ERROR CHECKING
+//--------------------
+
+// IsDuplicateUpcasterError checks if an error signals an upcaster
+// registered twice.
+func IsDuplicateUpcasterError(err error) bool {
+	return errors.IsError(err, ErrDuplicateUpcaster)
+}
+
+// IsMissingUpcasterError checks if an error signals a gap in the
+// chain of upcasters.
+func IsMissingUpcasterError(err error) bool {
+	return errors.IsError(err, ErrMissingUpcaster)
+}
+
+// IsDowncastError checks if an error signals an event with a
+// newer version than wanted.
+func IsDowncastError(err error) bool {
+	return errors.IsError(err, ErrDowncast)
+}
+
+// IsUpcastError checks if an error signals a failing upcaster.
+func IsUpcastError(err error) bool {
+	return errors.IsError(err, ErrUpcast)
+}
+
+// EOF
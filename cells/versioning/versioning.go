@@ -0,0 +1,197 @@
+// Tideland Go Cells - Versioning
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package versioning
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+
+	"github.com/tideland/golib/errors"
+	"github.com/tideland/golib/logger"
+
+	"github.com/tideland/gocells/cells"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// PayloadVersion contains the schema version of an event.
+const PayloadVersion = "schema:version"
+
+//--------------------
+// VERSIONS
+//--------------------
+
+// VersionOf returns the schema version of the event. Events
+// without version have version 1.
+func VersionOf(event cells.Event) int {
+	if event.Payload() == nil {
+		return 1
+	}
+	return event.Payload().GetInt(PayloadVersion, 1)
+}
+
+// WithVersion returns the payload values marked with the
+// schema version, so producers can emit newer versions.
+func WithVersion(version int, pvs cells.PayloadValues) cells.PayloadValues {
+	versioned := make(cells.PayloadValues, len(pvs)+1)
+	for key, value := range pvs {
+		versioned[key] = value
+	}
+	versioned[PayloadVersion] = version
+	return versioned
+}
+
+//--------------------
+// REGISTRY
+//--------------------
+
+// Upcaster converts the payload values of one version of a topic
+// into those of the next version. The passed values are a copy, so
+// they can be changed and returned.
+type Upcaster func(pvs cells.PayloadValues) (cells.PayloadValues, error)
+
+// upcasterKey identifies the upcaster of a topic from a version.
+type upcasterKey struct {
+	topic string
+	from  int
+}
+
+// Registry contains the upcasters of all topics.
+type Registry struct {
+	mutex     sync.RWMutex
+	upcasters map[upcasterKey]Upcaster
+	latest    map[string]int
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		upcasters: make(map[upcasterKey]Upcaster),
+		latest:    make(map[string]int),
+	}
+}
+
+// Register adds the upcaster of the topic from the version to
+// the next one.
+func (r *Registry) Register(topic string, from int, upcaster Upcaster) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := upcasterKey{topic, from}
+	if _, ok := r.upcasters[key]; ok {
+		return errors.New(ErrDuplicateUpcaster, errorMessages, topic, from)
+	}
+	r.upcasters[key] = upcaster
+	if from+1 > r.latest[topic] {
+		r.latest[topic] = from + 1
+	}
+	return nil
+}
+
+// Latest returns the latest version of the topic an upcaster
+// has been registered for, 1 if there is none.
+func (r *Registry) Latest(topic string) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if latest, ok := r.latest[topic]; ok {
+		return latest
+	}
+	return 1
+}
+
+// Upcast returns the event with its payload upcast to the wanted
+// version. Events already having it are returned unchanged.
+func (r *Registry) Upcast(event cells.Event, version int) (cells.Event, error) {
+	current := VersionOf(event)
+	if current == version {
+		return event, nil
+	}
+	if current > version {
+		return nil, errors.New(ErrDowncast, errorMessages, event.Topic(), current, version)
+	}
+	pvs := cells.PayloadValues{}
+	if event.Payload() != nil {
+		event.Payload().Do(func(key string, value interface{}) error {
+			pvs[key] = value
+			return nil
+		})
+	}
+	chain, err := r.chain(event.Topic(), current, version)
+	if err != nil {
+		return nil, err
+	}
+	for i, upcaster := range chain {
+		upcast, err := upcaster(pvs)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrUpcast, errorMessages, event.Topic(), current+i)
+		}
+		pvs = upcast
+	}
+	pvs[PayloadVersion] = version
+	return &upcastEvent{event, cells.NewPayload(pvs)}, nil
+}
+
+// chain returns the upcasters of the topic between the versions.
+func (r *Registry) chain(topic string, from, to int) ([]Upcaster, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var chain []Upcaster
+	for version := from; version < to; version++ {
+		upcaster, ok := r.upcasters[upcasterKey{topic, version}]
+		if !ok {
+			return nil, errors.New(ErrMissingUpcaster, errorMessages, topic, version)
+		}
+		chain = append(chain, upcaster)
+	}
+	return chain, nil
+}
+
+// upcastEvent is an event with an upcast payload.
+type upcastEvent struct {
+	cells.Event
+	payload cells.Payload
+}
+
+// Payload implements the cells.Event interface.
+func (e *upcastEvent) Payload() cells.Payload {
+	return e.payload
+}
+
+//--------------------
+// SUBSCRIPTION
+//--------------------
+
+// Transform returns a transform upcasting the events of the topics
+// to the wanted versions. Events of other topics are passed
+// unchanged, those which cannot be upcast are logged and dropped.
+func (r *Registry) Transform(versions map[string]int) cells.Transform {
+	return func(event cells.Event) (cells.Event, bool) {
+		version, ok := versions[event.Topic()]
+		if !ok {
+			return event, true
+		}
+		upcast, err := r.Upcast(event, version)
+		if err != nil {
+			logger.Errorf("cannot deliver event %q: %v", event.Topic(), err)
+			return nil, false
+		}
+		return upcast, true
+	}
+}
+
+// Subscribe subscribes the subscriber to the emitter receiving
+// the events of the topics in the wanted versions.
+func Subscribe(env cells.Environment, r *Registry, emitterID, subscriberID string, versions map[string]int) error {
+	return env.SubscribeWith(emitterID, subscriberID, r.Transform(versions))
+}
+
+// EOF
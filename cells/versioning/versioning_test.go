@@ -0,0 +1,137 @@
+// Tideland Go Cells - Versioning - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package versioning_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/behaviors"
+	"github.com/tideland/gocells/cells"
+	"github.com/tideland/gocells/cells/versioning"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// TestUpcast tests the upcasting of single events.
+func TestUpcast(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	r := newRegistry(assert)
+	assert.Equal(r.Latest("order"), 3)
+	assert.Equal(r.Latest("unknown"), 1)
+
+	err := r.Register("order", 2, nil)
+	assert.True(versioning.IsDuplicateUpcasterError(err))
+
+	event, err := cells.NewEvent(context.Background(), "order", cells.PayloadValues{
+		"amount": 10,
+	})
+	assert.Nil(err)
+	assert.Equal(versioning.VersionOf(event), 1)
+
+	upcast, err := r.Upcast(event, 3)
+	assert.Nil(err)
+	assert.Equal(upcast.Topic(), "order")
+	assert.Equal(versioning.VersionOf(upcast), 3)
+	assert.Equal(upcast.Payload().GetString("currency", ""), "EUR")
+	assert.Equal(upcast.Payload().GetInt("cents", 0), 1000)
+	assert.Nil(upcast.Payload().Get("amount", nil))
+
+	_, err = r.Upcast(upcast, 2)
+	assert.True(versioning.IsDowncastError(err))
+	_, err = r.Upcast(upcast, 4)
+	assert.True(versioning.IsMissingUpcasterError(err))
+
+	event, err = cells.NewEvent(context.Background(), "order", versioning.WithVersion(2, cells.PayloadValues{
+		"amount":   "invalid",
+		"currency": "USD",
+	}))
+	assert.Nil(err)
+	_, err = r.Upcast(event, 3)
+	assert.True(versioning.IsUpcastError(err))
+}
+
+// TestSubscribe tests the transparent upcasting for subscribers.
+func TestSubscribe(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	ctx := context.Background()
+	r := newRegistry(assert)
+	env := cells.NewEnvironment("versioning")
+	defer env.Stop()
+
+	env.StartCell("producer", behaviors.NewBroadcasterBehavior())
+	env.StartCell("old", behaviors.NewCollectorBehavior(10))
+	env.StartCell("new", behaviors.NewCollectorBehavior(10))
+	env.Subscribe("producer", "old")
+	err := versioning.Subscribe(env, r, "producer", "new", map[string]int{
+		"order": 3,
+	})
+	assert.Nil(err)
+
+	env.EmitNew(ctx, "producer", "order", cells.PayloadValues{"amount": 5})
+	env.EmitNew(ctx, "producer", "order", versioning.WithVersion(3, cells.PayloadValues{"cents": 700}))
+	env.EmitNew(ctx, "producer", "other", nil)
+	assert.Nil(env.Barrier(ctx))
+
+	old, err := behaviors.RequestCollectedAccessor(env, "old", time.Second)
+	assert.Nil(err)
+	assert.Length(old, 3)
+	first, _ := old.PeekFirst()
+	assert.Equal(first.Payload().GetInt("amount", 0), 5)
+
+	upcast, err := behaviors.RequestCollectedAccessor(env, "new", time.Second)
+	assert.Nil(err)
+	assert.Length(upcast, 3)
+	var cents []int
+	upcast.Do(func(index int, event cells.Event) error {
+		if event.Topic() == "order" {
+			assert.Equal(versioning.VersionOf(event), 3)
+			cents = append(cents, event.Payload().GetInt("cents", 0))
+		}
+		return nil
+	})
+	assert.Equal(cents, []int{500, 700})
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// newRegistry creates a registry for orders. Version 2 adds
+// the currency, version 3 replaces the amount by cents.
+func newRegistry(assert audit.Assertion) *versioning.Registry {
+	r := versioning.NewRegistry()
+	err := r.Register("order", 1, func(pvs cells.PayloadValues) (cells.PayloadValues, error) {
+		pvs["currency"] = "EUR"
+		return pvs, nil
+	})
+	assert.Nil(err)
+	err = r.Register("order", 2, func(pvs cells.PayloadValues) (cells.PayloadValues, error) {
+		amount, ok := pvs["amount"].(int)
+		if !ok {
+			return nil, errors.New("invalid amount")
+		}
+		delete(pvs, "amount")
+		pvs["cents"] = amount * 100
+		return pvs, nil
+	})
+	assert.Nil(err)
+	return r
+}
+
+// EOF
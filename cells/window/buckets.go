@@ -0,0 +1,159 @@
+// Tideland Go Cells - Window - Buckets
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package window
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math"
+	"time"
+)
+
+//--------------------
+// BUCKETS
+//--------------------
+
+// Bucket aggregates the values added during its time range.
+type Bucket struct {
+	Start time.Time
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// add adds a value to the bucket.
+func (b *Bucket) add(value float64) {
+	if b.Count == 0 {
+		b.Min, b.Max = value, value
+	} else {
+		b.Min = math.Min(b.Min, value)
+		b.Max = math.Max(b.Max, value)
+	}
+	b.Count++
+	b.Sum += value
+}
+
+// Buckets is a sliding window aggregating values in a ring of fixed
+// time buckets. So its memory usage only depends on the number of
+// buckets and not on the number of values, e.g. a day in 1440 minute
+// buckets. Adding a value newer than the current bucket advances the
+// window and evicts the oldest buckets.
+type Buckets struct {
+	width  time.Duration
+	ring   []Bucket
+	newest int
+	empty  bool
+}
+
+// NewBuckets creates a window of n buckets of the given width.
+func NewBuckets(width time.Duration, n int) *Buckets {
+	if n < 1 {
+		n = 1
+	}
+	return &Buckets{
+		width: width,
+		ring:  make([]Bucket, n),
+		empty: true,
+	}
+}
+
+// Add adds a value at a time. Values older than the window
+// are dropped, here false is returned.
+func (bs *Buckets) Add(t time.Time, value float64) bool {
+	start := t.Truncate(bs.width)
+	if bs.empty {
+		bs.empty = false
+		bs.ring[bs.newest] = Bucket{Start: start}
+	} else {
+		bs.Advance(t)
+	}
+	newest := bs.ring[bs.newest].Start
+	if start.After(newest) {
+		return false
+	}
+	offset := int(newest.Sub(start) / bs.width)
+	if offset >= len(bs.ring) {
+		return false
+	}
+	i := (bs.newest - offset + len(bs.ring)) % len(bs.ring)
+	if !bs.ring[i].Start.Equal(start) {
+		bs.ring[i] = Bucket{Start: start}
+	}
+	bs.ring[i].add(value)
+	return true
+}
+
+// Advance moves the window to the passed time and evicts the
+// buckets falling out of it.
+func (bs *Buckets) Advance(t time.Time) {
+	if bs.empty {
+		return
+	}
+	start := t.Truncate(bs.width)
+	newest := bs.ring[bs.newest].Start
+	if !start.After(newest) {
+		return
+	}
+	steps := int(start.Sub(newest) / bs.width)
+	if steps > len(bs.ring) {
+		steps = len(bs.ring)
+		newest = start.Add(-time.Duration(steps) * bs.width)
+	}
+	for i := 1; i <= steps; i++ {
+		bs.newest = (bs.newest + 1) % len(bs.ring)
+		bs.ring[bs.newest] = Bucket{Start: newest.Add(time.Duration(i) * bs.width)}
+	}
+}
+
+// Do calls the function for all buckets containing values from
+// the oldest to the newest one.
+func (bs *Buckets) Do(f func(b Bucket)) {
+	if bs.empty {
+		return
+	}
+	for i := 1; i <= len(bs.ring); i++ {
+		b := bs.ring[(bs.newest+i)%len(bs.ring)]
+		if b.Count > 0 {
+			f(b)
+		}
+	}
+}
+
+// Stats returns count, sum, minimum, maximum, and average of all
+// values in the window. The variance isn't available.
+func (bs *Buckets) Stats() Stats {
+	stats := Stats{}
+	bs.Do(func(b Bucket) {
+		if stats.Count == 0 {
+			stats.Min, stats.Max = b.Min, b.Max
+		} else {
+			stats.Min = math.Min(stats.Min, b.Min)
+			stats.Max = math.Max(stats.Max, b.Max)
+		}
+		stats.Count += b.Count
+		stats.Sum += b.Sum
+	})
+	if stats.Count > 0 {
+		stats.Average = stats.Sum / float64(stats.Count)
+	}
+	return stats
+}
+
+// Reset removes all values from the window.
+func (bs *Buckets) Reset() {
+	for i := range bs.ring {
+		bs.ring[i] = Bucket{}
+	}
+	bs.newest = 0
+	bs.empty = true
+}
+
+// EOF
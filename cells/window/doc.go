@@ -0,0 +1,22 @@
+// Tideland Go Cells - Window
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// Package window provides sliding windows of values over time for
+// behaviors. A Window keeps the individual samples of a span or of
+// a maximum number in a ring, Buckets aggregate long spans in a ring
+// of fixed time buckets. Both allocate their memory once, so also
+// long windows don't cause pressure on the garbage collector.
+//
+//     w := window.New(time.Minute, 1000)
+//     w.Push(eventTime, value)
+//     stats := w.Stats()
+//
+// Windows are not synchronized, they are intended to be used inside
+// of the ProcessEvent() method of one behavior.
+package window
+
+// EOF
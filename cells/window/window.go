@@ -0,0 +1,219 @@
+// Tideland Go Cells - Window
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package window
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math"
+	"time"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// initialSize is the initial size of the ring of a window
+// without maximum length.
+const initialSize = 16
+
+//--------------------
+// STATS
+//--------------------
+
+// Stats contains the statistics of the values in a window.
+type Stats struct {
+	Count    int
+	Sum      float64
+	Min      float64
+	Max      float64
+	Average  float64
+	Variance float64
+}
+
+//--------------------
+// WINDOW
+//--------------------
+
+// Sample is one value of a window at a time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Window is a sliding window of samples stored in a ring. Samples
+// older than the span relative to the newest one are evicted, as
+// well as the oldest ones when the maximum length is reached. A
+// zero span or maximum length disables the according eviction. The
+// ring grows on demand but never shrinks, so a running window
+// doesn't allocate anymore.
+type Window struct {
+	span   time.Duration
+	maxLen int
+	ring   []Sample
+	head   int
+	n      int
+}
+
+// New creates a window for the given span and maximum length.
+func New(span time.Duration, maxLen int) *Window {
+	size := initialSize
+	if maxLen > 0 {
+		size = maxLen
+	}
+	return &Window{
+		span:   span,
+		maxLen: maxLen,
+		ring:   make([]Sample, size),
+	}
+}
+
+// Push adds a value at a time to the window and evicts the samples
+// out of its span or beyond its maximum length.
+func (w *Window) Push(t time.Time, value float64) {
+	if w.maxLen > 0 && w.n == w.maxLen {
+		w.head = (w.head + 1) % len(w.ring)
+		w.n--
+	}
+	if w.n == len(w.ring) {
+		w.grow()
+	}
+	w.ring[(w.head+w.n)%len(w.ring)] = Sample{t, value}
+	w.n++
+	if w.span > 0 {
+		w.EvictBefore(t.Add(-w.span))
+	}
+}
+
+// Insert adds a value at a time to the window keeping the samples
+// ordered by time, e.g. for late values. Samples out of the span of
+// the newest one or beyond the maximum length are evicted, this may
+// be the inserted one itself.
+func (w *Window) Insert(t time.Time, value float64) {
+	if last, ok := w.Last(); !ok || !t.Before(last.Time) {
+		w.Push(t, value)
+		return
+	}
+	if w.maxLen > 0 && w.n == w.maxLen {
+		if t.Before(w.ring[w.head].Time) {
+			// Would be the oldest one and evicted.
+			return
+		}
+		w.ring[w.head] = Sample{}
+		w.head = (w.head + 1) % len(w.ring)
+		w.n--
+	}
+	if w.n == len(w.ring) {
+		w.grow()
+	}
+	// Shift newer samples to free the position.
+	i := w.n
+	for i > 0 && t.Before(w.At(i-1).Time) {
+		w.ring[(w.head+i)%len(w.ring)] = w.At(i - 1)
+		i--
+	}
+	w.ring[(w.head+i)%len(w.ring)] = Sample{t, value}
+	w.n++
+	if w.span > 0 {
+		last, _ := w.Last()
+		w.EvictBefore(last.Time.Add(-w.span))
+	}
+}
+
+// EvictBefore removes all samples older than the passed time.
+func (w *Window) EvictBefore(t time.Time) {
+	for w.n > 0 && w.ring[w.head].Time.Before(t) {
+		w.ring[w.head] = Sample{}
+		w.head = (w.head + 1) % len(w.ring)
+		w.n--
+	}
+}
+
+// Len returns the number of samples in the window.
+func (w *Window) Len() int {
+	return w.n
+}
+
+// At returns the sample at the index, 0 is the oldest one. The
+// index has to be less than Len().
+func (w *Window) At(i int) Sample {
+	return w.ring[(w.head+i)%len(w.ring)]
+}
+
+// First returns the oldest sample, false if the window is empty.
+func (w *Window) First() (Sample, bool) {
+	if w.n == 0 {
+		return Sample{}, false
+	}
+	return w.At(0), true
+}
+
+// Last returns the newest sample, false if the window is empty.
+func (w *Window) Last() (Sample, bool) {
+	if w.n == 0 {
+		return Sample{}, false
+	}
+	return w.At(w.n - 1), true
+}
+
+// Do calls the function for all samples from the oldest to
+// the newest one.
+func (w *Window) Do(f func(s Sample)) {
+	for i := 0; i < w.n; i++ {
+		f(w.At(i))
+	}
+}
+
+// Stats returns the statistics of the values in the window.
+func (w *Window) Stats() Stats {
+	stats := Stats{
+		Count: w.n,
+		Min:   math.Inf(1),
+		Max:   math.Inf(-1),
+	}
+	if w.n == 0 {
+		stats.Min, stats.Max = 0, 0
+		return stats
+	}
+	for i := 0; i < w.n; i++ {
+		v := w.At(i).Value
+		stats.Sum += v
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+	}
+	stats.Average = stats.Sum / float64(w.n)
+	for i := 0; i < w.n; i++ {
+		d := w.At(i).Value - stats.Average
+		stats.Variance += d * d
+	}
+	stats.Variance /= float64(w.n)
+	return stats
+}
+
+// Reset removes all samples from the window.
+func (w *Window) Reset() {
+	for i := range w.ring {
+		w.ring[i] = Sample{}
+	}
+	w.head = 0
+	w.n = 0
+}
+
+// grow doubles the size of the ring.
+func (w *Window) grow() {
+	ring := make([]Sample, 2*len(w.ring))
+	for i := 0; i < w.n; i++ {
+		ring[i] = w.At(i)
+	}
+	w.ring = ring
+	w.head = 0
+}
+
+// EOF
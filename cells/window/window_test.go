@@ -0,0 +1,181 @@
+// Tideland Go Cells - Window - Unit Tests
+//
+// Copyright (C) 2010-2017 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package window_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tideland/golib/audit"
+
+	"github.com/tideland/gocells/cells/window"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// start is the start time of the tests.
+var start = time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// TestWindowSpan tests the eviction of samples by time.
+func TestWindowSpan(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	w := window.New(10*time.Second, 0)
+
+	for i := 0; i < 50; i++ {
+		w.Push(start.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	assert.Equal(w.Len(), 11)
+	first, ok := w.First()
+	assert.True(ok)
+	assert.Equal(first.Value, 39.0)
+	last, ok := w.Last()
+	assert.True(ok)
+	assert.Equal(last.Value, 49.0)
+
+	w.EvictBefore(start.Add(45 * time.Second))
+	assert.Equal(w.Len(), 5)
+	values := []float64{}
+	w.Do(func(s window.Sample) {
+		values = append(values, s.Value)
+	})
+	assert.Equal(values, []float64{45, 46, 47, 48, 49})
+
+	w.Reset()
+	assert.Equal(w.Len(), 0)
+	_, ok = w.First()
+	assert.False(ok)
+}
+
+// TestWindowMaxLen tests the eviction of samples by length
+// and the statistics.
+func TestWindowMaxLen(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	w := window.New(0, 3)
+
+	for i, v := range []float64{10, 2, 4, 6, 8} {
+		w.Push(start.Add(time.Duration(i)*time.Second), v)
+	}
+	assert.Equal(w.Len(), 3)
+	stats := w.Stats()
+	assert.Equal(stats.Count, 3)
+	assert.Equal(stats.Sum, 18.0)
+	assert.Equal(stats.Min, 4.0)
+	assert.Equal(stats.Max, 8.0)
+	assert.Equal(stats.Average, 6.0)
+	assert.About(stats.Variance, 8.0/3.0, 0.0001)
+}
+
+// TestWindowInsert tests the ordered insertion of late samples.
+func TestWindowInsert(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	at := func(s int) time.Time {
+		return start.Add(time.Duration(s) * time.Second)
+	}
+	times := func(w *window.Window) []int {
+		var ts []int
+		w.Do(func(s window.Sample) {
+			ts = append(ts, int(s.Time.Sub(start)/time.Second))
+		})
+		return ts
+	}
+	w := window.New(0, 4)
+	for _, s := range []int{1, 5, 3, 4, 2, 0} {
+		w.Insert(at(s), float64(s))
+	}
+	assert.Equal(times(w), []int{2, 3, 4, 5})
+
+	w = window.New(10*time.Second, 0)
+	for _, s := range []int{10, 20, 15, 5, 25} {
+		w.Insert(at(s), float64(s))
+	}
+	assert.Equal(times(w), []int{15, 20, 25})
+}
+
+// TestBuckets tests the aggregation in time buckets.
+func TestBuckets(t *testing.T) {
+	assert := audit.NewTestingAssertion(t, true)
+	bs := window.NewBuckets(time.Minute, 3)
+
+	assert.True(bs.Add(start, 1))
+	assert.True(bs.Add(start.Add(30*time.Second), 2))
+	assert.True(bs.Add(start.Add(90*time.Second), 3))
+	assert.True(bs.Add(start.Add(150*time.Second), 4))
+	counts := []int{}
+	bs.Do(func(b window.Bucket) {
+		counts = append(counts, b.Count)
+	})
+	assert.Equal(counts, []int{2, 1, 1})
+
+	// Late value inside and outside of the window.
+	assert.True(bs.Add(start.Add(100*time.Second), 5))
+	assert.False(bs.Add(start.Add(-time.Minute), 6))
+
+	// Advance evicts the oldest buckets.
+	bs.Advance(start.Add(200 * time.Second))
+	stats := bs.Stats()
+	assert.Equal(stats.Count, 3)
+	assert.Equal(stats.Sum, 12.0)
+	assert.Equal(stats.Min, 3.0)
+	assert.Equal(stats.Max, 5.0)
+	assert.Equal(stats.Average, 4.0)
+
+	bs.Advance(start.Add(time.Hour))
+	assert.Equal(bs.Stats().Count, 0)
+	bs.Reset()
+	assert.True(bs.Add(start, 1))
+	assert.Equal(bs.Stats().Count, 1)
+}
+
+//--------------------
+// BENCHMARKS
+//--------------------
+
+// longWindow is the number of samples of a long window.
+const longWindow = 10000
+
+// BenchmarkSliceWindow benchmarks an ad-hoc window with a slice.
+func BenchmarkSliceWindow(b *testing.B) {
+	b.ReportAllocs()
+	type sample struct {
+		t time.Time
+		v float64
+	}
+	samples := []sample{}
+	for i := 0; i < b.N; i++ {
+		samples = append(samples, sample{start.Add(time.Duration(i)), float64(i)})
+		if len(samples) > longWindow {
+			samples = samples[1:]
+		}
+	}
+}
+
+// BenchmarkWindow benchmarks the window with a long span.
+func BenchmarkWindow(b *testing.B) {
+	w := window.New(longWindow, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.Push(start.Add(time.Duration(i)), float64(i))
+	}
+}
+
+// BenchmarkBuckets benchmarks the buckets with a long span.
+func BenchmarkBuckets(b *testing.B) {
+	bs := window.NewBuckets(time.Duration(longWindow/100), 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bs.Add(start.Add(time.Duration(i)), float64(i))
+	}
+}
+
+// EOF